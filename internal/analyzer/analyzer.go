@@ -1,22 +1,32 @@
 // Package analyzer orchestrates AI code analysis via the OpenCode Server HTTP API.
 //
-// When a webhook triggers analysis, the Analyzer matches trigger keywords,
-// creates a task record, calls the OpenCode Server to perform analysis,
-// and routes the result back to the originating channel via the provider's SendReply.
+// When a webhook triggers analysis, the Analyzer enqueues a task record. Once a
+// worker claims it, the Analyzer runs it on the OpenCode Server and routes the
+// result back to the originating channel through the provider.
 package analyzer
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/opencode-ai/opencode-dog/internal/db"
 	"github.com/opencode-ai/opencode-dog/internal/provider"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
+)
+
+var (
+	ErrTaskNotFound = errors.New("task not found")
+	ErrTaskFinished = errors.New("task already finished")
+	ErrTaskActive   = errors.New("task is still pending or processing")
 )
 
 type Analyzer struct {
@@ -25,9 +35,23 @@ type Analyzer struct {
 	logger         *slog.Logger
 	configDir      string
 	opencodeClient *OpencodeClient
+	// workspaces, if set, provides the project checkout each task runs in.
+	workspaces *workspace.Manager
+
+	// notify, if set, wakes the worker pool after a task is queued.
+	notify func()
+
+	// running holds the cancel func of every task processing in this process,
+	// so a cancellation can stop it immediately instead of waiting for the
+	// worker's next heartbeat.
+	mu      sync.Mutex
+	running map[string]context.CancelFunc
+
+	// outboxWake wakes the outbox dispatcher when a reply is resent.
+	outboxWake chan struct{}
 }
 
-func New(database db.Store, registry *provider.Registry, logger *slog.Logger, configDir string) *Analyzer {
+func New(database db.Store, registry *provider.Registry, logger *slog.Logger, configDir string, workspaces *workspace.Manager) *Analyzer {
 	ctx := context.Background()
 	serverURL := database.GetSettingString(ctx, "opencode_server_url", "http://opencode-server:4096")
 	authUser := database.GetSettingString(ctx, "opencode_server_auth_user", "opencode")
@@ -42,29 +66,77 @@ func New(database db.Store, registry *provider.Registry, logger *slog.Logger, co
 		logger:         logger,
 		configDir:      configDir,
 		opencodeClient: client,
+		workspaces:     workspaces,
+		outboxWake:     make(chan struct{}, 1),
 	}
 }
 
-func (a *Analyzer) HandleMessage(ctx context.Context, msg *provider.IncomingMessage) {
-	pcfg, err := a.database.GetProviderConfig(ctx, msg.ProviderCfgID)
-	if err != nil {
-		a.logger.Error("provider config not found", "id", msg.ProviderCfgID, "error", err)
-		return
-	}
+// SetQueueNotifier registers fn to be called whenever a task is queued, so a
+// worker can pick it up without waiting for its next poll.
+func (a *Analyzer) SetQueueNotifier(fn func()) {
+	a.notify = fn
+}
 
-	keywords, err := a.database.GetTriggerKeywords(ctx, msg.ProjectID)
-	if err != nil {
-		a.logger.Error("get keywords failed", "error", err)
-		return
+func (a *Analyzer) notifyQueued() {
+	if a.notify != nil {
+		a.notify()
 	}
+}
 
-	matchedKeyword, matchedMode := matchKeyword(msg.Body, keywords)
-	if matchedKeyword == "" {
-		return
+// HandleMessage enqueues a pending task for msg if it triggers analysis, and
+// returns it, or nil if it does not. ProcessTask runs the task once a worker
+// claims it.
+func (a *Analyzer) HandleMessage(ctx context.Context, msg *provider.IncomingMessage) *db.Task {
+	task, outcome := a.handleMessage(ctx, msg)
+	a.recordWebhookOutcome(ctx, outcome, task)
+	return task
+}
+
+// handleMessage is HandleMessage, also returning the outcome of msg as one
+// of the db.Webhook* outcomes. A message triggers analysis with a trigger
+// keyword, with a mode its provider already chose (an issue label rule), or
+// as a failed CI job acceptFailedJob accepts. A redelivery of an event that
+// already queued a task is skipped before a failed job's cooldown is claimed.
+func (a *Analyzer) handleMessage(ctx context.Context, msg *provider.IncomingMessage) (*db.Task, string) {
+	var cooldown time.Duration
+	switch {
+	case msg.FailedJob != nil:
+		var ok bool
+		if cooldown, ok = a.acceptFailedJob(ctx, msg); !ok {
+			return nil, db.WebhookIgnored
+		}
+		msg.TriggerMode = provider.ModePipeline
+	case msg.TriggerMode != "":
+	default:
+		keywords, err := a.database.GetTriggerKeywords(ctx, msg.ProjectID)
+		if err != nil {
+			a.logger.Error("get keywords failed", "error", err)
+			return nil, db.WebhookFailed
+		}
+
+		matchedKeyword, matchedMode := matchKeyword(msg.Body, keywords)
+		if matchedKeyword == "" {
+			return nil, db.WebhookNoKeyword
+		}
+
+		msg.TriggerKeyword = matchedKeyword
+		msg.TriggerMode = matchedMode
+		if opts, _ := parseOptions(msg.Body); opts.Ref != "" {
+			msg.Ref = opts.Ref
+		}
 	}
 
-	msg.TriggerKeyword = matchedKeyword
-	msg.TriggerMode = matchedMode
+	if !a.firstDelivery(ctx, msg) {
+		return nil, db.WebhookDuplicate
+	}
+	if msg.FailedJob != nil && !a.claimFailedJob(ctx, msg, cooldown) {
+		return nil, db.WebhookIgnored
+	}
+	if msg.TriggerKeyword != "" && isRetryCommand(msg.Body, msg.TriggerKeyword) {
+		if task, outcome, ok := a.retryThread(ctx, msg); ok {
+			return task, outcome
+		}
+	}
 
 	task := &db.Task{
 		ProjectID:        ptrStr(msg.ProjectID),
@@ -76,59 +148,463 @@ func (a *Analyzer) HandleMessage(ctx context.Context, msg *provider.IncomingMess
 		Title:            msg.Title,
 		MessageBody:      msg.Body,
 		Author:           msg.Author,
+		ReplyMeta:        db.ToJSON(msg.ReplyMeta),
+		ThreadKey:        a.threadKey(ctx, msg),
+		Ref:              msg.Ref,
 	}
 
 	if err := a.database.CreateTask(ctx, task); err != nil {
 		a.logger.Error("create task failed", "error", err)
-		return
+		a.forgetDelivery(ctx, msg)
+		a.releaseFailedJob(ctx, msg)
+		return nil, db.WebhookFailed
 	}
+	a.recordMessage(ctx, task, db.MessageInbound, db.MessageKindTrigger, &msg.Source)
 
-	a.logger.Info("task created",
+	a.logger.Info("task queued",
 		"id", task.ID,
 		"provider", msg.Provider,
-		"mode", matchedMode,
-		"keyword", matchedKeyword,
+		"mode", msg.TriggerMode,
+		"keyword", msg.TriggerKeyword,
+		"ref", msg.Ref,
 		"author", msg.Author,
 	)
+	a.notifyQueued()
+	return task, db.WebhookTaskCreated
+}
+
+// RetryTask queues a new task that re-runs a finished one: same message body,
+// trigger mode and reply metadata, linked back through parent_task_id. The
+// reply goes to the same channel or thread as the original.
+func (a *Analyzer) RetryTask(ctx context.Context, taskID, by string) (*db.Task, error) {
+	orig, err := a.database.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, ErrTaskNotFound
+	}
+	if isActive(orig.Status) {
+		return nil, ErrTaskActive
+	}
+
+	task := &db.Task{
+		ParentTaskID:     &orig.ID,
+		ProjectID:        orig.ProjectID,
+		ProviderConfigID: orig.ProviderConfigID,
+		ProviderType:     orig.ProviderType,
+		TriggerMode:      orig.TriggerMode,
+		TriggerKeyword:   orig.TriggerKeyword,
+		ExternalRef:      orig.ExternalRef,
+		ThreadKey:        orig.ThreadKey,
+		Ref:              orig.Ref,
+		Title:            orig.Title,
+		MessageBody:      orig.MessageBody,
+		Author:           orig.Author,
+		ReplyMeta:        orig.ReplyMeta,
+	}
+	if err := a.database.CreateTask(ctx, task); err != nil {
+		return nil, fmt.Errorf("create task: %w", err)
+	}
+
+	a.logger.Info("task retry queued", "id", task.ID, "parent", orig.ID, "by", by)
+	a.notifyQueued()
+	return task, nil
+}
+
+// retryThread answers a retry command (see isRetryCommand) by re-running the
+// latest task of the thread msg was posted in. ok is false if the thread has
+// no task, in which case the message is handled as an ordinary request.
+func (a *Analyzer) retryThread(ctx context.Context, msg *provider.IncomingMessage) (task *db.Task, outcome string, ok bool) {
+	thread := a.threadKey(ctx, msg)
+	if thread == "" || msg.ProviderCfgID == "" {
+		return nil, "", false
+	}
+	last, err := a.database.GetLatestThreadTask(ctx, msg.ProviderCfgID, thread)
+	if err != nil {
+		return nil, "", false
+	}
+	task, err = a.RetryTask(ctx, last.ID, msg.Author)
+	if errors.Is(err, ErrTaskActive) {
+		a.logger.Info("retry skipped, task still running", "task_id", last.ID, "thread", thread)
+		return nil, db.WebhookIgnored, true
+	}
+	if err != nil {
+		a.logger.Error("retry thread task failed", "task_id", last.ID, "error", err)
+		a.forgetDelivery(ctx, msg)
+		return nil, db.WebhookFailed, true
+	}
+	a.recordMessage(ctx, task, db.MessageInbound, db.MessageKindTrigger, &msg.Source)
+	return task, db.WebhookTaskCreated, true
+}
+
+// ProcessTask runs the analysis for a task already claimed by a worker and
+// routes the acknowledgement, result or error back through the provider.
+func (a *Analyzer) ProcessTask(ctx context.Context, task *db.Task) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.trackRunning(task.ID, cancel)
+	defer a.untrackRunning(task.ID)
+
+	msg := messageFromTask(task)
+
+	pcfg, err := a.database.GetProviderConfig(ctx, msg.ProviderCfgID)
+	if err != nil {
+		a.logger.Error("provider config not found", "task_id", task.ID, "id", msg.ProviderCfgID, "error", err)
+		errMsg := "provider config not found"
+		a.finishTask(ctx, task, db.TaskStatusFailed, nil, &errMsg)
+		return
+	}
 
 	p, ok := a.registry.Get(msg.Provider)
 	if !ok {
 		a.logger.Error("provider not registered", "type", msg.Provider)
+		errMsg := fmt.Sprintf("provider not registered: %s", msg.Provider)
+		a.finishTask(ctx, task, db.TaskStatusFailed, nil, &errMsg)
 		return
 	}
 	cfgMap := pcfg.ConfigMap()
 
-	tpl := a.database.GetSettingString(ctx, "analyzer_ack_template",
-		"🔍 **OpenCode** received your request (%s mode).\n> Keyword: `%s` | Author: %s\n\n_Analyzing..._")
-	ackBody := fmt.Sprintf(tpl, matchedMode, matchedKeyword, msg.Author)
-	if err := p.SendReply(ctx, cfgMap, msg, ackBody); err != nil {
-		a.logger.Error("send ack failed", "error", err)
+	var ackBody string
+	if msg.TriggerMode == provider.ModePipeline {
+		tpl := a.database.GetSettingString(ctx, "analyzer_pipeline_ack_template",
+			"🔍 **OpenCode** is analyzing a failed CI job.\n> %s\n\n_Analyzing..._")
+		ackBody = formatTemplate(tpl, msg.Body)
+	} else {
+		tpl := a.database.GetSettingString(ctx, "analyzer_ack_template",
+			"🔍 **OpenCode** received your request (%s mode).\n> Keyword: `%s` | Author: %s\n\n_Analyzing..._")
+		ackBody = fmt.Sprintf(tpl, msg.TriggerMode, msg.TriggerKeyword, msg.Author)
+	}
+	// An attempt recovered after its worker stopped reuses the
+	// acknowledgement the earlier attempt posted.
+	ack := a.ackRef(ctx, task.ID)
+	if ack == nil {
+		ack, err = a.reply(ctx, p, cfgMap, task, msg, db.MessageKindAck, ackBody)
+		if err != nil {
+			a.logger.Error("send ack failed", "error", err)
+		}
 	}
 
-	_ = a.database.UpdateTaskStatus(ctx, task.ID, db.TaskStatusProcessing, nil, nil)
-
-	result, err := a.analyze(ctx, msg, matchedMode)
+	progress := a.newProgressReporter(ctx, p, cfgMap, task, msg, ack, ackBody)
+	result, err := a.analyze(ctx, task, msg, msg.TriggerMode, progress.handle)
+	if ctx.Err() != nil {
+		// Cancelled by a user (who has already been answered) or by shutdown
+		// (recovery will re-queue the task); either way, nothing to report.
+		a.logger.Info("task stopped before completion", "task_id", task.ID)
+		return
+	}
 	if err != nil {
 		a.logger.Error("analysis failed", "task_id", task.ID, "error", err)
 		errMsg := err.Error()
-		_ = a.database.UpdateTaskStatus(ctx, task.ID, db.TaskStatusFailed, nil, &errMsg)
+		if !a.finishTask(ctx, task, db.TaskStatusFailed, nil, &errMsg) {
+			return
+		}
 		tpl := a.database.GetSettingString(ctx, "analyzer_error_template",
 			"⚠️ **OpenCode** error:\n```\n%s\n```")
 		errReply := fmt.Sprintf(tpl, err.Error())
-		_ = p.SendReply(ctx, cfgMap, msg, errReply)
+		_ = a.finalReply(ctx, p, cfgMap, task, msg, db.MessageKindError, errReply)
 		return
 	}
 
-	_ = a.database.UpdateTaskStatus(ctx, task.ID, db.TaskStatusCompleted, &result, nil)
+	if !a.finishTask(ctx, task, db.TaskStatusCompleted, &result, nil) {
+		return
+	}
 
 	resultTpl := a.database.GetSettingString(ctx, "analyzer_result_template",
-		"## 🤖 OpenCode Analysis\n\n%s\n\n---\n_%s mode | triggered by %s_")
-	replyBody := fmt.Sprintf(resultTpl, result, matchedMode, msg.Author)
-	if err := p.SendReply(ctx, cfgMap, msg, replyBody); err != nil {
+		"## 🤖 OpenCode Analysis\n\n%s\n\n---\n_%s mode | triggered by %s%s_")
+	refNote := ""
+	if task.Ref != "" {
+		refNote = fmt.Sprintf(" | ref `%s`", task.Ref)
+	}
+	replyBody := formatTemplate(resultTpl, result, msg.TriggerMode, msg.Author, refNote)
+	if err := a.finalReply(ctx, p, cfgMap, task, msg, db.MessageKindResult, replyBody); err != nil {
 		a.logger.Error("send result failed", "error", err)
 	}
 }
 
+// finishTask records the final status of the attempt of task a worker
+// claimed, and reports whether the outcome should be posted: not if the task
+// was cancelled or, its lease having expired, claimed again meanwhile. If the
+// status cannot be recorded, the outcome is posted anyway.
+func (a *Analyzer) finishTask(ctx context.Context, task *db.Task, status db.TaskStatus, result, errMsg *string) bool {
+	held, err := a.database.UpdateTaskStatus(ctx, task.ID, task.Attempts, status, result, errMsg)
+	if err != nil {
+		a.logger.Error("update task status failed", "task_id", task.ID, "status", status, "error", err)
+		return true
+	}
+	if !held {
+		a.logger.Warn("task no longer held by this attempt, dropping its outcome", "task_id", task.ID, "attempt", task.Attempts)
+	}
+	return held
+}
+
+// formatTemplate fills tpl with as many of args as it has %s verbs, so a
+// template customized before a placeholder was added keeps working.
+func formatTemplate(tpl string, args ...any) string {
+	if n := strings.Count(tpl, "%s"); n < len(args) {
+		args = args[:n]
+	}
+	return fmt.Sprintf(tpl, args...)
+}
+
+// reply posts body through the provider and records the posted message
+// against the task.
+func (a *Analyzer) reply(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, kind, body string) (*provider.MessageRef, error) {
+	ref, err := p.SendReply(ctx, cfg, msg, body)
+	if err != nil {
+		return nil, err
+	}
+	a.recordMessage(ctx, task, db.MessageOutbound, kind, ref)
+	return ref, nil
+}
+
+// finalReply delivers the closing message of a task (result, error or notice)
+// through the reply outbox: it is queued, then delivered at once by
+// deliverReply. If that fails, the outbox dispatcher retries it later (see
+// RunOutboxDispatcher), so finalReply only returns an error once the reply
+// has been given up on.
+func (a *Analyzer) finalReply(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, kind, body string) error {
+	r := &db.OutboxReply{TaskID: task.ID, Kind: kind, Body: body}
+	if err := a.database.CreateOutboxReply(ctx, r, outboxLease); err != nil {
+		a.logger.Warn("queue reply failed, sending it directly", "task_id", task.ID, "error", err)
+		r.ID = ""
+		return a.deliverReply(ctx, p, cfg, task, msg, r)
+	}
+	return a.settleReply(ctx, task, r, a.deliverReply(ctx, p, cfg, task, msg, r))
+}
+
+// deliverReply posts an outbox reply. When analyzer_replace_ack is enabled
+// and the provider can edit replies, the first part overwrites the task's
+// "Analyzing..." acknowledgement; otherwise, or if the edit fails, it is
+// posted as a new reply. A body too long for one message is split (see
+// splitReply) and the remaining parts are posted as further replies. Parts
+// already sent by an earlier attempt are skipped.
+func (a *Analyzer) deliverReply(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, r *db.OutboxReply) error {
+	parts, err := a.splitReply(ctx, p, cfg, task, msg, r)
+	if err != nil {
+		return err
+	}
+	for i := r.PartsSent; i < len(parts); i++ {
+		if err := a.replyPart(ctx, p, cfg, task, msg, r.Kind, i, parts[i]); err != nil {
+			return err
+		}
+		r.PartsSent = i + 1
+		a.saveReplyProgress(ctx, r)
+	}
+	return nil
+}
+
+// replyPart sends part i of a closing reply, editing it into the
+// acknowledgement if it is the first.
+func (a *Analyzer) replyPart(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, kind string, i int, part string) error {
+	editor, ok := p.(provider.ReplyEditor)
+	if i == 0 && ok && a.database.GetSettingBool(ctx, "analyzer_replace_ack", true) {
+		if ack := a.ackRef(ctx, task.ID); ack != nil {
+			err := editor.EditReply(ctx, cfg, msg, *ack, part)
+			if err == nil {
+				a.recordMessage(ctx, task, db.MessageOutbound, kind, ack)
+				return nil
+			}
+			a.logger.Warn("edit ack failed, posting a new reply", "task_id", task.ID, "error", err)
+		}
+	}
+	_, err := a.reply(ctx, p, cfg, task, msg, kind, part)
+	return err
+}
+
+// replyFileName names the file a reply too long to post in parts is uploaded
+// as.
+const replyFileName = "opencode-result.md"
+
+// splitReply splits the body of r into parts that fit the provider's message
+// limit. Past reply_max_parts parts it uploads the body as a file instead, if
+// the provider can, and returns only the beginning of it pointing to the
+// file. An upload is only tried before any part has been sent, and only
+// once; a rate limited upload fails the attempt so it is retried later.
+func (a *Analyzer) splitReply(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, r *db.OutboxReply) ([]string, error) {
+	limiter, ok := p.(provider.MessageLimiter)
+	if !ok {
+		return []string{r.Body}, nil
+	}
+	limit := limiter.MaxMessageLength()
+	if !r.Uploaded {
+		parts := provider.SplitMessage(r.Body, limit)
+		uploader, ok := p.(provider.FileUploader)
+		maxParts := a.database.GetSettingInt(ctx, "reply_max_parts", 3)
+		if !ok || maxParts <= 0 || len(parts) <= maxParts || r.PartsSent > 0 {
+			return parts, nil
+		}
+
+		ref, err := uploader.UploadReply(ctx, cfg, msg, replyFileName, []byte(r.Body), "📎 "+replyFileName)
+		if err != nil {
+			if provider.RetryAfter(err) > 0 {
+				return nil, err
+			}
+			a.logger.Warn("upload reply failed, posting it in parts", "task_id", task.ID, "error", err)
+			return parts, nil
+		}
+		r.Uploaded = true
+		a.saveReplyProgress(ctx, r)
+		a.recordMessage(ctx, task, db.MessageOutbound, r.Kind, ref)
+		a.logEvent(ctx, task, "reply", fmt.Sprintf("uploaded as %s (%d parts)", replyFileName, len(parts)))
+	}
+	note := fmt.Sprintf("\n\n📎 Continued in the attached `%s`.", replyFileName)
+	return []string{provider.SplitMarkdown(r.Body, limit-len([]rune(note)))[0] + note}, nil
+}
+
+// ackRef returns the acknowledgement posted for a task, if any.
+func (a *Analyzer) ackRef(ctx context.Context, taskID string) *provider.MessageRef {
+	msgs, err := a.database.ListTaskMessages(ctx, taskID)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		if m.Direction == db.MessageOutbound && m.Kind == db.MessageKindAck {
+			return &provider.MessageRef{ID: m.ExternalID, Channel: m.Channel, URL: m.URL}
+		}
+	}
+	return nil
+}
+
+// logEvent appends an entry to the task's event log.
+func (a *Analyzer) logEvent(ctx context.Context, task *db.Task, kind, message string) {
+	e := &db.TaskEvent{TaskID: task.ID, Kind: kind, Message: message}
+	if err := a.database.CreateTaskEvent(ctx, e); err != nil {
+		a.logger.Warn("record task event failed", "task_id", task.ID, "error", err)
+	}
+}
+
+func (a *Analyzer) recordMessage(ctx context.Context, task *db.Task, direction, kind string, ref *provider.MessageRef) {
+	if ref == nil || ref.ID == "" {
+		return
+	}
+	m := &db.TaskMessage{
+		TaskID:       task.ID,
+		Direction:    direction,
+		Kind:         kind,
+		ProviderType: task.ProviderType,
+		ExternalID:   ref.ID,
+		Channel:      ref.Channel,
+		URL:          ref.URL,
+	}
+	if err := a.database.CreateTaskMessage(ctx, m); err != nil {
+		a.logger.Warn("record task message failed", "task_id", task.ID, "kind", kind, "error", err)
+	}
+}
+
+// CancelTask cancels a pending or processing task on behalf of by. A running
+// task is stopped at once if it runs in this process (otherwise its worker
+// notices on the next heartbeat), which cancels the request to OpenCode and
+// aborts the session. The originating channel is told who cancelled it.
+func (a *Analyzer) CancelTask(ctx context.Context, taskID, by string) (*db.Task, error) {
+	existing, err := a.database.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, ErrTaskNotFound
+	}
+	prevStatus := existing.Status
+	if !isActive(prevStatus) {
+		return nil, ErrTaskFinished
+	}
+
+	task, err := a.database.CancelTask(ctx, taskID, "cancelled by "+by)
+	if err != nil {
+		if current, getErr := a.database.GetTask(ctx, taskID); getErr == nil && !isActive(current.Status) {
+			return nil, ErrTaskFinished
+		}
+		return nil, fmt.Errorf("cancel task: %w", err)
+	}
+
+	a.stopRunning(taskID)
+	a.logger.Info("task cancelled", "task_id", taskID, "by", by, "was", prevStatus)
+
+	msg := messageFromTask(task)
+	if pcfg, err := a.database.GetProviderConfig(ctx, msg.ProviderCfgID); err == nil {
+		if p, ok := a.registry.Get(msg.Provider); ok {
+			tpl := a.database.GetSettingString(ctx, "analyzer_cancel_template",
+				"🛑 **OpenCode** request cancelled by %s.")
+			if err := a.finalReply(ctx, p, pcfg.ConfigMap(), task, msg, db.MessageKindNotice, fmt.Sprintf(tpl, by)); err != nil {
+				a.logger.Error("send cancel notice failed", "task_id", taskID, "error", err)
+			}
+		}
+	}
+	return task, nil
+}
+
+func isActive(status db.TaskStatus) bool {
+	return status == db.TaskStatusPending || status == db.TaskStatusProcessing
+}
+
+func (a *Analyzer) trackRunning(taskID string, cancel context.CancelFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running == nil {
+		a.running = make(map[string]context.CancelFunc)
+	}
+	a.running[taskID] = cancel
+}
+
+func (a *Analyzer) untrackRunning(taskID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.running, taskID)
+}
+
+func (a *Analyzer) stopRunning(taskID string) {
+	a.mu.Lock()
+	cancel, ok := a.running[taskID]
+	a.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// AbandonTask tells the originating channel that a task was given up after
+// repeatedly being interrupted by worker crashes or restarts. The task has
+// already been marked failed by the recovery loop.
+func (a *Analyzer) AbandonTask(ctx context.Context, task *db.Task) {
+	msg := messageFromTask(task)
+
+	pcfg, err := a.database.GetProviderConfig(ctx, msg.ProviderCfgID)
+	if err != nil {
+		a.logger.Warn("abandoned task has no provider config", "task_id", task.ID, "error", err)
+		return
+	}
+	p, ok := a.registry.Get(msg.Provider)
+	if !ok {
+		a.logger.Warn("abandoned task provider not registered", "task_id", task.ID, "type", msg.Provider)
+		return
+	}
+
+	reason := fmt.Sprintf(a.database.GetSettingString(ctx, "analyzer_interrupted_message",
+		"The task was interrupted %d time(s) by a restart or crash and has been abandoned. Please post your request again."),
+		task.Attempts)
+	tpl := a.database.GetSettingString(ctx, "analyzer_error_template",
+		"⚠️ **OpenCode** error:\n```\n%s\n```")
+	if err := a.finalReply(ctx, p, pcfg.ConfigMap(), task, msg, db.MessageKindError, fmt.Sprintf(tpl, reason)); err != nil {
+		a.logger.Error("send abandon notice failed", "task_id", task.ID, "error", err)
+	}
+}
+
+// messageFromTask rebuilds the IncomingMessage a task was created from, so the
+// provider can address its replies to the original thread.
+func messageFromTask(t *db.Task) *provider.IncomingMessage {
+	msg := &provider.IncomingMessage{
+		Provider:       provider.ProviderType(t.ProviderType),
+		ExternalRef:    t.ExternalRef,
+		Title:          t.Title,
+		Body:           t.MessageBody,
+		Author:         t.Author,
+		TriggerMode:    provider.TriggerMode(t.TriggerMode),
+		TriggerKeyword: t.TriggerKeyword,
+		ReplyMeta:      t.ReplyMeta,
+		Ref:            t.Ref,
+	}
+	if t.ProjectID != nil {
+		msg.ProjectID = *t.ProjectID
+	}
+	if t.ProviderConfigID != nil {
+		msg.ProviderCfgID = *t.ProviderConfigID
+	}
+	return msg
+}
+
 func matchKeyword(text string, keywords []*db.TriggerKeyword) (string, provider.TriggerMode) {
 	lower := strings.ToLower(text)
 	for _, kw := range keywords {
@@ -147,18 +623,109 @@ func (a *Analyzer) SyncConfig(ctx context.Context) {
 	a.logger.Info("opencode config files synced to disk", "dir", a.configDir)
 }
 
-func (a *Analyzer) analyze(ctx context.Context, msg *provider.IncomingMessage, mode provider.TriggerMode) (string, error) {
+// analyze runs the prompt for msg in the task's OpenCode session. In "do"
+// mode with a project checkout, the files OpenCode edits are then verified
+// with the project's commands, pushed and proposed as a merge request; in
+// "review" mode the answer is posted as comments on the merge request's diff.
+// onProgress, if not nil, receives the session's progress events; it is never
+// called after analyze returns.
+func (a *Analyzer) analyze(ctx context.Context, task *db.Task, msg *provider.IncomingMessage, mode provider.TriggerMode, onProgress func(ProgressEvent)) (string, error) {
 	if err := a.writeConfigFiles(ctx); err != nil {
 		return "", fmt.Errorf("write config: %w", err)
 	}
 
 	prompt := a.buildPrompt(ctx, msg, mode)
-	return a.runOpencodeHTTP(ctx, prompt)
+	if extra := a.fetchContext(ctx, msg); extra != "" {
+		prompt += "\n\n" + extra
+	}
+	files := a.fetchAttachments(ctx, msg)
+	if len(files) > 0 {
+		names := make([]string, len(files))
+		for i, f := range files {
+			names[i] = f.Filename
+		}
+		a.logEvent(ctx, task, "attachments", "sent "+strings.Join(names, ", "))
+	}
+
+	ws, err := a.prepareWorkspace(ctx, task)
+	if err != nil {
+		return "", fmt.Errorf("prepare workspace: %w", err)
+	}
+	if ws != nil {
+		defer ws.Release()
+		prompt += fmt.Sprintf("\n\nThe project repository is checked out in your working directory at `%s` (commit %s).", ws.Ref, shortCommit(ws.Commit))
+		if mode == provider.ModeDo {
+			prompt += "\n\n" + a.database.GetSettingString(ctx, "prompt_do_workspace",
+				"Make the changes by editing the files in your working directory. Do not commit: your changes will be committed and submitted as a merge request. Finish with a short summary of what you changed.")
+		}
+	}
+
+	if mode == provider.ModeReview {
+		return a.runReview(ctx, task, msg, ws, prompt, files, onProgress)
+	}
+	if ws == nil || mode != provider.ModeDo {
+		return a.runOpencodeHTTP(ctx, task, ws, prompt, files, onProgress, nil)
+	}
+	result, err := a.runOpencodeHTTP(ctx, task, ws, prompt, files, onProgress, func(result string, send func(string) (string, error)) (string, error) {
+		return a.verifyChanges(ctx, task, ws, result, send)
+	})
+	if err != nil {
+		return "", err
+	}
+	return a.publishChanges(ctx, task, msg, ws, result)
 }
 
-func (a *Analyzer) runOpencodeHTTP(ctx context.Context, prompt string) (string, error) {
-	title := fmt.Sprintf("Analysis %s", time.Now().Format("2006-01-02 15:04:05"))
-	session, err := a.opencodeClient.CreateSession(ctx, title)
+// prepareWorkspace checks out the task's project for the session to work in.
+// The task's ref is checked out, or the project's default branch, which is
+// then recorded as the task's ref. It returns nil when workspaces are
+// disabled (workspace_enabled) or the task has no project with a repository.
+func (a *Analyzer) prepareWorkspace(ctx context.Context, task *db.Task) (*workspace.Workspace, error) {
+	if a.workspaces == nil || task.ProjectID == nil || !a.database.GetSettingBool(ctx, "workspace_enabled", true) {
+		return nil, nil
+	}
+	project, err := a.database.GetProject(ctx, *task.ProjectID)
+	if err != nil {
+		return nil, fmt.Errorf("get project: %w", err)
+	}
+	if project.SSHURL == "" {
+		return nil, nil
+	}
+	ws, err := a.workspaces.Checkout(ctx, project, task.Ref, worktreeName(task))
+	if err != nil {
+		return nil, err
+	}
+	if task.Ref != ws.Ref {
+		task.Ref = ws.Ref
+		if err := a.database.UpdateTaskRef(ctx, task.ID, ws.Ref); err != nil {
+			a.logger.Warn("record task ref failed", "task_id", task.ID, "error", err)
+		}
+	}
+	a.logEvent(ctx, task, "workspace", fmt.Sprintf("checked out %s @ %s", ws.Ref, shortCommit(ws.Commit)))
+	return ws, nil
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// runOpencodeHTTP sends prompt and files to the task's session and returns
+// the answer.
+// followUp, if not nil, is handed the answer while the session is still open,
+// along with a func to send it further prompts, and its return value becomes
+// the result.
+func (a *Analyzer) runOpencodeHTTP(ctx context.Context, task *db.Task, ws *workspace.Workspace, prompt string, files []MessagePart, onProgress func(ProgressEvent), followUp func(result string, send func(string) (string, error)) (string, error)) (string, error) {
+	dir := ""
+	if ws != nil {
+		dir = ws.Dir
+	}
+	oc := a.opencodeClient.In(dir)
+
+	// ClaimNextTask runs a thread's tasks one at a time, so a conversation's
+	// session never receives two prompts at once.
+	session, keep, err := a.openSession(ctx, oc, task, dir)
 	if err != nil {
 		return "", fmt.Errorf("create session: %w", err)
 	}
@@ -166,15 +733,44 @@ func (a *Analyzer) runOpencodeHTTP(ctx context.Context, prompt string) (string,
 	defer func() {
 		cleanupCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		if delErr := a.opencodeClient.DeleteSession(cleanupCtx, session.ID); delErr != nil {
+		if ctx.Err() != nil {
+			if abortErr := oc.AbortSession(cleanupCtx, session.ID); abortErr != nil {
+				a.logger.Warn("failed to abort session", "session_id", session.ID, "error", abortErr)
+			}
+		}
+		if keep {
+			return
+		}
+		if delErr := oc.DeleteSession(cleanupCtx, session.ID); delErr != nil {
 			a.logger.Warn("failed to delete session", "session_id", session.ID, "error", delErr)
 		}
 	}()
 
-	result, err := a.opencodeClient.SendMessage(ctx, session.ID, prompt)
+	if onProgress != nil {
+		streamCtx, stopStream := context.WithCancel(ctx)
+		streamDone, err := oc.StreamEvents(streamCtx, session.ID, onProgress)
+		if err != nil {
+			a.logger.Warn("opencode event stream unavailable, no progress updates", "session_id", session.ID, "error", err)
+			stopStream()
+		} else {
+			// Wait for the stream goroutine so no progress update can land
+			// after the caller posts the final reply.
+			defer func() {
+				stopStream()
+				<-streamDone
+			}()
+		}
+	}
+
+	result, err := oc.SendMessage(ctx, session.ID, prompt, files...)
 	if err != nil {
 		return "", fmt.Errorf("send message: %w", err)
 	}
+	if followUp != nil {
+		return followUp(result, func(prompt string) (string, error) {
+			return oc.SendMessage(ctx, session.ID, prompt)
+		})
+	}
 
 	return result, nil
 }
@@ -263,6 +859,12 @@ func (a *Analyzer) buildPrompt(ctx context.Context, msg *provider.IncomingMessag
 	case provider.ModeDo:
 		sb.WriteString(a.database.GetSettingString(ctx, "prompt_do",
 			"You are an expert software engineer. Provide the exact code changes needed to resolve the following issue.\n\n"))
+	case provider.ModePipeline:
+		sb.WriteString(a.database.GetSettingString(ctx, "prompt_pipeline",
+			"You are an expert software engineer. A CI job failed. Find the root cause from the job log and the code, and propose a fix.\n\n"))
+	case provider.ModeReview:
+		sb.WriteString(a.database.GetSettingString(ctx, "prompt_review",
+			"You are an expert code reviewer. Review the changes of the following merge request for bugs, security problems and maintainability issues. Only report findings worth a reviewer's comment.\n\n"))
 	default:
 		sb.WriteString(a.database.GetSettingString(ctx, "prompt_default",
 			"You are an expert software engineer. Analyze the following and provide a detailed response.\n\n"))
@@ -270,7 +872,8 @@ func (a *Analyzer) buildPrompt(ctx context.Context, msg *provider.IncomingMessag
 
 	sb.WriteString(fmt.Sprintf("## Source: %s\n", msg.Provider))
 	sb.WriteString(fmt.Sprintf("## Title: %s\n\n", msg.Title))
-	sb.WriteString(fmt.Sprintf("### Message from @%s:\n%s\n\n", msg.Author, msg.Body))
+	_, body := parseOptions(msg.Body)
+	sb.WriteString(fmt.Sprintf("### Message from @%s:\n%s\n\n", msg.Author, body))
 
 	if msg.ExternalRef != "" {
 		sb.WriteString(fmt.Sprintf("Reference: %s\n\n", msg.ExternalRef))
@@ -280,6 +883,91 @@ func (a *Analyzer) buildPrompt(ctx context.Context, msg *provider.IncomingMessag
 	return sb.String()
 }
 
+// fetchContext asks the message's provider, if it is a ContextFetcher, what
+// the message refers to (e.g. a merge request). An issue's comments are
+// bounded by gitlab_issue_context_notes and gitlab_issue_context_tokens.
+// Failures are logged and leave the prompt without the context.
+func (a *Analyzer) fetchContext(ctx context.Context, msg *provider.IncomingMessage) string {
+	p, cfg, ok := a.providerFor(ctx, msg)
+	if !ok {
+		return ""
+	}
+	fetcher, ok := p.(provider.ContextFetcher)
+	if !ok {
+		return ""
+	}
+	limits := provider.ContextLimits{
+		IssueNotes:  a.database.GetSettingInt(ctx, "gitlab_issue_context_notes", 20),
+		IssueTokens: a.database.GetSettingInt(ctx, "gitlab_issue_context_tokens", 8000),
+	}
+	extra, err := fetcher.FetchContext(ctx, cfg, msg, limits)
+	if err != nil {
+		a.logger.Warn("fetch message context failed", "provider", msg.Provider, "ref", msg.ExternalRef, "error", err)
+		return ""
+	}
+	return extra
+}
+
+// defaultAttachmentTypes are the attachment types sent to OpenCode when the
+// attachment_mime_types setting is missing.
+var defaultAttachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "text/*", "application/json", "application/pdf"}
+
+// fetchAttachments downloads the message's attachments, if its provider is an
+// AttachmentFetcher, as file parts for the prompt. Attachments above
+// attachment_max_bytes (0 disables them) or of a type not listed in
+// attachment_mime_types are left out.
+func (a *Analyzer) fetchAttachments(ctx context.Context, msg *provider.IncomingMessage) []MessagePart {
+	limits := provider.AttachmentLimits{
+		MaxBytes:  int64(a.database.GetSettingInt(ctx, "attachment_max_bytes", 5<<20)),
+		MIMETypes: defaultAttachmentTypes,
+	}
+	if limits.MaxBytes <= 0 {
+		return nil
+	}
+	if s, err := a.database.GetSetting(ctx, "attachment_mime_types"); err == nil {
+		var types []string
+		if err := json.Unmarshal(s.Value, &types); err == nil {
+			limits.MIMETypes = types
+		}
+	}
+	p, cfg, ok := a.providerFor(ctx, msg)
+	if !ok {
+		return nil
+	}
+	fetcher, ok := p.(provider.AttachmentFetcher)
+	if !ok {
+		return nil
+	}
+	files, err := fetcher.FetchAttachments(ctx, cfg, msg, limits)
+	if err != nil {
+		a.logger.Warn("fetch message attachments failed", "provider", msg.Provider, "ref", msg.ExternalRef, "error", err)
+		return nil
+	}
+	parts := make([]MessagePart, 0, len(files))
+	for _, f := range files {
+		parts = append(parts, MessagePart{
+			Type:     "file",
+			Mime:     f.MIMEType,
+			Filename: f.Name,
+			URL:      "data:" + f.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(f.Data),
+		})
+	}
+	return parts
+}
+
+// providerFor returns the provider msg came from and its configuration.
+func (a *Analyzer) providerFor(ctx context.Context, msg *provider.IncomingMessage) (provider.Provider, map[string]any, bool) {
+	p, ok := a.registry.Get(msg.Provider)
+	if !ok {
+		return nil, nil, false
+	}
+	pcfg, err := a.database.GetProviderConfig(ctx, msg.ProviderCfgID)
+	if err != nil {
+		return nil, nil, false
+	}
+	return p, pcfg.ConfigMap(), true
+}
+
 func ptrStr(s string) *string {
 	if s == "" {
 		return nil
@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"net/http/httptest"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -143,6 +145,17 @@ func TestBuildPrompt_DoMode(t *testing.T) {
 	}
 }
 
+func TestBuildPrompt_ReviewMode(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default(), configDir: t.TempDir()}
+	msg := &provider.IncomingMessage{Provider: provider.ProviderGitLab, Title: "Add cache", Author: "dana", Body: "@review"}
+
+	result := a.buildPrompt(context.Background(), msg, provider.ModeReview)
+	if !strings.Contains(result, "expert code reviewer") {
+		t.Fatalf("review prompt missing expected prefix, got:\n%s", result)
+	}
+}
+
 func TestBuildPrompt_DefaultMode(t *testing.T) {
 	store := dbmock.New()
 	a := &Analyzer{database: store, logger: slog.Default(), configDir: t.TempDir()}
@@ -195,70 +208,43 @@ func (f *fakeProvider) ValidateConfig(_ map[string]any) error { return nil }
 func (f *fakeProvider) BuildHandler(_, _ string, _ map[string]any, _ func(context.Context, *provider.IncomingMessage)) http.Handler {
 	return nil
 }
-func (f *fakeProvider) SendReply(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, body string) error {
+func (f *fakeProvider) SendReply(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, body string) (*provider.MessageRef, error) {
 	f.replies = append(f.replies, body)
-	return nil
+	return &provider.MessageRef{ID: fmt.Sprintf("note-%d", len(f.replies))}, nil
 }
 
 func TestHandleMessage_FullFlow(t *testing.T) {
-	ocServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == "POST" && r.URL.Path == "/session":
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(Session{ID: "sess-1", Title: "test"})
-		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/session/sess-1/message"):
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(MessageResponse{
-				Parts: []MessagePart{{Type: "text", Text: "analysis result"}},
-			})
-		case r.Method == "DELETE" && r.URL.Path == "/session/sess-1":
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer ocServer.Close()
-
-	store := dbmock.New()
-	_ = store.SetSetting(context.Background(), "opencode_server_url", mustJSON(ocServer.URL))
-
-	pcfg := &db.ProviderConfig{
-		ProjectID:    "proj-1",
-		ProviderType: "gitlab",
-		Config:       json.RawMessage(`{}`),
-		Enabled:      true,
-	}
-	_ = store.CreateProviderConfig(context.Background(), pcfg)
-
+	fp := &fakeProvider{}
+	h := newHarness(t, fp, answering("analysis result", nil))
+	store, a := h.store, h.analyzer
 	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{
 		{Keyword: "@opencode", Mode: "ask"},
 	})
 
-	fp := &fakeProvider{}
-	registry := provider.NewRegistry(slog.Default())
-	registry.Register(fp)
-
-	logger := slog.Default()
-	client := NewOpencodeClient(ocServer.URL, "user", "pass", 30*time.Second, logger)
-	a := &Analyzer{
-		database:       store,
-		registry:       registry,
-		logger:         logger,
-		configDir:      t.TempDir(),
-		opencodeClient: client,
-	}
-
 	msg := &provider.IncomingMessage{
 		Provider:      provider.ProviderGitLab,
-		ProviderCfgID: pcfg.ID,
+		ProviderCfgID: h.pcfg.ID,
 		ProjectID:     "proj-1",
 		Title:         "Test Issue",
 		Body:          "hey @opencode help me",
 		Author:        "tester",
 		ExternalRef:   "https://gitlab.com/issue/42",
+		ReplyMeta:     map[string]int{"issue_iid": 42},
+		Source:        provider.MessageRef{ID: "note-in", URL: "https://gitlab.com/issue/42#note_1"},
 	}
 
-	a.HandleMessage(context.Background(), msg)
+	queued := a.HandleMessage(context.Background(), msg)
+	if queued == nil {
+		t.Fatal("expected a queued task")
+	}
+	if queued.Status != db.TaskStatusPending {
+		t.Fatalf("queued status: got %q, want %q", queued.Status, db.TaskStatusPending)
+	}
+	if len(fp.replies) != 0 {
+		t.Fatalf("expected no replies before processing, got %d", len(fp.replies))
+	}
+
+	h.processNext()
 
 	if len(store.Tasks) != 1 {
 		t.Fatalf("expected 1 task, got %d", len(store.Tasks))
@@ -280,6 +266,20 @@ func TestHandleMessage_FullFlow(t *testing.T) {
 	if !strings.Contains(fp.replies[1], "analysis result") {
 		t.Fatalf("result reply unexpected: %s", fp.replies[1])
 	}
+
+	msgs, _ := store.ListTaskMessages(context.Background(), task.ID)
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 task messages (trigger, ack, result), got %d", len(msgs))
+	}
+	if msgs[0].Direction != db.MessageInbound || msgs[0].ExternalID != "note-in" {
+		t.Fatalf("inbound message unexpected: %+v", msgs[0])
+	}
+	if msgs[1].Kind != db.MessageKindAck || msgs[1].ExternalID != "note-1" {
+		t.Fatalf("ack message unexpected: %+v", msgs[1])
+	}
+	if msgs[2].Kind != db.MessageKindResult || msgs[2].ExternalID != "note-2" {
+		t.Fatalf("result message unexpected: %+v", msgs[2])
+	}
 }
 
 func TestHandleMessage_NoKeywordMatch(t *testing.T) {
@@ -317,7 +317,9 @@ func TestHandleMessage_NoKeywordMatch(t *testing.T) {
 		Author:        "tester",
 	}
 
-	a.HandleMessage(context.Background(), msg)
+	if task := a.HandleMessage(context.Background(), msg); task != nil {
+		t.Fatalf("expected no task, got %+v", task)
+	}
 
 	if len(store.Tasks) != 0 {
 		t.Fatalf("expected 0 tasks, got %d", len(store.Tasks))
@@ -327,54 +329,45 @@ func TestHandleMessage_NoKeywordMatch(t *testing.T) {
 	}
 }
 
-func TestHandleMessage_AnalysisError(t *testing.T) {
-	ocServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch {
-		case r.Method == "POST" && r.URL.Path == "/session":
-			w.WriteHeader(http.StatusOK)
-			_ = json.NewEncoder(w).Encode(Session{ID: "sess-err", Title: "test"})
-		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/session/sess-err/message"):
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, "server error")
-		case r.Method == "DELETE":
-			w.WriteHeader(http.StatusOK)
-		default:
-			w.WriteHeader(http.StatusNotFound)
-		}
-	}))
-	defer ocServer.Close()
-
+func TestHandleMessage_ModeChosenByProvider(t *testing.T) {
 	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
 
-	pcfg := &db.ProviderConfig{
-		ProjectID:    "proj-1",
-		ProviderType: "gitlab",
-		Config:       json.RawMessage(`{}`),
-		Enabled:      true,
+	msg := &provider.IncomingMessage{
+		Provider:       provider.ProviderGitLab,
+		ProjectID:      "proj-1",
+		Title:          "Login fails",
+		Body:           "Login fails\n\nSteps to reproduce.",
+		Author:         "pm",
+		TriggerMode:    provider.ModePlan,
+		TriggerKeyword: "~ai-plan",
 	}
-	_ = store.CreateProviderConfig(context.Background(), pcfg)
+	task := a.HandleMessage(context.Background(), msg)
+	if task == nil {
+		t.Fatal("expected a task without trigger keywords")
+	}
+	if task.TriggerMode != "plan" || task.TriggerKeyword != "~ai-plan" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+}
 
+func TestHandleMessage_AnalysisError(t *testing.T) {
+	fp := &fakeProvider{}
+	h := newHarness(t, fp, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/session/sess-1/message" {
+			http.Error(w, "server error", http.StatusInternalServerError)
+			return
+		}
+		answering("", nil)(w, r)
+	})
+	store, a := h.store, h.analyzer
 	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{
 		{Keyword: "@opencode", Mode: "do"},
 	})
 
-	fp := &fakeProvider{}
-	registry := provider.NewRegistry(slog.Default())
-	registry.Register(fp)
-
-	logger := slog.Default()
-	client := NewOpencodeClient(ocServer.URL, "user", "pass", 30*time.Second, logger)
-	a := &Analyzer{
-		database:       store,
-		registry:       registry,
-		logger:         logger,
-		configDir:      t.TempDir(),
-		opencodeClient: client,
-	}
-
 	msg := &provider.IncomingMessage{
 		Provider:      provider.ProviderGitLab,
-		ProviderCfgID: pcfg.ID,
+		ProviderCfgID: h.pcfg.ID,
 		ProjectID:     "proj-1",
 		Title:         "Fix bug",
 		Body:          "hey @opencode fix this",
@@ -382,6 +375,7 @@ func TestHandleMessage_AnalysisError(t *testing.T) {
 	}
 
 	a.HandleMessage(context.Background(), msg)
+	h.processNext()
 
 	if len(store.Tasks) != 1 {
 		t.Fatalf("expected 1 task, got %d", len(store.Tasks))
@@ -397,9 +391,479 @@ func TestHandleMessage_AnalysisError(t *testing.T) {
 	}
 }
 
+func TestProcessTask_MissingProviderConfig(t *testing.T) {
+	store := dbmock.New()
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(&fakeProvider{})
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default(), configDir: t.TempDir()}
+
+	task := &db.Task{ProviderConfigID: ptrStr("gone"), ProviderType: "gitlab"}
+	_ = store.CreateTask(context.Background(), task)
+	claimed, _ := store.ClaimNextTask(context.Background(), 0, time.Minute)
+
+	a.ProcessTask(context.Background(), claimed)
+
+	if task.Status != db.TaskStatusFailed {
+		t.Fatalf("task status: got %q, want %q", task.Status, db.TaskStatusFailed)
+	}
+}
+
+func TestProcessTask_RecoveredAttempt(t *testing.T) {
+	// OpenCode is down, so every attempt fails.
+	ep := &editingProvider{}
+	h := newHarness(t, ep, http.NotFound)
+	a := h.analyzer
+	h.queue(&db.Task{TriggerMode: "ask"})
+	task := h.claim()
+	a.recordMessage(context.Background(), task, db.MessageOutbound, db.MessageKindAck, &provider.MessageRef{ID: "note-1"})
+
+	// The first attempt outlived its lease and the task was claimed again:
+	// its outcome is dropped.
+	stale := *task
+	task.Attempts++
+	a.ProcessTask(context.Background(), &stale)
+	if len(ep.replies) != 0 || len(ep.edits) != 0 || task.Status != db.TaskStatusProcessing {
+		t.Fatalf("stale attempt reported: posts=%v edits=%v status=%s", ep.replies, ep.edits, task.Status)
+	}
+
+	// The current attempt reuses the first attempt's acknowledgement.
+	a.ProcessTask(context.Background(), task)
+	if len(ep.replies) != 0 || len(ep.edits) != 1 || !strings.HasPrefix(ep.edits[0], "note-1: ") {
+		t.Fatalf("expected the error edited into the existing ack, got posts=%v edits=%v", ep.replies, ep.edits)
+	}
+	if task.Status != db.TaskStatusFailed {
+		t.Fatalf("task status: got %q, want %q", task.Status, db.TaskStatusFailed)
+	}
+}
+
+func TestAbandonTask_NotifiesChannel(t *testing.T) {
+	store := dbmock.New()
+	pcfg := &db.ProviderConfig{ProjectID: "proj-1", ProviderType: "gitlab", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+
+	fp := &fakeProvider{}
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(fp)
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default(), configDir: t.TempDir()}
+
+	task := &db.Task{ProviderConfigID: ptrStr(pcfg.ID), ProviderType: "gitlab", Attempts: 3, Status: db.TaskStatusFailed}
+	a.AbandonTask(context.Background(), task)
+
+	if len(fp.replies) != 1 {
+		t.Fatalf("expected 1 reply, got %d", len(fp.replies))
+	}
+	if !strings.Contains(fp.replies[0], "interrupted 3 time(s)") {
+		t.Fatalf("abandon reply unexpected: %s", fp.replies[0])
+	}
+}
+
+// ---- finalReply ----
+
+type editingProvider struct {
+	fakeProvider
+	edits   []string
+	editErr error
+}
+
+func (e *editingProvider) EditReply(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, ref provider.MessageRef, body string) error {
+	if e.editErr != nil {
+		return e.editErr
+	}
+	e.edits = append(e.edits, ref.ID+": "+body)
+	return nil
+}
+
+type contextProvider struct {
+	fakeProvider
+	context string
+	err     error
+	limits  provider.ContextLimits
+}
+
+func (c *contextProvider) FetchContext(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, limits provider.ContextLimits) (string, error) {
+	c.limits = limits
+	return c.context, c.err
+}
+
+func TestFetchContext(t *testing.T) {
+	store := dbmock.New()
+	pcfg := &db.ProviderConfig{ProviderType: "gitlab", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+	cp := &contextProvider{context: "## Merge request !7: Add cache"}
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(cp)
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default()}
+	msg := &provider.IncomingMessage{Provider: provider.ProviderGitLab, ProviderCfgID: pcfg.ID}
+
+	if got := a.fetchContext(context.Background(), msg); got != cp.context {
+		t.Fatalf("fetchContext() = %q", got)
+	}
+	if cp.limits != (provider.ContextLimits{IssueNotes: 20, IssueTokens: 8000}) {
+		t.Errorf("default limits = %+v", cp.limits)
+	}
+	_ = store.SetSetting(context.Background(), "gitlab_issue_context_notes", json.RawMessage(`5`))
+	_ = a.fetchContext(context.Background(), msg)
+	if cp.limits.IssueNotes != 5 {
+		t.Errorf("limits = %+v", cp.limits)
+	}
+	cp.err = fmt.Errorf("404 Not Found")
+	if got := a.fetchContext(context.Background(), msg); got != "" {
+		t.Fatalf("fetchContext() on error = %q", got)
+	}
+	registry.Register(&fakeProvider{})
+	if got := a.fetchContext(context.Background(), msg); got != "" {
+		t.Fatalf("fetchContext() without a ContextFetcher = %q", got)
+	}
+}
+
+type attachmentProvider struct {
+	fakeProvider
+	limits provider.AttachmentLimits
+}
+
+func (p *attachmentProvider) FetchAttachments(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, limits provider.AttachmentLimits) ([]provider.Attachment, error) {
+	p.limits = limits
+	return []provider.Attachment{{Name: "trace.log", MIMEType: "text/plain", Data: []byte("panic")}}, nil
+}
+
+func TestFetchAttachments(t *testing.T) {
+	store := dbmock.New()
+	pcfg := &db.ProviderConfig{ProviderType: "gitlab", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+	_ = store.SetSetting(context.Background(), "attachment_mime_types", json.RawMessage(`["text/*"]`))
+	ap := &attachmentProvider{}
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(ap)
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default()}
+	msg := &provider.IncomingMessage{Provider: provider.ProviderGitLab, ProviderCfgID: pcfg.ID}
+
+	parts := a.fetchAttachments(context.Background(), msg)
+	want := MessagePart{Type: "file", Mime: "text/plain", Filename: "trace.log", URL: "data:text/plain;base64,cGFuaWM="}
+	if len(parts) != 1 || parts[0] != want {
+		t.Fatalf("fetchAttachments() = %+v", parts)
+	}
+	if ap.limits.MaxBytes != 5<<20 || len(ap.limits.MIMETypes) != 1 || ap.limits.MIMETypes[0] != "text/*" {
+		t.Errorf("limits = %+v", ap.limits)
+	}
+
+	_ = store.SetSetting(context.Background(), "attachment_max_bytes", json.RawMessage(`0`))
+	if parts := a.fetchAttachments(context.Background(), msg); parts != nil {
+		t.Errorf("fetchAttachments() with attachments disabled = %+v", parts)
+	}
+}
+
+func TestProcessTask_EditsAckWithResult(t *testing.T) {
+	ep := &editingProvider{}
+	h := newHarness(t, ep, answering("analysis result", nil))
+	task := h.run(&db.Task{TriggerMode: "ask", MessageBody: "help"})
+
+	if len(ep.replies) != 1 {
+		t.Fatalf("expected only the ack to be posted, got %d posts", len(ep.replies))
+	}
+	if len(ep.edits) != 1 || !strings.HasPrefix(ep.edits[0], "note-1: ") || !strings.Contains(ep.edits[0], "analysis result") {
+		t.Fatalf("expected the ack to be edited into the result, got %v", ep.edits)
+	}
+	msgs, _ := h.store.ListTaskMessages(context.Background(), task.ID)
+	if len(msgs) != 2 || msgs[1].Kind != db.MessageKindResult || msgs[1].ExternalID != "note-1" {
+		t.Fatalf("unexpected task messages: %+v", msgs)
+	}
+}
+
+func TestProcessTask_EditFailureFallsBackToNewPost(t *testing.T) {
+	ep := &editingProvider{editErr: fmt.Errorf("message_not_found")}
+	h := newHarness(t, ep, answering("analysis result", nil))
+	h.run(&db.Task{TriggerMode: "ask", MessageBody: "help"})
+
+	if len(ep.replies) != 2 || !strings.Contains(ep.replies[1], "analysis result") {
+		t.Fatalf("expected ack + result posts, got %v", ep.replies)
+	}
+}
+
+func TestProcessTask_ReplaceAckDisabled(t *testing.T) {
+	ep := &editingProvider{}
+	h := newHarness(t, ep, answering("analysis result", nil))
+	_ = h.store.SetSetting(context.Background(), "analyzer_replace_ack", json.RawMessage(`false`))
+	h.run(&db.Task{TriggerMode: "ask", MessageBody: "help"})
+
+	if len(ep.edits) != 0 || len(ep.replies) != 2 {
+		t.Fatalf("expected two posts and no edits, got posts=%d edits=%d", len(ep.replies), len(ep.edits))
+	}
+}
+
+type limitedProvider struct {
+	editingProvider
+	uploads []string
+}
+
+func (l *limitedProvider) MaxMessageLength() int { return 60 }
+
+func (l *limitedProvider) UploadReply(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, name string, content []byte, _ string) (*provider.MessageRef, error) {
+	l.uploads = append(l.uploads, name+": "+string(content))
+	return &provider.MessageRef{ID: "file-1"}, nil
+}
+
+// finalReplyTo delivers body as the result of a task whose ack is "ack-1".
+func finalReplyTo(t *testing.T, store *dbmock.Store, p provider.Provider, body string) {
+	t.Helper()
+	a := &Analyzer{database: store, logger: slog.Default()}
+	task := &db.Task{}
+	_ = store.CreateTask(context.Background(), task)
+	a.recordMessage(context.Background(), task, db.MessageOutbound, db.MessageKindAck, &provider.MessageRef{ID: "ack-1"})
+	if err := a.finalReply(context.Background(), p, nil, task, &provider.IncomingMessage{}, db.MessageKindResult, body); err != nil {
+		t.Fatalf("finalReply: %v", err)
+	}
+}
+
+const longResult = "First paragraph of the result.\n\nSecond paragraph of the result.\n\nThird paragraph of the result."
+
+func TestFinalReply_SplitsLongBody(t *testing.T) {
+	store := dbmock.New()
+	lp := &limitedProvider{}
+	finalReplyTo(t, store, lp, longResult)
+
+	if len(lp.edits) != 1 || lp.edits[0] != "ack-1: (1/3)\n\nFirst paragraph of the result." {
+		t.Fatalf("edits = %q", lp.edits)
+	}
+	if len(lp.replies) != 2 || lp.replies[1] != "(3/3)\n\nThird paragraph of the result." {
+		t.Fatalf("replies = %q", lp.replies)
+	}
+	if len(lp.uploads) != 0 {
+		t.Errorf("unexpected uploads %q", lp.uploads)
+	}
+}
+
+func TestFinalReply_UploadsPastMaxParts(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "reply_max_parts", json.RawMessage(`2`))
+	lp := &limitedProvider{}
+	finalReplyTo(t, store, lp, longResult)
+
+	if len(lp.uploads) != 1 || lp.uploads[0] != replyFileName+": "+longResult {
+		t.Fatalf("uploads = %q", lp.uploads)
+	}
+	if len(lp.replies) != 0 || len(lp.edits) != 1 || !strings.Contains(lp.edits[0], "attached `"+replyFileName+"`") {
+		t.Fatalf("edits = %q, replies = %q", lp.edits, lp.replies)
+	}
+}
+
+// ---- CancelTask ----
+
+func TestCancelTask_Pending(t *testing.T) {
+	store := dbmock.New()
+	pcfg := &db.ProviderConfig{ProjectID: "proj-1", ProviderType: "gitlab", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+
+	fp := &fakeProvider{}
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(fp)
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default(), configDir: t.TempDir()}
+
+	task := &db.Task{ProviderConfigID: ptrStr(pcfg.ID), ProviderType: "gitlab"}
+	_ = store.CreateTask(context.Background(), task)
+
+	cancelled, err := a.CancelTask(context.Background(), task.ID, "alice")
+	if err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+	if cancelled.Status != db.TaskStatusCancelled {
+		t.Fatalf("status = %s, want cancelled", cancelled.Status)
+	}
+	if len(fp.replies) != 1 || !strings.Contains(fp.replies[0], "cancelled by alice") {
+		t.Fatalf("cancel notice unexpected: %v", fp.replies)
+	}
+
+	if _, err := a.CancelTask(context.Background(), task.ID, "alice"); err != ErrTaskFinished {
+		t.Fatalf("second cancel: got %v, want ErrTaskFinished", err)
+	}
+	if _, err := a.CancelTask(context.Background(), "missing", "alice"); err != ErrTaskNotFound {
+		t.Fatalf("missing task: got %v, want ErrTaskNotFound", err)
+	}
+}
+
+func TestCancelTask_RunningAbortsSession(t *testing.T) {
+	started := make(chan struct{})
+	aborted := make(chan struct{}, 1)
+	fp := &fakeProvider{}
+	h := newHarness(t, fp, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/session/sess-1/message":
+			// Drain the body so the server notices when the client disconnects.
+			_, _ = io.Copy(io.Discard, r.Body)
+			close(started)
+			<-r.Context().Done()
+		case r.Method == "POST" && r.URL.Path == "/session/sess-1/abort":
+			aborted <- struct{}{}
+			_, _ = w.Write([]byte("true"))
+		default:
+			answering("", nil)(w, r)
+		}
+	})
+	store, a := h.store, h.analyzer
+	h.queue(&db.Task{TriggerMode: "ask", MessageBody: "help"})
+	claimed := h.claim()
+
+	done := make(chan struct{})
+	go func() {
+		a.ProcessTask(context.Background(), claimed)
+		close(done)
+	}()
+
+	<-started
+	if _, err := a.CancelTask(context.Background(), claimed.ID, "bob"); err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessTask did not stop after cancel")
+	}
+	select {
+	case <-aborted:
+	default:
+		t.Fatal("expected the OpenCode session to be aborted")
+	}
+
+	if got, _ := store.GetTask(context.Background(), claimed.ID); got.Status != db.TaskStatusCancelled {
+		t.Fatalf("status = %s, want cancelled", got.Status)
+	}
+	// ack + cancel notice; no result or error reply after the cancel.
+	if len(fp.replies) != 2 || !strings.Contains(fp.replies[1], "cancelled by bob") {
+		t.Fatalf("replies unexpected: %v", fp.replies)
+	}
+}
+
+// ---- RetryTask ----
+
+func TestRetryTask_QueuesLinkedCopy(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, registry: provider.NewRegistry(slog.Default()), logger: slog.Default()}
+	notified := 0
+	a.SetQueueNotifier(func() { notified++ })
+
+	orig := &db.Task{
+		ProjectID:        ptrStr("proj-1"),
+		ProviderConfigID: ptrStr("cfg-1"),
+		ProviderType:     "slack",
+		TriggerMode:      "plan",
+		TriggerKeyword:   "@plan",
+		MessageBody:      "@plan the migration",
+		ReplyMeta:        json.RawMessage(`{"channel":"C1","thread_ts":"1.0"}`),
+	}
+	_ = store.CreateTask(context.Background(), orig)
+
+	if _, err := a.RetryTask(context.Background(), orig.ID, "alice"); err != ErrTaskActive {
+		t.Fatalf("retry of pending task: got %v, want ErrTaskActive", err)
+	}
+
+	errMsg := "opencode timeout"
+	claimed, _ := store.ClaimNextTask(context.Background(), 0, time.Minute)
+	_, _ = store.UpdateTaskStatus(context.Background(), claimed.ID, claimed.Attempts, db.TaskStatusFailed, nil, &errMsg)
+
+	retry, err := a.RetryTask(context.Background(), orig.ID, "alice")
+	if err != nil {
+		t.Fatalf("RetryTask: %v", err)
+	}
+	if retry.ID == orig.ID || retry.ParentTaskID == nil || *retry.ParentTaskID != orig.ID {
+		t.Fatalf("retry not linked to parent: %+v", retry)
+	}
+	if retry.Status != db.TaskStatusPending || retry.MessageBody != orig.MessageBody || retry.TriggerMode != "plan" {
+		t.Fatalf("retry fields not copied: %+v", retry)
+	}
+	if string(retry.ReplyMeta) != string(orig.ReplyMeta) {
+		t.Fatalf("reply meta = %s, want %s", retry.ReplyMeta, orig.ReplyMeta)
+	}
+	if notified != 1 {
+		t.Fatalf("notifier called %d times, want 1", notified)
+	}
+
+	if _, err := a.RetryTask(context.Background(), "missing", "alice"); err != ErrTaskNotFound {
+		t.Fatalf("missing task: got %v, want ErrTaskNotFound", err)
+	}
+}
+
+// ---- messageFromTask ----
+
+func TestMessageFromTask_RoundTrip(t *testing.T) {
+	task := &db.Task{
+		ProjectID:        ptrStr("proj-1"),
+		ProviderConfigID: ptrStr("cfg-1"),
+		ProviderType:     "slack",
+		TriggerMode:      "plan",
+		TriggerKeyword:   "@plan",
+		ExternalRef:      "slack://C1/1.0",
+		Title:            "T",
+		MessageBody:      "@plan things",
+		Author:           "U1",
+		ReplyMeta:        json.RawMessage(`{"channel":"C1","thread_ts":"1.0"}`),
+	}
+
+	msg := messageFromTask(task)
+	if msg.Provider != provider.ProviderSlack || msg.ProjectID != "proj-1" || msg.ProviderCfgID != "cfg-1" {
+		t.Fatalf("unexpected identity fields: %+v", msg)
+	}
+	if msg.TriggerMode != provider.ModePlan || msg.TriggerKeyword != "@plan" {
+		t.Fatalf("unexpected trigger fields: %+v", msg)
+	}
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if string(raw) != `{"channel":"C1","thread_ts":"1.0"}` {
+		t.Fatalf("reply meta: got %s", raw)
+	}
+}
+
 // ---- helpers ----
 
 func mustJSON(v string) json.RawMessage {
 	b, _ := json.Marshal(v)
 	return b
 }
+
+// ---- workspace ----
+
+func TestProcessTask_RunsInProjectWorkspace(t *testing.T) {
+	var mu sync.Mutex
+	dirs := map[string]string{}
+	var prompt string
+	stub := answering("analysis result", func(r *http.Request) {
+		var req MessageRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Parts[0].Text
+	})
+	fp := &fakeProvider{}
+	h := newRepoHarness(t, fp, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		dirs[r.Method+" "+r.URL.Path] = r.Header.Get("X-Opencode-Directory")
+		stub(w, r)
+	})
+	store := h.store
+	claimed := h.run(&db.Task{TriggerMode: "ask", MessageBody: "help", Author: "alice"})
+
+	task, _ := store.GetTask(context.Background(), claimed.ID)
+	if task.Status != db.TaskStatusCompleted {
+		t.Fatalf("status = %s, error = %v", task.Status, task.ErrorMessage)
+	}
+	wsDir := dirs["POST /session"]
+	if wsDir == "" || !strings.HasSuffix(wsDir, claimed.ID) {
+		t.Fatalf("session not created in the task worktree: %q", wsDir)
+	}
+	if dirs["POST /session/sess-1/message"] != wsDir || dirs["DELETE /session/sess-1"] != wsDir {
+		t.Fatalf("requests not scoped to the worktree: %v", dirs)
+	}
+	if !strings.Contains(prompt, "checked out in your working directory at `main`") {
+		t.Fatalf("prompt does not mention the checkout: %q", prompt)
+	}
+	if task.Ref != "main" {
+		t.Fatalf("default branch not recorded as the task ref: %q", task.Ref)
+	}
+	if last := fp.replies[len(fp.replies)-1]; !strings.Contains(last, "triggered by alice | ref `main`_") {
+		t.Fatalf("result does not show the ref: %q", last)
+	}
+	if _, err := os.Stat(wsDir); !os.IsNotExist(err) {
+		t.Fatalf("worktree not released: %v", err)
+	}
+	events, _ := store.ListTaskEvents(context.Background(), claimed.ID)
+	if len(events) == 0 || events[0].Kind != "workspace" || !strings.HasPrefix(events[0].Message, "checked out main @ ") {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
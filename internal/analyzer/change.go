@@ -0,0 +1,158 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
+)
+
+const maxChangeTitle = 72
+
+// publishChanges pushes the files OpenCode edited in a "do" task's worktree to
+// a branch named after the task, opens a merge request for it and appends the
+// merge request URL and diff stats to result. A failure to open the merge
+// request is reported in the result rather than failing the task, since the
+// branch has already been pushed.
+func (a *Analyzer) publishChanges(ctx context.Context, task *db.Task, msg *provider.IncomingMessage, ws *workspace.Workspace, result string) (string, error) {
+	prefix := a.database.GetSettingString(ctx, "do_branch_prefix", "opencode/")
+	branch := prefix + "task-" + shortID(task.ID)
+	title := changeTitle(msg, task.TriggerKeyword)
+
+	commitMsg := fmt.Sprintf("%s\n\nRequested by %s via %s.\n", title, msg.Author, msg.Provider)
+	if msg.ExternalRef != "" {
+		commitMsg += "Source: " + msg.ExternalRef + "\n"
+	}
+	commitMsg += "Task: " + task.ID + "\n"
+
+	change, err := ws.Publish(ctx, branch, commitMsg,
+		a.database.GetSettingString(ctx, "do_git_author_name", "OpenCode"),
+		a.database.GetSettingString(ctx, "do_git_author_email", "opencode@localhost"))
+	if errors.Is(err, workspace.ErrNoChanges) {
+		a.logEvent(ctx, task, "change", "no files changed")
+		return result + "\n\n_No files were changed._", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("publish changes: %w", err)
+	}
+	a.logEvent(ctx, task, "change", fmt.Sprintf("pushed %s: %s", branch, change.ShortStat))
+
+	var sb strings.Builder
+	sb.WriteString(result)
+	sb.WriteString("\n\n---\n")
+	mrURL, err := a.openMergeRequest(ctx, task, msg, ws, change, title, result)
+	if err != nil {
+		a.logger.Warn("open merge request failed", "task_id", task.ID, "branch", branch, "error", err)
+		fmt.Fprintf(&sb, "⚠️ Pushed branch `%s`, but opening a merge request failed: %s\n", branch, err)
+	} else {
+		a.logEvent(ctx, task, "merge_request", mrURL)
+		fmt.Fprintf(&sb, "**Merge request:** %s\n", mrURL)
+	}
+	fmt.Fprintf(&sb, "**Branch:** `%s` · %s\n```\n%s\n```", branch, change.ShortStat, change.Stat)
+	return sb.String(), nil
+}
+
+// openMergeRequest opens a merge request from the pushed branch into the
+// branch the task started from (or the project's default branch when it
+// started from a tag or commit).
+func (a *Analyzer) openMergeRequest(ctx context.Context, task *db.Task, msg *provider.IncomingMessage, ws *workspace.Workspace, change *workspace.Change, title, summary string) (string, error) {
+	pcfg, creator, err := a.mergeRequestProvider(ctx, task)
+	if err != nil {
+		return "", err
+	}
+	target := ws.Branch
+	if target == "" {
+		target = ws.Project.DefaultBranch
+	}
+
+	var desc strings.Builder
+	if msg.ExternalRef != "" {
+		fmt.Fprintf(&desc, "Requested by %s in %s.\n\n", msg.Author, msg.ExternalRef)
+	} else {
+		fmt.Fprintf(&desc, "Requested by %s via %s.\n\n", msg.Author, msg.Provider)
+	}
+	desc.WriteString(truncate(summary, 10000))
+	fmt.Fprintf(&desc, "\n\n---\n_Generated by OpenCode, task `%s`._", task.ID)
+
+	return creator.CreateMergeRequest(ctx, pcfg.ConfigMap(), msg, provider.MergeRequest{
+		RepoURL:      ws.Project.SSHURL,
+		SourceBranch: change.Branch,
+		TargetBranch: target,
+		Title:        title,
+		Description:  desc.String(),
+	})
+}
+
+// mergeRequestProvider picks the provider config used to open merge requests:
+// the task's own if its provider can, otherwise the first enabled config of
+// the project whose provider can (e.g. the GitLab config of a project whose
+// request came from Slack).
+func (a *Analyzer) mergeRequestProvider(ctx context.Context, task *db.Task) (*db.ProviderConfig, provider.MergeRequestCreator, error) {
+	if task.ProviderConfigID != nil {
+		if p, ok := a.registry.Get(provider.ProviderType(task.ProviderType)); ok {
+			if creator, ok := p.(provider.MergeRequestCreator); ok {
+				pcfg, err := a.database.GetProviderConfig(ctx, *task.ProviderConfigID)
+				if err == nil {
+					return pcfg, creator, nil
+				}
+			}
+		}
+	}
+	if task.ProjectID != nil {
+		configs, err := a.database.ListProviderConfigs(ctx, *task.ProjectID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list provider configs: %w", err)
+		}
+		for _, pcfg := range configs {
+			if !pcfg.Enabled {
+				continue
+			}
+			if p, ok := a.registry.Get(provider.ProviderType(pcfg.ProviderType)); ok {
+				if creator, ok := p.(provider.MergeRequestCreator); ok {
+					return pcfg, creator, nil
+				}
+			}
+		}
+	}
+	return nil, nil, errors.New("project has no provider that can open merge requests")
+}
+
+// changeTitle derives a commit and merge request title from the request: its
+// first line without the trigger keyword and inline options.
+func changeTitle(msg *provider.IncomingMessage, keyword string) string {
+	_, body := parseOptions(msg.Body)
+	line, _, _ := strings.Cut(body, "\n")
+	if keyword != "" {
+		if i := strings.Index(strings.ToLower(line), strings.ToLower(keyword)); i >= 0 {
+			line = line[:i] + line[i+len(keyword):]
+		}
+	}
+	line = strings.Join(strings.Fields(line), " ")
+	if line == "" {
+		line = msg.Title
+	}
+	if line == "" {
+		return "OpenCode changes"
+	}
+	return truncate(line, maxChangeTitle)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
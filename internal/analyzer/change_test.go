@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+type mrProvider struct {
+	fakeProvider
+	requests []provider.MergeRequest
+}
+
+func (m *mrProvider) CreateMergeRequest(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, mr provider.MergeRequest) (string, error) {
+	m.requests = append(m.requests, mr)
+	return "https://gitlab.example.com/g/p/-/merge_requests/1", nil
+}
+
+// runDoTask runs a "do" task against a fresh repository. setup, if not nil,
+// can adjust the store and project first. The OpenCode stub applies edit to
+// the session's working directory before answering each message.
+func runDoTask(t *testing.T, p provider.Provider, setup func(*dbmock.Store, *db.Project), edit func(dir string)) (*dbmock.Store, *db.Task, string) {
+	t.Helper()
+	h := newRepoHarness(t, p, answering("Fixed the parser.", func(r *http.Request) {
+		edit(r.Header.Get("X-Opencode-Directory"))
+	}))
+	if setup != nil {
+		setup(h.store, h.project)
+	}
+	task := h.run(&db.Task{
+		TriggerMode: "do", TriggerKeyword: "@do", MessageBody: "@do fix the null pointer in the parser",
+		Author: "alice", ExternalRef: "https://gitlab.example.com/g/p/-/issues/5",
+	})
+	return h.store, task, h.remote
+}
+
+func TestDoMode_PushesBranchAndOpensMergeRequest(t *testing.T) {
+	mp := &mrProvider{}
+	_, task, remote := runDoTask(t, mp, nil, func(dir string) {
+		_ = os.WriteFile(filepath.Join(dir, "parser.go"), []byte("package parser\n"), 0o644)
+	})
+
+	if task.Status != db.TaskStatusCompleted {
+		t.Fatalf("status = %s, error = %v", task.Status, task.ErrorMessage)
+	}
+	branch := "opencode/task-" + shortID(task.ID)
+	out, err := exec.Command("git", "-C", remote, "log", "-1", "--format=%s", branch).Output()
+	if err != nil {
+		t.Fatalf("branch %s not pushed: %v", branch, err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "fix the null pointer in the parser" {
+		t.Fatalf("commit subject = %q", got)
+	}
+
+	if len(mp.requests) != 1 {
+		t.Fatalf("expected one merge request, got %d", len(mp.requests))
+	}
+	mr := mp.requests[0]
+	if mr.SourceBranch != branch || mr.TargetBranch != "main" || mr.Title != "fix the null pointer in the parser" {
+		t.Fatalf("unexpected merge request: %+v", mr)
+	}
+	if !strings.Contains(mr.Description, "https://gitlab.example.com/g/p/-/issues/5") {
+		t.Fatalf("merge request does not link back to the issue: %q", mr.Description)
+	}
+
+	reply := mp.replies[len(mp.replies)-1]
+	for _, want := range []string{"Fixed the parser.", "**Merge request:** https://gitlab.example.com/g/p/-/merge_requests/1", "1 file changed", "parser.go"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply missing %q:\n%s", want, reply)
+		}
+	}
+}
+
+func TestDoMode_NoChanges(t *testing.T) {
+	mp := &mrProvider{}
+	_, task, _ := runDoTask(t, mp, nil, func(string) {})
+
+	if task.Status != db.TaskStatusCompleted || len(mp.requests) != 0 {
+		t.Fatalf("status = %s, merge requests = %d", task.Status, len(mp.requests))
+	}
+	if reply := mp.replies[len(mp.replies)-1]; !strings.Contains(reply, "No files were changed") {
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestDoMode_NoMergeRequestProvider(t *testing.T) {
+	fp := &fakeProvider{}
+	_, task, _ := runDoTask(t, fp, nil, func(dir string) {
+		_ = os.WriteFile(filepath.Join(dir, "x.txt"), []byte("x\n"), 0o644)
+	})
+
+	if task.Status != db.TaskStatusCompleted {
+		t.Fatalf("status = %s", task.Status)
+	}
+	if reply := fp.replies[len(fp.replies)-1]; !strings.Contains(reply, "opening a merge request failed") {
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestChangeTitle(t *testing.T) {
+	tests := []struct {
+		body, title, want string
+	}{
+		{"@do fix the parser\nmore details", "Issue", "fix the parser"},
+		{"@DO --ref=dev   fix   spacing", "", "fix spacing"},
+		{"@do", "Crash on start", "Crash on start"},
+		{"@do", "", "OpenCode changes"},
+	}
+	for _, tt := range tests {
+		got := changeTitle(&provider.IncomingMessage{Body: tt.body, Title: tt.title}, "@do")
+		if got != tt.want {
+			t.Errorf("changeTitle(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+	long := changeTitle(&provider.IncomingMessage{Body: "@do " + strings.Repeat("x", 100)}, "@do")
+	if len([]rune(long)) != maxChangeTitle || !strings.HasSuffix(long, "…") {
+		t.Errorf("long title not truncated: %q", long)
+	}
+}
@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+// threadKey returns the conversation a message belongs to. A message that
+// replies to one the bot has seen or sent joins that message's conversation;
+// otherwise the provider's own thread identity is used.
+func (a *Analyzer) threadKey(ctx context.Context, msg *provider.IncomingMessage) string {
+	if msg.ReplyTo != nil {
+		key, err := a.database.GetThreadKeyByMessage(ctx, string(msg.Provider), msg.ReplyTo.Channel, msg.ReplyTo.ID)
+		if err == nil && key != "" {
+			return key
+		}
+	}
+	return msg.ThreadKey
+}
+
+// openSession returns the OpenCode session to run task in. A task in a thread
+// with a live conversation continues that conversation's session. Otherwise a
+// new session is created and, when conversations are enabled
+// (conversation_idle_timeout > 0), remembered for the thread. keep reports
+// whether the session must outlive the task. oc is the client scoped to dir,
+// the task's working directory ("" for the server's own). The conversation
+// keeps dir, and is only continued by a task running in the same directory:
+// the tasks of a thread share a worktree path (see worktreeName).
+func (a *Analyzer) openSession(ctx context.Context, oc *OpencodeClient, task *db.Task, dir string) (session *Session, keep bool, err error) {
+	title := fmt.Sprintf("Analysis %s", time.Now().Format("2006-01-02 15:04:05"))
+	idle := a.database.GetSettingDuration(ctx, "conversation_idle_timeout", 24*time.Hour)
+	if idle <= 0 || task.ThreadKey == "" || task.ProviderConfigID == nil {
+		session, err = oc.CreateSession(ctx, title)
+		return session, false, err
+	}
+
+	conv, err := a.database.GetConversation(ctx, *task.ProviderConfigID, task.ThreadKey)
+	if err == nil {
+		if conv.Directory == dir && time.Since(conv.LastUsedAt) < idle {
+			exists, err := oc.SessionExists(ctx, conv.SessionID)
+			if err == nil && exists {
+				if err := a.database.TouchConversation(ctx, conv.ID); err != nil {
+					a.logger.Warn("touch conversation failed", "conversation_id", conv.ID, "error", err)
+				}
+				a.logger.Info("continuing conversation", "task_id", task.ID, "thread", task.ThreadKey, "session_id", conv.SessionID)
+				return &Session{ID: conv.SessionID}, true, nil
+			}
+		}
+		// Expired, gone on the server or opened elsewhere: start over in a
+		// new session.
+		a.deleteSession(a.opencodeClient.In(conv.Directory), conv.SessionID)
+	}
+
+	session, err = oc.CreateSession(ctx, fmt.Sprintf("Thread %s", task.ThreadKey))
+	if err != nil {
+		return nil, false, err
+	}
+	conv = &db.Conversation{
+		ProviderConfigID: *task.ProviderConfigID,
+		ThreadKey:        task.ThreadKey,
+		SessionID:        session.ID,
+		Directory:        dir,
+	}
+	if err := a.database.SaveConversation(ctx, conv); err != nil {
+		// Without a record nobody would clean the session up; treat it as a
+		// one-off session instead.
+		a.logger.Warn("save conversation failed", "thread", task.ThreadKey, "error", err)
+		return session, false, nil
+	}
+	return session, true, nil
+}
+
+// worktreeName names the worktree task runs in. The tasks of a thread, which
+// run one at a time, share a name: each gets a fresh checkout at the same
+// path, so the thread's conversation session is always addressed from the
+// directory it was opened in.
+func worktreeName(task *db.Task) string {
+	if task.ThreadKey == "" {
+		return task.ID
+	}
+	cfg := ""
+	if task.ProviderConfigID != nil {
+		cfg = *task.ProviderConfigID
+	}
+	sum := sha256.Sum256([]byte(cfg + "\x00" + task.ThreadKey))
+	return "thread-" + hex.EncodeToString(sum[:8])
+}
+
+func (a *Analyzer) deleteSession(oc *OpencodeClient, sessionID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := oc.DeleteSession(ctx, sessionID); err != nil {
+		a.logger.Warn("failed to delete session", "session_id", sessionID, "error", err)
+	}
+}
+
+// RunConversationCleanup deletes conversations idle for longer than
+// conversation_idle_timeout, together with their OpenCode sessions, every
+// conversation_cleanup_interval until ctx is done.
+func (a *Analyzer) RunConversationCleanup(ctx context.Context) {
+	interval := a.database.GetSettingDuration(ctx, "conversation_cleanup_interval", 10*time.Minute)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.cleanupConversations(ctx)
+		}
+	}
+}
+
+func (a *Analyzer) cleanupConversations(ctx context.Context) int {
+	idle := a.database.GetSettingDuration(ctx, "conversation_idle_timeout", 24*time.Hour)
+	if idle < 0 {
+		idle = 0
+	}
+	convs, err := a.database.ListIdleConversations(ctx, time.Now().Add(-idle))
+	if err != nil {
+		a.logger.Error("list idle conversations failed", "error", err)
+		return 0
+	}
+	for _, c := range convs {
+		a.deleteSession(a.opencodeClient.In(c.Directory), c.SessionID)
+		if err := a.database.DeleteConversation(ctx, c.ID); err != nil {
+			a.logger.Warn("delete conversation failed", "conversation_id", c.ID, "error", err)
+		}
+	}
+	if len(convs) > 0 {
+		a.logger.Info("expired idle conversations", "count", len(convs))
+	}
+	return len(convs)
+}
@@ -0,0 +1,227 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+// sessionStub is an OpenCode server that hands out numbered sessions and
+// records which ones were prompted and deleted.
+type sessionStub struct {
+	mu       sync.Mutex
+	created  int
+	live     map[string]bool
+	prompted []string
+	deleted  []string
+}
+
+func newSessionStub() (*sessionStub, http.HandlerFunc) {
+	st := &sessionStub{live: map[string]bool{}}
+	return st, func(w http.ResponseWriter, r *http.Request) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		id := strings.Split(strings.TrimPrefix(r.URL.Path, "/session/"), "/")[0]
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/session":
+			st.created++
+			s := Session{ID: fmt.Sprintf("sess-%d", st.created)}
+			st.live[s.ID] = true
+			_ = json.NewEncoder(w).Encode(s)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/session/"):
+			if !st.live[id] {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(Session{ID: id})
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/message"):
+			st.prompted = append(st.prompted, id)
+			_ = json.NewEncoder(w).Encode(MessageResponse{Parts: []MessagePart{{Type: "text", Text: "answer"}}})
+		case r.Method == "DELETE":
+			st.deleted = append(st.deleted, id)
+			delete(st.live, id)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// newConversationHarness returns a harness whose OpenCode server is a
+// sessionStub.
+func newConversationHarness(t *testing.T) (*testHarness, *sessionStub) {
+	t.Helper()
+	st, oc := newSessionStub()
+	return newHarness(t, &fakeProvider{}, oc), st
+}
+
+func runThreadTask(h *testHarness, threadKey string) {
+	h.run(&db.Task{TriggerMode: "ask", MessageBody: "help", ThreadKey: threadKey})
+}
+
+func TestConversation_FollowUpReusesSession(t *testing.T) {
+	h, st := newConversationHarness(t)
+	store := h.store
+
+	runThreadTask(h, "gitlab:1:issue:2")
+	runThreadTask(h, "gitlab:1:issue:2")
+
+	if st.created != 1 {
+		t.Fatalf("expected one session for the thread, created %d", st.created)
+	}
+	if len(st.prompted) != 2 || st.prompted[0] != "sess-1" || st.prompted[1] != "sess-1" {
+		t.Fatalf("expected both prompts in sess-1, got %v", st.prompted)
+	}
+	if len(st.deleted) != 0 {
+		t.Fatalf("conversation session must outlive the task, deleted %v", st.deleted)
+	}
+	if len(store.Conversations) != 1 || store.Conversations[0].SessionID != "sess-1" {
+		t.Fatalf("unexpected conversations: %+v", store.Conversations)
+	}
+}
+
+func TestConversation_ExpiredStartsNewSession(t *testing.T) {
+	h, st := newConversationHarness(t)
+	store := h.store
+
+	runThreadTask(h, "slack:C1:1.0")
+	store.Conversations[0].LastUsedAt = time.Now().Add(-48 * time.Hour)
+	runThreadTask(h, "slack:C1:1.0")
+
+	if st.created != 2 {
+		t.Fatalf("expected a fresh session after expiry, created %d", st.created)
+	}
+	if len(st.deleted) != 1 || st.deleted[0] != "sess-1" {
+		t.Fatalf("expected the expired session to be deleted, got %v", st.deleted)
+	}
+	if store.Conversations[0].SessionID != "sess-2" {
+		t.Fatalf("conversation not moved to the new session: %+v", store.Conversations[0])
+	}
+}
+
+func TestConversation_DisabledUsesOneOffSessions(t *testing.T) {
+	h, st := newConversationHarness(t)
+	store := h.store
+	_ = store.SetSetting(context.Background(), "conversation_idle_timeout", json.RawMessage(`"0s"`))
+
+	runThreadTask(h, "telegram:5:10")
+	runThreadTask(h, "telegram:5:10")
+
+	if st.created != 2 || len(st.deleted) != 2 || len(store.Conversations) != 0 {
+		t.Fatalf("expected two deleted one-off sessions, created=%d deleted=%v convs=%d",
+			st.created, st.deleted, len(store.Conversations))
+	}
+}
+
+func TestConversation_FollowUpInWorkspace(t *testing.T) {
+	st, stub := newSessionStub()
+	var mu sync.Mutex
+	dirs := map[string][]string{}
+	h := newRepoHarness(t, &fakeProvider{}, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		dirs[r.Method+" "+r.URL.Path] = append(dirs[r.Method+" "+r.URL.Path], r.Header.Get("X-Opencode-Directory"))
+		mu.Unlock()
+		stub(w, r)
+	})
+	store := h.store
+
+	first := h.run(&db.Task{TriggerMode: "ask", MessageBody: "help", ThreadKey: "gitlab:1:issue:2"})
+	second := h.run(&db.Task{TriggerMode: "ask", MessageBody: "and now?", ThreadKey: "gitlab:1:issue:2"})
+
+	if first.Status != db.TaskStatusCompleted || second.Status != db.TaskStatusCompleted {
+		t.Fatalf("statuses = %s, %s", first.Status, second.Status)
+	}
+	if st.created != 1 || len(st.prompted) != 2 {
+		t.Fatalf("expected the follow-up in the thread's session, created=%d prompted=%v", st.created, st.prompted)
+	}
+	opened := dirs["POST /session"][0]
+	if opened == "" {
+		t.Fatal("session not opened in the thread's worktree")
+	}
+	for _, dir := range dirs["POST /session/sess-1/message"] {
+		if dir != opened {
+			t.Fatalf("prompt sent from %q, session opened in %q", dir, opened)
+		}
+	}
+	if len(store.Conversations) != 1 || store.Conversations[0].Directory != opened {
+		t.Fatalf("unexpected conversations: %+v", store.Conversations)
+	}
+
+	store.Conversations[0].LastUsedAt = time.Now().Add(-48 * time.Hour)
+	h.analyzer.cleanupConversations(context.Background())
+	if got := dirs["DELETE /session/sess-1"]; len(got) != 1 || got[0] != opened {
+		t.Fatalf("session deleted from %v, opened in %q", got, opened)
+	}
+}
+
+func TestConversation_OtherDirectoryStartsNewSession(t *testing.T) {
+	h, st := newConversationHarness(t)
+	store := h.store
+
+	runThreadTask(h, "gitlab:1:issue:2")
+	// Saved by a task that ran in another directory.
+	store.Conversations[0].Directory = "/work/elsewhere"
+	runThreadTask(h, "gitlab:1:issue:2")
+
+	if st.created != 2 || len(st.deleted) != 1 || st.deleted[0] != "sess-1" {
+		t.Fatalf("expected a new session, created=%d deleted=%v", st.created, st.deleted)
+	}
+	if store.Conversations[0].SessionID != "sess-2" || store.Conversations[0].Directory != "" {
+		t.Fatalf("conversation not moved to the new session: %+v", store.Conversations[0])
+	}
+}
+
+func TestCleanupConversations_DeletesIdle(t *testing.T) {
+	h, st := newConversationHarness(t)
+	store := h.store
+
+	runThreadTask(h, "gitlab:1:issue:2")
+	runThreadTask(h, "gitlab:1:issue:3")
+	store.Conversations[0].LastUsedAt = time.Now().Add(-48 * time.Hour)
+
+	if n := h.analyzer.cleanupConversations(context.Background()); n != 1 {
+		t.Fatalf("cleaned %d conversations, want 1", n)
+	}
+	if len(st.deleted) != 1 || st.deleted[0] != "sess-1" {
+		t.Fatalf("expected sess-1 deleted, got %v", st.deleted)
+	}
+	if len(store.Conversations) != 1 || store.Conversations[0].ThreadKey != "gitlab:1:issue:3" {
+		t.Fatalf("unexpected remaining conversations: %+v", store.Conversations)
+	}
+}
+
+func TestThreadKey_ReplyToKnownMessage(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
+
+	task := &db.Task{ProviderType: "telegram", ThreadKey: "telegram:5:10"}
+	_ = store.CreateTask(context.Background(), task)
+	_ = store.CreateTaskMessage(context.Background(), &db.TaskMessage{
+		TaskID: task.ID, ProviderType: "telegram", Direction: db.MessageOutbound,
+		Kind: db.MessageKindResult, Channel: "5", ExternalID: "11",
+	})
+
+	reply := &provider.IncomingMessage{
+		Provider:  provider.ProviderTelegram,
+		ThreadKey: "telegram:5:12",
+		ReplyTo:   &provider.MessageRef{ID: "11", Channel: "5"},
+	}
+	if got := a.threadKey(context.Background(), reply); got != "telegram:5:10" {
+		t.Fatalf("threadKey = %q, want the replied-to task's thread", got)
+	}
+
+	reply.ReplyTo = &provider.MessageRef{ID: "99", Channel: "5"}
+	if got := a.threadKey(context.Background(), reply); got != "telegram:5:12" {
+		t.Fatalf("threadKey = %q, want the message's own thread", got)
+	}
+}
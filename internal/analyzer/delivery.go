@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"context"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+// firstDelivery records the webhook delivery msg arrived in and reports
+// whether it is the first one of its event, i.e. not a redelivery of an
+// event that already queued a task. Delivery IDs are scoped to the provider
+// config, as Telegram update IDs are only unique per bot. If the delivery
+// cannot be recorded the message is let through: a duplicate answer is
+// better than none. A replayed webhook is always let through.
+func (a *Analyzer) firstDelivery(ctx context.Context, msg *provider.IncomingMessage) bool {
+	if msg.Delivery == nil || isReplay(ctx) {
+		return true
+	}
+	d := &db.WebhookDelivery{
+		EventUUID:   deliveryKey(msg),
+		EventType:   msg.Delivery.Event,
+		PayloadHash: msg.Delivery.PayloadHash,
+	}
+	first, err := a.database.RecordWebhookDelivery(ctx, d)
+	if err != nil {
+		a.logger.Warn("record webhook delivery failed", "delivery", d.EventUUID, "error", err)
+		return true
+	}
+	if !first {
+		a.logger.Info("duplicate webhook delivery skipped", "provider", msg.Provider, "delivery", d.EventUUID)
+	}
+	return first
+}
+
+// forgetDelivery deletes the delivery firstDelivery recorded for msg when no
+// task could be queued for it, so that a redelivery of the event is not
+// skipped as a duplicate of a message that came to nothing.
+func (a *Analyzer) forgetDelivery(ctx context.Context, msg *provider.IncomingMessage) {
+	if msg.Delivery == nil || isReplay(ctx) {
+		return
+	}
+	if err := a.database.ForgetWebhookDelivery(context.WithoutCancel(ctx), deliveryKey(msg)); err != nil {
+		a.logger.Warn("forget webhook delivery failed", "delivery", deliveryKey(msg), "error", err)
+	}
+}
+
+// deliveryKey is the key msg's webhook delivery is recorded under.
+func deliveryKey(msg *provider.IncomingMessage) string {
+	return msg.ProviderCfgID + ":" + msg.Delivery.ID
+}
+
+// RunDeliveryCleanup deletes webhook delivery records older than
+// webhook_delivery_retention, and inbound webhooks older than
+// webhook_log_retention, every webhook_delivery_cleanup_interval until ctx
+// is done.
+func (a *Analyzer) RunDeliveryCleanup(ctx context.Context) {
+	interval := a.database.GetSettingDuration(ctx, "webhook_delivery_cleanup_interval", time.Hour)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.cleanupDeliveries(ctx)
+			a.cleanupInboundWebhooks(ctx)
+		}
+	}
+}
+
+func (a *Analyzer) cleanupDeliveries(ctx context.Context) int64 {
+	retention := a.database.GetSettingDuration(ctx, "webhook_delivery_retention", 7*24*time.Hour)
+	n, err := a.database.DeleteWebhookDeliveries(ctx, time.Now().Add(-retention))
+	if err != nil {
+		a.logger.Error("delete webhook deliveries failed", "error", err)
+		return 0
+	}
+	if n > 0 {
+		a.logger.Info("expired webhook deliveries", "count", n)
+	}
+	return n
+}
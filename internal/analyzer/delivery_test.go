@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+func TestHandleMessage_SkipsRedelivery(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{{Keyword: "@opencode", Mode: "ask"}})
+	a := &Analyzer{database: store, logger: slog.Default()}
+
+	newMsg := func(cfgID, deliveryID string) *provider.IncomingMessage {
+		return &provider.IncomingMessage{
+			Provider:      provider.ProviderSlack,
+			ProviderCfgID: cfgID,
+			ProjectID:     "proj-1",
+			Body:          "@opencode why?",
+			Delivery:      &provider.Delivery{ID: deliveryID, Event: "app_mention", PayloadHash: "abc"},
+		}
+	}
+
+	if task := a.HandleMessage(context.Background(), newMsg("cfg-1", "Ev1")); task == nil {
+		t.Fatal("expected the first delivery to queue a task")
+	}
+	if task := a.HandleMessage(context.Background(), newMsg("cfg-1", "Ev1")); task != nil {
+		t.Fatalf("expected the redelivery to be skipped, got %+v", task)
+	}
+	if task := a.HandleMessage(context.Background(), newMsg("cfg-2", "Ev1")); task == nil {
+		t.Fatal("expected the same ID from another provider config to queue a task")
+	}
+	if len(store.Tasks) != 2 || len(store.Webhooks) != 2 || store.Webhooks[0].EventUUID != "cfg-1:Ev1" {
+		t.Fatalf("tasks=%d deliveries=%+v", len(store.Tasks), store.Webhooks)
+	}
+}
+
+func TestHandleMessage_NoKeywordRecordsNoDelivery(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
+
+	msg := &provider.IncomingMessage{
+		Provider:  provider.ProviderTelegram,
+		ProjectID: "proj-1",
+		Body:      "just chatting",
+		Delivery:  &provider.Delivery{ID: "42", Event: "message"},
+	}
+	if task := a.HandleMessage(context.Background(), msg); task != nil {
+		t.Fatalf("expected no task, got %+v", task)
+	}
+	if len(store.Webhooks) != 0 {
+		t.Fatalf("expected no recorded delivery, got %+v", store.Webhooks)
+	}
+}
+
+func TestCleanupDeliveries_DeletesExpired(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
+
+	for _, id := range []string{"old", "new"} {
+		_, _ = store.RecordWebhookDelivery(context.Background(), &db.WebhookDelivery{EventUUID: id})
+	}
+	store.Webhooks[0].CreatedAt = time.Now().Add(-8 * 24 * time.Hour)
+
+	if n := a.cleanupDeliveries(context.Background()); n != 1 {
+		t.Fatalf("deleted %d deliveries, want 1", n)
+	}
+	if len(store.Webhooks) != 1 || store.Webhooks[0].EventUUID != "new" {
+		t.Fatalf("remaining deliveries = %+v", store.Webhooks)
+	}
+}
+
+// failingTasks is a store that cannot create tasks.
+type failingTasks struct {
+	*dbmock.Store
+}
+
+func (failingTasks) CreateTask(context.Context, *db.Task) error {
+	return errors.New("connection reset")
+}
+
+func TestHandleMessage_FailedTaskForgetsDelivery(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{{Keyword: "@opencode", Mode: "ask"}})
+	msg := func() *provider.IncomingMessage {
+		return &provider.IncomingMessage{
+			Provider:      provider.ProviderSlack,
+			ProviderCfgID: "cfg-1",
+			ProjectID:     "proj-1",
+			Body:          "@opencode why?",
+			Delivery:      &provider.Delivery{ID: "Ev1", Event: "app_mention"},
+		}
+	}
+
+	a := &Analyzer{database: failingTasks{store}, logger: slog.Default()}
+	if task := a.HandleMessage(context.Background(), msg()); task != nil {
+		t.Fatalf("expected no task, got %+v", task)
+	}
+	if len(store.Webhooks) != 0 {
+		t.Fatalf("expected the delivery to be forgotten, got %+v", store.Webhooks)
+	}
+
+	// The provider's redelivery is handled once the store recovers.
+	a.database = store
+	if task := a.HandleMessage(context.Background(), msg()); task == nil {
+		t.Fatal("expected the redelivery to queue a task")
+	}
+}
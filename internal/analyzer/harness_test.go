@@ -0,0 +1,143 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
+)
+
+// testHarness is an Analyzer wired to an in-memory store, a provider and an
+// OpenCode stub, with a provider config to queue tasks under.
+type testHarness struct {
+	t        *testing.T
+	store    *dbmock.Store
+	analyzer *Analyzer
+	pcfg     *db.ProviderConfig
+	// project and the path of its repository are set by newRepoHarness.
+	project *db.Project
+	remote  string
+}
+
+// newHarness returns a harness whose provider config, of project "proj-1",
+// replies through p and whose OpenCode server is served by oc.
+func newHarness(t *testing.T, p provider.Provider, oc http.HandlerFunc) *testHarness {
+	t.Helper()
+	srv := httptest.NewServer(oc)
+	t.Cleanup(srv.Close)
+
+	store := dbmock.New()
+	pcfg := &db.ProviderConfig{ProjectID: "proj-1", ProviderType: "gitlab", Config: json.RawMessage(`{}`), Enabled: true}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(p)
+	return &testHarness{
+		t:     t,
+		store: store,
+		pcfg:  pcfg,
+		analyzer: &Analyzer{
+			database:       store,
+			registry:       registry,
+			logger:         slog.Default(),
+			configDir:      t.TempDir(),
+			opencodeClient: NewOpencodeClient(srv.URL, "user", "pass", 30*time.Second, slog.Default()),
+		},
+	}
+}
+
+// newRepoHarness is newHarness with the provider config belonging to a
+// project, whose repository has a single empty commit on main, and tasks run
+// in a workspace of it.
+func newRepoHarness(t *testing.T, p provider.Provider, oc http.HandlerFunc) *testHarness {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	remote := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = remote
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	h := newHarness(t, p, oc)
+	h.remote = remote
+	h.project = &db.Project{Name: "p", SSHURL: remote, DefaultBranch: "main"}
+	_ = h.store.CreateProject(context.Background(), h.project)
+	h.pcfg.ProjectID = h.project.ID
+	h.analyzer.workspaces = workspace.New(h.store, t.TempDir(), slog.Default())
+	return h
+}
+
+// queue creates task as a pending task of the harness's provider config, and
+// of its project if it has one. The provider type defaults to gitlab.
+func (h *testHarness) queue(task *db.Task) *db.Task {
+	task.ProviderConfigID = ptrStr(h.pcfg.ID)
+	if task.ProviderType == "" {
+		task.ProviderType = "gitlab"
+	}
+	if h.project != nil {
+		task.ProjectID = ptrStr(h.project.ID)
+	}
+	_ = h.store.CreateTask(context.Background(), task)
+	return task
+}
+
+// claim claims the next pending task.
+func (h *testHarness) claim() *db.Task {
+	h.t.Helper()
+	claimed, err := h.store.ClaimNextTask(context.Background(), 0, time.Minute)
+	if err != nil || claimed == nil {
+		h.t.Fatalf("ClaimNextTask: task=%v err=%v", claimed, err)
+	}
+	return claimed
+}
+
+// processNext claims the next pending task and processes it.
+func (h *testHarness) processNext() *db.Task {
+	h.t.Helper()
+	claimed := h.claim()
+	h.analyzer.ProcessTask(context.Background(), claimed)
+	return claimed
+}
+
+// run queues task and processes it.
+func (h *testHarness) run(task *db.Task) *db.Task {
+	h.t.Helper()
+	h.queue(task)
+	return h.processNext()
+}
+
+// answering returns an OpenCode stub that hands out session "sess-1" and
+// answers each of its messages with answer, after passing the request to
+// onMessage if it is not nil. Other requests succeed with an empty body.
+func answering(answer string, onMessage func(r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/session":
+			_ = json.NewEncoder(w).Encode(Session{ID: "sess-1"})
+		case r.Method == "POST" && r.URL.Path == "/session/sess-1/message":
+			if onMessage != nil {
+				onMessage(r)
+			}
+			_ = json.NewEncoder(w).Encode(MessageResponse{Parts: []MessagePart{{Type: "text", Text: answer}}})
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package analyzer
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/base64"
@@ -9,14 +10,21 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type OpencodeClient struct {
 	baseURL    string
 	httpClient *http.Client
-	authHeader string
-	logger     *slog.Logger
+	// streamClient has no overall timeout: the event stream stays open for
+	// the whole session and is bounded by the caller's context instead.
+	streamClient *http.Client
+	authHeader   string
+	logger       *slog.Logger
+	// directory, if set, is the working directory the server runs the
+	// session's tools in.
+	directory string
 }
 
 func NewOpencodeClient(baseURL, username, password string, timeout time.Duration, logger *slog.Logger) *OpencodeClient {
@@ -27,8 +35,27 @@ func NewOpencodeClient(baseURL, username, password string, timeout time.Duration
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
-		authHeader: "Basic " + auth,
-		logger:     logger,
+		streamClient: &http.Client{},
+		authHeader:   "Basic " + auth,
+		logger:       logger,
+	}
+}
+
+// In returns a client whose requests operate on the project checked out in
+// dir. An empty dir leaves the server's own working directory in effect.
+func (c *OpencodeClient) In(dir string) *OpencodeClient {
+	if dir == "" || dir == c.directory {
+		return c
+	}
+	scoped := *c
+	scoped.directory = dir
+	return &scoped
+}
+
+func (c *OpencodeClient) authorize(req *http.Request) {
+	req.Header.Set("Authorization", c.authHeader)
+	if c.directory != "" {
+		req.Header.Set("X-Opencode-Directory", c.directory)
 	}
 }
 
@@ -39,7 +66,12 @@ type Session struct {
 
 type MessagePart struct {
 	Type string `json:"type"`
-	Text string `json:"text"`
+	Text string `json:"text,omitempty"`
+
+	// A "file" part carries its content in URL, as a data: URL.
+	Mime     string `json:"mime,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	URL      string `json:"url,omitempty"`
 }
 
 type MessageRequest struct {
@@ -72,7 +104,7 @@ func (c *OpencodeClient) CreateSession(ctx context.Context, title string) (*Sess
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", c.authHeader)
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -94,11 +126,11 @@ func (c *OpencodeClient) CreateSession(ctx context.Context, title string) (*Sess
 	return &session, nil
 }
 
-func (c *OpencodeClient) SendMessage(ctx context.Context, sessionID, prompt string) (string, error) {
+// SendMessage sends prompt, followed by files, to the session and returns the
+// answer's text.
+func (c *OpencodeClient) SendMessage(ctx context.Context, sessionID, prompt string, files ...MessagePart) (string, error) {
 	reqBody := MessageRequest{
-		Parts: []MessagePart{
-			{Type: "text", Text: prompt},
-		},
+		Parts: append([]MessagePart{{Type: "text", Text: prompt}}, files...),
 	}
 
 	body, err := json.Marshal(reqBody)
@@ -113,9 +145,9 @@ func (c *OpencodeClient) SendMessage(ctx context.Context, sessionID, prompt stri
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", c.authHeader)
+	c.authorize(req)
 
-	c.logger.Info("sending message to opencode", "session_id", sessionID, "prompt_len", len(prompt))
+	c.logger.Info("sending message to opencode", "session_id", sessionID, "prompt_len", len(prompt), "files", len(files))
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -159,7 +191,7 @@ func (c *OpencodeClient) DeleteSession(ctx context.Context, sessionID string) er
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", c.authHeader)
+	c.authorize(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -175,3 +207,160 @@ func (c *OpencodeClient) DeleteSession(ctx context.Context, sessionID string) er
 	c.logger.Info("opencode session deleted", "session_id", sessionID)
 	return nil
 }
+
+// SessionExists reports whether the server still has the session.
+func (c *OpencodeClient) SessionExists(ctx context.Context, sessionID string) (bool, error) {
+	url := fmt.Sprintf("%s/session/%s", c.baseURL, sessionID)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("get session failed: status %d: %s", resp.StatusCode, string(body))
+	}
+}
+
+// AbortSession stops any generation currently running in the session.
+func (c *OpencodeClient) AbortSession(ctx context.Context, sessionID string) error {
+	url := fmt.Sprintf("%s/session/%s/abort", c.baseURL, sessionID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	c.authorize(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("abort session failed: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	c.logger.Info("opencode session aborted", "session_id", sessionID)
+	return nil
+}
+
+// ProgressEvent is one step of a running session, decoded from the OpenCode
+// server's event stream.
+type ProgressEvent struct {
+	// PartID identifies the message part; updates of the same tool call or
+	// text block share it.
+	PartID string
+	// Kind is "tool" for a tool call or "text" for assistant output.
+	Kind string
+	Tool string
+	// Status is the tool call state: pending, running, completed or error.
+	Status string
+	// Title briefly describes the tool call (file, pattern, command).
+	Title string
+	// Text is the text of the part so far.
+	Text string
+}
+
+type streamEvent struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Part struct {
+			ID        string `json:"id"`
+			SessionID string `json:"sessionID"`
+			Type      string `json:"type"`
+			Text      string `json:"text"`
+			Tool      string `json:"tool"`
+			State     struct {
+				Status string         `json:"status"`
+				Title  string         `json:"title"`
+				Input  map[string]any `json:"input"`
+			} `json:"state"`
+		} `json:"part"`
+	} `json:"properties"`
+}
+
+// progress converts a message.part.updated event of the given session into a
+// ProgressEvent; other events are ignored.
+func (e *streamEvent) progress(sessionID string) (ProgressEvent, bool) {
+	part := e.Properties.Part
+	if e.Type != "message.part.updated" || part.SessionID != sessionID {
+		return ProgressEvent{}, false
+	}
+	switch part.Type {
+	case "tool":
+		title := part.State.Title
+		for _, key := range []string{"filePath", "path", "pattern", "command", "url"} {
+			if title != "" {
+				break
+			}
+			title, _ = part.State.Input[key].(string)
+		}
+		return ProgressEvent{PartID: part.ID, Kind: "tool", Tool: part.Tool, Status: part.State.Status, Title: title}, true
+	case "text":
+		return ProgressEvent{PartID: part.ID, Kind: "text", Text: part.Text}, true
+	}
+	return ProgressEvent{}, false
+}
+
+// StreamEvents subscribes to the server's event stream (SSE) and calls fn for
+// every tool or text update of the session. It returns once the subscription
+// is established; events are delivered from a background goroutine until ctx
+// is done or the stream ends, at which point the returned channel is closed.
+func (c *OpencodeClient) StreamEvents(ctx context.Context, sessionID string, fn func(ProgressEvent)) (<-chan struct{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/event", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	c.authorize(req)
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("subscribe events failed: status %d: %s", resp.StatusCode, string(body))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			var evt streamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &evt); err != nil {
+				continue
+			}
+			if pe, ok := evt.progress(sessionID); ok {
+				fn(pe)
+			}
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamEvents_FiltersSessionParts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/event" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		events := []string{
+			`{"type":"server.connected","properties":{}}`,
+			`{"type":"message.part.updated","properties":{"part":{"id":"p1","sessionID":"other","type":"tool","tool":"read","state":{"status":"running"}}}}`,
+			`{"type":"message.part.updated","properties":{"part":{"id":"p2","sessionID":"sess-1","type":"tool","tool":"read","state":{"status":"running","input":{"filePath":"main.go"}}}}}`,
+			`not json`,
+			`{"type":"message.part.updated","properties":{"part":{"id":"p3","sessionID":"sess-1","type":"text","text":"Hello"}}}`,
+		}
+		for _, e := range events {
+			fmt.Fprintf(w, "data: %s\n\n", e)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewOpencodeClient(srv.URL, "u", "p", time.Minute, slog.Default())
+	var got []ProgressEvent
+	done, err := c.StreamEvents(context.Background(), "sess-1", func(ev ProgressEvent) {
+		got = append(got, ev)
+	})
+	if err != nil {
+		t.Fatalf("StreamEvents: %v", err)
+	}
+	<-done
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %d: %+v", len(got), got)
+	}
+	if got[0].Kind != "tool" || got[0].Tool != "read" || got[0].Title != "main.go" || got[0].Status != "running" {
+		t.Fatalf("tool event unexpected: %+v", got[0])
+	}
+	if got[1].Kind != "text" || got[1].Text != "Hello" {
+		t.Fatalf("text event unexpected: %+v", got[1])
+	}
+}
+
+func TestStreamEvents_Unavailable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	c := NewOpencodeClient(srv.URL, "u", "p", time.Minute, slog.Default())
+	if _, err := c.StreamEvents(context.Background(), "sess-1", func(ProgressEvent) {}); err == nil {
+		t.Fatal("expected an error when the event endpoint is missing")
+	}
+}
+
+func TestSendMessage_WithFiles(t *testing.T) {
+	var got MessageRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_ = json.NewEncoder(w).Encode(MessageResponse{Parts: []MessagePart{{Type: "text", Text: "ok"}}})
+	}))
+	defer srv.Close()
+
+	c := NewOpencodeClient(srv.URL, "user", "pass", 5*time.Second, slog.Default())
+	file := MessagePart{Type: "file", Mime: "image/png", Filename: "shot.png", URL: "data:image/png;base64,AA=="}
+	if _, err := c.SendMessage(context.Background(), "sess-1", "what broke?", file); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if len(got.Parts) != 2 || got.Parts[0] != (MessagePart{Type: "text", Text: "what broke?"}) || got.Parts[1] != file {
+		t.Errorf("parts = %+v", got.Parts)
+	}
+}
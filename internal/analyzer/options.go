@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// triggerOptions are the inline options a trigger message may carry, e.g.
+// "@opencode --ref=release/2.3 why does X fail".
+type triggerOptions struct {
+	// Ref is the branch, tag or commit to analyze.
+	Ref string
+}
+
+var optionPattern = regexp.MustCompile(`(^|\s)--([a-z][a-z-]*)=(\S+)`)
+
+// parseOptions extracts the known inline options from text and returns them
+// along with text stripped of them. Unknown options are left in place. A
+// removed option takes the blanks after it along, or else those before it,
+// so no double space is left where it was.
+func parseOptions(text string) (triggerOptions, string) {
+	var opts triggerOptions
+	var b strings.Builder
+	last := 0
+	for _, m := range optionPattern.FindAllStringSubmatchIndex(text, -1) {
+		switch text[m[4]:m[5]] {
+		case "ref":
+			opts.Ref = text[m[6]:m[7]]
+		default:
+			continue
+		}
+		start, end := m[3], m[1]
+		tail := text[end:]
+		if blanks := len(tail) - len(strings.TrimLeft(tail, " \t")); blanks > 0 {
+			b.WriteString(text[last:start])
+			last = end + blanks
+		} else {
+			b.WriteString(strings.TrimRight(text[last:start], " \t"))
+			last = end
+		}
+	}
+	b.WriteString(text[last:])
+	return opts, strings.TrimSpace(b.String())
+}
+
+// retryCommand is what a trigger message says, besides the keyword, to re-run
+// the latest task of its thread, e.g. "@opencode retry".
+const retryCommand = "retry"
+
+// isRetryCommand reports whether text, triggered by keyword, is a retry
+// command.
+func isRetryCommand(text, keyword string) bool {
+	_, rest := parseOptions(text)
+	rest = strings.Replace(strings.ToLower(rest), strings.ToLower(keyword), "", 1)
+	return strings.TrimSpace(rest) == retryCommand
+}
@@ -0,0 +1,132 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		text, ref, rest string
+	}{
+		{"@opencode --ref=release/2.3 why does X fail", "release/2.3", "@opencode why does X fail"},
+		{"@opencode why --ref=main\nand how", "main", "@opencode why\nand how"},
+		{"@opencode --ref=a --ref=b  go", "b", "@opencode go"},
+		{"--ref=v1.2.0 @opencode explain", "v1.2.0", "@opencode explain"},
+		{"@opencode why\n--ref=abc123", "abc123", "@opencode why"},
+		{"@opencode --verbose=yes keep unknown", "", "@opencode --verbose=yes keep unknown"},
+		{"@opencode compare a--ref=x", "", "@opencode compare a--ref=x"},
+	}
+	for _, tt := range tests {
+		opts, rest := parseOptions(tt.text)
+		if opts.Ref != tt.ref || rest != tt.rest {
+			t.Errorf("parseOptions(%q) = %q, %q; want %q, %q", tt.text, opts.Ref, rest, tt.ref, tt.rest)
+		}
+	}
+}
+
+func TestHandleMessage_RefOption(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{
+		{Keyword: "@opencode", Mode: "ask"},
+	})
+	a := &Analyzer{database: store, registry: provider.NewRegistry(slog.Default()), logger: slog.Default()}
+
+	// A provider default (MR source branch) is overridden by --ref.
+	msg := &provider.IncomingMessage{
+		Provider: provider.ProviderGitLab, ProjectID: "proj-1",
+		Body: "@opencode --ref=release/2.3 why does X fail", Ref: "feature/x",
+	}
+	task := a.HandleMessage(context.Background(), msg)
+	if task == nil || task.Ref != "release/2.3" {
+		t.Fatalf("expected ref release/2.3, got %+v", task)
+	}
+
+	msg = &provider.IncomingMessage{
+		Provider: provider.ProviderGitLab, ProjectID: "proj-1",
+		Body: "@opencode review this", Ref: "feature/x",
+	}
+	if task := a.HandleMessage(context.Background(), msg); task == nil || task.Ref != "feature/x" {
+		t.Fatalf("expected the provider's ref, got %+v", task)
+	}
+}
+
+func TestBuildPrompt_StripsOptions(t *testing.T) {
+	a := &Analyzer{database: dbmock.New(), logger: slog.Default()}
+	prompt := a.buildPrompt(context.Background(), &provider.IncomingMessage{
+		Author: "alice", Body: "@opencode --ref=main what is this",
+	}, provider.ModeAsk)
+	if want := "@opencode what is this"; !strings.Contains(prompt, want) || strings.Contains(prompt, "--ref") {
+		t.Fatalf("prompt should carry the message without options:\n%s", prompt)
+	}
+}
+
+func TestFormatTemplate_ExtraArgsDropped(t *testing.T) {
+	if got := formatTemplate("_%s mode | by %s_", "ask", "bob", " | ref `main`"); got != "_ask mode | by bob_" {
+		t.Fatalf("got %q", got)
+	}
+	if got := formatTemplate("_%s mode | by %s%s_", "ask", "bob", " | ref `main`"); got != "_ask mode | by bob | ref `main`_" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestIsRetryCommand(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"@opencode retry", true},
+		{"  @OpenCode   Retry\n", true},
+		{"retry @opencode", true},
+		{"@opencode --ref=main retry", true},
+		{"@opencode retry the build", false},
+		{"@opencode why does retry fail", false},
+		{"@opencode", false},
+	}
+	for _, tt := range tests {
+		if got := isRetryCommand(tt.text, "@opencode"); got != tt.want {
+			t.Errorf("isRetryCommand(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHandleMessage_RetryInThread(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{
+		{Keyword: "@opencode", Mode: "plan"},
+	})
+	a := &Analyzer{database: store, registry: provider.NewRegistry(slog.Default()), logger: slog.Default()}
+	thread := func(body string) *provider.IncomingMessage {
+		return &provider.IncomingMessage{
+			Provider: provider.ProviderSlack, ProjectID: "proj-1", ProviderCfgID: "cfg-1",
+			ThreadKey: "C1:1.0", Author: "bob", Body: body,
+		}
+	}
+
+	// With nothing to retry, the message is an ordinary request.
+	orig := a.HandleMessage(context.Background(), thread("@opencode retry"))
+	if orig == nil || orig.ParentTaskID != nil {
+		t.Fatalf("expected a new task, got %+v", orig)
+	}
+	if task := a.HandleMessage(context.Background(), thread("@opencode retry")); task != nil {
+		t.Fatalf("retry of a pending task should be skipped, got %+v", task)
+	}
+
+	errMsg := "opencode timeout"
+	claimed, _ := store.ClaimNextTask(context.Background(), 0, time.Minute)
+	_, _ = store.UpdateTaskStatus(context.Background(), claimed.ID, claimed.Attempts, db.TaskStatusFailed, nil, &errMsg)
+	retry := a.HandleMessage(context.Background(), thread("@opencode retry"))
+	if retry == nil || retry.ParentTaskID == nil || *retry.ParentTaskID != orig.ID || retry.ThreadKey != orig.ThreadKey {
+		t.Fatalf("expected a retry of %s, got %+v", orig.ID, retry)
+	}
+	if len(store.Tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(store.Tasks))
+	}
+}
@@ -0,0 +1,161 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+var (
+	ErrReplyNotFound = errors.New("reply not found")
+	ErrReplyNotDead  = errors.New("reply is not dead")
+)
+
+// outboxLease is how long a reply being delivered is withheld from the
+// dispatcher. A delivery outliving it (a crashed process) is retried.
+const outboxLease = 2 * time.Minute
+
+// settleReply records the outcome of an attempt to deliver r. A failed
+// attempt is retried after an exponential backoff, or after the delay the
+// channel asked for if that is longer, until outbox_max_attempts attempts
+// have been made; the reply is then dead and an error is returned.
+func (a *Analyzer) settleReply(ctx context.Context, task *db.Task, r *db.OutboxReply, err error) error {
+	if err == nil {
+		if err := a.database.CompleteOutboxReply(ctx, r.ID); err != nil {
+			a.logger.Warn("mark reply delivered failed", "reply_id", r.ID, "error", err)
+		}
+		return nil
+	}
+
+	maxAttempts := a.database.GetSettingInt(ctx, "outbox_max_attempts", 8)
+	if r.Attempts >= maxAttempts {
+		if err := a.database.FailOutboxReply(ctx, r.ID, err.Error()); err != nil {
+			a.logger.Warn("mark reply dead failed", "reply_id", r.ID, "error", err)
+		}
+		a.logEvent(ctx, task, "reply", fmt.Sprintf("delivery failed after %d attempt(s): %v", r.Attempts, err))
+		return fmt.Errorf("reply %s failed after %d attempt(s): %w", r.ID, r.Attempts, err)
+	}
+
+	delay := outboxBackoff(r.Attempts,
+		a.database.GetSettingDuration(ctx, "outbox_retry_base", 10*time.Second),
+		a.database.GetSettingDuration(ctx, "outbox_retry_max", 10*time.Minute),
+		provider.RetryAfter(err))
+	if err := a.database.RetryOutboxReply(ctx, r.ID, err.Error(), time.Now().Add(delay)); err != nil {
+		a.logger.Warn("schedule reply retry failed", "reply_id", r.ID, "error", err)
+	}
+	a.logger.Warn("send reply failed, will retry", "task_id", task.ID, "reply_id", r.ID,
+		"attempt", r.Attempts, "retry_in", delay, "error", err)
+	return nil
+}
+
+// outboxBackoff returns the delay before the attempt following the given
+// one: base doubled for every earlier attempt, capped at maxDelay, unless the
+// channel asked to wait longer.
+func outboxBackoff(attempt int, base, maxDelay, retryAfter time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d
+}
+
+func (a *Analyzer) saveReplyProgress(ctx context.Context, r *db.OutboxReply) {
+	if r.ID == "" {
+		return
+	}
+	if err := a.database.UpdateOutboxProgress(ctx, r.ID, r.PartsSent, r.Uploaded); err != nil {
+		a.logger.Warn("record reply progress failed", "reply_id", r.ID, "error", err)
+	}
+}
+
+// RunOutboxDispatcher delivers the outbox replies that are due, every
+// outbox_poll_interval and whenever a reply is resent, until ctx is done.
+func (a *Analyzer) RunOutboxDispatcher(ctx context.Context) {
+	interval := a.database.GetSettingDuration(ctx, "outbox_poll_interval", 5*time.Second)
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		a.dispatchOutbox(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.outboxWake:
+		}
+	}
+}
+
+// dispatchOutbox attempts every reply that is due and returns how many it
+// attempted.
+func (a *Analyzer) dispatchOutbox(ctx context.Context) int {
+	n := 0
+	for ctx.Err() == nil {
+		r, err := a.database.ClaimOutboxReply(ctx, outboxLease)
+		if err != nil {
+			a.logger.Error("claim outbox reply failed", "error", err)
+			break
+		}
+		if r == nil {
+			break
+		}
+		a.dispatchReply(ctx, r)
+		n++
+	}
+	return n
+}
+
+func (a *Analyzer) dispatchReply(ctx context.Context, r *db.OutboxReply) {
+	task, err := a.database.GetTask(ctx, r.TaskID)
+	if err != nil {
+		a.logger.Warn("outbox reply has no task", "reply_id", r.ID, "task_id", r.TaskID, "error", err)
+		if err := a.database.FailOutboxReply(ctx, r.ID, "task not found"); err != nil {
+			a.logger.Warn("mark reply dead failed", "reply_id", r.ID, "error", err)
+		}
+		return
+	}
+	msg := messageFromTask(task)
+	sendErr := fmt.Errorf("provider %s not available", msg.Provider)
+	if p, cfg, ok := a.providerFor(ctx, msg); ok {
+		sendErr = a.deliverReply(ctx, p, cfg, task, msg, r)
+	}
+	if err := a.settleReply(ctx, task, r, sendErr); err != nil {
+		a.logger.Error("send reply failed", "task_id", task.ID, "reply_id", r.ID, "error", err)
+	} else if sendErr == nil {
+		a.logger.Info("reply delivered", "task_id", task.ID, "reply_id", r.ID, "attempt", r.Attempts)
+	}
+}
+
+// ResendReply queues a dead reply for delivery again with a fresh set of
+// attempts and wakes the dispatcher.
+func (a *Analyzer) ResendReply(ctx context.Context, id string) (*db.OutboxReply, error) {
+	existing, err := a.database.GetOutboxReply(ctx, id)
+	if err != nil {
+		return nil, ErrReplyNotFound
+	}
+	if existing.Status != db.OutboxDead {
+		return nil, ErrReplyNotDead
+	}
+	r, err := a.database.ResendOutboxReply(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("resend reply: %w", err)
+	}
+	a.logger.Info("reply resent", "reply_id", id, "task_id", r.TaskID)
+	select {
+	case a.outboxWake <- struct{}{}:
+	default:
+	}
+	return r, nil
+}
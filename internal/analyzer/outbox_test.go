@@ -0,0 +1,148 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempt    int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{1, 0, 10 * time.Second},
+		{2, 0, 20 * time.Second},
+		{4, 0, 80 * time.Second},
+		{10, 0, 5 * time.Minute},
+		{1, 45 * time.Second, 45 * time.Second},
+		{3, time.Second, 40 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempt, 10*time.Second, 5*time.Minute, tt.retryAfter); got != tt.want {
+			t.Errorf("outboxBackoff(%d, retry after %s) = %s, want %s", tt.attempt, tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+// flakyProvider fails its next failures posts as rate limited.
+type flakyProvider struct {
+	limitedProvider
+	failures int
+}
+
+func (f *flakyProvider) SendReply(ctx context.Context, cfg map[string]any, msg *provider.IncomingMessage, body string) (*provider.MessageRef, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, &provider.RateLimitError{After: 30 * time.Second, Err: errors.New("slack api error: ratelimited")}
+	}
+	return f.limitedProvider.SendReply(ctx, cfg, msg, body)
+}
+
+// newOutboxTest returns an analyzer delivering through p and a task whose
+// ack is "ack-1".
+func newOutboxTest(t *testing.T, store *dbmock.Store, p provider.Provider) (*Analyzer, *db.Task) {
+	t.Helper()
+	pcfg := &db.ProviderConfig{ProjectID: "proj-1", ProviderType: "gitlab", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pcfg)
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(p)
+	a := &Analyzer{database: store, registry: registry, logger: slog.Default(), outboxWake: make(chan struct{}, 1)}
+
+	task := &db.Task{ProviderConfigID: ptrStr(pcfg.ID), ProviderType: "gitlab"}
+	_ = store.CreateTask(context.Background(), task)
+	a.recordMessage(context.Background(), task, db.MessageOutbound, db.MessageKindAck, &provider.MessageRef{ID: "ack-1"})
+	return a, task
+}
+
+// makeDue lets the dispatcher pick up every pending reply now.
+func makeDue(store *dbmock.Store) {
+	for _, r := range store.Outbox {
+		r.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func TestFinalReply_RetriesRemainingParts(t *testing.T) {
+	store := dbmock.New()
+	fp := &flakyProvider{failures: 1}
+	a, task := newOutboxTest(t, store, fp)
+
+	start := time.Now()
+	if err := a.finalReply(context.Background(), fp, nil, task, messageFromTask(task), db.MessageKindResult, longResult); err != nil {
+		t.Fatalf("finalReply: %v", err)
+	}
+	if len(store.Outbox) != 1 {
+		t.Fatalf("expected 1 outbox reply, got %d", len(store.Outbox))
+	}
+	r := store.Outbox[0]
+	if r.Status != db.OutboxPending || r.Attempts != 1 || r.PartsSent != 1 || !strings.Contains(r.LastError, "ratelimited") {
+		t.Fatalf("unexpected reply after failed attempt: %+v", r)
+	}
+	if r.NextAttemptAt.Before(start.Add(30 * time.Second)) {
+		t.Errorf("retry scheduled at %s, before the channel's retry after", r.NextAttemptAt)
+	}
+
+	if n := a.dispatchOutbox(context.Background()); n != 0 {
+		t.Fatalf("dispatched %d replies before they were due", n)
+	}
+	makeDue(store)
+	if n := a.dispatchOutbox(context.Background()); n != 1 {
+		t.Fatalf("dispatched %d replies, want 1", n)
+	}
+	if r.Status != db.OutboxDelivered || r.Attempts != 2 || r.DeliveredAt == nil {
+		t.Fatalf("unexpected reply after retry: %+v", r)
+	}
+	if len(fp.edits) != 1 || !strings.HasPrefix(fp.edits[0], "ack-1: (1/3)") {
+		t.Fatalf("edits = %q", fp.edits)
+	}
+	if len(fp.replies) != 2 || !strings.HasPrefix(fp.replies[0], "(2/3)") || !strings.HasPrefix(fp.replies[1], "(3/3)") {
+		t.Fatalf("expected only the remaining parts to be posted, got %q", fp.replies)
+	}
+}
+
+func TestFinalReply_DeadAfterMaxAttempts(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "outbox_max_attempts", json.RawMessage(`2`))
+	_ = store.SetSetting(context.Background(), "analyzer_replace_ack", json.RawMessage(`false`))
+	fp := &flakyProvider{failures: 3}
+	a, task := newOutboxTest(t, store, fp)
+
+	if err := a.finalReply(context.Background(), fp, nil, task, messageFromTask(task), db.MessageKindError, "boom"); err != nil {
+		t.Fatalf("first failure should be retried, got %v", err)
+	}
+	makeDue(store)
+	a.dispatchOutbox(context.Background())
+
+	r := store.Outbox[0]
+	if r.Status != db.OutboxDead || r.Attempts != 2 {
+		t.Fatalf("expected the reply to be dead after 2 attempts, got %+v", r)
+	}
+	events, _ := store.ListTaskEvents(context.Background(), task.ID)
+	if len(events) != 1 || !strings.Contains(events[0].Message, "delivery failed after 2 attempt(s)") {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if _, err := a.ResendReply(context.Background(), r.ID); err != nil {
+		t.Fatalf("ResendReply: %v", err)
+	}
+	if r.Status != db.OutboxPending || r.Attempts != 0 {
+		t.Fatalf("unexpected resent reply: %+v", r)
+	}
+	if _, err := a.ResendReply(context.Background(), r.ID); !errors.Is(err, ErrReplyNotDead) {
+		t.Fatalf("resending a pending reply: got %v, want ErrReplyNotDead", err)
+	}
+	fp.failures = 0
+	a.dispatchOutbox(context.Background())
+	if r.Status != db.OutboxDelivered || len(fp.replies) != 1 || fp.replies[0] != "boom" {
+		t.Fatalf("resent reply not delivered: %+v, replies %q", r, fp.replies)
+	}
+}
@@ -0,0 +1,71 @@
+package analyzer
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+// acceptFailedJob reports whether msg's failed CI job should be analyzed: the
+// project must have pipeline analysis enabled and the job's ref and name must
+// match its patterns. It also returns the project's cooldown, which
+// claimFailedJob applies once the delivery is known not to be a duplicate.
+func (a *Analyzer) acceptFailedJob(ctx context.Context, msg *provider.IncomingMessage) (time.Duration, bool) {
+	job := msg.FailedJob
+	project, err := a.database.GetProject(ctx, msg.ProjectID)
+	if err != nil || !project.Enabled || !project.PipelineAnalysis {
+		return 0, false
+	}
+	branches := project.PipelineBranches
+	if len(branches) == 0 {
+		branches = []string{project.DefaultBranch}
+	}
+	if !matchPattern(branches, job.Ref) {
+		return 0, false
+	}
+	if len(project.PipelineJobs) > 0 && !matchPattern(project.PipelineJobs, job.Name) {
+		return 0, false
+	}
+	return time.Duration(project.PipelineCooldownMinutes) * time.Minute, true
+}
+
+// claimFailedJob starts the cooldown of msg's failed job and reports whether
+// the same job of the same ref was not analyzed within cooldown.
+func (a *Analyzer) claimFailedJob(ctx context.Context, msg *provider.IncomingMessage, cooldown time.Duration) bool {
+	job := msg.FailedJob
+	ok, err := a.database.ClaimPipelineAnalysis(ctx, msg.ProjectID, job.Ref, job.Name, cooldown)
+	if err != nil {
+		a.logger.Error("claim pipeline analysis failed", "project", msg.ProjectID, "ref", job.Ref, "job", job.Name, "error", err)
+		return false
+	}
+	if !ok {
+		a.logger.Info("failed job skipped during cooldown", "project", msg.ProjectID, "ref", job.Ref, "job", job.Name)
+	}
+	return ok
+}
+
+// releaseFailedJob ends the cooldown claimFailedJob started for msg's failed
+// job when no task could be queued for it, so the job is not silenced by an
+// analysis that never ran.
+func (a *Analyzer) releaseFailedJob(ctx context.Context, msg *provider.IncomingMessage) {
+	if msg.FailedJob == nil {
+		return
+	}
+	job := msg.FailedJob
+	if err := a.database.ReleasePipelineAnalysis(context.WithoutCancel(ctx), msg.ProjectID, job.Ref, job.Name); err != nil {
+		a.logger.Warn("release pipeline analysis failed", "project", msg.ProjectID, "ref", job.Ref, "job", job.Name, "error", err)
+	}
+}
+
+// matchPattern reports whether name matches one of the glob patterns (as in
+// path.Match, so "release/*" matches "release/1.2").
+func matchPattern(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
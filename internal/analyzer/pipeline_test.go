@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+func failedJobMessage(projectID, ref, job string) *provider.IncomingMessage {
+	return &provider.IncomingMessage{
+		Provider:  provider.ProviderGitLab,
+		ProjectID: projectID,
+		Title:     "Add cache",
+		Body:      "Job `" + job + "` failed on `" + ref + "`.",
+		Author:    "bob",
+		Ref:       "abc123",
+		FailedJob: &provider.FailedJob{Ref: ref, Name: job, Stage: "test"},
+	}
+}
+
+func TestHandleMessage_FailedJob(t *testing.T) {
+	store := dbmock.New()
+	project := &db.Project{Name: "p", DefaultBranch: "main", Enabled: true, PipelineAnalysis: true, PipelineCooldownMinutes: 60}
+	_ = store.CreateProject(context.Background(), project)
+	a := &Analyzer{database: store, logger: slog.Default()}
+
+	task := a.HandleMessage(context.Background(), failedJobMessage(project.ID, "main", "unit-tests"))
+	if task == nil {
+		t.Fatal("expected a task for a failed job on the default branch")
+	}
+	if task.TriggerMode != string(provider.ModePipeline) || task.TriggerKeyword != "" || task.Ref != "abc123" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+
+	if task := a.HandleMessage(context.Background(), failedJobMessage(project.ID, "main", "unit-tests")); task != nil {
+		t.Fatal("expected the same job to be skipped during the cooldown")
+	}
+	if task := a.HandleMessage(context.Background(), failedJobMessage(project.ID, "main", "lint")); task == nil {
+		t.Fatal("expected another job of the same branch to be analyzed")
+	}
+}
+
+func TestAcceptFailedJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		project  db.Project
+		ref, job string
+		want     bool
+	}{
+		{"disabled", db.Project{Enabled: true, DefaultBranch: "main"}, "main", "test", false},
+		{"project disabled", db.Project{PipelineAnalysis: true, DefaultBranch: "main"}, "main", "test", false},
+		{"default branch", db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main"}, "main", "test", true},
+		{"other branch", db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main"}, "feature/x", "test", false},
+		{"branch pattern", db.Project{Enabled: true, PipelineAnalysis: true, PipelineBranches: []string{"release/*"}}, "release/1.2", "test", true},
+		{"pattern replaces default branch", db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main", PipelineBranches: []string{"release/*"}}, "main", "test", false},
+		{"job pattern", db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main", PipelineJobs: []string{"test:*"}}, "main", "test:unit", true},
+		{"job not listed", db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main", PipelineJobs: []string{"test:*"}}, "main", "deploy", false},
+	}
+	for _, tt := range tests {
+		store := dbmock.New()
+		project := tt.project
+		_ = store.CreateProject(context.Background(), &project)
+		a := &Analyzer{database: store, logger: slog.Default()}
+		if _, got := a.acceptFailedJob(context.Background(), failedJobMessage(project.ID, tt.ref, tt.job)); got != tt.want {
+			t.Errorf("%s: acceptFailedJob() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClaimFailedJob_NoCooldown(t *testing.T) {
+	store := dbmock.New()
+	project := &db.Project{Enabled: true, PipelineAnalysis: true, DefaultBranch: "main"}
+	_ = store.CreateProject(context.Background(), project)
+	a := &Analyzer{database: store, logger: slog.Default()}
+	for i := 0; i < 2; i++ {
+		if !a.claimFailedJob(context.Background(), failedJobMessage(project.ID, "main", "test"), 0) {
+			t.Fatalf("attempt %d rejected without a cooldown", i+1)
+		}
+	}
+}
+
+func TestHandleMessage_FailedJobRedeliveryKeepsCooldown(t *testing.T) {
+	store := dbmock.New()
+	project := &db.Project{Name: "p", DefaultBranch: "main", Enabled: true, PipelineAnalysis: true, PipelineCooldownMinutes: 60}
+	_ = store.CreateProject(context.Background(), project)
+	a := &Analyzer{database: store, logger: slog.Default()}
+	msg := func(jobID string) *provider.IncomingMessage {
+		m := failedJobMessage(project.ID, "main", "unit-tests")
+		m.ProviderCfgID = "cfg-1"
+		m.Delivery = &provider.Delivery{ID: "job/" + jobID, Event: "Job Hook"}
+		return m
+	}
+	key := project.ID + "/main/unit-tests"
+
+	if task, outcome := a.handleMessage(context.Background(), msg("99")); task == nil || outcome != db.WebhookTaskCreated {
+		t.Fatalf("first report: task=%v outcome=%s", task, outcome)
+	}
+	// The cooldown has run out when the Pipeline Hook reports the same job.
+	expired := time.Now().Add(-2 * time.Hour)
+	store.PipelineAnalyses[key] = expired
+	if task, outcome := a.handleMessage(context.Background(), msg("99")); task != nil || outcome != db.WebhookDuplicate {
+		t.Fatalf("second report: task=%v outcome=%s, want a duplicate", task, outcome)
+	}
+	if !store.PipelineAnalyses[key].Equal(expired) {
+		t.Fatal("a duplicate report claimed the cooldown")
+	}
+	if task := a.HandleMessage(context.Background(), msg("100")); task == nil {
+		t.Fatal("expected a retried job to be analyzed")
+	}
+}
+
+func TestHandleMessage_FailedJobTaskFailureReleasesCooldown(t *testing.T) {
+	store := dbmock.New()
+	project := &db.Project{Name: "p", DefaultBranch: "main", Enabled: true, PipelineAnalysis: true, PipelineCooldownMinutes: 60}
+	_ = store.CreateProject(context.Background(), project)
+	msg := func() *provider.IncomingMessage {
+		m := failedJobMessage(project.ID, "main", "unit-tests")
+		m.ProviderCfgID = "cfg-1"
+		m.Delivery = &provider.Delivery{ID: "job/99", Event: "Job Hook"}
+		return m
+	}
+
+	a := &Analyzer{database: failingTasks{store}, logger: slog.Default()}
+	if task := a.HandleMessage(context.Background(), msg()); task != nil {
+		t.Fatalf("expected no task, got %+v", task)
+	}
+	if len(store.PipelineAnalyses) != 0 {
+		t.Fatalf("expected the cooldown to be released, got %v", store.PipelineAnalyses)
+	}
+
+	a.database = store
+	if task := a.HandleMessage(context.Background(), msg()); task == nil {
+		t.Fatal("expected the redelivery to queue a task")
+	}
+}
+
+func TestBuildPrompt_PipelineMode(t *testing.T) {
+	a := &Analyzer{database: dbmock.New(), logger: slog.Default()}
+	result := a.buildPrompt(context.Background(), failedJobMessage("p", "main", "test"), provider.ModePipeline)
+	if !strings.Contains(result, "A CI job failed") || !strings.Contains(result, "Job `test` failed on `main`.") {
+		t.Fatalf("pipeline prompt:\n%s", result)
+	}
+}
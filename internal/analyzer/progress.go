@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+const (
+	progressMaxSteps = 5
+	progressMaxText  = 300
+)
+
+// progressReporter turns the events of a running OpenCode session into the
+// task's event log and, when the provider can edit replies, into periodic
+// updates of the acknowledgement message. Updates are throttled by the
+// <provider>_progress_interval setting (falling back to
+// analyzer_progress_interval) to stay within each channel's rate limits.
+//
+// handle is only ever called from the single event stream goroutine, so the
+// reporter needs no locking.
+type progressReporter struct {
+	a    *Analyzer
+	ctx  context.Context
+	task *db.Task
+	msg  *provider.IncomingMessage
+	cfg  map[string]any
+
+	editor   provider.ReplyEditor
+	ack      *provider.MessageRef
+	header   string
+	interval time.Duration
+	lastEdit time.Time
+
+	steps   []progressStep
+	text    string
+	textLog bool
+}
+
+type progressStep struct {
+	partID string
+	line   string
+	status string
+}
+
+func (a *Analyzer) newProgressReporter(ctx context.Context, p provider.Provider, cfg map[string]any, task *db.Task, msg *provider.IncomingMessage, ack *provider.MessageRef, header string) *progressReporter {
+	r := &progressReporter{a: a, ctx: ctx, task: task, msg: msg, cfg: cfg, ack: ack, header: header}
+	if editor, ok := p.(provider.ReplyEditor); ok && ack != nil {
+		r.editor = editor
+		fallback := a.database.GetSettingDuration(ctx, "analyzer_progress_interval", 10*time.Second)
+		r.interval = a.database.GetSettingDuration(ctx, string(msg.Provider)+"_progress_interval", fallback)
+		// The ack itself was just posted; count it as the first update.
+		r.lastEdit = time.Now()
+	}
+	return r
+}
+
+func (r *progressReporter) handle(ev ProgressEvent) {
+	switch ev.Kind {
+	case "tool":
+		if !r.trackTool(ev) {
+			return
+		}
+	case "text":
+		r.text = ev.Text
+		if !r.textLog {
+			r.textLog = true
+			r.log("text", "writing response")
+		}
+	default:
+		return
+	}
+	r.maybeUpdate()
+}
+
+// trackTool records a tool call state change and reports whether anything
+// visible changed. Pending states and repeated updates are ignored.
+func (r *progressReporter) trackTool(ev ProgressEvent) bool {
+	if ev.Status != "running" && ev.Status != "completed" && ev.Status != "error" {
+		return false
+	}
+	desc := ev.Tool
+	if ev.Title != "" {
+		desc += " " + ev.Title
+	}
+
+	for i := range r.steps {
+		if r.steps[i].partID == ev.PartID {
+			if r.steps[i].status == ev.Status {
+				return false
+			}
+			r.steps[i].status = ev.Status
+			r.steps[i].line = desc
+			r.log("tool", fmt.Sprintf("%s: %s", desc, ev.Status))
+			return true
+		}
+	}
+	r.steps = append(r.steps, progressStep{partID: ev.PartID, line: desc, status: ev.Status})
+	r.log("tool", fmt.Sprintf("%s: %s", desc, ev.Status))
+	return true
+}
+
+func (r *progressReporter) log(kind, message string) {
+	r.a.logEvent(r.ctx, r.task, kind, message)
+}
+
+func (r *progressReporter) maybeUpdate() {
+	if r.editor == nil || r.interval <= 0 || time.Since(r.lastEdit) < r.interval {
+		return
+	}
+	r.lastEdit = time.Now()
+	if err := r.editor.EditReply(r.ctx, r.cfg, r.msg, *r.ack, r.render()); err != nil {
+		r.a.logger.Warn("progress update failed", "task_id", r.task.ID, "error", err)
+	}
+}
+
+// render builds the ack body followed by the most recent tool calls and the
+// tail of the response being written.
+func (r *progressReporter) render() string {
+	var sb strings.Builder
+	sb.WriteString(r.header)
+
+	steps := r.steps
+	if len(steps) > progressMaxSteps {
+		sb.WriteString(fmt.Sprintf("\n\n_… %d earlier steps_", len(steps)-progressMaxSteps))
+		steps = steps[len(steps)-progressMaxSteps:]
+	} else if len(steps) > 0 {
+		sb.WriteString("\n")
+	}
+	for _, s := range steps {
+		icon := "⏳"
+		switch s.status {
+		case "completed":
+			icon = "✅"
+		case "error":
+			icon = "❌"
+		}
+		sb.WriteString(fmt.Sprintf("\n%s `%s`", icon, s.line))
+	}
+
+	if text := strings.TrimSpace(r.text); text != "" {
+		if runes := []rune(text); len(runes) > progressMaxText {
+			text = "…" + string(runes[len(runes)-progressMaxText:])
+		}
+		sb.WriteString("\n\n> " + strings.ReplaceAll(text, "\n", "\n> "))
+	}
+	return sb.String()
+}
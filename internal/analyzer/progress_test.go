@@ -0,0 +1,125 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+func TestProgressReporter_LogsAndEditsAck(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
+	ep := &editingProvider{}
+	task := &db.Task{ID: "t1"}
+	msg := &provider.IncomingMessage{Provider: provider.ProviderGitLab}
+
+	r := a.newProgressReporter(context.Background(), ep, nil, task, msg, &provider.MessageRef{ID: "note-1"}, "Analyzing...")
+	if r.interval != 10*time.Second {
+		t.Fatalf("interval = %v, want default 10s", r.interval)
+	}
+
+	// Within the interval: logged but not pushed to the chat.
+	r.handle(ProgressEvent{PartID: "p1", Kind: "tool", Tool: "read", Status: "running", Title: "main.go"})
+	if len(ep.edits) != 0 {
+		t.Fatalf("expected no edit within the interval, got %v", ep.edits)
+	}
+
+	r.lastEdit = time.Time{}
+	r.handle(ProgressEvent{PartID: "p1", Kind: "tool", Tool: "read", Status: "completed", Title: "main.go"})
+	if len(ep.edits) != 1 || !strings.Contains(ep.edits[0], "✅ `read main.go`") {
+		t.Fatalf("expected ack edited with the completed step, got %v", ep.edits)
+	}
+
+	// Repeated state and pending tools are ignored entirely.
+	r.lastEdit = time.Time{}
+	r.handle(ProgressEvent{PartID: "p1", Kind: "tool", Tool: "read", Status: "completed", Title: "main.go"})
+	r.handle(ProgressEvent{PartID: "p2", Kind: "tool", Tool: "grep", Status: "pending"})
+	if len(ep.edits) != 1 {
+		t.Fatalf("expected no further edits, got %v", ep.edits)
+	}
+
+	r.handle(ProgressEvent{PartID: "p3", Kind: "text", Text: "The bug is in"})
+	r.handle(ProgressEvent{PartID: "p3", Kind: "text", Text: "The bug is in the parser"})
+	if last := ep.edits[len(ep.edits)-1]; !strings.Contains(last, "> The bug is in") {
+		t.Fatalf("expected partial text in the ack, got %q", last)
+	}
+
+	events, _ := store.ListTaskEvents(context.Background(), "t1")
+	var logged []string
+	for _, e := range events {
+		logged = append(logged, e.Kind+":"+e.Message)
+	}
+	want := []string{"tool:read main.go: running", "tool:read main.go: completed", "text:writing response"}
+	if strings.Join(logged, "|") != strings.Join(want, "|") {
+		t.Fatalf("event log = %v, want %v", logged, want)
+	}
+}
+
+func TestProgressReporter_RenderTruncates(t *testing.T) {
+	r := &progressReporter{header: "H"}
+	for i := 0; i < progressMaxSteps+2; i++ {
+		r.steps = append(r.steps, progressStep{partID: fmt.Sprint(i), line: fmt.Sprintf("step%d", i), status: "completed"})
+	}
+	r.text = strings.Repeat("x", progressMaxText+50)
+
+	out := r.render()
+	if !strings.Contains(out, "2 earlier steps") || strings.Contains(out, "`step1`") || !strings.Contains(out, "`step6`") {
+		t.Fatalf("steps not truncated: %q", out)
+	}
+	if !strings.Contains(out, "> …"+strings.Repeat("x", progressMaxText)) {
+		t.Fatalf("text not truncated to its tail: %q", out)
+	}
+}
+
+func TestProgressReporter_NoEditorOnlyLogs(t *testing.T) {
+	store := dbmock.New()
+	a := &Analyzer{database: store, logger: slog.Default()}
+	r := a.newProgressReporter(context.Background(), &fakeProvider{}, nil, &db.Task{ID: "t1"},
+		&provider.IncomingMessage{Provider: provider.ProviderGitLab}, &provider.MessageRef{ID: "n"}, "H")
+
+	r.handle(ProgressEvent{PartID: "p1", Kind: "tool", Tool: "bash", Status: "running", Title: "go test"})
+	if r.editor != nil {
+		t.Fatal("expected no editor for a provider without EditReply")
+	}
+	if events, _ := store.ListTaskEvents(context.Background(), "t1"); len(events) != 1 {
+		t.Fatalf("expected 1 logged event, got %d", len(events))
+	}
+}
+
+func TestProcessTask_StreamsProgressIntoEventLog(t *testing.T) {
+	eventsSent := make(chan struct{})
+	answer := answering("done", func(*http.Request) {
+		<-eventsSent
+		// Give the stream goroutine a moment to handle the event.
+		time.Sleep(50 * time.Millisecond)
+	})
+	h := newHarness(t, &fakeProvider{}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/event" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, `data: {"type":"message.part.updated","properties":{"part":{"id":"p1","sessionID":"sess-1","type":"tool","tool":"read","state":{"status":"completed","title":"db.go"}}}}`+"\n\n")
+			w.(http.Flusher).Flush()
+			close(eventsSent)
+			<-r.Context().Done()
+			return
+		}
+		answer(w, r)
+	})
+	store := h.store
+	claimed := h.run(&db.Task{TriggerMode: "ask"})
+
+	events, _ := store.ListTaskEvents(context.Background(), claimed.ID)
+	if len(events) != 1 || events[0].Message != "read db.go: completed" {
+		t.Fatalf("unexpected event log: %+v", events)
+	}
+	if got, _ := store.GetTask(context.Background(), claimed.ID); got.Status != db.TaskStatusCompleted {
+		t.Fatalf("status = %s, want completed", got.Status)
+	}
+}
@@ -0,0 +1,157 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
+)
+
+// reviewFormat is the output contract of review mode; parseReview depends on
+// it, so unlike the mode prompt it is not a setting.
+const reviewFormat = "Answer with a single JSON object in a ```json code block and nothing else:\n" +
+	"```json\n" +
+	`{"summary": "<overall assessment, Markdown>", "findings": [{"file": "<path in the new version>", "line": <line in the new version>, "severity": "critical|warning|suggestion", "comment": "<Markdown>"}]}` + "\n" +
+	"```\n" +
+	`Only report lines that appear in the diff below. For a comment on a removed line, give "old_line" (the line in the old version) instead of "line". Use an empty findings list if there is nothing to report.`
+
+// review is OpenCode's answer in review mode.
+type review struct {
+	Summary  string          `json:"summary"`
+	Findings []reviewFinding `json:"findings"`
+}
+
+type reviewFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	OldLine  int    `json:"old_line"`
+	Severity string `json:"severity"`
+	Comment  string `json:"comment"`
+}
+
+// runReview reviews the merge request msg was posted on: it hands OpenCode
+// the merge request's diff, asks for findings in the reviewFormat contract and
+// posts each finding as a discussion on its line. The returned summary, which
+// becomes the task's result, counts the posted comments and lists findings
+// that could not be placed on the diff. If the answer does not follow the
+// contract, it is returned as is.
+func (a *Analyzer) runReview(ctx context.Context, task *db.Task, msg *provider.IncomingMessage, ws *workspace.Workspace, prompt string, files []MessagePart, onProgress func(ProgressEvent)) (string, error) {
+	p, cfg, ok := a.providerFor(ctx, msg)
+	if !ok {
+		return "", fmt.Errorf("provider %s is not available", msg.Provider)
+	}
+	reviewer, ok := p.(provider.MergeRequestReviewer)
+	if !ok {
+		return "", fmt.Errorf("review mode is not supported on %s", msg.Provider)
+	}
+	diff, err := reviewer.ReviewDiff(ctx, cfg, msg)
+	if errors.Is(err, provider.ErrNotMergeRequest) {
+		return "", errors.New("review mode only works in merge request comments")
+	}
+	if err != nil {
+		return "", fmt.Errorf("get merge request diff: %w", err)
+	}
+	if strings.TrimSpace(diff.Diff) == "" {
+		return "The merge request has no changes to review.", nil
+	}
+
+	diffText := diff.Diff
+	if limit := a.database.GetSettingInt(ctx, "review_max_diff_bytes", 200000); limit > 0 && len(diffText) > limit {
+		diffText = strings.ToValidUTF8(diffText[:limit], "") + "\n[diff truncated]"
+	}
+	prompt += "\n\n" + reviewFormat + "\n\n## Diff\n```diff\n" + diffText + "\n```"
+
+	answer, err := a.runOpencodeHTTP(ctx, task, ws, prompt, files, onProgress, nil)
+	if err != nil {
+		return "", err
+	}
+	rv, err := parseReview(answer)
+	if err != nil {
+		a.logger.Warn("review answer is not in the expected format", "task_id", task.ID, "error", err)
+		return answer, nil
+	}
+
+	posted := 0
+	var unplaced []reviewFinding
+	for _, f := range rv.Findings {
+		c := provider.ReviewComment{Path: f.File, Line: f.Line, OldLine: f.OldLine, Body: findingBody(f)}
+		if _, _, _, ok := diff.Locate(c); !ok {
+			unplaced = append(unplaced, f)
+			continue
+		}
+		ref, err := reviewer.PostReviewComment(ctx, cfg, msg, diff, c)
+		if err != nil {
+			a.logger.Warn("post review comment failed", "task_id", task.ID, "file", f.File, "line", f.Line, "error", err)
+			unplaced = append(unplaced, f)
+			continue
+		}
+		posted++
+		a.recordMessage(ctx, task, db.MessageOutbound, db.MessageKindReviewComment, ref)
+	}
+	a.logEvent(ctx, task, "review", fmt.Sprintf("%d finding(s), %d posted inline", len(rv.Findings), posted))
+
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSpace(rv.Summary))
+	switch {
+	case len(rv.Findings) == 0:
+		sb.WriteString("\n\nNo issues found.")
+	case posted > 0:
+		fmt.Fprintf(&sb, "\n\n**%d inline comment(s)** posted on the diff.", posted)
+	}
+	if len(unplaced) > 0 {
+		sb.WriteString("\n\n**Other findings:**\n")
+		for _, f := range unplaced {
+			line := f.Line
+			if line == 0 {
+				line = f.OldLine
+			}
+			fmt.Fprintf(&sb, "- `%s:%d` %s\n", f.File, line, findingBody(f))
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// parseReview extracts the review from OpenCode's answer: the last ```json
+// block, or the outermost braces if there is none.
+func parseReview(answer string) (*review, error) {
+	text := answer
+	if i := strings.LastIndex(answer, "```json"); i >= 0 {
+		text = answer[i+len("```json"):]
+		if j := strings.Index(text, "```"); j >= 0 {
+			text = text[:j]
+		}
+	} else if i, j := strings.Index(answer, "{"), strings.LastIndex(answer, "}"); i >= 0 && j > i {
+		text = answer[i : j+1]
+	}
+	var rv review
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &rv); err != nil {
+		return nil, err
+	}
+	if rv.Summary == "" && rv.Findings == nil {
+		return nil, errors.New("no summary or findings")
+	}
+	return &rv, nil
+}
+
+var severityIcons = map[string]string{
+	"critical":   "🔴",
+	"warning":    "🟠",
+	"suggestion": "💡",
+}
+
+func findingBody(f reviewFinding) string {
+	sev := strings.ToLower(strings.TrimSpace(f.Severity))
+	if sev == "" {
+		return f.Comment
+	}
+	icon := severityIcons[sev]
+	if icon == "" {
+		icon = "•"
+	}
+	return fmt.Sprintf("%s **%s**: %s", icon, sev, f.Comment)
+}
@@ -0,0 +1,124 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+type reviewProvider struct {
+	fakeProvider
+	diff     string
+	diffErr  error
+	comments []provider.ReviewComment
+}
+
+func (r *reviewProvider) ReviewDiff(_ context.Context, _ map[string]any, _ *provider.IncomingMessage) (*provider.ReviewDiff, error) {
+	if r.diffErr != nil {
+		return nil, r.diffErr
+	}
+	return &provider.ReviewDiff{Diff: r.diff}, nil
+}
+
+func (r *reviewProvider) PostReviewComment(_ context.Context, _ map[string]any, _ *provider.IncomingMessage, _ *provider.ReviewDiff, c provider.ReviewComment) (*provider.MessageRef, error) {
+	r.comments = append(r.comments, c)
+	return &provider.MessageRef{ID: strconv.Itoa(len(r.comments)), Channel: "d"}, nil
+}
+
+// runReviewTask runs a "review" task whose OpenCode session answers with
+// answer, and returns the stored task and the prompt OpenCode received.
+func runReviewTask(t *testing.T, rp *reviewProvider, answer string) (*dbmock.Store, *db.Task, string) {
+	t.Helper()
+	var prompt string
+	h := newHarness(t, rp, answering(answer, func(r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		prompt = string(body)
+	}))
+	task := h.run(&db.Task{
+		TriggerMode: "review", TriggerKeyword: "@review",
+		MessageBody: "@review", ExternalRef: "https://gitlab.example.com/g/p/-/merge_requests/7#note_1",
+	})
+	return h.store, task, prompt
+}
+
+const reviewTestDiff = "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,3 @@\n package main\n+var x = 1\n func main() {}\n"
+
+func TestReviewMode_PostsInlineComments(t *testing.T) {
+	rp := &reviewProvider{diff: reviewTestDiff}
+	answer := "Looks fine overall.\n```json\n" + `{"summary": "One issue.", "findings": [` +
+		`{"file": "main.go", "line": 2, "severity": "warning", "comment": "Unused variable."},` +
+		`{"file": "other.go", "line": 9, "severity": "suggestion", "comment": "Add a test."}]}` + "\n```"
+	store, task, prompt := runReviewTask(t, rp, answer)
+
+	if task.Status != db.TaskStatusCompleted {
+		t.Fatalf("status = %s, error = %v", task.Status, task.ErrorMessage)
+	}
+	if !strings.Contains(prompt, "+var x = 1") || !strings.Contains(prompt, `\"findings\"`) {
+		t.Errorf("prompt lacks the diff or the output format:\n%s", prompt)
+	}
+	if len(rp.comments) != 1 {
+		t.Fatalf("comments = %+v", rp.comments)
+	}
+	if c := rp.comments[0]; c.Path != "main.go" || c.Line != 2 || c.Body != "🟠 **warning**: Unused variable." {
+		t.Errorf("comment = %+v", c)
+	}
+
+	reply := rp.replies[len(rp.replies)-1]
+	for _, want := range []string{"One issue.", "**1 inline comment(s)**", "`other.go:9` 💡 **suggestion**: Add a test."} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply missing %q:\n%s", want, reply)
+		}
+	}
+
+	msgs, _ := store.ListTaskMessages(context.Background(), task.ID)
+	n := 0
+	for _, m := range msgs {
+		if m.Kind == db.MessageKindReviewComment {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("recorded %d review comments, want 1", n)
+	}
+}
+
+func TestReviewMode_UnparsableAnswer(t *testing.T) {
+	rp := &reviewProvider{diff: reviewTestDiff}
+	_, task, _ := runReviewTask(t, rp, "The change looks good to me.")
+
+	if task.Status != db.TaskStatusCompleted || len(rp.comments) != 0 {
+		t.Fatalf("status = %s, comments = %d", task.Status, len(rp.comments))
+	}
+	if reply := rp.replies[len(rp.replies)-1]; !strings.Contains(reply, "The change looks good to me.") {
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestReviewMode_NotMergeRequest(t *testing.T) {
+	rp := &reviewProvider{diffErr: provider.ErrNotMergeRequest}
+	_, task, _ := runReviewTask(t, rp, "")
+
+	if task.Status != db.TaskStatusFailed || task.ErrorMessage == nil || !strings.Contains(*task.ErrorMessage, "merge request comments") {
+		t.Fatalf("status = %s, error = %v", task.Status, task.ErrorMessage)
+	}
+}
+
+func TestParseReview(t *testing.T) {
+	rv, err := parseReview(`Here you go: {"summary": "ok", "findings": [{"file": "a.go", "old_line": 3, "comment": "x"}]}`)
+	if err != nil || rv.Summary != "ok" || len(rv.Findings) != 1 || rv.Findings[0].OldLine != 3 {
+		t.Fatalf("parseReview() = %+v, %v", rv, err)
+	}
+	if _, err := parseReview("no json here"); err == nil {
+		t.Fatal("expected an error without JSON")
+	}
+	if _, err := parseReview(`{"other": 1}`); err == nil {
+		t.Fatal("expected an error without summary or findings")
+	}
+}
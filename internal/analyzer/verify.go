@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
+)
+
+// maxVerifyReplyLog caps the failure output quoted in the reply; the task
+// keeps the full (verify_output_limit) log.
+const maxVerifyReplyLog = 3000
+
+// verifyChanges runs the project's verification commands in a "do" task's
+// worktree once OpenCode has answered with result. While they fail and fix-up
+// rounds (verify_fix_rounds) remain, the failure is sent back to the session
+// through send and the commands run again. The outcome is stored on the task
+// and appended to the returned result, which also includes OpenCode's answers
+// to the fix-up prompts. Nothing runs if the project has no commands or
+// OpenCode changed no files.
+func (a *Analyzer) verifyChanges(ctx context.Context, task *db.Task, ws *workspace.Workspace, result string, send func(prompt string) (string, error)) (string, error) {
+	commands := ws.Project.VerifyCommands
+	if len(commands) == 0 {
+		return result, nil
+	}
+	if changed, err := ws.Changed(ctx); err != nil || !changed {
+		return result, err
+	}
+
+	timeout := a.database.GetSettingDuration(ctx, "verify_timeout", 10*time.Minute)
+	limit := a.database.GetSettingInt(ctx, "verify_output_limit", 20000)
+	maxRounds := a.database.GetSettingInt(ctx, "verify_fix_rounds", 0)
+
+	var checks []workspace.CheckResult
+	for round := 0; ; round++ {
+		var err error
+		checks, err = ws.Verify(ctx, commands, timeout, limit)
+		if err != nil {
+			return "", fmt.Errorf("verify changes: %w", err)
+		}
+		failed := failedCheck(checks)
+		if failed == nil {
+			a.logEvent(ctx, task, "verify", fmt.Sprintf("passed (%d command(s))", len(checks)))
+			break
+		}
+		a.logEvent(ctx, task, "verify", fmt.Sprintf("`%s` failed (%s)", failed.Command, checkOutcome(failed)))
+		if round >= maxRounds {
+			break
+		}
+
+		tpl := a.database.GetSettingString(ctx, "prompt_verify_fix",
+			"The verification command `%s` failed after your changes:\n```\n%s\n```\nFix the problem by editing the files in your working directory. Do not commit. Finish with a short summary of what you changed.")
+		fix, err := send(fmt.Sprintf(tpl, failed.Command, failed.Output))
+		if err != nil {
+			return "", fmt.Errorf("send fix-up message: %w", err)
+		}
+		a.logEvent(ctx, task, "verify", fmt.Sprintf("fix-up round %d", round+1))
+		result += fmt.Sprintf("\n\n**Fix-up round %d:**\n%s", round+1, fix)
+	}
+
+	status := db.VerifyPassed
+	if failedCheck(checks) != nil {
+		status = db.VerifyFailed
+	}
+	if err := a.database.UpdateTaskVerification(ctx, task.ID, status, verifyLog(checks)); err != nil {
+		a.logger.Warn("record verification failed", "task_id", task.ID, "error", err)
+	}
+	task.VerifyStatus = status
+	return result + "\n\n" + verifyReport(checks), nil
+}
+
+func failedCheck(checks []workspace.CheckResult) *workspace.CheckResult {
+	for i := range checks {
+		if !checks[i].Passed {
+			return &checks[i]
+		}
+	}
+	return nil
+}
+
+func checkOutcome(c *workspace.CheckResult) string {
+	switch {
+	case c.Passed:
+		return fmt.Sprintf("ok in %s", c.Duration)
+	case c.TimedOut:
+		return fmt.Sprintf("timed out after %s", c.Duration)
+	default:
+		return fmt.Sprintf("exit code %d after %s", c.ExitCode, c.Duration)
+	}
+}
+
+// verifyLog formats the checks of the last verification run for the task.
+func verifyLog(checks []workspace.CheckResult) string {
+	var sb strings.Builder
+	for i := range checks {
+		c := &checks[i]
+		fmt.Fprintf(&sb, "$ %s\n", c.Command)
+		if c.Truncated {
+			sb.WriteString("[output truncated]\n")
+		}
+		sb.WriteString(c.Output)
+		if c.Output != "" && !strings.HasSuffix(c.Output, "\n") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "[%s]\n\n", checkOutcome(c))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// verifyReport summarizes the checks for the reply, quoting the end of the
+// failed command's output.
+func verifyReport(checks []workspace.CheckResult) string {
+	failed := failedCheck(checks)
+	if failed == nil {
+		cmds := make([]string, len(checks))
+		for i, c := range checks {
+			cmds[i] = "`" + c.Command + "`"
+		}
+		return "**Verification:** ✅ passed (" + strings.Join(cmds, ", ") + ")"
+	}
+	out := strings.TrimRight(failed.Output, "\n")
+	if r := []rune(out); len(r) > maxVerifyReplyLog {
+		out = "…" + string(r[len(r)-maxVerifyReplyLog+1:])
+	}
+	return fmt.Sprintf("**Verification:** ❌ `%s` failed (%s)\n```\n%s\n```", failed.Command, checkOutcome(failed), out)
+}
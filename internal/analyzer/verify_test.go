@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+)
+
+func TestDoMode_VerificationPasses(t *testing.T) {
+	mp := &mrProvider{}
+	_, task, remote := runDoTask(t, mp, func(_ *dbmock.Store, p *db.Project) {
+		p.VerifyCommands = []string{"test -f parser.go", "echo built > out.bin"}
+	}, func(dir string) {
+		_ = os.WriteFile(filepath.Join(dir, "parser.go"), []byte("package parser\n"), 0o644)
+	})
+
+	if task.Status != db.TaskStatusCompleted || task.VerifyStatus != db.VerifyPassed {
+		t.Fatalf("status = %s, verify = %q, log = %q", task.Status, task.VerifyStatus, task.VerifyLog)
+	}
+	if !strings.Contains(task.VerifyLog, "$ echo built > out.bin") {
+		t.Fatalf("verify log = %q", task.VerifyLog)
+	}
+	reply := mp.replies[len(mp.replies)-1]
+	if !strings.Contains(reply, "✅ passed (`test -f parser.go`, `echo built > out.bin`)") {
+		t.Fatalf("reply = %q", reply)
+	}
+
+	// Files left behind by the commands are not published.
+	out, err := exec.Command("git", "-C", remote, "show", "--name-only", "--format=", "opencode/task-"+shortID(task.ID)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "parser.go" {
+		t.Fatalf("pushed files = %q", got)
+	}
+}
+
+func TestDoMode_VerificationFailsWithoutFixRounds(t *testing.T) {
+	mp := &mrProvider{}
+	_, task, _ := runDoTask(t, mp, func(_ *dbmock.Store, p *db.Project) {
+		p.VerifyCommands = []string{"echo compile error: x undefined; exit 2", "echo never"}
+	}, func(dir string) {
+		_ = os.WriteFile(filepath.Join(dir, "x.go"), []byte("package x\n"), 0o644)
+	})
+
+	if task.Status != db.TaskStatusCompleted || task.VerifyStatus != db.VerifyFailed {
+		t.Fatalf("status = %s, verify = %q", task.Status, task.VerifyStatus)
+	}
+	if strings.Contains(task.VerifyLog, "never") {
+		t.Fatalf("commands after the failure ran: %q", task.VerifyLog)
+	}
+	if len(mp.requests) != 1 || !strings.Contains(mp.requests[0].Description, "❌") {
+		t.Fatalf("merge request should still be opened and mention the failure: %+v", mp.requests)
+	}
+	reply := mp.replies[len(mp.replies)-1]
+	for _, want := range []string{"❌ `echo compile error: x undefined; exit 2` failed (exit code 2", "compile error: x undefined"} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply missing %q:\n%s", want, reply)
+		}
+	}
+}
+
+func TestDoMode_VerificationFixRound(t *testing.T) {
+	mp := &mrProvider{}
+	calls := 0
+	_, task, _ := runDoTask(t, mp, func(store *dbmock.Store, p *db.Project) {
+		p.VerifyCommands = []string{"grep -q fixed x.go"}
+		_ = store.SetSetting(context.Background(), "verify_fix_rounds", json.RawMessage(`2`))
+	}, func(dir string) {
+		calls++
+		content := "package x\n"
+		if calls > 1 {
+			content += "// fixed\n"
+		}
+		_ = os.WriteFile(filepath.Join(dir, "x.go"), []byte(content), 0o644)
+	})
+
+	if calls != 2 {
+		t.Fatalf("expected one fix-up message, got %d messages", calls)
+	}
+	if task.VerifyStatus != db.VerifyPassed {
+		t.Fatalf("verify = %q, log = %q", task.VerifyStatus, task.VerifyLog)
+	}
+	reply := mp.replies[len(mp.replies)-1]
+	if !strings.Contains(reply, "**Fix-up round 1:**") || !strings.Contains(reply, "✅ passed") {
+		t.Fatalf("reply = %q", reply)
+	}
+}
+
+func TestDoMode_NoVerificationCommands(t *testing.T) {
+	mp := &mrProvider{}
+	_, task, _ := runDoTask(t, mp, nil, func(dir string) {
+		_ = os.WriteFile(filepath.Join(dir, "x.go"), []byte("package x\n"), 0o644)
+	})
+	if task.VerifyStatus != "" || strings.Contains(mp.replies[len(mp.replies)-1], "Verification") {
+		t.Fatalf("verification ran without commands: %q", task.VerifyStatus)
+	}
+}
@@ -0,0 +1,273 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook delivery not found")
+	ErrWebhookNotReplayable = errors.New("webhook delivery cannot be replayed")
+)
+
+// redactedHeaders are the headers that carry a webhook's secret or
+// signature. They are recorded as redacted; a replay is authenticated again
+// by the provider (see provider.WebhookSigner).
+var redactedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"X-Gitlab-Token",
+	"X-Slack-Signature",
+	"X-Telegram-Bot-Api-Secret-Token",
+}
+
+const redacted = "[redacted]"
+
+// inboundWebhookKey is the context key of the ID of the inbound webhook a
+// request, and the messages parsed from it, belong to.
+type inboundWebhookKey struct{}
+
+// replayKey is the context key of the *replay a request is serving.
+type replayKey struct{}
+
+type replay struct {
+	// of is the ID of the webhook replayed, id that of its replay.
+	of, id string
+}
+
+// WebhookHandler returns the handler of pc's webhook route: the provider's
+// handler, routing the messages it parses to HandleMessage, with every
+// request recorded as an inbound webhook.
+func (a *Analyzer) WebhookHandler(pc *db.ProviderConfig) (http.Handler, error) {
+	p, ok := a.registry.Get(provider.ProviderType(pc.ProviderType))
+	if !ok {
+		return nil, fmt.Errorf("unknown provider type: %s", pc.ProviderType)
+	}
+	handler := p.BuildHandler(pc.ID, pc.WebhookSecret, pc.ConfigMap(), func(ctx context.Context, msg *provider.IncomingMessage) {
+		msg.ProjectID = pc.ProjectID
+		msg.ProviderCfgID = pc.ID
+		a.HandleMessage(ctx, msg)
+	})
+	return a.recordWebhook(pc, handler), nil
+}
+
+// recordWebhook records every request next serves as an inbound webhook of
+// pc, with the status code next answers with. Providers hand the request
+// context on to HandleMessage, which records what came of each message. A
+// body larger than webhook_max_body is refused, and the body of a request
+// next rejects is not kept: it was not authenticated.
+func (a *Analyzer) recordWebhook(pc *db.ProviderConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		hook := &db.InboundWebhook{
+			ProviderConfigID: pc.ID,
+			ProviderType:     pc.ProviderType,
+			Method:           r.Method,
+			Path:             r.URL.RequestURI(),
+			Headers:          redactHeaders(r.Header),
+		}
+		rp, _ := ctx.Value(replayKey{}).(*replay)
+		if rp != nil {
+			hook.ReplayOf = &rp.of
+		}
+		if err := a.database.CreateInboundWebhook(ctx, hook); err != nil {
+			a.logger.Warn("record inbound webhook failed", "provider_cfg", pc.ID, "error", err)
+			hook = nil
+		} else if rp != nil {
+			rp.id = hook.ID
+		}
+
+		maxBody := int64(a.database.GetSettingInt(ctx, "webhook_max_body", 4<<20))
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.As(err, new(*http.MaxBytesError)) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, http.StatusText(status), status)
+			a.finishWebhook(ctx, hook, status, nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if hook == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(ctx, inboundWebhookKey{}, hook.ID)))
+		a.finishWebhook(ctx, hook, sw.status, body)
+	})
+}
+
+// finishWebhook records the status code hook was answered with and, unless
+// it was rejected, its body capped at webhook_log_max_body. hook is nil if it
+// could not be recorded.
+func (a *Analyzer) finishWebhook(ctx context.Context, hook *db.InboundWebhook, status int, body []byte) {
+	if hook == nil {
+		return
+	}
+	outcome := db.WebhookIgnored
+	if status >= http.StatusMultipleChoices {
+		outcome = db.WebhookRejected
+		body = nil
+	}
+	text, truncated := capBody(body, a.database.GetSettingInt(ctx, "webhook_log_max_body", 64<<10))
+	if err := a.database.FinishInboundWebhook(context.WithoutCancel(ctx), hook.ID, status, outcome, text, truncated); err != nil {
+		a.logger.Warn("record inbound webhook status failed", "id", hook.ID, "error", err)
+	}
+}
+
+// recordWebhookOutcome records what came of a message on the inbound
+// webhook it arrived in, if it arrived in one.
+func (a *Analyzer) recordWebhookOutcome(ctx context.Context, outcome string, task *db.Task) {
+	id, ok := ctx.Value(inboundWebhookKey{}).(string)
+	if !ok {
+		return
+	}
+	var taskID *string
+	if task != nil {
+		taskID = &task.ID
+	}
+	if err := a.database.SetInboundWebhookOutcome(ctx, id, outcome, taskID); err != nil {
+		a.logger.Warn("record inbound webhook outcome failed", "id", id, "outcome", outcome, "error", err)
+	}
+}
+
+// isReplay reports whether ctx belongs to a replayed webhook.
+func isReplay(ctx context.Context) bool {
+	return ctx.Value(replayKey{}) != nil
+}
+
+func redactHeaders(h http.Header) json.RawMessage {
+	h = h.Clone()
+	for _, k := range redactedHeaders {
+		if _, ok := h[k]; ok {
+			h[k] = []string{redacted}
+		}
+	}
+	return db.ToJSON(h)
+}
+
+// capBody returns body as text, cut to at most maxBytes bytes, and whether
+// it was cut.
+func capBody(body []byte, maxBytes int) (string, bool) {
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	if len(body) <= maxBytes {
+		return strings.ToValidUTF8(string(body), "\uFFFD"), false
+	}
+	return strings.ToValidUTF8(string(body[:maxBytes]), ""), true
+}
+
+// ReplayWebhook serves a recorded webhook again through the current handler
+// of its provider config, as if its sender had delivered it once more, and
+// returns the record of the replay. The redacted headers are restored by the
+// provider signing the request anew, and the replay is not skipped as a
+// redelivery even if the original queued a task. Messages are handled in the
+// background, so the replay's outcome may not be final yet.
+func (a *Analyzer) ReplayWebhook(ctx context.Context, id, by string) (*db.InboundWebhook, error) {
+	orig, err := a.database.GetInboundWebhook(ctx, id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+	if orig.Outcome == db.WebhookRejected {
+		return nil, fmt.Errorf("%w: it was rejected", ErrWebhookNotReplayable)
+	}
+	if orig.BodyTruncated {
+		return nil, fmt.Errorf("%w: its body was truncated", ErrWebhookNotReplayable)
+	}
+	pc, err := a.database.GetProviderConfig(ctx, orig.ProviderConfigID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: provider config not found", ErrWebhookNotReplayable)
+	}
+	handler, err := a.WebhookHandler(pc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookNotReplayable, err)
+	}
+
+	var header http.Header
+	if err := json.Unmarshal(orig.Headers, &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid headers: %v", ErrWebhookNotReplayable, err)
+	}
+	rp := &replay{of: orig.ID}
+	body := []byte(orig.Body)
+	req, err := http.NewRequestWithContext(context.WithValue(ctx, replayKey{}, rp), orig.Method, orig.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookNotReplayable, err)
+	}
+	for k, v := range header {
+		if len(v) == 1 && v[0] == redacted {
+			continue
+		}
+		req.Header[k] = v
+	}
+	if p, ok := a.registry.Get(provider.ProviderType(pc.ProviderType)); ok {
+		if signer, ok := p.(provider.WebhookSigner); ok {
+			signer.SignWebhook(req, pc.WebhookSecret, pc.ConfigMap(), body)
+		}
+	}
+
+	handler.ServeHTTP(&replayResponse{header: http.Header{}}, req)
+	if rp.id == "" {
+		return nil, errors.New("replay was not recorded")
+	}
+	a.logger.Info("webhook replayed", "id", orig.ID, "replay", rp.id, "by", by)
+	return a.database.GetInboundWebhook(ctx, rp.id)
+}
+
+// cleanupInboundWebhooks deletes the inbound webhooks older than
+// webhook_log_retention.
+func (a *Analyzer) cleanupInboundWebhooks(ctx context.Context) int64 {
+	retention := a.database.GetSettingDuration(ctx, "webhook_log_retention", 7*24*time.Hour)
+	n, err := a.database.DeleteInboundWebhooks(ctx, time.Now().Add(-retention))
+	if err != nil {
+		a.logger.Error("delete inbound webhooks failed", "error", err)
+		return 0
+	}
+	if n > 0 {
+		a.logger.Info("expired inbound webhooks", "count", n)
+	}
+	return n
+}
+
+// statusWriter records the status code a handler answers with.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// replayResponse discards the answer to a replayed webhook; recordWebhook
+// has recorded its status code by the time it is dropped.
+type replayResponse struct {
+	header http.Header
+}
+
+func (r *replayResponse) Header() http.Header         { return r.header }
+func (r *replayResponse) Write(b []byte) (int, error) { return len(b), nil }
+func (r *replayResponse) WriteHeader(int)             {}
@@ -0,0 +1,176 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
+)
+
+// newWebhookTest returns an analyzer with a Telegram provider config whose
+// secret is "secret" and whose project triggers on "@opencode".
+func newWebhookTest(t *testing.T, store *dbmock.Store) (*Analyzer, *db.ProviderConfig) {
+	t.Helper()
+	pc := &db.ProviderConfig{ProjectID: "proj-1", ProviderType: "telegram", WebhookSecret: "secret", WebhookPath: "/hook/tg", Config: json.RawMessage(`{}`)}
+	_ = store.CreateProviderConfig(context.Background(), pc)
+	_ = store.SetTriggerKeywords(context.Background(), "proj-1", []db.TriggerKeyword{{Keyword: "@opencode", Mode: "ask"}})
+	registry := provider.NewRegistry(slog.Default())
+	registry.Register(provider.NewTelegramProvider(store, slog.Default()))
+	return &Analyzer{database: store, registry: registry, logger: slog.Default()}, pc
+}
+
+func postUpdate(t *testing.T, h http.Handler, secret string, updateID int, text string) int {
+	t.Helper()
+	body := fmt.Sprintf(`{"update_id":%d,"message":{"message_id":%d,"from":{"id":1,"username":"alice"},"chat":{"id":7,"type":"group"},"text":%q}}`, updateID, updateID, text)
+	req := httptest.NewRequest(http.MethodPost, "/hook/tg", strings.NewReader(body))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+// waitOutcome waits for the messages of a webhook, handled in the
+// background, to settle its outcome.
+func waitOutcome(t *testing.T, store *dbmock.Store, id, want string) *db.InboundWebhook {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		hook, err := store.GetInboundWebhook(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetInboundWebhook(%s): %v", id, err)
+		}
+		if hook.Outcome == want {
+			return hook
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("webhook %s: outcome = %q, want %q", id, hook.Outcome, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookHandler_RecordsOutcomes(t *testing.T) {
+	store := dbmock.New()
+	a, pc := newWebhookTest(t, store)
+	h, err := a.WebhookHandler(pc)
+	if err != nil {
+		t.Fatalf("WebhookHandler: %v", err)
+	}
+
+	if code := postUpdate(t, h, "wrong", 1, "@opencode hi"); code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", code)
+	}
+	postUpdate(t, h, "secret", 2, "just chatting")
+	postUpdate(t, h, "secret", 3, "@opencode why?")
+
+	if len(store.InboundWebhooks) != 3 {
+		t.Fatalf("expected 3 recorded webhooks, got %d", len(store.InboundWebhooks))
+	}
+	rejected := waitOutcome(t, store, store.InboundWebhooks[0].ID, db.WebhookRejected)
+	if rejected.StatusCode != http.StatusForbidden || rejected.ProviderConfigID != pc.ID || rejected.Body != "" {
+		t.Fatalf("unexpected rejected webhook: %+v", rejected)
+	}
+	if strings.Contains(string(rejected.Headers), "wrong") || !strings.Contains(string(rejected.Headers), redacted) {
+		t.Fatalf("secret header not redacted: %s", rejected.Headers)
+	}
+	waitOutcome(t, store, store.InboundWebhooks[1].ID, db.WebhookNoKeyword)
+	created := waitOutcome(t, store, store.InboundWebhooks[2].ID, db.WebhookTaskCreated)
+	if created.TaskID == nil || len(store.Tasks) != 1 || *created.TaskID != store.Tasks[0].ID {
+		t.Fatalf("task not linked: %+v, tasks %d", created, len(store.Tasks))
+	}
+	if !strings.Contains(created.Body, "@opencode why?") {
+		t.Fatalf("body not recorded: %q", created.Body)
+	}
+	if _, err := a.ReplayWebhook(context.Background(), rejected.ID, "admin"); !errors.Is(err, ErrWebhookNotReplayable) {
+		t.Fatalf("replaying a rejected webhook: got %v, want ErrWebhookNotReplayable", err)
+	}
+}
+
+func TestWebhookHandler_RefusesLargeBody(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "webhook_max_body", json.RawMessage(`64`))
+	a, pc := newWebhookTest(t, store)
+	h, _ := a.WebhookHandler(pc)
+
+	if code := postUpdate(t, h, "secret", 1, "@opencode "+strings.Repeat("x", 64)); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want 413", code)
+	}
+	hook := waitOutcome(t, store, store.InboundWebhooks[0].ID, db.WebhookRejected)
+	if hook.StatusCode != http.StatusRequestEntityTooLarge || hook.Body != "" || len(store.Tasks) != 0 {
+		t.Fatalf("unexpected oversized webhook: %+v, tasks %d", hook, len(store.Tasks))
+	}
+}
+
+func TestWebhookHandler_CapsBody(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "webhook_log_max_body", json.RawMessage(`16`))
+	a, pc := newWebhookTest(t, store)
+	h, _ := a.WebhookHandler(pc)
+
+	postUpdate(t, h, "secret", 1, "@opencode why?")
+	hook := waitOutcome(t, store, store.InboundWebhooks[0].ID, db.WebhookTaskCreated)
+	if len(hook.Body) != 16 || !hook.BodyTruncated {
+		t.Fatalf("body not capped: %q truncated=%v", hook.Body, hook.BodyTruncated)
+	}
+	if _, err := a.ReplayWebhook(context.Background(), hook.ID, "admin"); !errors.Is(err, ErrWebhookNotReplayable) {
+		t.Fatalf("replaying a truncated webhook: got %v, want ErrWebhookNotReplayable", err)
+	}
+}
+
+func TestReplayWebhook(t *testing.T) {
+	store := dbmock.New()
+	a, pc := newWebhookTest(t, store)
+	h, _ := a.WebhookHandler(pc)
+
+	postUpdate(t, h, "secret", 1, "@opencode why?")
+	orig := waitOutcome(t, store, store.InboundWebhooks[0].ID, db.WebhookTaskCreated)
+
+	replayed, err := a.ReplayWebhook(context.Background(), orig.ID, "admin")
+	if err != nil {
+		t.Fatalf("ReplayWebhook: %v", err)
+	}
+	if replayed.ID == orig.ID || replayed.ReplayOf == nil || *replayed.ReplayOf != orig.ID || replayed.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected replay record: %+v", replayed)
+	}
+	// The redacted secret was restored, and the redelivered update was not
+	// skipped as a duplicate.
+	waitOutcome(t, store, replayed.ID, db.WebhookTaskCreated)
+	if len(store.Tasks) != 2 {
+		t.Fatalf("expected the replay to queue a second task, got %d", len(store.Tasks))
+	}
+
+	if _, err := a.ReplayWebhook(context.Background(), "missing", "admin"); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("replaying a missing webhook: got %v, want ErrWebhookNotFound", err)
+	}
+}
+
+func TestCapBody(t *testing.T) {
+	tests := []struct {
+		body      string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{"hello", 10, "hello", false},
+		{"hello", 5, "hello", false},
+		{"hello", 3, "hel", true},
+		{"héllo", 2, "h", true},
+		{"hello", -1, "", true},
+	}
+	for _, tt := range tests {
+		got, truncated := capBody([]byte(tt.body), tt.max)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("capBody(%q, %d) = %q, %v; want %q, %v", tt.body, tt.max, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
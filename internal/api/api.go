@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
 	"github.com/opencode-ai/opencode-dog/internal/auth"
 	"github.com/opencode-ai/opencode-dog/internal/db"
 	"github.com/opencode-ai/opencode-dog/internal/mcpmgr"
@@ -20,11 +21,12 @@ type API struct {
 	database db.Store
 	auth     *auth.Auth
 	mcpMgr   *mcpmgr.Manager
+	analyzer *analyzer.Analyzer
 	logger   *slog.Logger
 }
 
-func New(database db.Store, a *auth.Auth, mcpMgr *mcpmgr.Manager, logger *slog.Logger) *API {
-	return &API{database: database, auth: a, mcpMgr: mcpMgr, logger: logger}
+func New(database db.Store, a *auth.Auth, mcpMgr *mcpmgr.Manager, an *analyzer.Analyzer, logger *slog.Logger) *API {
+	return &API{database: database, auth: a, mcpMgr: mcpMgr, analyzer: an, logger: logger}
 }
 
 func (a *API) RegisterRoutes(mux *http.ServeMux) {
@@ -42,6 +44,10 @@ func (a *API) RegisterRoutes(mux *http.ServeMux) {
 	protected.HandleFunc("/api/keywords/", a.handleKeywords)
 	protected.HandleFunc("/api/tasks", a.handleTasks)
 	protected.HandleFunc("/api/tasks/", a.handleTaskDetail)
+	protected.HandleFunc("/api/outbox", a.handleOutbox)
+	protected.HandleFunc("/api/outbox/", a.handleOutboxDetail)
+	protected.HandleFunc("/api/webhook-deliveries", a.handleWebhookDeliveries)
+	protected.HandleFunc("/api/webhook-deliveries/", a.handleWebhookDeliveryDetail)
 
 	protected.HandleFunc("/api/settings", a.handleSettings)
 	protected.HandleFunc("/api/settings/", a.handleSettingDetail)
@@ -11,10 +11,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
 	"github.com/opencode-ai/opencode-dog/internal/auth"
 	"github.com/opencode-ai/opencode-dog/internal/db"
 	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
 	"github.com/opencode-ai/opencode-dog/internal/mcpmgr"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
 )
 
 // --- Test helpers ---
@@ -32,7 +34,8 @@ func newTestEnv(t *testing.T) *testEnv {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	a := auth.New(store, logger, "test-secret")
 	mgr := mcpmgr.New(store, logger)
-	api := New(store, a, mgr, logger)
+	an := analyzer.New(store, provider.NewRegistry(logger), logger, t.TempDir(), nil)
+	api := New(store, a, mgr, an, logger)
 	mux := http.NewServeMux()
 	api.RegisterRoutes(mux)
 	return &testEnv{api: api, store: store, auth: a, mux: mux}
@@ -263,6 +266,51 @@ func TestProjectsCreateAdmin(t *testing.T) {
 	}
 }
 
+func TestProjectsCreateVerifyCommands(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	body := jsonBody(map[string]any{
+		"name": "p", "ssh_url": "git@example.com:p.git",
+		"verify_commands": []string{" go build ./... ", "", "go test ./..."},
+	})
+	rec := doRequest(env, http.MethodPost, "/api/projects", body, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var p db.Project
+	decodeJSON(t, rec, &p)
+	if len(p.VerifyCommands) != 2 || p.VerifyCommands[0] != "go build ./..." || p.VerifyCommands[1] != "go test ./..." {
+		t.Fatalf("verify_commands = %q", p.VerifyCommands)
+	}
+}
+
+func TestProjectsCreatePipelinePatterns(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	body := jsonBody(map[string]any{
+		"name": "p", "ssh_url": "git@example.com:p.git", "pipeline_analysis": true,
+		"pipeline_branches": []string{" main ", "release/*", ""}, "pipeline_jobs": []string{"test*"},
+	})
+	rec := doRequest(env, http.MethodPost, "/api/projects", body, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var p db.Project
+	decodeJSON(t, rec, &p)
+	if !p.PipelineAnalysis || len(p.PipelineBranches) != 2 || p.PipelineBranches[0] != "main" || len(p.PipelineJobs) != 1 {
+		t.Fatalf("project = %+v", p)
+	}
+
+	body = jsonBody(map[string]any{"name": "q", "ssh_url": "git@example.com:q.git", "pipeline_jobs": []string{"test["}})
+	if rec := doRequest(env, http.MethodPost, "/api/projects", body, token); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed pattern, got %d", rec.Code)
+	}
+}
+
 func TestProjectsCreateViewerForbidden(t *testing.T) {
 	env := newTestEnv(t)
 	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
@@ -659,6 +707,44 @@ func TestTaskDetail(t *testing.T) {
 	}
 }
 
+func TestTaskDetailIncludesMessages(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusCompleted, CreatedAt: time.Now()},
+	}
+	env.store.TaskMessages = []*db.TaskMessage{
+		{ID: "m1", TaskID: "t1", Direction: db.MessageInbound, Kind: db.MessageKindTrigger, ExternalID: "100"},
+		{ID: "m2", TaskID: "t1", Direction: db.MessageOutbound, Kind: db.MessageKindResult, ExternalID: "101", URL: "https://gitlab.example/i/1#note_101"},
+		{ID: "m3", TaskID: "other", Direction: db.MessageOutbound, Kind: db.MessageKindAck, ExternalID: "5"},
+	}
+	env.store.TaskEvents = []*db.TaskEvent{
+		{ID: "e1", TaskID: "t1", Kind: "tool", Message: "read main.go: completed"},
+	}
+
+	rec := doRequest(env, http.MethodGet, "/api/tasks/t1", nil, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		ID       string            `json:"id"`
+		Messages []*db.TaskMessage `json:"messages"`
+		Events   []*db.TaskEvent   `json:"events"`
+	}
+	decodeJSON(t, rec, &resp)
+	if resp.ID != "t1" {
+		t.Fatalf("expected task fields inline, got id %q", resp.ID)
+	}
+	if len(resp.Messages) != 2 || resp.Messages[1].URL != "https://gitlab.example/i/1#note_101" {
+		t.Fatalf("unexpected messages: %+v", resp.Messages)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Message != "read main.go: completed" {
+		t.Fatalf("unexpected events: %+v", resp.Events)
+	}
+}
+
 func TestTaskDetailNotFound(t *testing.T) {
 	env := newTestEnv(t)
 	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
@@ -670,6 +756,277 @@ func TestTaskDetailNotFound(t *testing.T) {
 	}
 }
 
+func TestTaskCancel(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "editor", "pass", db.RoleEditor)
+	token := loginToken(t, env, "editor", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusPending, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/cancel", nil, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var task db.Task
+	decodeJSON(t, rec, &task)
+	if task.Status != db.TaskStatusCancelled {
+		t.Fatalf("expected cancelled, got %s", task.Status)
+	}
+	if task.ErrorMessage == nil || *task.ErrorMessage != "cancelled by editor" {
+		t.Fatalf("unexpected error_message: %v", task.ErrorMessage)
+	}
+}
+
+func TestTaskCancelAlreadyFinished(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusCompleted, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/cancel", nil, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestTaskCancelNotFound(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/nonexistent/cancel", nil, token)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestTaskCancelViewerForbidden(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
+	token := loginToken(t, env, "viewer", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusPending, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/cancel", nil, token)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if env.store.Tasks[0].Status != db.TaskStatusPending {
+		t.Fatalf("viewer must not cancel, status %s", env.store.Tasks[0].Status)
+	}
+}
+
+func TestTaskRetry(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", MessageBody: "@oc why", TriggerMode: "ask", Status: db.TaskStatusFailed, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/retry", nil, token)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var task db.Task
+	decodeJSON(t, rec, &task)
+	if task.ID == "t1" || task.ParentTaskID == nil || *task.ParentTaskID != "t1" {
+		t.Fatalf("expected a new task linked to t1, got %+v", task)
+	}
+	if task.Status != db.TaskStatusPending || task.MessageBody != "@oc why" {
+		t.Fatalf("unexpected retry task: %+v", task)
+	}
+}
+
+func TestTaskRetryStillRunning(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusProcessing, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/retry", nil, token)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+}
+
+func TestTaskRetryViewerForbidden(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
+	token := loginToken(t, env, "viewer", "pass")
+
+	env.store.Tasks = []*db.Task{
+		{ID: "t1", Title: "task1", Status: db.TaskStatusFailed, CreatedAt: time.Now()},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/tasks/t1/retry", nil, token)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if len(env.store.Tasks) != 1 {
+		t.Fatalf("viewer must not create tasks, got %d", len(env.store.Tasks))
+	}
+}
+
+// --- Reply Outbox ---
+
+func TestOutboxListByStatus(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
+	token := loginToken(t, env, "viewer", "pass")
+
+	env.store.Outbox = []*db.OutboxReply{
+		{ID: "r1", TaskID: "t1", Status: db.OutboxDelivered},
+		{ID: "r2", TaskID: "t2", Status: db.OutboxDead, Attempts: 8, LastError: "slack api error: ratelimited"},
+	}
+
+	rec := doRequest(env, http.MethodGet, "/api/outbox?status=dead", nil, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Replies []db.OutboxReply `json:"replies"`
+	}
+	decodeJSON(t, rec, &resp)
+	if len(resp.Replies) != 1 || resp.Replies[0].ID != "r2" || resp.Replies[0].LastError == "" {
+		t.Fatalf("expected the dead reply only, got %+v", resp.Replies)
+	}
+}
+
+func TestOutboxResend(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "editor", "pass", db.RoleEditor)
+	token := loginToken(t, env, "editor", "pass")
+
+	env.store.Outbox = []*db.OutboxReply{
+		{ID: "r1", TaskID: "t1", Status: db.OutboxDead, Attempts: 8, PartsSent: 1},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/outbox/r1/resend", nil, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var reply db.OutboxReply
+	decodeJSON(t, rec, &reply)
+	if reply.Status != db.OutboxPending || reply.Attempts != 0 || reply.PartsSent != 1 {
+		t.Fatalf("unexpected resent reply: %+v", reply)
+	}
+}
+
+func TestOutboxResendNotDead(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.Outbox = []*db.OutboxReply{
+		{ID: "r1", TaskID: "t1", Status: db.OutboxPending},
+	}
+
+	if rec := doRequest(env, http.MethodPost, "/api/outbox/r1/resend", nil, token); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+	if rec := doRequest(env, http.MethodPost, "/api/outbox/missing/resend", nil, token); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestOutboxResendViewerForbidden(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
+	token := loginToken(t, env, "viewer", "pass")
+
+	env.store.Outbox = []*db.OutboxReply{
+		{ID: "r1", TaskID: "t1", Status: db.OutboxDead},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/outbox/r1/resend", nil, token)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if env.store.Outbox[0].Status != db.OutboxDead {
+		t.Fatalf("viewer must not resend replies")
+	}
+}
+
+// --- Webhook Deliveries ---
+
+func TestWebhookDeliveriesFilter(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "viewer", "pass", db.RoleViewer)
+	token := loginToken(t, env, "viewer", "pass")
+
+	env.store.InboundWebhooks = []*db.InboundWebhook{
+		{ID: "w1", ProviderConfigID: "cfg-1", ProviderType: "slack", Outcome: db.WebhookTaskCreated},
+		{ID: "w2", ProviderConfigID: "cfg-1", ProviderType: "slack", Outcome: db.WebhookNoKeyword},
+		{ID: "w3", ProviderConfigID: "cfg-2", ProviderType: "gitlab", Outcome: db.WebhookNoKeyword},
+	}
+
+	rec := doRequest(env, http.MethodGet, "/api/webhook-deliveries?provider_config_id=cfg-1&outcome=no_keyword", nil, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Deliveries []db.InboundWebhook `json:"deliveries"`
+	}
+	decodeJSON(t, rec, &resp)
+	if len(resp.Deliveries) != 1 || resp.Deliveries[0].ID != "w2" {
+		t.Fatalf("expected w2 only, got %+v", resp.Deliveries)
+	}
+
+	if rec := doRequest(env, http.MethodGet, "/api/webhook-deliveries/w3", nil, token); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if rec := doRequest(env, http.MethodGet, "/api/webhook-deliveries/missing", nil, token); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestWebhookDeliveryReplay(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "admin", "pass", db.RoleAdmin)
+	token := loginToken(t, env, "admin", "pass")
+
+	env.store.InboundWebhooks = []*db.InboundWebhook{
+		{ID: "w1", ProviderConfigID: "cfg-1", ProviderType: "slack", Body: "{", BodyTruncated: true},
+	}
+
+	if rec := doRequest(env, http.MethodPost, "/api/webhook-deliveries/w1/replay", nil, token); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", rec.Code)
+	}
+	if rec := doRequest(env, http.MethodPost, "/api/webhook-deliveries/missing/replay", nil, token); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestWebhookDeliveryReplayEditorForbidden(t *testing.T) {
+	env := newTestEnv(t)
+	seedUser(t, env.store, "editor", "pass", db.RoleEditor)
+	token := loginToken(t, env, "editor", "pass")
+
+	env.store.InboundWebhooks = []*db.InboundWebhook{
+		{ID: "w1", ProviderConfigID: "cfg-1", ProviderType: "slack"},
+	}
+
+	rec := doRequest(env, http.MethodPost, "/api/webhook-deliveries/w1/replay", nil, token)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if len(env.store.InboundWebhooks) != 1 {
+		t.Fatalf("editor must not replay webhooks")
+	}
+}
+
 // --- Settings ---
 
 func TestSettingsList(t *testing.T) {
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+func (a *API) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	defaultLimit := a.database.GetSettingInt(r.Context(), "task_list_default_limit", 50)
+	maxLimit := a.database.GetSettingInt(r.Context(), "task_list_max_limit", 100)
+	if limit <= 0 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	replies, err := a.database.ListOutboxReplies(r.Context(), r.URL.Query().Get("status"), limit, offset)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if replies == nil {
+		replies = []*db.OutboxReply{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"replies": replies})
+}
+
+func (a *API) handleOutboxDetail(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/outbox/"), "/")
+	id := parts[0]
+
+	if len(parts) == 2 && parts[1] == "resend" {
+		a.handleOutboxResend(w, r, id)
+		return
+	}
+	if len(parts) != 1 || id == "" {
+		writeErr(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reply, err := a.database.GetOutboxReply(r.Context(), id)
+	if err != nil {
+		writeErr(w, http.StatusNotFound, "reply not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, reply)
+}
+
+func (a *API) handleOutboxResend(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireRole(w, r, db.RoleAdmin, db.RoleEditor) {
+		return
+	}
+	reply, err := a.analyzer.ResendReply(r.Context(), id)
+	switch {
+	case errors.Is(err, analyzer.ErrReplyNotFound):
+		writeErr(w, http.StatusNotFound, "reply not found")
+	case errors.Is(err, analyzer.ErrReplyNotDead):
+		writeErr(w, http.StatusConflict, "reply is not dead")
+	case err != nil:
+		writeErr(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, reply)
+	}
+}
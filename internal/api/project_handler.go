@@ -2,7 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/opencode-ai/opencode-dog/internal/db"
@@ -37,6 +39,9 @@ func (a *API) handleProjects(w http.ResponseWriter, r *http.Request) {
 		if p.DefaultBranch == "" {
 			p.DefaultBranch = a.database.GetSettingString(r.Context(), "default_git_branch", "main")
 		}
+		if !cleanProject(w, &p) {
+			return
+		}
 		p.Enabled = true
 		if err := a.database.CreateProject(r.Context(), &p); err != nil {
 			writeErr(w, http.StatusInternalServerError, err.Error())
@@ -75,6 +80,9 @@ func (a *API) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		p.ID = id
+		if !cleanProject(w, &p) {
+			return
+		}
 		if err := a.database.UpdateProject(r.Context(), &p); err != nil {
 			writeErr(w, http.StatusInternalServerError, err.Error())
 			return
@@ -95,3 +103,33 @@ func (a *API) handleProjectDetail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// cleanProject normalizes the list fields of p and checks its pipeline
+// patterns, answering 400 if one is malformed.
+func cleanProject(w http.ResponseWriter, p *db.Project) bool {
+	p.VerifyCommands = cleanList(p.VerifyCommands)
+	p.PipelineBranches = cleanList(p.PipelineBranches)
+	p.PipelineJobs = cleanList(p.PipelineJobs)
+	for _, pattern := range append(p.PipelineBranches, p.PipelineJobs...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			writeErr(w, http.StatusBadRequest, fmt.Sprintf("invalid pattern %q", pattern))
+			return false
+		}
+	}
+	if p.PipelineCooldownMinutes < 0 {
+		writeErr(w, http.StatusBadRequest, "pipeline_cooldown_minutes must not be negative")
+		return false
+	}
+	return true
+}
+
+// cleanList trims the entries of a list field and drops empty ones.
+func cleanList(list []string) []string {
+	cleaned := []string{}
+	for _, c := range list {
+		if c = strings.TrimSpace(c); c != "" {
+			cleaned = append(cleaned, c)
+		}
+	}
+	return cleaned
+}
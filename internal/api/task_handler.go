@@ -1,10 +1,13 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
+	"github.com/opencode-ai/opencode-dog/internal/auth"
 	"github.com/opencode-ai/opencode-dog/internal/db"
 )
 
@@ -40,7 +43,21 @@ func (a *API) handleTasks(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *API) handleTaskDetail(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/tasks/"), "/")
+	id := parts[0]
+
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "cancel":
+			a.handleTaskCancel(w, r, id)
+		case "retry":
+			a.handleTaskRetry(w, r, id)
+		default:
+			writeErr(w, http.StatusNotFound, "not found")
+		}
+		return
+	}
+
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -50,5 +67,67 @@ func (a *API) handleTaskDetail(w http.ResponseWriter, r *http.Request) {
 		writeErr(w, http.StatusNotFound, "task not found")
 		return
 	}
-	writeJSON(w, http.StatusOK, task)
+	messages, err := a.database.ListTaskMessages(r.Context(), id)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if messages == nil {
+		messages = []*db.TaskMessage{}
+	}
+	events, err := a.database.ListTaskEvents(r.Context(), id)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if events == nil {
+		events = []*db.TaskEvent{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		*db.Task
+		Messages []*db.TaskMessage `json:"messages"`
+		Events   []*db.TaskEvent   `json:"events"`
+	}{task, messages, events})
+}
+
+func (a *API) handleTaskCancel(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireRole(w, r, db.RoleAdmin, db.RoleEditor) {
+		return
+	}
+	task, err := a.analyzer.CancelTask(r.Context(), id, auth.GetUser(r.Context()).Username)
+	switch {
+	case errors.Is(err, analyzer.ErrTaskNotFound):
+		writeErr(w, http.StatusNotFound, "task not found")
+	case errors.Is(err, analyzer.ErrTaskFinished):
+		writeErr(w, http.StatusConflict, "task already finished")
+	case err != nil:
+		writeErr(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, task)
+	}
+}
+
+func (a *API) handleTaskRetry(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireRole(w, r, db.RoleAdmin, db.RoleEditor) {
+		return
+	}
+	task, err := a.analyzer.RetryTask(r.Context(), id, auth.GetUser(r.Context()).Username)
+	switch {
+	case errors.Is(err, analyzer.ErrTaskNotFound):
+		writeErr(w, http.StatusNotFound, "task not found")
+	case errors.Is(err, analyzer.ErrTaskActive):
+		writeErr(w, http.StatusConflict, "task is still pending or processing")
+	case err != nil:
+		writeErr(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, task)
+	}
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
+	"github.com/opencode-ai/opencode-dog/internal/auth"
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+func (a *API) handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	defaultLimit := a.database.GetSettingInt(r.Context(), "task_list_default_limit", 50)
+	maxLimit := a.database.GetSettingInt(r.Context(), "task_list_max_limit", 100)
+	if limit <= 0 || limit > maxLimit {
+		limit = defaultLimit
+	}
+
+	filter := db.InboundWebhookFilter{
+		ProviderConfigID: q.Get("provider_config_id"),
+		ProviderType:     q.Get("provider"),
+		Outcome:          q.Get("outcome"),
+	}
+	deliveries, err := a.database.ListInboundWebhooks(r.Context(), filter, limit, offset)
+	if err != nil {
+		writeErr(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deliveries == nil {
+		deliveries = []*db.InboundWebhook{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": deliveries})
+}
+
+func (a *API) handleWebhookDeliveryDetail(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/webhook-deliveries/"), "/")
+	id := parts[0]
+
+	if len(parts) == 2 && parts[1] == "replay" {
+		a.handleWebhookDeliveryReplay(w, r, id)
+		return
+	}
+	if len(parts) != 1 || id == "" {
+		writeErr(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	delivery, err := a.database.GetInboundWebhook(r.Context(), id)
+	if err != nil {
+		writeErr(w, http.StatusNotFound, "webhook delivery not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func (a *API) handleWebhookDeliveryReplay(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.requireRole(w, r, db.RoleAdmin) {
+		return
+	}
+	delivery, err := a.analyzer.ReplayWebhook(r.Context(), id, auth.GetUser(r.Context()).Username)
+	switch {
+	case errors.Is(err, analyzer.ErrWebhookNotFound):
+		writeErr(w, http.StatusNotFound, "webhook delivery not found")
+	case errors.Is(err, analyzer.ErrWebhookNotReplayable):
+		writeErr(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeErr(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, delivery)
+	}
+}
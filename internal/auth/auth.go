@@ -134,8 +134,7 @@ func (a *Auth) Middleware(next http.Handler) http.Handler {
 			writeAuthErr(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
-		ctx := context.WithValue(r.Context(), userContextKey, claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), claims)))
 	})
 }
 
@@ -160,6 +159,12 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// WithUser returns a copy of ctx carrying claims, as Middleware does for an
+// authenticated request.
+func WithUser(ctx context.Context, claims *TokenClaims) context.Context {
+	return context.WithValue(ctx, userContextKey, claims)
+}
+
 func GetUser(ctx context.Context) *TokenClaims {
 	claims, _ := ctx.Value(userContextKey).(*TokenClaims)
 	return claims
@@ -30,6 +30,11 @@ type Config struct {
 	// container so both services share the same configuration.
 	OpencodeConfigDir string
 
+	// WorkspaceDir holds the project clones and per-task worktrees analysis
+	// runs in. Must be mounted at the same path in the OpenCode server
+	// container.
+	WorkspaceDir string
+
 	JWTSecret string
 
 	ReadHeaderTimeout time.Duration
@@ -53,6 +58,7 @@ func Load() (*Config, error) {
 		DBName:            getEnv("DB_NAME", "opencode_dog"),
 		DBSSLMode:         getEnv("DB_SSLMODE", "disable"),
 		OpencodeConfigDir: getEnv("OPENCODE_CONFIG_DIR", "/app/config"),
+		WorkspaceDir:      getEnv("WORKSPACE_DIR", "/app/workspaces"),
 		JWTSecret:         getEnv("JWT_SECRET", ""),
 		ReadHeaderTimeout: getEnvDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
 		ReadTimeout:       getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
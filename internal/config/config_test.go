@@ -28,6 +28,7 @@ func TestLoad_Defaults(t *testing.T) {
 		{"DBName", cfg.DBName, "opencode_dog"},
 		{"DBSSLMode", cfg.DBSSLMode, "disable"},
 		{"OpencodeConfigDir", cfg.OpencodeConfigDir, "/app/config"},
+		{"WorkspaceDir", cfg.WorkspaceDir, "/app/workspaces"},
 	}
 	for _, c := range checks {
 		if c.got != c.want {
@@ -55,6 +56,7 @@ func TestLoad_CustomEnvVars(t *testing.T) {
 	t.Setenv("DB_NAME", "mydb")
 	t.Setenv("DB_SSLMODE", "require")
 	t.Setenv("OPENCODE_CONFIG_DIR", "/tmp/oc")
+	t.Setenv("WORKSPACE_DIR", "/tmp/ws")
 	t.Setenv("JWT_SECRET", "jwt-key")
 
 	cfg, err := Load()
@@ -86,6 +88,9 @@ func TestLoad_CustomEnvVars(t *testing.T) {
 	if cfg.OpencodeConfigDir != "/tmp/oc" {
 		t.Errorf("OpencodeConfigDir = %q, want %q", cfg.OpencodeConfigDir, "/tmp/oc")
 	}
+	if cfg.WorkspaceDir != "/tmp/ws" {
+		t.Errorf("WorkspaceDir = %q, want %q", cfg.WorkspaceDir, "/tmp/ws")
+	}
 	if cfg.JWTSecret != "jwt-key" {
 		t.Errorf("JWTSecret = %q, want %q", cfg.JWTSecret, "jwt-key")
 	}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const conversationColumns = `id, provider_config_id, thread_key, session_id, directory, created_at, last_used_at`
+
+func (d *DB) GetConversation(ctx context.Context, providerConfigID, threadKey string) (*Conversation, error) {
+	c := &Conversation{}
+	err := d.Pool.QueryRow(ctx,
+		`SELECT `+conversationColumns+` FROM conversations WHERE provider_config_id=$1 AND thread_key=$2`,
+		providerConfigID, threadKey,
+	).Scan(&c.ID, &c.ProviderConfigID, &c.ThreadKey, &c.SessionID, &c.Directory, &c.CreatedAt, &c.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SaveConversation creates the conversation for a thread, or points an
+// existing one at a new session, and marks it used now.
+func (d *DB) SaveConversation(ctx context.Context, c *Conversation) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO conversations (provider_config_id, thread_key, session_id, directory) VALUES ($1,$2,$3,$4)
+		 ON CONFLICT (provider_config_id, thread_key)
+		 DO UPDATE SET session_id=EXCLUDED.session_id, directory=EXCLUDED.directory, last_used_at=NOW()
+		 RETURNING id, created_at, last_used_at`,
+		c.ProviderConfigID, c.ThreadKey, c.SessionID, c.Directory,
+	).Scan(&c.ID, &c.CreatedAt, &c.LastUsedAt)
+}
+
+func (d *DB) TouchConversation(ctx context.Context, id string) error {
+	_, err := d.Pool.Exec(ctx, `UPDATE conversations SET last_used_at=NOW() WHERE id=$1`, id)
+	return err
+}
+
+func (d *DB) DeleteConversation(ctx context.Context, id string) error {
+	_, err := d.Pool.Exec(ctx, `DELETE FROM conversations WHERE id=$1`, id)
+	return err
+}
+
+// ListIdleConversations returns conversations not used since the given time.
+func (d *DB) ListIdleConversations(ctx context.Context, before time.Time) ([]*Conversation, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+conversationColumns+` FROM conversations WHERE last_used_at < $1 ORDER BY last_used_at`, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var convs []*Conversation
+	for rows.Next() {
+		c := &Conversation{}
+		if err := rows.Scan(&c.ID, &c.ProviderConfigID, &c.ThreadKey, &c.SessionID, &c.Directory, &c.CreatedAt, &c.LastUsedAt); err != nil {
+			return nil, err
+		}
+		convs = append(convs, c)
+	}
+	return convs, rows.Err()
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -36,13 +38,24 @@ func New(ctx context.Context, dsn string, maxConns int32, minConns int32, maxLif
 
 func (d *DB) Close() { d.Pool.Close() }
 
+// RunMigrations executes every *.sql file in dir in lexical order. Migrations
+// are written to be idempotent, so they are safe to re-run on every startup.
 func (d *DB) RunMigrations(ctx context.Context, dir string) error {
-	sql, err := os.ReadFile(dir + "/001_init.sql")
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
 	if err != nil {
-		return fmt.Errorf("read migration: %w", err)
+		return fmt.Errorf("list migrations: %w", err)
 	}
-	_, err = d.Pool.Exec(ctx, string(sql))
-	return err
+	sort.Strings(files)
+	for _, f := range files {
+		sql, err := os.ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", filepath.Base(f), err)
+		}
+		if _, err := d.Pool.Exec(ctx, string(sql)); err != nil {
+			return fmt.Errorf("apply migration %s: %w", filepath.Base(f), err)
+		}
+	}
+	return nil
 }
 
 func HashPayload(payload []byte) string {
@@ -19,10 +19,17 @@ type Store struct {
 	ProviderConfigs []*db.ProviderConfig
 	TriggerKeywords []*db.TriggerKeyword
 	Tasks           []*db.Task
+	TaskMessages    []*db.TaskMessage
+	TaskEvents      []*db.TaskEvent
+	Conversations   []*db.Conversation
+	Outbox          []*db.OutboxReply
 	Webhooks        []*db.WebhookDelivery
+	InboundWebhooks []*db.InboundWebhook
 	Settings        []*db.Setting
 	MCPServers      []*db.MCPServer
 	Users           []*db.User
+	// PipelineAnalyses holds the last claim time per "project/ref/job".
+	PipelineAnalyses map[string]time.Time
 
 	// Error injection: set these to force specific methods to return errors.
 	ErrDefault error
@@ -148,6 +155,33 @@ func (s *Store) DeleteProject(_ context.Context, id string) error {
 	return nil
 }
 
+func (s *Store) ClaimPipelineAnalysis(_ context.Context, projectID, ref, job string, cooldown time.Duration) (bool, error) {
+	if s.ErrDefault != nil {
+		return false, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := projectID + "/" + ref + "/" + job
+	if last, ok := s.PipelineAnalyses[key]; ok && time.Since(last) < cooldown {
+		return false, nil
+	}
+	if s.PipelineAnalyses == nil {
+		s.PipelineAnalyses = make(map[string]time.Time)
+	}
+	s.PipelineAnalyses[key] = time.Now()
+	return true, nil
+}
+
+func (s *Store) ReleasePipelineAnalysis(_ context.Context, projectID, ref, job string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.PipelineAnalyses, projectID+"/"+ref+"/"+job)
+	return nil
+}
+
 // --- Provider Configs ---
 
 func (s *Store) CreateProviderConfig(_ context.Context, pc *db.ProviderConfig) error {
@@ -278,28 +312,174 @@ func (s *Store) CreateTask(_ context.Context, t *db.Task) error {
 	return nil
 }
 
-func (s *Store) UpdateTaskStatus(_ context.Context, taskID string, status db.TaskStatus, result *string, errMsg *string) error {
+func (s *Store) UpdateTaskStatus(_ context.Context, taskID string, attempt int, status db.TaskStatus, result *string, errMsg *string) (bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	for _, t := range s.Tasks {
 		if t.ID == taskID {
+			if t.Status != db.TaskStatusProcessing || t.Attempts != attempt {
+				return false, nil
+			}
+			now := time.Now()
 			t.Status = status
 			t.Result = result
 			t.ErrorMessage = errMsg
-			t.UpdatedAt = time.Now()
-			now := time.Now()
-			if status == db.TaskStatusProcessing {
-				t.StartedAt = &now
-			}
-			if status == db.TaskStatusCompleted || status == db.TaskStatusFailed {
+			t.LeaseExpiresAt = nil
+			t.UpdatedAt = now
+			if status == db.TaskStatusCompleted || status == db.TaskStatusFailed || status == db.TaskStatusCancelled {
 				t.CompletedAt = &now
 			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) UpdateTaskRef(_ context.Context, taskID, ref string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tasks {
+		if t.ID == taskID {
+			t.Ref = ref
 			return nil
 		}
 	}
 	return errNotFound("task", taskID)
 }
 
+func (s *Store) UpdateTaskVerification(_ context.Context, taskID, status, log string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tasks {
+		if t.ID == taskID {
+			t.VerifyStatus = status
+			t.VerifyLog = log
+			return nil
+		}
+	}
+	return errNotFound("task", taskID)
+}
+
+func (s *Store) ClaimNextTask(_ context.Context, projectLimit int, lease time.Duration) (*db.Task, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	processing := make(map[string]int)
+	busyThreads := make(map[string]bool)
+	for _, t := range s.Tasks {
+		if t.Status != db.TaskStatusProcessing {
+			continue
+		}
+		if t.ProjectID != nil {
+			processing[*t.ProjectID]++
+		}
+		if t.ThreadKey != "" {
+			busyThreads[threadOf(t)] = true
+		}
+	}
+	for _, t := range s.Tasks {
+		if t.Status != db.TaskStatusPending {
+			continue
+		}
+		if projectLimit > 0 && t.ProjectID != nil && processing[*t.ProjectID] >= projectLimit {
+			continue
+		}
+		if t.ThreadKey != "" && busyThreads[threadOf(t)] {
+			continue
+		}
+		now := time.Now()
+		expires := now.Add(lease)
+		t.Status = db.TaskStatusProcessing
+		t.Attempts++
+		t.LeaseExpiresAt = &expires
+		t.StartedAt = &now
+		t.UpdatedAt = now
+		return t, nil
+	}
+	return nil, nil
+}
+
+// threadOf returns the key of the conversation thread t belongs to.
+func threadOf(t *db.Task) string {
+	cfg := ""
+	if t.ProviderConfigID != nil {
+		cfg = *t.ProviderConfigID
+	}
+	return cfg + "/" + t.ThreadKey
+}
+
+func (s *Store) RenewTaskLease(_ context.Context, taskID string, attempt int, lease time.Duration) (bool, error) {
+	if s.ErrDefault != nil {
+		return false, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tasks {
+		if t.ID == taskID && t.Attempts == attempt && t.Status == db.TaskStatusProcessing {
+			expires := time.Now().Add(lease)
+			t.LeaseExpiresAt = &expires
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) CancelTask(_ context.Context, taskID string, reason string) (*db.Task, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range s.Tasks {
+		if t.ID == taskID && (t.Status == db.TaskStatusPending || t.Status == db.TaskStatusProcessing) {
+			now := time.Now()
+			t.Status = db.TaskStatusCancelled
+			t.ErrorMessage = &reason
+			t.LeaseExpiresAt = nil
+			t.CompletedAt = &now
+			t.UpdatedAt = now
+			return t, nil
+		}
+	}
+	return nil, errNotFound("task", taskID)
+}
+
+func (s *Store) RecoverStaleTasks(_ context.Context, maxAttempts int, errMsg string) (int, []*db.Task, error) {
+	if s.ErrDefault != nil {
+		return 0, nil, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	requeued := 0
+	var failed []*db.Task
+	for _, t := range s.Tasks {
+		if t.Status != db.TaskStatusProcessing || (t.LeaseExpiresAt != nil && t.LeaseExpiresAt.After(now)) {
+			continue
+		}
+		t.LeaseExpiresAt = nil
+		if t.Attempts < maxAttempts {
+			t.Status = db.TaskStatusPending
+			requeued++
+			continue
+		}
+		msg := errMsg
+		t.Status = db.TaskStatusFailed
+		t.ErrorMessage = &msg
+		t.CompletedAt = &now
+		failed = append(failed, t)
+	}
+	return requeued, failed, nil
+}
+
 func (s *Store) ListTasks(_ context.Context, limit, offset int) ([]*db.Task, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -324,37 +504,479 @@ func (s *Store) GetTask(_ context.Context, id string) (*db.Task, error) {
 	return nil, errNotFound("task", id)
 }
 
+func (s *Store) GetLatestThreadTask(_ context.Context, providerConfigID, threadKey string) (*db.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.Tasks) - 1; i >= 0; i-- {
+		t := s.Tasks[i]
+		if t.ProviderConfigID != nil && *t.ProviderConfigID == providerConfigID && t.ThreadKey == threadKey {
+			return t, nil
+		}
+	}
+	return nil, errNotFound("task", threadKey)
+}
+
 func (s *Store) CountTasks(_ context.Context) (int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.Tasks), s.ErrDefault
 }
 
-// --- Webhook Dedup ---
+// --- Task Messages ---
+
+func (s *Store) CreateTaskMessage(_ context.Context, m *db.TaskMessage) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.ID = s.nextID()
+	m.CreatedAt = time.Now()
+	s.TaskMessages = append(s.TaskMessages, m)
+	return nil
+}
 
-func (s *Store) IsWebhookProcessed(_ context.Context, eventUUID string) (bool, error) {
+func (s *Store) ListTaskMessages(_ context.Context, taskID string) ([]*db.TaskMessage, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	for _, w := range s.Webhooks {
-		if w.EventUUID == eventUUID {
-			return true, nil
+	var result []*db.TaskMessage
+	for _, m := range s.TaskMessages {
+		if m.TaskID == taskID {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) GetThreadKeyByMessage(_ context.Context, providerType, channel, externalID string) (string, error) {
+	if s.ErrDefault != nil {
+		return "", s.ErrDefault
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := len(s.TaskMessages) - 1; i >= 0; i-- {
+		m := s.TaskMessages[i]
+		if m.ProviderType != providerType || m.Channel != channel || m.ExternalID != externalID {
+			continue
+		}
+		for _, t := range s.Tasks {
+			if t.ID == m.TaskID {
+				return t.ThreadKey, nil
+			}
+		}
+	}
+	return "", errNotFound("task message", externalID)
+}
+
+// --- Task Events ---
+
+func (s *Store) CreateTaskEvent(_ context.Context, e *db.TaskEvent) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.ID = s.nextID()
+	e.CreatedAt = time.Now()
+	s.TaskEvents = append(s.TaskEvents, e)
+	return nil
+}
+
+func (s *Store) ListTaskEvents(_ context.Context, taskID string) ([]*db.TaskEvent, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*db.TaskEvent
+	for _, e := range s.TaskEvents {
+		if e.TaskID == taskID {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// --- Conversations ---
+
+func (s *Store) GetConversation(_ context.Context, providerConfigID, threadKey string) (*db.Conversation, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, c := range s.Conversations {
+		if c.ProviderConfigID == providerConfigID && c.ThreadKey == threadKey {
+			return c, nil
+		}
+	}
+	return nil, errNotFound("conversation", threadKey)
+}
+
+func (s *Store) SaveConversation(_ context.Context, c *db.Conversation) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, existing := range s.Conversations {
+		if existing.ProviderConfigID == c.ProviderConfigID && existing.ThreadKey == c.ThreadKey {
+			existing.SessionID = c.SessionID
+			existing.Directory = c.Directory
+			existing.LastUsedAt = now
+			*c = *existing
+			return nil
+		}
+	}
+	c.ID = s.nextID()
+	c.CreatedAt = now
+	c.LastUsedAt = now
+	s.Conversations = append(s.Conversations, c)
+	return nil
+}
+
+func (s *Store) TouchConversation(_ context.Context, id string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.Conversations {
+		if c.ID == id {
+			c.LastUsedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteConversation(_ context.Context, id string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.Conversations {
+		if c.ID == id {
+			s.Conversations = append(s.Conversations[:i], s.Conversations[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListIdleConversations(_ context.Context, before time.Time) ([]*db.Conversation, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*db.Conversation
+	for _, c := range s.Conversations {
+		if c.LastUsedAt.Before(before) {
+			result = append(result, c)
 		}
 	}
-	return false, s.ErrDefault
+	return result, nil
 }
 
-func (s *Store) RecordWebhookDelivery(_ context.Context, delivery *db.WebhookDelivery) error {
+// --- Reply Outbox ---
+
+func (s *Store) CreateOutboxReply(_ context.Context, r *db.OutboxReply, lease time.Duration) error {
 	if s.ErrDefault != nil {
 		return s.ErrDefault
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	now := time.Now()
+	r.ID = s.nextID()
+	r.Status = db.OutboxPending
+	r.Attempts = 1
+	r.NextAttemptAt = now.Add(lease)
+	r.CreatedAt = now
+	r.UpdatedAt = now
+	s.Outbox = append(s.Outbox, r)
+	return nil
+}
+
+func (s *Store) GetOutboxReply(_ context.Context, id string) (*db.OutboxReply, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.Outbox {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, errNotFound("outbox_reply", id)
+}
+
+func (s *Store) ClaimOutboxReply(_ context.Context, lease time.Duration) (*db.OutboxReply, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var due *db.OutboxReply
+	for _, r := range s.Outbox {
+		if r.Status == db.OutboxPending && !r.NextAttemptAt.After(now) && (due == nil || r.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = r
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	due.Attempts++
+	due.NextAttemptAt = now.Add(lease)
+	due.UpdatedAt = now
+	return due, nil
+}
+
+func (s *Store) UpdateOutboxProgress(_ context.Context, id string, partsSent int, uploaded bool) error {
+	return s.updateOutbox(id, func(r *db.OutboxReply) {
+		r.PartsSent = partsSent
+		r.Uploaded = uploaded
+	})
+}
+
+func (s *Store) CompleteOutboxReply(_ context.Context, id string) error {
+	return s.updateOutbox(id, func(r *db.OutboxReply) {
+		now := time.Now()
+		r.Status = db.OutboxDelivered
+		r.LastError = ""
+		r.DeliveredAt = &now
+	})
+}
+
+func (s *Store) RetryOutboxReply(_ context.Context, id, errMsg string, at time.Time) error {
+	return s.updateOutbox(id, func(r *db.OutboxReply) {
+		r.LastError = errMsg
+		r.NextAttemptAt = at
+	})
+}
+
+func (s *Store) FailOutboxReply(_ context.Context, id, errMsg string) error {
+	return s.updateOutbox(id, func(r *db.OutboxReply) {
+		r.Status = db.OutboxDead
+		r.LastError = errMsg
+	})
+}
+
+func (s *Store) updateOutbox(id string, fn func(r *db.OutboxReply)) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.Outbox {
+		if r.ID == id {
+			fn(r)
+			r.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return errNotFound("outbox_reply", id)
+}
+
+func (s *Store) ListOutboxReplies(_ context.Context, status string, limit, offset int) ([]*db.OutboxReply, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*db.OutboxReply
+	for i := len(s.Outbox) - 1; i >= 0; i-- {
+		if status == "" || s.Outbox[i].Status == status {
+			result = append(result, s.Outbox[i])
+		}
+	}
+	if offset >= len(result) {
+		return nil, s.ErrDefault
+	}
+	end := offset + limit
+	if end > len(result) {
+		end = len(result)
+	}
+	return result[offset:end], s.ErrDefault
+}
+
+func (s *Store) ResendOutboxReply(_ context.Context, id string) (*db.OutboxReply, error) {
+	if s.ErrDefault != nil {
+		return nil, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.Outbox {
+		if r.ID == id && r.Status == db.OutboxDead {
+			now := time.Now()
+			r.Status = db.OutboxPending
+			r.Attempts = 0
+			r.NextAttemptAt = now
+			r.UpdatedAt = now
+			return r, nil
+		}
+	}
+	return nil, errNotFound("outbox_reply", id)
+}
+
+// --- Webhook Dedup ---
+
+func (s *Store) RecordWebhookDelivery(_ context.Context, delivery *db.WebhookDelivery) (bool, error) {
+	if s.ErrDefault != nil {
+		return false, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.Webhooks {
+		if w.EventUUID == delivery.EventUUID {
+			return false, nil
+		}
+	}
 	delivery.ID = s.nextID()
+	delivery.Processed = true
 	delivery.CreatedAt = time.Now()
 	s.Webhooks = append(s.Webhooks, delivery)
+	return true, nil
+}
+
+func (s *Store) ForgetWebhookDelivery(_ context.Context, eventUUID string) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, w := range s.Webhooks {
+		if w.EventUUID == eventUUID {
+			s.Webhooks = append(s.Webhooks[:i], s.Webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebhookDeliveries(_ context.Context, before time.Time) (int64, error) {
+	if s.ErrDefault != nil {
+		return 0, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.Webhooks[:0]
+	for _, w := range s.Webhooks {
+		if !w.CreatedAt.Before(before) {
+			kept = append(kept, w)
+		}
+	}
+	n := int64(len(s.Webhooks) - len(kept))
+	s.Webhooks = kept
+	return n, nil
+}
+
+// --- Inbound Webhooks ---
+
+func (s *Store) CreateInboundWebhook(_ context.Context, w *db.InboundWebhook) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.ID = s.nextID()
+	if w.Outcome == "" {
+		w.Outcome = db.WebhookReceived
+	}
+	w.CreatedAt = time.Now()
+	s.InboundWebhooks = append(s.InboundWebhooks, w)
 	return nil
 }
 
+func (s *Store) GetInboundWebhook(_ context.Context, id string) (*db.InboundWebhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, w := range s.InboundWebhooks {
+		if w.ID == id {
+			// A copy, as messages of the webhook update it in the background.
+			c := *w
+			return &c, nil
+		}
+	}
+	return nil, errNotFound("inbound_webhook", id)
+}
+
+func (s *Store) ListInboundWebhooks(_ context.Context, f db.InboundWebhookFilter, limit, offset int) ([]*db.InboundWebhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*db.InboundWebhook
+	for i := len(s.InboundWebhooks) - 1; i >= 0; i-- {
+		w := s.InboundWebhooks[i]
+		if (f.ProviderConfigID == "" || w.ProviderConfigID == f.ProviderConfigID) &&
+			(f.ProviderType == "" || w.ProviderType == f.ProviderType) &&
+			(f.Outcome == "" || w.Outcome == f.Outcome) {
+			result = append(result, w)
+		}
+	}
+	if offset >= len(result) {
+		return nil, s.ErrDefault
+	}
+	end := offset + limit
+	if end > len(result) {
+		end = len(result)
+	}
+	return result[offset:end], s.ErrDefault
+}
+
+func (s *Store) FinishInboundWebhook(_ context.Context, id string, statusCode int, outcome, body string, bodyTruncated bool) error {
+	return s.updateInboundWebhook(id, func(w *db.InboundWebhook) {
+		w.StatusCode = statusCode
+		w.Body = body
+		w.BodyTruncated = bodyTruncated
+		if w.Outcome == db.WebhookReceived {
+			w.Outcome = outcome
+		}
+	})
+}
+
+func (s *Store) SetInboundWebhookOutcome(_ context.Context, id, outcome string, taskID *string) error {
+	return s.updateInboundWebhook(id, func(w *db.InboundWebhook) {
+		if w.Outcome != db.WebhookTaskCreated {
+			w.Outcome = outcome
+		}
+		if w.TaskID == nil {
+			w.TaskID = taskID
+		}
+	})
+}
+
+func (s *Store) updateInboundWebhook(id string, fn func(w *db.InboundWebhook)) error {
+	if s.ErrDefault != nil {
+		return s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range s.InboundWebhooks {
+		if w.ID == id {
+			fn(w)
+			return nil
+		}
+	}
+	return errNotFound("inbound_webhook", id)
+}
+
+func (s *Store) DeleteInboundWebhooks(_ context.Context, before time.Time) (int64, error) {
+	if s.ErrDefault != nil {
+		return 0, s.ErrDefault
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.InboundWebhooks[:0]
+	for _, w := range s.InboundWebhooks {
+		if !w.CreatedAt.Before(before) {
+			kept = append(kept, w)
+		}
+	}
+	n := int64(len(s.InboundWebhooks) - len(kept))
+	s.InboundWebhooks = kept
+	return n, nil
+}
+
 // --- Settings ---
 
 func (s *Store) GetSetting(_ context.Context, key string) (*db.Setting, error) {
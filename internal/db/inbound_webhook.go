@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const inboundWebhookColumns = `id, provider_config_id, provider_type, method, path, headers, body, body_truncated, status_code, outcome, task_id, replay_of, created_at`
+
+func scanInboundWebhook(row pgx.Row) (*InboundWebhook, error) {
+	w := &InboundWebhook{}
+	err := row.Scan(&w.ID, &w.ProviderConfigID, &w.ProviderType, &w.Method, &w.Path, &w.Headers, &w.Body, &w.BodyTruncated, &w.StatusCode, &w.Outcome, &w.TaskID, &w.ReplayOf, &w.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (d *DB) CreateInboundWebhook(ctx context.Context, w *InboundWebhook) error {
+	if w.Outcome == "" {
+		w.Outcome = WebhookReceived
+	}
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO inbound_webhooks (provider_config_id, provider_type, method, path, headers, body, body_truncated, outcome, replay_of)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		 RETURNING id, created_at`,
+		w.ProviderConfigID, w.ProviderType, w.Method, w.Path, w.Headers, w.Body, w.BodyTruncated, w.Outcome, w.ReplayOf,
+	).Scan(&w.ID, &w.CreatedAt)
+}
+
+func (d *DB) GetInboundWebhook(ctx context.Context, id string) (*InboundWebhook, error) {
+	return scanInboundWebhook(d.Pool.QueryRow(ctx, `SELECT `+inboundWebhookColumns+` FROM inbound_webhooks WHERE id=$1`, id))
+}
+
+func (d *DB) ListInboundWebhooks(ctx context.Context, f InboundWebhookFilter, limit, offset int) ([]*InboundWebhook, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+inboundWebhookColumns+` FROM inbound_webhooks
+		 WHERE ($1='' OR provider_config_id::text=$1) AND ($2='' OR provider_type=$2) AND ($3='' OR outcome=$3)
+		 ORDER BY created_at DESC LIMIT $4 OFFSET $5`,
+		f.ProviderConfigID, f.ProviderType, f.Outcome, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var webhooks []*InboundWebhook
+	for rows.Next() {
+		w, err := scanInboundWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// FinishInboundWebhook records the status code of the answer, the body kept
+// of the request and, while the webhook is still only received, outcome. A
+// message handled before the answer was sent has already set the outcome.
+func (d *DB) FinishInboundWebhook(ctx context.Context, id string, statusCode int, outcome, body string, bodyTruncated bool) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE inbound_webhooks SET status_code=$2, body=$4, body_truncated=$5,
+		     outcome = CASE WHEN outcome='received' THEN $3 ELSE outcome END
+		 WHERE id=$1`, id, statusCode, outcome, body, bodyTruncated)
+	return err
+}
+
+// SetInboundWebhookOutcome records the outcome of a message of the webhook,
+// keeping task_created and the task of an earlier message of the same
+// webhook.
+func (d *DB) SetInboundWebhookOutcome(ctx context.Context, id, outcome string, taskID *string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE inbound_webhooks SET
+		     outcome = CASE WHEN outcome='task_created' THEN outcome ELSE $2 END,
+		     task_id = COALESCE(task_id, $3)
+		 WHERE id=$1`, id, outcome, taskID)
+	return err
+}
+
+func (d *DB) DeleteInboundWebhooks(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := d.Pool.Exec(ctx, `DELETE FROM inbound_webhooks WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
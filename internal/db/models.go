@@ -24,14 +24,23 @@ type SSHKey struct {
 }
 
 type Project struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	SSHURL        string    `json:"ssh_url"`
-	SSHKeyID      *string   `json:"ssh_key_id,omitempty"`
-	DefaultBranch string    `json:"default_branch"`
-	Enabled       bool      `json:"enabled"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	SSHURL         string   `json:"ssh_url"`
+	SSHKeyID       *string  `json:"ssh_key_id,omitempty"`
+	DefaultBranch  string   `json:"default_branch"`
+	VerifyCommands []string `json:"verify_commands"`
+	// PipelineAnalysis enables automatic analysis of failed CI jobs on the
+	// branches matching PipelineBranches (the default branch if empty) and the
+	// jobs matching PipelineJobs (all if empty), at most once per branch and
+	// job every PipelineCooldownMinutes (0 means no limit).
+	PipelineAnalysis        bool      `json:"pipeline_analysis"`
+	PipelineBranches        []string  `json:"pipeline_branches"`
+	PipelineJobs            []string  `json:"pipeline_jobs"`
+	PipelineCooldownMinutes int       `json:"pipeline_cooldown_minutes"`
+	Enabled                 bool      `json:"enabled"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
 }
 
 type ProviderConfig struct {
@@ -61,23 +70,119 @@ type TriggerKeyword struct {
 }
 
 type Task struct {
-	ID               string     `json:"id"`
-	ProjectID        *string    `json:"project_id,omitempty"`
-	ProviderConfigID *string    `json:"provider_config_id,omitempty"`
-	ProviderType     string     `json:"provider_type"`
-	TriggerMode      string     `json:"trigger_mode"`
-	TriggerKeyword   string     `json:"trigger_keyword"`
-	ExternalRef      string     `json:"external_ref"`
-	Title            string     `json:"title"`
-	MessageBody      string     `json:"message_body"`
-	Author           string     `json:"author"`
-	Status           TaskStatus `json:"status"`
-	Result           *string    `json:"result,omitempty"`
-	ErrorMessage     *string    `json:"error_message,omitempty"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
-	StartedAt        *time.Time `json:"started_at,omitempty"`
-	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	ID               string          `json:"id"`
+	ParentTaskID     *string         `json:"parent_task_id,omitempty"`
+	ProjectID        *string         `json:"project_id,omitempty"`
+	ProviderConfigID *string         `json:"provider_config_id,omitempty"`
+	ProviderType     string          `json:"provider_type"`
+	TriggerMode      string          `json:"trigger_mode"`
+	TriggerKeyword   string          `json:"trigger_keyword"`
+	ExternalRef      string          `json:"external_ref"`
+	ThreadKey        string          `json:"thread_key,omitempty"`
+	Ref              string          `json:"ref,omitempty"`
+	Title            string          `json:"title"`
+	MessageBody      string          `json:"message_body"`
+	Author           string          `json:"author"`
+	ReplyMeta        json.RawMessage `json:"reply_meta,omitempty"`
+	Status           TaskStatus      `json:"status"`
+	Attempts         int             `json:"attempts"`
+	LeaseExpiresAt   *time.Time      `json:"lease_expires_at,omitempty"`
+	Result           *string         `json:"result,omitempty"`
+	ErrorMessage     *string         `json:"error_message,omitempty"`
+	VerifyStatus     string          `json:"verify_status,omitempty"`
+	VerifyLog        string          `json:"verify_log,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	StartedAt        *time.Time      `json:"started_at,omitempty"`
+	CompletedAt      *time.Time      `json:"completed_at,omitempty"`
+}
+
+// Outcomes of a project's verification commands, stored as a task's
+// VerifyStatus. Tasks that ran no verification have an empty status.
+const (
+	VerifyPassed = "passed"
+	VerifyFailed = "failed"
+)
+
+const (
+	MessageInbound  = "inbound"
+	MessageOutbound = "outbound"
+)
+
+const (
+	MessageKindTrigger       = "trigger"
+	MessageKindAck           = "ack"
+	MessageKindResult        = "result"
+	MessageKindError         = "error"
+	MessageKindNotice        = "notice"
+	MessageKindReviewComment = "review_comment"
+)
+
+// TaskMessage records a chat message tied to a task: the inbound message that
+// triggered it, or a reply the bot posted. ExternalID and Channel are the
+// provider's own identifiers (GitLab note ID; Slack channel and ts; Telegram
+// chat and message_id), so the message can be edited or linked to later.
+type TaskMessage struct {
+	ID           string    `json:"id"`
+	TaskID       string    `json:"task_id"`
+	Direction    string    `json:"direction"`
+	Kind         string    `json:"kind"`
+	ProviderType string    `json:"provider_type"`
+	ExternalID   string    `json:"external_id"`
+	Channel      string    `json:"channel,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TaskEvent is an entry in a task's progress log, e.g. a tool call made by
+// OpenCode while the task was running.
+type TaskEvent struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation maps a chat thread (GitLab issue, Slack thread, Telegram reply
+// chain) to the OpenCode session that holds its history, so follow-ups in the
+// thread continue where the previous task left off.
+type Conversation struct {
+	ID               string    `json:"id"`
+	ProviderConfigID string    `json:"provider_config_id"`
+	ThreadKey        string    `json:"thread_key"`
+	SessionID        string    `json:"session_id"`
+	Directory        string    `json:"directory,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	LastUsedAt       time.Time `json:"last_used_at"`
+}
+
+// Outbox reply statuses. A pending reply is retried until it is delivered or
+// runs out of attempts and is dead.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// OutboxReply is a closing reply of a task queued for delivery to its channel.
+// PartsSent and Uploaded record the progress of a reply split into several
+// messages or uploaded as a file, so a retry resumes where the last attempt
+// stopped.
+type OutboxReply struct {
+	ID            string     `json:"id"`
+	TaskID        string     `json:"task_id"`
+	Kind          string     `json:"kind"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	PartsSent     int        `json:"parts_sent"`
+	Uploaded      bool       `json:"uploaded"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
 }
 
 type WebhookDelivery struct {
@@ -89,6 +194,48 @@ type WebhookDelivery struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Outcomes of an inbound webhook. A webhook is received until its handler
+// answers; it is then rejected (a non-2xx answer, such as a bad signature) or
+// ignored (nothing in it to handle), unless a message it carried was handled,
+// in which case it records what came of that. A created task is never
+// overwritten by the outcome of another message of the same webhook.
+const (
+	WebhookReceived    = "received"
+	WebhookRejected    = "rejected"
+	WebhookIgnored     = "ignored"
+	WebhookNoKeyword   = "no_keyword"
+	WebhookDuplicate   = "duplicate"
+	WebhookFailed      = "failed"
+	WebhookTaskCreated = "task_created"
+)
+
+// InboundWebhook is a request received on a provider config's webhook route.
+// Headers holds the request headers, with secrets redacted, as a JSON object
+// of string arrays. Body is cut at webhook_log_max_body bytes, in which case
+// BodyTruncated is set and the webhook cannot be replayed.
+type InboundWebhook struct {
+	ID               string          `json:"id"`
+	ProviderConfigID string          `json:"provider_config_id"`
+	ProviderType     string          `json:"provider_type"`
+	Method           string          `json:"method"`
+	Path             string          `json:"path"`
+	Headers          json.RawMessage `json:"headers"`
+	Body             string          `json:"body"`
+	BodyTruncated    bool            `json:"body_truncated"`
+	StatusCode       int             `json:"status_code"`
+	Outcome          string          `json:"outcome"`
+	TaskID           *string         `json:"task_id,omitempty"`
+	ReplayOf         *string         `json:"replay_of,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+// InboundWebhookFilter selects inbound webhooks; empty fields match all.
+type InboundWebhookFilter struct {
+	ProviderConfigID string
+	ProviderType     string
+	Outcome          string
+}
+
 type Setting struct {
 	Key       string          `json:"key"`
 	Value     json.RawMessage `json:"value"`
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const outboxColumns = `id, task_id, kind, body, status, attempts, parts_sent, uploaded, last_error, next_attempt_at, created_at, updated_at, delivered_at`
+
+func scanOutboxReply(row pgx.Row) (*OutboxReply, error) {
+	r := &OutboxReply{}
+	err := row.Scan(&r.ID, &r.TaskID, &r.Kind, &r.Body, &r.Status, &r.Attempts, &r.PartsSent, &r.Uploaded, &r.LastError, &r.NextAttemptAt, &r.CreatedAt, &r.UpdatedAt, &r.DeliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CreateOutboxReply inserts a pending reply on behalf of a caller that is
+// about to deliver it: the attempt is counted and the reply is only due for
+// the dispatcher once lease has passed, i.e. if the caller never settles it.
+func (d *DB) CreateOutboxReply(ctx context.Context, r *OutboxReply, lease time.Duration) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO reply_outbox (task_id, kind, body, attempts, next_attempt_at)
+		 VALUES ($1,$2,$3,1,NOW() + make_interval(secs => $4))
+		 RETURNING id, status, attempts, next_attempt_at, created_at, updated_at`,
+		r.TaskID, r.Kind, r.Body, lease.Seconds(),
+	).Scan(&r.ID, &r.Status, &r.Attempts, &r.NextAttemptAt, &r.CreatedAt, &r.UpdatedAt)
+}
+
+func (d *DB) GetOutboxReply(ctx context.Context, id string) (*OutboxReply, error) {
+	return scanOutboxReply(d.Pool.QueryRow(ctx, `SELECT `+outboxColumns+` FROM reply_outbox WHERE id=$1`, id))
+}
+
+// ClaimOutboxReply takes the pending reply that has been due the longest,
+// counts an attempt and postpones it by lease so no other dispatcher picks it
+// up meanwhile. FOR UPDATE SKIP LOCKED keeps concurrent instances from
+// claiming the same row. Returns (nil, nil) when nothing is due.
+func (d *DB) ClaimOutboxReply(ctx context.Context, lease time.Duration) (*OutboxReply, error) {
+	r, err := scanOutboxReply(d.Pool.QueryRow(ctx,
+		`UPDATE reply_outbox SET attempts=attempts+1, next_attempt_at=NOW() + make_interval(secs => $1), updated_at=NOW()
+		 WHERE id = (
+		     SELECT id FROM reply_outbox
+		     WHERE status='pending' AND next_attempt_at <= NOW()
+		     ORDER BY next_attempt_at
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+outboxColumns, lease.Seconds()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return r, err
+}
+
+func (d *DB) UpdateOutboxProgress(ctx context.Context, id string, partsSent int, uploaded bool) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE reply_outbox SET parts_sent=$2, uploaded=$3, updated_at=NOW() WHERE id=$1`, id, partsSent, uploaded)
+	return err
+}
+
+func (d *DB) CompleteOutboxReply(ctx context.Context, id string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE reply_outbox SET status='delivered', last_error='', delivered_at=NOW(), updated_at=NOW() WHERE id=$1`, id)
+	return err
+}
+
+func (d *DB) RetryOutboxReply(ctx context.Context, id, errMsg string, at time.Time) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE reply_outbox SET last_error=$2, next_attempt_at=$3, updated_at=NOW() WHERE id=$1`, id, errMsg, at)
+	return err
+}
+
+func (d *DB) FailOutboxReply(ctx context.Context, id, errMsg string) error {
+	_, err := d.Pool.Exec(ctx,
+		`UPDATE reply_outbox SET status='dead', last_error=$2, updated_at=NOW() WHERE id=$1`, id, errMsg)
+	return err
+}
+
+func (d *DB) ListOutboxReplies(ctx context.Context, status string, limit, offset int) ([]*OutboxReply, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT `+outboxColumns+` FROM reply_outbox WHERE ($1='' OR status=$1)
+		 ORDER BY created_at DESC LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var replies []*OutboxReply
+	for rows.Next() {
+		r, err := scanOutboxReply(rows)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, r)
+	}
+	return replies, rows.Err()
+}
+
+// ResendOutboxReply puts a dead reply back to pending, due now, with its
+// attempt counter reset. Delivery progress is kept, so parts already posted
+// are not posted again. Returns pgx.ErrNoRows if the reply does not exist or
+// is not dead.
+func (d *DB) ResendOutboxReply(ctx context.Context, id string) (*OutboxReply, error) {
+	return scanOutboxReply(d.Pool.QueryRow(ctx,
+		`UPDATE reply_outbox SET status='pending', attempts=0, next_attempt_at=NOW(), updated_at=NOW()
+		 WHERE id=$1 AND status='dead'
+		 RETURNING `+outboxColumns, id))
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (d *DB) ClaimPipelineAnalysis(ctx context.Context, projectID, ref, job string, cooldown time.Duration) (bool, error) {
+	var claimed bool
+	err := d.Pool.QueryRow(ctx,
+		`INSERT INTO pipeline_analyses (project_id, ref, job_name) VALUES ($1,$2,$3)
+		ON CONFLICT (project_id, ref, job_name) DO UPDATE SET last_run_at=NOW()
+		WHERE pipeline_analyses.last_run_at <= NOW() - make_interval(secs => $4)
+		RETURNING true`,
+		projectID, ref, job, cooldown.Seconds()).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return claimed, err
+}
+
+func (d *DB) ReleasePipelineAnalysis(ctx context.Context, projectID, ref, job string) error {
+	_, err := d.Pool.Exec(ctx,
+		`DELETE FROM pipeline_analyses WHERE project_id=$1 AND ref=$2 AND job_name=$3`, projectID, ref, job)
+	return err
+}
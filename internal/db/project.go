@@ -1,24 +1,44 @@
 package db
 
-import "context"
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const projectColumns = `id, name, ssh_url, ssh_key_id, default_branch, verify_commands,
+	pipeline_analysis, pipeline_branches, pipeline_jobs, pipeline_cooldown_minutes, enabled, created_at, updated_at`
+
+func scanProject(row pgx.Row) (*Project, error) {
+	p := &Project{}
+	if err := row.Scan(&p.ID, &p.Name, &p.SSHURL, &p.SSHKeyID, &p.DefaultBranch, &p.VerifyCommands,
+		&p.PipelineAnalysis, &p.PipelineBranches, &p.PipelineJobs, &p.PipelineCooldownMinutes,
+		&p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
 func (d *DB) CreateProject(ctx context.Context, p *Project) error {
 	return d.Pool.QueryRow(ctx,
-		`INSERT INTO projects (name, ssh_url, ssh_key_id, default_branch, enabled) VALUES ($1,$2,$3,$4,$5) RETURNING id, created_at, updated_at`,
-		p.Name, p.SSHURL, p.SSHKeyID, p.DefaultBranch, p.Enabled,
+		`INSERT INTO projects (name, ssh_url, ssh_key_id, default_branch, verify_commands,
+			pipeline_analysis, pipeline_branches, pipeline_jobs, pipeline_cooldown_minutes, enabled)
+		VALUES ($1,$2,$3,$4,COALESCE($5,'[]'::jsonb),$6,COALESCE($7,'[]'::jsonb),COALESCE($8,'[]'::jsonb),$9,$10) RETURNING id, created_at, updated_at`,
+		p.Name, p.SSHURL, p.SSHKeyID, p.DefaultBranch, p.VerifyCommands,
+		p.PipelineAnalysis, p.PipelineBranches, p.PipelineJobs, p.PipelineCooldownMinutes, p.Enabled,
 	).Scan(&p.ID, &p.CreatedAt, &p.UpdatedAt)
 }
 
 func (d *DB) ListProjects(ctx context.Context) ([]*Project, error) {
-	rows, err := d.Pool.Query(ctx, `SELECT id, name, ssh_url, ssh_key_id, default_branch, enabled, created_at, updated_at FROM projects ORDER BY created_at DESC`)
+	rows, err := d.Pool.Query(ctx, `SELECT `+projectColumns+` FROM projects ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var projects []*Project
 	for rows.Next() {
-		p := &Project{}
-		if err := rows.Scan(&p.ID, &p.Name, &p.SSHURL, &p.SSHKeyID, &p.DefaultBranch, &p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		p, err := scanProject(rows)
+		if err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -27,17 +47,16 @@ func (d *DB) ListProjects(ctx context.Context) ([]*Project, error) {
 }
 
 func (d *DB) GetProject(ctx context.Context, id string) (*Project, error) {
-	p := &Project{}
-	err := d.Pool.QueryRow(ctx,
-		`SELECT id, name, ssh_url, ssh_key_id, default_branch, enabled, created_at, updated_at FROM projects WHERE id=$1`, id).
-		Scan(&p.ID, &p.Name, &p.SSHURL, &p.SSHKeyID, &p.DefaultBranch, &p.Enabled, &p.CreatedAt, &p.UpdatedAt)
-	return p, err
+	return scanProject(d.Pool.QueryRow(ctx, `SELECT `+projectColumns+` FROM projects WHERE id=$1`, id))
 }
 
 func (d *DB) UpdateProject(ctx context.Context, p *Project) error {
 	_, err := d.Pool.Exec(ctx,
-		`UPDATE projects SET name=$2, ssh_url=$3, ssh_key_id=$4, default_branch=$5, enabled=$6 WHERE id=$1`,
-		p.ID, p.Name, p.SSHURL, p.SSHKeyID, p.DefaultBranch, p.Enabled)
+		`UPDATE projects SET name=$2, ssh_url=$3, ssh_key_id=$4, default_branch=$5, verify_commands=COALESCE($6,'[]'::jsonb),
+			pipeline_analysis=$7, pipeline_branches=COALESCE($8,'[]'::jsonb), pipeline_jobs=COALESCE($9,'[]'::jsonb),
+			pipeline_cooldown_minutes=$10, enabled=$11 WHERE id=$1`,
+		p.ID, p.Name, p.SSHURL, p.SSHKeyID, p.DefaultBranch, p.VerifyCommands,
+		p.PipelineAnalysis, p.PipelineBranches, p.PipelineJobs, p.PipelineCooldownMinutes, p.Enabled)
 	return err
 }
 
@@ -35,6 +35,13 @@ type Store interface {
 	GetProject(ctx context.Context, id string) (*Project, error)
 	UpdateProject(ctx context.Context, p *Project) error
 	DeleteProject(ctx context.Context, id string) error
+	// ClaimPipelineAnalysis records an automatic analysis of the failed job
+	// of a project's ref and reports whether it may run: false if one was
+	// claimed less than cooldown ago.
+	ClaimPipelineAnalysis(ctx context.Context, projectID, ref, job string, cooldown time.Duration) (bool, error)
+	// ReleasePipelineAnalysis deletes the claim of the failed job of a
+	// project's ref, ending its cooldown.
+	ReleasePipelineAnalysis(ctx context.Context, projectID, ref, job string) error
 
 	// --- Provider Configs ---
 
@@ -53,15 +60,104 @@ type Store interface {
 	// --- Tasks ---
 
 	CreateTask(ctx context.Context, t *Task) error
-	UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus, result *string, errMsg *string) error
+	// UpdateTaskStatus records the outcome of a processing task's attempt and
+	// reports whether the task was still held by that attempt.
+	UpdateTaskStatus(ctx context.Context, taskID string, attempt int, status TaskStatus, result *string, errMsg *string) (bool, error)
+	UpdateTaskRef(ctx context.Context, taskID, ref string) error
+	UpdateTaskVerification(ctx context.Context, taskID, status, log string) error
+	// ClaimNextTask moves the oldest eligible pending task to processing under
+	// a lease and returns it, or (nil, nil) if none is available. projectLimit
+	// caps how many tasks of one project may be processing at once (<= 0 means
+	// no cap); a task of a thread with a task processing is never claimed.
+	ClaimNextTask(ctx context.Context, projectLimit int, lease time.Duration) (*Task, error)
+	// RenewTaskLease extends a processing task's lease and reports whether the
+	// task is still processing under the given attempt.
+	RenewTaskLease(ctx context.Context, taskID string, attempt int, lease time.Duration) (bool, error)
+	// RecoverStaleTasks re-queues processing tasks whose lease expired and
+	// fails those that reached maxAttempts, returning the requeued count and
+	// the failed tasks.
+	RecoverStaleTasks(ctx context.Context, maxAttempts int, errMsg string) (int, []*Task, error)
+	// CancelTask marks a pending or processing task cancelled; it fails if the
+	// task does not exist or has already finished.
+	CancelTask(ctx context.Context, taskID string, reason string) (*Task, error)
 	ListTasks(ctx context.Context, limit, offset int) ([]*Task, error)
 	GetTask(ctx context.Context, id string) (*Task, error)
+	// GetLatestThreadTask returns the most recent task of a provider config's
+	// thread.
+	GetLatestThreadTask(ctx context.Context, providerConfigID, threadKey string) (*Task, error)
 	CountTasks(ctx context.Context) (int, error)
 
+	// --- Task Messages ---
+
+	CreateTaskMessage(ctx context.Context, m *TaskMessage) error
+	ListTaskMessages(ctx context.Context, taskID string) ([]*TaskMessage, error)
+	// GetThreadKeyByMessage returns the thread key of the task a provider
+	// message belongs to.
+	GetThreadKeyByMessage(ctx context.Context, providerType, channel, externalID string) (string, error)
+
+	// --- Task Events ---
+
+	CreateTaskEvent(ctx context.Context, e *TaskEvent) error
+	ListTaskEvents(ctx context.Context, taskID string) ([]*TaskEvent, error)
+
+	// --- Conversations ---
+
+	GetConversation(ctx context.Context, providerConfigID, threadKey string) (*Conversation, error)
+	// SaveConversation upserts the conversation of a thread and marks it used.
+	SaveConversation(ctx context.Context, c *Conversation) error
+	TouchConversation(ctx context.Context, id string) error
+	DeleteConversation(ctx context.Context, id string) error
+	ListIdleConversations(ctx context.Context, before time.Time) ([]*Conversation, error)
+
+	// --- Reply Outbox ---
+
+	// CreateOutboxReply queues a reply already claimed by the caller: its
+	// first attempt is counted and it is not due again until lease has passed.
+	CreateOutboxReply(ctx context.Context, r *OutboxReply, lease time.Duration) error
+	GetOutboxReply(ctx context.Context, id string) (*OutboxReply, error)
+	// ClaimOutboxReply counts an attempt of the oldest due pending reply and
+	// postpones it by lease, or returns (nil, nil) if none is due.
+	ClaimOutboxReply(ctx context.Context, lease time.Duration) (*OutboxReply, error)
+	UpdateOutboxProgress(ctx context.Context, id string, partsSent int, uploaded bool) error
+	CompleteOutboxReply(ctx context.Context, id string) error
+	// RetryOutboxReply records a failed attempt and schedules the next one.
+	RetryOutboxReply(ctx context.Context, id, errMsg string, at time.Time) error
+	// FailOutboxReply records a failed attempt and marks the reply dead.
+	FailOutboxReply(ctx context.Context, id, errMsg string) error
+	// ListOutboxReplies lists replies newest first, only those with status
+	// if it is not empty.
+	ListOutboxReplies(ctx context.Context, status string, limit, offset int) ([]*OutboxReply, error)
+	// ResendOutboxReply makes a dead reply pending again with a fresh set of
+	// attempts; it fails if the reply does not exist or is not dead.
+	ResendOutboxReply(ctx context.Context, id string) (*OutboxReply, error)
+
 	// --- Webhook Dedup ---
 
-	IsWebhookProcessed(ctx context.Context, eventUUID string) (bool, error)
-	RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// RecordWebhookDelivery atomically records a delivery unless its
+	// EventUUID was recorded before, and reports whether it was new.
+	RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	// ForgetWebhookDelivery deletes the delivery of an event, so that a
+	// redelivery of it is handled again.
+	ForgetWebhookDelivery(ctx context.Context, eventUUID string) error
+	// DeleteWebhookDeliveries deletes deliveries recorded before the given
+	// time and returns how many it deleted.
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// --- Inbound Webhooks ---
+
+	CreateInboundWebhook(ctx context.Context, w *InboundWebhook) error
+	GetInboundWebhook(ctx context.Context, id string) (*InboundWebhook, error)
+	ListInboundWebhooks(ctx context.Context, f InboundWebhookFilter, limit, offset int) ([]*InboundWebhook, error)
+	// FinishInboundWebhook records the status code a webhook was answered
+	// with, the body kept of it, and outcome unless one of its messages
+	// already set another.
+	FinishInboundWebhook(ctx context.Context, id string, statusCode int, outcome, body string, bodyTruncated bool) error
+	// SetInboundWebhookOutcome records what came of a message of the
+	// webhook. It does not overwrite WebhookTaskCreated.
+	SetInboundWebhookOutcome(ctx context.Context, id, outcome string, taskID *string) error
+	// DeleteInboundWebhooks deletes webhooks received before the given time
+	// and returns how many it deleted.
+	DeleteInboundWebhooks(ctx context.Context, before time.Time) (int64, error)
 
 	// --- Settings ---
 
@@ -2,45 +2,193 @@ package db
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
+const taskColumns = `id, parent_task_id, project_id, provider_config_id, provider_type, trigger_mode, trigger_keyword, external_ref, thread_key, ref, title, message_body, author, reply_meta, status, attempts, lease_expires_at, result, error_message, verify_status, verify_log, created_at, updated_at, started_at, completed_at`
+
+func scanTask(row pgx.Row) (*Task, error) {
+	t := &Task{}
+	err := row.Scan(&t.ID, &t.ParentTaskID, &t.ProjectID, &t.ProviderConfigID, &t.ProviderType, &t.TriggerMode, &t.TriggerKeyword, &t.ExternalRef, &t.ThreadKey, &t.Ref, &t.Title, &t.MessageBody, &t.Author, &t.ReplyMeta, &t.Status, &t.Attempts, &t.LeaseExpiresAt, &t.Result, &t.ErrorMessage, &t.VerifyStatus, &t.VerifyLog, &t.CreatedAt, &t.UpdatedAt, &t.StartedAt, &t.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
 func (d *DB) CreateTask(ctx context.Context, t *Task) error {
 	return d.Pool.QueryRow(ctx,
-		`INSERT INTO tasks (project_id, provider_config_id, provider_type, trigger_mode, trigger_keyword, external_ref, title, message_body, author)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING id, created_at, updated_at`,
+		`INSERT INTO tasks (project_id, provider_config_id, provider_type, trigger_mode, trigger_keyword, external_ref, title, message_body, author, reply_meta, parent_task_id, thread_key, ref)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,COALESCE($10,'{}'::jsonb),$11,$12,$13) RETURNING id, status, created_at, updated_at`,
 		t.ProjectID, t.ProviderConfigID, t.ProviderType, t.TriggerMode, t.TriggerKeyword,
-		t.ExternalRef, t.Title, t.MessageBody, t.Author,
-	).Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+		t.ExternalRef, t.Title, t.MessageBody, t.Author, t.ReplyMeta, t.ParentTaskID, t.ThreadKey, t.Ref,
+	).Scan(&t.ID, &t.Status, &t.CreatedAt, &t.UpdatedAt)
 }
 
-func (d *DB) UpdateTaskStatus(ctx context.Context, taskID string, status TaskStatus, result *string, errMsg *string) error {
-	now := time.Now()
-	var startedAt, completedAt *time.Time
+// UpdateTaskStatus records the outcome of attempt, the attempt counter
+// returned by the claim, of a processing task. The attempt fences the update:
+// a worker whose lease expired, and whose task was since cancelled or claimed
+// again by another worker, must not overwrite it. It reports false when the
+// task was no longer held by attempt.
+func (d *DB) UpdateTaskStatus(ctx context.Context, taskID string, attempt int, status TaskStatus, result *string, errMsg *string) (bool, error) {
+	var completedAt *time.Time
 	switch status {
-	case TaskStatusProcessing:
-		startedAt = &now
-	case TaskStatusCompleted, TaskStatusFailed:
+	case TaskStatusCompleted, TaskStatusFailed, TaskStatusCancelled:
+		now := time.Now()
 		completedAt = &now
 	}
-	_, err := d.Pool.Exec(ctx,
-		`UPDATE tasks SET status=$2, result=$3, error_message=$4, started_at=COALESCE($5, started_at), completed_at=COALESCE($6, completed_at) WHERE id=$1`,
-		taskID, status, result, errMsg, startedAt, completedAt)
+	tag, err := d.Pool.Exec(ctx,
+		`UPDATE tasks SET status=$3, result=$4, error_message=$5, lease_expires_at=NULL, completed_at=COALESCE($6, completed_at)
+		 WHERE id=$1 AND attempts=$2 AND status='processing'`,
+		taskID, attempt, status, result, errMsg, completedAt)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// UpdateTaskRef records the ref a task actually analyzed.
+func (d *DB) UpdateTaskRef(ctx context.Context, taskID, ref string) error {
+	_, err := d.Pool.Exec(ctx, `UPDATE tasks SET ref=$2 WHERE id=$1`, taskID, ref)
+	return err
+}
+
+// UpdateTaskVerification records the outcome and output of a task's
+// verification commands.
+func (d *DB) UpdateTaskVerification(ctx context.Context, taskID, status, log string) error {
+	_, err := d.Pool.Exec(ctx, `UPDATE tasks SET verify_status=$2, verify_log=$3 WHERE id=$1`, taskID, status, log)
 	return err
 }
 
+// CancelTask marks a pending or processing task as cancelled, recording reason
+// as its error message. started_at is left untouched (NULL for a task that
+// never ran) and completed_at is set. Returns pgx.ErrNoRows if the task does
+// not exist or has already finished.
+func (d *DB) CancelTask(ctx context.Context, taskID string, reason string) (*Task, error) {
+	return scanTask(d.Pool.QueryRow(ctx,
+		`UPDATE tasks SET status='cancelled', error_message=$2, lease_expires_at=NULL, completed_at=NOW()
+		 WHERE id=$1 AND status IN ('pending','processing')
+		 RETURNING `+taskColumns, taskID, reason))
+}
+
+// ClaimNextTask atomically moves the oldest pending task to processing,
+// increments its attempt counter, grants it a lease of the given duration and
+// returns it. Tasks whose project already has projectLimit tasks processing
+// are skipped (projectLimit <= 0 disables the per-project cap), as are tasks
+// of a conversation thread that already has a task processing: a thread's
+// tasks run one at a time, in order. Returns (nil, nil) when there is nothing
+// eligible to claim.
+//
+// Claims are serialized with a transaction-scoped advisory lock so the
+// per-project and per-thread checks cannot be raced by concurrent workers; FOR UPDATE SKIP
+// LOCKED additionally keeps multiple instances from grabbing the same row.
+func (d *DB) ClaimNextTask(ctx context.Context, projectLimit int, lease time.Duration) (*Task, error) {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('tasks_claim'))`); err != nil {
+		return nil, err
+	}
+
+	t, err := scanTask(tx.QueryRow(ctx,
+		`UPDATE tasks SET status='processing', started_at=NOW(), attempts=attempts+1,
+		     lease_expires_at=NOW() + make_interval(secs => $2)
+		 WHERE id = (
+		     SELECT c.id FROM tasks c
+		     WHERE c.status='pending'
+		       AND ($1 <= 0 OR c.project_id IS NULL OR
+		            (SELECT COUNT(*) FROM tasks p WHERE p.project_id=c.project_id AND p.status='processing') < $1)
+		       AND (c.thread_key = '' OR NOT EXISTS (
+		            SELECT 1 FROM tasks p WHERE p.status='processing' AND p.thread_key=c.thread_key
+		              AND p.provider_config_id IS NOT DISTINCT FROM c.provider_config_id))
+		     ORDER BY c.created_at
+		     LIMIT 1
+		     FOR UPDATE SKIP LOCKED
+		 )
+		 RETURNING `+taskColumns, projectLimit, lease.Seconds()))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit(ctx)
+}
+
+// RenewTaskLease extends the lease of a task that is still processing under
+// attempt. It is called periodically by the worker running the task as a
+// heartbeat, and reports false once the task is no longer processing (e.g. it
+// was cancelled) or was claimed again after its lease expired, telling the
+// worker to stop.
+func (d *DB) RenewTaskLease(ctx context.Context, taskID string, attempt int, lease time.Duration) (bool, error) {
+	tag, err := d.Pool.Exec(ctx,
+		`UPDATE tasks SET lease_expires_at=NOW() + make_interval(secs => $3) WHERE id=$1 AND attempts=$2 AND status='processing'`,
+		taskID, attempt, lease.Seconds())
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RecoverStaleTasks finds processing tasks whose lease has expired (or that
+// never had one), i.e. tasks orphaned by a crashed or redeployed worker. Tasks
+// with fewer than maxAttempts attempts are put back to pending; the rest are
+// marked failed with errMsg and returned so the caller can notify the channel.
+func (d *DB) RecoverStaleTasks(ctx context.Context, maxAttempts int, errMsg string) (int, []*Task, error) {
+	tx, err := d.Pool.Begin(ctx)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE tasks SET status='pending', lease_expires_at=NULL
+		 WHERE status='processing' AND (lease_expires_at IS NULL OR lease_expires_at < NOW()) AND attempts < $1`,
+		maxAttempts)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	rows, err := tx.Query(ctx,
+		`UPDATE tasks SET status='failed', lease_expires_at=NULL, completed_at=NOW(), error_message=$1
+		 WHERE status='processing' AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+		 RETURNING `+taskColumns, errMsg)
+	if err != nil {
+		return 0, nil, err
+	}
+	var failed []*Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		failed = append(failed, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	return int(tag.RowsAffected()), failed, tx.Commit(ctx)
+}
+
 func (d *DB) ListTasks(ctx context.Context, limit, offset int) ([]*Task, error) {
 	rows, err := d.Pool.Query(ctx,
-		`SELECT id, project_id, provider_config_id, provider_type, trigger_mode, trigger_keyword, external_ref, title, message_body, author, status, result, error_message, created_at, updated_at, started_at, completed_at
-		 FROM tasks ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+		`SELECT `+taskColumns+` FROM tasks ORDER BY created_at DESC LIMIT $1 OFFSET $2`, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	var tasks []*Task
 	for rows.Next() {
-		t := &Task{}
-		if err := rows.Scan(&t.ID, &t.ProjectID, &t.ProviderConfigID, &t.ProviderType, &t.TriggerMode, &t.TriggerKeyword, &t.ExternalRef, &t.Title, &t.MessageBody, &t.Author, &t.Status, &t.Result, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.StartedAt, &t.CompletedAt); err != nil {
+		t, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, t)
@@ -49,14 +197,15 @@ func (d *DB) ListTasks(ctx context.Context, limit, offset int) ([]*Task, error)
 }
 
 func (d *DB) GetTask(ctx context.Context, id string) (*Task, error) {
-	t := &Task{}
-	err := d.Pool.QueryRow(ctx,
-		`SELECT id, project_id, provider_config_id, provider_type, trigger_mode, trigger_keyword, external_ref, title, message_body, author, status, result, error_message, created_at, updated_at, started_at, completed_at
-		 FROM tasks WHERE id=$1`, id).Scan(&t.ID, &t.ProjectID, &t.ProviderConfigID, &t.ProviderType, &t.TriggerMode, &t.TriggerKeyword, &t.ExternalRef, &t.Title, &t.MessageBody, &t.Author, &t.Status, &t.Result, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.StartedAt, &t.CompletedAt)
-	if err != nil {
-		return nil, err
-	}
-	return t, nil
+	return scanTask(d.Pool.QueryRow(ctx, `SELECT `+taskColumns+` FROM tasks WHERE id=$1`, id))
+}
+
+// GetLatestThreadTask returns the most recently created task of the thread
+// threadKey of a provider config.
+func (d *DB) GetLatestThreadTask(ctx context.Context, providerConfigID, threadKey string) (*Task, error) {
+	return scanTask(d.Pool.QueryRow(ctx,
+		`SELECT `+taskColumns+` FROM tasks WHERE provider_config_id=$1 AND thread_key=$2
+		 ORDER BY created_at DESC LIMIT 1`, providerConfigID, threadKey))
 }
 
 func (d *DB) CountTasks(ctx context.Context) (int, error) {
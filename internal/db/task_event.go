@@ -0,0 +1,29 @@
+package db
+
+import "context"
+
+func (d *DB) CreateTaskEvent(ctx context.Context, e *TaskEvent) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO task_events (task_id, kind, message) VALUES ($1,$2,$3) RETURNING id, created_at`,
+		e.TaskID, e.Kind, e.Message,
+	).Scan(&e.ID, &e.CreatedAt)
+}
+
+// ListTaskEvents returns the progress log of a task, oldest first.
+func (d *DB) ListTaskEvents(ctx context.Context, taskID string) ([]*TaskEvent, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT id, task_id, kind, message, created_at FROM task_events WHERE task_id=$1 ORDER BY created_at, id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []*TaskEvent
+	for rows.Next() {
+		e := &TaskEvent{}
+		if err := rows.Scan(&e.ID, &e.TaskID, &e.Kind, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,45 @@
+package db
+
+import "context"
+
+func (d *DB) CreateTaskMessage(ctx context.Context, m *TaskMessage) error {
+	return d.Pool.QueryRow(ctx,
+		`INSERT INTO task_messages (task_id, direction, kind, provider_type, external_id, channel, url)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING id, created_at`,
+		m.TaskID, m.Direction, m.Kind, m.ProviderType, m.ExternalID, m.Channel, m.URL,
+	).Scan(&m.ID, &m.CreatedAt)
+}
+
+// ListTaskMessages returns the inbound and outbound messages of a task, oldest first.
+func (d *DB) ListTaskMessages(ctx context.Context, taskID string) ([]*TaskMessage, error) {
+	rows, err := d.Pool.Query(ctx,
+		`SELECT id, task_id, direction, kind, provider_type, external_id, channel, url, created_at
+		 FROM task_messages WHERE task_id=$1 ORDER BY created_at, id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var msgs []*TaskMessage
+	for rows.Next() {
+		m := &TaskMessage{}
+		if err := rows.Scan(&m.ID, &m.TaskID, &m.Direction, &m.Kind, &m.ProviderType, &m.ExternalID, &m.Channel, &m.URL, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// GetThreadKeyByMessage returns the thread key of the task that sent or
+// received the given provider message, so a reply to it can join the same
+// conversation. Returns pgx.ErrNoRows if the message is unknown.
+func (d *DB) GetThreadKeyByMessage(ctx context.Context, providerType, channel, externalID string) (string, error) {
+	var key string
+	err := d.Pool.QueryRow(ctx,
+		`SELECT t.thread_key FROM task_messages m JOIN tasks t ON t.id = m.task_id
+		 WHERE m.provider_type=$1 AND m.channel=$2 AND m.external_id=$3
+		 ORDER BY m.created_at DESC LIMIT 1`,
+		providerType, channel, externalID,
+	).Scan(&key)
+	return key, err
+}
@@ -1,16 +1,41 @@
 package db
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
 
-func (d *DB) IsWebhookProcessed(ctx context.Context, eventUUID string) (bool, error) {
-	var exists bool
-	err := d.Pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM webhook_deliveries WHERE event_uuid=$1)`, eventUUID).Scan(&exists)
-	return exists, err
+	"github.com/jackc/pgx/v5"
+)
+
+// RecordWebhookDelivery records a delivery as processed and reports whether
+// it is new. Checking and recording are one statement, so of two concurrent
+// deliveries of the same event exactly one is reported new.
+func (d *DB) RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error) {
+	err := d.Pool.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (event_uuid, event_type, payload_hash, processed) VALUES ($1,$2,$3,TRUE)
+		 ON CONFLICT (event_uuid) DO NOTHING
+		 RETURNING id, processed, created_at`,
+		delivery.EventUUID, delivery.EventType, delivery.PayloadHash,
+	).Scan(&delivery.ID, &delivery.Processed, &delivery.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
-func (d *DB) RecordWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
-	_, err := d.Pool.Exec(ctx,
-		`INSERT INTO webhook_deliveries (event_uuid, event_type, payload_hash) VALUES ($1,$2,$3) ON CONFLICT (event_uuid) DO NOTHING`,
-		delivery.EventUUID, delivery.EventType, delivery.PayloadHash)
+// ForgetWebhookDelivery deletes the delivery recorded for eventUUID, if any.
+func (d *DB) ForgetWebhookDelivery(ctx context.Context, eventUUID string) error {
+	_, err := d.Pool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE event_uuid=$1`, eventUUID)
 	return err
 }
+
+// DeleteWebhookDeliveries deletes the deliveries recorded before the given
+// time and returns how many there were.
+func (d *DB) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := d.Pool.Exec(ctx, `DELETE FROM webhook_deliveries WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
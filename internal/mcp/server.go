@@ -6,25 +6,31 @@ package mcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
+	"github.com/opencode-ai/opencode-dog/internal/auth"
 	"github.com/opencode-ai/opencode-dog/internal/db"
 )
 
 type Server struct {
 	mcpServer *server.MCPServer
 	database  db.Store
+	analyzer  *analyzer.Analyzer
 	logger    *slog.Logger
 }
 
-func NewServer(database db.Store, logger *slog.Logger) *Server {
+func NewServer(database db.Store, an *analyzer.Analyzer, logger *slog.Logger) *Server {
 	s := &Server{
 		database: database,
+		analyzer: an,
 		logger:   logger,
 	}
 
@@ -63,6 +69,18 @@ func (s *Server) registerTools() {
 	)
 	s.mcpServer.AddTool(getTask, s.handleGetTask)
 
+	cancelTask := mcp.NewTool("cancel_task",
+		mcp.WithDescription("Cancel a pending or running analysis task"),
+		mcp.WithString("task_id", mcp.Required(), mcp.Description("Task UUID")),
+	)
+	s.mcpServer.AddTool(cancelTask, s.handleCancelTask)
+
+	retryTask := mcp.NewTool("retry_task",
+		mcp.WithDescription("Re-run a finished analysis task, replying to the same channel"),
+		mcp.WithString("task_id", mcp.Required(), mcp.Description("Task UUID")),
+	)
+	s.mcpServer.AddTool(retryTask, s.handleRetryTask)
+
 	listProviders := mcp.NewTool("list_providers",
 		mcp.WithDescription("List provider configurations for a project"),
 		mcp.WithString("project_id", mcp.Required(), mcp.Description("Project UUID")),
@@ -147,6 +165,42 @@ func (s *Server) handleGetTask(ctx context.Context, request mcp.CallToolRequest)
 	return mcp.NewToolResultText(string(data)), nil
 }
 
+func (s *Server) handleCancelTask(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	taskID, err := request.RequireString("task_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	user, err := requireRole(ctx, db.RoleAdmin, db.RoleEditor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	task, err := s.analyzer.CancelTask(ctx, taskID, user.Username)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to cancel task: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Task %s cancelled (status: %s).", task.ID, task.Status)), nil
+}
+
+func (s *Server) handleRetryTask(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	taskID, err := request.RequireString("task_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	user, err := requireRole(ctx, db.RoleAdmin, db.RoleEditor)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	task, err := s.analyzer.RetryTask(ctx, taskID, user.Username)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to retry task: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Task %s queued as a retry of %s.", task.ID, taskID)), nil
+}
+
 func (s *Server) handleListProviders(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	projectID, err := request.RequireString("project_id")
 	if err != nil {
@@ -173,6 +227,20 @@ func (s *Server) handleListProviders(ctx context.Context, request mcp.CallToolRe
 	return mcp.NewToolResultText(sb.String()), nil
 }
 
+// requireRole returns the user calling a tool if their role is one of roles.
+// The endpoint is served behind auth.Middleware, which puts the user in the
+// request context tools are called with.
+func requireRole(ctx context.Context, roles ...string) (*auth.TokenClaims, error) {
+	user := auth.GetUser(ctx)
+	if user == nil {
+		return nil, errors.New("not authenticated")
+	}
+	if !slices.Contains(roles, user.Role) {
+		return nil, errors.New("insufficient permissions")
+	}
+	return user, nil
+}
+
 func (s *Server) GetServer() *server.MCPServer {
 	return s.mcpServer
 }
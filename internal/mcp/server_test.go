@@ -9,12 +9,16 @@ import (
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/opencode-ai/opencode-dog/internal/analyzer"
+	"github.com/opencode-ai/opencode-dog/internal/auth"
 	"github.com/opencode-ai/opencode-dog/internal/db"
 	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+	"github.com/opencode-ai/opencode-dog/internal/provider"
 )
 
 func newTestServer(store *dbmock.Store) *Server {
-	return NewServer(store, slog.Default())
+	an := analyzer.New(store, provider.NewRegistry(slog.Default()), slog.Default(), "", nil)
+	return NewServer(store, an, slog.Default())
 }
 
 func makeReq(args map[string]any) mcp.CallToolRequest {
@@ -368,3 +372,76 @@ func TestHandleListProviders_MissingArg(t *testing.T) {
 		t.Fatal("expected error for missing project_id")
 	}
 }
+
+// asUser returns a context of a request authenticated as a user with role.
+func asUser(role string) context.Context {
+	return auth.WithUser(context.Background(), &auth.TokenClaims{Username: "alice", Role: role})
+}
+
+func TestHandleCancelTask(t *testing.T) {
+	store := dbmock.New()
+	task := &db.Task{ProviderType: "gitlab", Title: "Pending", CreatedAt: time.Now()}
+	_ = store.CreateTask(context.Background(), task)
+
+	s := newTestServer(store)
+	result, err := s.handleCancelTask(asUser(db.RoleEditor), makeReq(map[string]any{"task_id": task.ID}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", resultText(result))
+	}
+	if got, _ := store.GetTask(context.Background(), task.ID); got.Status != db.TaskStatusCancelled {
+		t.Fatalf("status = %s, want cancelled", got.Status)
+	}
+
+	result, _ = s.handleCancelTask(asUser(db.RoleEditor), makeReq(map[string]any{"task_id": task.ID}))
+	if !result.IsError {
+		t.Fatal("expected error cancelling a finished task")
+	}
+}
+
+func TestHandleRetryTask(t *testing.T) {
+	store := dbmock.New()
+	task := &db.Task{ProviderType: "gitlab", Title: "Failed", CreatedAt: time.Now()}
+	_ = store.CreateTask(context.Background(), task)
+
+	s := newTestServer(store)
+	result, _ := s.handleRetryTask(asUser(db.RoleAdmin), makeReq(map[string]any{"task_id": task.ID}))
+	if !result.IsError {
+		t.Fatal("expected error retrying a pending task")
+	}
+
+	claimed, _ := store.ClaimNextTask(context.Background(), 0, time.Minute)
+	_, _ = store.UpdateTaskStatus(context.Background(), claimed.ID, claimed.Attempts, db.TaskStatusFailed, nil, nil)
+	result, err := s.handleRetryTask(asUser(db.RoleAdmin), makeReq(map[string]any{"task_id": task.ID}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", resultText(result))
+	}
+	if len(store.Tasks) != 2 || store.Tasks[1].ParentTaskID == nil || *store.Tasks[1].ParentTaskID != task.ID {
+		t.Fatalf("expected a linked retry task, got %d tasks", len(store.Tasks))
+	}
+}
+
+func TestMutatingTools_RequireRole(t *testing.T) {
+	store := dbmock.New()
+	task := &db.Task{ProviderType: "gitlab", Title: "Pending", CreatedAt: time.Now()}
+	_ = store.CreateTask(context.Background(), task)
+	s := newTestServer(store)
+	req := makeReq(map[string]any{"task_id": task.ID})
+
+	for _, ctx := range []context.Context{context.Background(), asUser(db.RoleViewer)} {
+		if result, _ := s.handleCancelTask(ctx, req); !result.IsError {
+			t.Fatal("expected cancel_task to be refused")
+		}
+		if result, _ := s.handleRetryTask(ctx, req); !result.IsError {
+			t.Fatal("expected retry_task to be refused")
+		}
+	}
+	if got, _ := store.GetTask(context.Background(), task.ID); got.Status == db.TaskStatusCancelled || len(store.Tasks) != 1 {
+		t.Fatalf("task changed by an unauthorized call: %+v", got)
+	}
+}
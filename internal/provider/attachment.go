@@ -0,0 +1,64 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// maxAttachments caps the files downloaded for one message.
+const maxAttachments = 10
+
+// Allows reports whether a file of the given MIME type may be downloaded.
+func (l AttachmentLimits) Allows(mimeType string) bool {
+	mt, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range l.MIMETypes {
+		prefix, wildcard := strings.CutSuffix(allowed, "*")
+		if mt == allowed || wildcard && strings.HasPrefix(mt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// check rejects a file by the type and size the provider reports for it,
+// before it is downloaded. An unknown type ("") or size (0) passes.
+func (l AttachmentLimits) check(name, mimeType string, size int64) error {
+	if size > l.MaxBytes {
+		return fmt.Errorf("%s is larger than %d bytes", name, l.MaxBytes)
+	}
+	if mimeType != "" && mimeType != "application/octet-stream" && !l.Allows(mimeType) {
+		return fmt.Errorf("%s has a type that is not allowed: %s", name, mimeType)
+	}
+	return nil
+}
+
+// readAttachment reads a downloaded file, failing if it exceeds limits. Its
+// type is mimeType or, if that is missing or generic, guessed from the file
+// name or content.
+func readAttachment(r io.Reader, name, mimeType string, limits AttachmentLimits) (Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return Attachment{}, fmt.Errorf("read %s: %w", name, err)
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return Attachment{}, fmt.Errorf("%s is larger than %d bytes", name, limits.MaxBytes)
+	}
+	mt, _, _ := mime.ParseMediaType(mimeType)
+	if mt == "" || mt == "application/octet-stream" {
+		mt, _, _ = mime.ParseMediaType(mime.TypeByExtension(path.Ext(name)))
+	}
+	if mt == "" {
+		mt, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+	if !limits.Allows(mt) {
+		return Attachment{}, fmt.Errorf("%s has a type that is not allowed: %s", name, mt)
+	}
+	return Attachment{Name: name, MIMEType: mt, Data: data}, nil
+}
@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+var testAttachmentLimits = AttachmentLimits{MaxBytes: 16, MIMETypes: []string{"image/*", "text/plain"}}
+
+func TestAttachmentLimits_Allows(t *testing.T) {
+	for mimeType, want := range map[string]bool{
+		"image/png":                 true,
+		"text/plain; charset=utf-8": true,
+		"text/html":                 false,
+		"application/zip":           false,
+		"":                          false,
+	} {
+		if got := testAttachmentLimits.Allows(mimeType); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", mimeType, got, want)
+		}
+	}
+}
+
+func TestReadAttachment(t *testing.T) {
+	att, err := readAttachment(strings.NewReader("panic: boom"), "trace", "application/octet-stream", testAttachmentLimits)
+	if err != nil || att.MIMEType != "text/plain" || string(att.Data) != "panic: boom" {
+		t.Fatalf("readAttachment() = %+v, %v", att, err)
+	}
+	if _, err := readAttachment(strings.NewReader(strings.Repeat("x", 17)), "big.txt", "text/plain", testAttachmentLimits); err == nil {
+		t.Error("expected a file above MaxBytes to be rejected")
+	}
+	if _, err := readAttachment(strings.NewReader("<html></html>"), "page.html", "text/html", testAttachmentLimits); err == nil {
+		t.Error("expected a disallowed type to be rejected")
+	}
+}
@@ -0,0 +1,29 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Delivery identifies the webhook delivery a message arrived in. Senders
+// deliver an event again when they think the first delivery failed (Slack
+// after 3 seconds without an answer, GitLab on timeouts); the analyzer
+// handles each delivery ID once.
+type Delivery struct {
+	// ID is the sender's identifier of the event, the same across retries.
+	ID string
+	// Event is the sender's name for the kind of event.
+	Event string
+	// PayloadHash is the hex SHA-256 of the request body.
+	PayloadHash string
+}
+
+// newDelivery describes a delivery of payload, or returns nil if the sender
+// gave it no ID.
+func newDelivery(id, event string, payload []byte) *Delivery {
+	if id == "" {
+		return nil
+	}
+	sum := sha256.Sum256(payload)
+	return &Delivery{ID: id, Event: event, PayloadHash: hex.EncodeToString(sum[:])}
+}
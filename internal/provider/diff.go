@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReviewDiff is the diff of a merge request under review.
+type ReviewDiff struct {
+	// Diff is the unified diff of every changed file, each starting with
+	// "--- a/<old path>" and "+++ b/<new path>" headers.
+	Diff string
+	// BaseSHA, StartSHA and HeadSHA identify the version of the merge
+	// request the diff was taken from; comments are positioned against it.
+	BaseSHA  string
+	StartSHA string
+	HeadSHA  string
+
+	once  sync.Once
+	files map[string]*diffFile
+}
+
+// diffFile records which lines of a file appear in the diff.
+type diffFile struct {
+	oldPath string
+	// lines maps each new line shown in the diff to its old line, or 0 if
+	// the line was added.
+	lines map[int]int
+	// removed holds the old lines that were removed.
+	removed map[int]bool
+}
+
+// Locate resolves c to a position in the diff: the file's old path and the
+// new and old line numbers, as needed to anchor a comment on it. A context
+// line has both line numbers, an added line only the new and a removed line
+// only the old one. ok is false if the line is not part of the diff.
+func (d *ReviewDiff) Locate(c ReviewComment) (oldPath string, newLine, oldLine int, ok bool) {
+	d.once.Do(d.parse)
+	f, found := d.files[c.Path]
+	if !found {
+		return "", 0, 0, false
+	}
+	if c.Line > 0 {
+		if old, shown := f.lines[c.Line]; shown {
+			return f.oldPath, c.Line, old, true
+		}
+		return "", 0, 0, false
+	}
+	if c.OldLine > 0 && f.removed[c.OldLine] {
+		return f.oldPath, 0, c.OldLine, true
+	}
+	return "", 0, 0, false
+}
+
+func (d *ReviewDiff) parse() {
+	d.files = make(map[string]*diffFile)
+	var f *diffFile
+	oldPath := ""
+	// Position in the current hunk and the lines it has left, so a removed
+	// line such as "-- comment" is not taken for a file header.
+	oldLine, newLine, oldLeft, newLeft := 0, 0, 0, 0
+	for _, line := range strings.Split(d.Diff, "\n") {
+		if f != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				f.lines[newLine] = 0
+				newLine++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				f.removed[oldLine] = true
+				oldLine++
+				oldLeft--
+			case strings.HasPrefix(line, " "), line == "":
+				f.lines[newLine] = oldLine
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			oldPath = diffPath(line[4:])
+			f = nil
+		case strings.HasPrefix(line, "+++ "):
+			newPath := diffPath(line[4:])
+			if newPath == "" {
+				newPath = oldPath
+			}
+			if oldPath == "" {
+				oldPath = newPath
+			}
+			f = &diffFile{oldPath: oldPath, lines: make(map[int]int), removed: make(map[int]bool)}
+			d.files[newPath] = f
+		case strings.HasPrefix(line, "@@ "):
+			oldLine, oldLeft, newLine, newLeft = parseHunkHeader(line)
+		}
+	}
+}
+
+// diffPath strips the a/ or b/ prefix from a diff header path; /dev/null
+// becomes "".
+func diffPath(p string) string {
+	if i := strings.IndexByte(p, '\t'); i >= 0 {
+		p = p[:i]
+	}
+	if p == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(p, "a/") || strings.HasPrefix(p, "b/") {
+		return p[2:]
+	}
+	return p
+}
+
+// parseHunkHeader returns the first line and line count of both sides of a
+// hunk header such as "@@ -10,7 +12,8 @@ func main() {".
+func parseHunkHeader(line string) (oldStart, oldCount, newStart, newCount int) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0, 0, 0, 0
+	}
+	rng := func(s string) (start, count int) {
+		first, n, found := strings.Cut(s[1:], ",")
+		start, _ = strconv.Atoi(first)
+		count = 1
+		if found {
+			count, _ = strconv.Atoi(n)
+		}
+		return start, count
+	}
+	oldStart, oldCount = rng(fields[1])
+	newStart, newCount = rng(fields[2])
+	return oldStart, oldCount, newStart, newCount
+}
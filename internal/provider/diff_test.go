@@ -0,0 +1,67 @@
+package provider
+
+import "testing"
+
+const testDiff = `--- a/main.go
++++ b/main.go
+@@ -1,4 +1,6 @@
+ package main
+ 
+-import "fmt"
++import (
++	"fmt"
++)
+ func main() {
+--- a/schema.sql
++++ b/schema.sql
+@@ -10,2 +10,1 @@
+--- old comment
+ SELECT 1;
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++first
++second
+--- a/old.go
++++ b/renamed.go
+@@ -3,1 +3,1 @@
+-var x = 1
++var x = 2
+`
+
+func TestReviewDiffLocate(t *testing.T) {
+	d := &ReviewDiff{Diff: testDiff}
+	tests := []struct {
+		name             string
+		c                ReviewComment
+		oldPath          string
+		newLine, oldLine int
+		ok               bool
+	}{
+		{"context line", ReviewComment{Path: "main.go", Line: 1}, "main.go", 1, 1, true},
+		{"added line", ReviewComment{Path: "main.go", Line: 4}, "main.go", 4, 0, true},
+		{"context after hunk change", ReviewComment{Path: "main.go", Line: 6}, "main.go", 6, 4, true},
+		{"removed line", ReviewComment{Path: "main.go", OldLine: 3}, "main.go", 0, 3, true},
+		{"line outside hunk", ReviewComment{Path: "main.go", Line: 40}, "", 0, 0, false},
+		{"removed line like a header", ReviewComment{Path: "schema.sql", OldLine: 10}, "schema.sql", 0, 10, true},
+		{"line after removed header-like line", ReviewComment{Path: "schema.sql", Line: 10}, "schema.sql", 10, 11, true},
+		{"new file", ReviewComment{Path: "new.txt", Line: 2}, "new.txt", 2, 0, true},
+		{"renamed file", ReviewComment{Path: "renamed.go", Line: 3}, "old.go", 3, 0, true},
+		{"old path of renamed file", ReviewComment{Path: "old.go", Line: 3}, "", 0, 0, false},
+		{"unknown file", ReviewComment{Path: "other.go", Line: 1}, "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		oldPath, newLine, oldLine, ok := d.Locate(tt.c)
+		if oldPath != tt.oldPath || newLine != tt.newLine || oldLine != tt.oldLine || ok != tt.ok {
+			t.Errorf("%s: Locate() = %q, %d, %d, %v; want %q, %d, %d, %v", tt.name,
+				oldPath, newLine, oldLine, ok, tt.oldPath, tt.newLine, tt.oldLine, tt.ok)
+		}
+	}
+}
+
+func TestParseHunkHeader(t *testing.T) {
+	oldStart, oldCount, newStart, newCount := parseHunkHeader("@@ -10,7 +12 @@ func main() {")
+	if oldStart != 10 || oldCount != 7 || newStart != 12 || newCount != 1 {
+		t.Fatalf("parseHunkHeader() = %d, %d, %d, %d", oldStart, oldCount, newStart, newCount)
+	}
+}
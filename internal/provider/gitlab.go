@@ -7,16 +7,32 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	gogitlab "github.com/xanzy/go-gitlab"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
 )
 
 type GitLabProvider struct {
-	logger *slog.Logger
+	logger     *slog.Logger
+	httpClient *http.Client
 }
 
-func NewGitLabProvider(logger *slog.Logger) *GitLabProvider {
-	return &GitLabProvider{logger: logger}
+var (
+	_ ReplyEditor         = (*GitLabProvider)(nil)
+	_ MergeRequestCreator = (*GitLabProvider)(nil)
+	_ ContextFetcher      = (*GitLabProvider)(nil)
+)
+
+func NewGitLabProvider(database db.Store, logger *slog.Logger) *GitLabProvider {
+	timeout := database.GetSettingDuration(context.Background(), "gitlab_http_timeout", 30*time.Second)
+	return &GitLabProvider{
+		logger:     logger,
+		httpClient: &http.Client{Timeout: timeout},
+	}
 }
 
 func (g *GitLabProvider) Type() ProviderType { return ProviderGitLab }
@@ -28,15 +44,46 @@ func (g *GitLabProvider) ValidateConfig(cfg map[string]any) error {
 			return fmt.Errorf("missing required field: %s", k)
 		}
 	}
-	return nil
+	_, err := gitlabIssueRules(cfg)
+	return err
 }
 
+// gitlabReplyMeta addresses replies to the noteable the comment was made on:
+// an issue, or the merge request, commit or snippet whose field is set. JobID
+// is the failed CI job a pipeline analysis is about.
 type gitlabReplyMeta struct {
-	ProjectID int `json:"project_id"`
-	IssueIID  int `json:"issue_iid"`
+	ProjectID       int    `json:"project_id"`
+	IssueIID        int    `json:"issue_iid"`
+	MergeRequestIID int    `json:"merge_request_iid,omitempty"`
+	CommitSHA       string `json:"commit_sha,omitempty"`
+	SnippetID       int    `json:"snippet_id,omitempty"`
+	JobID           int    `json:"job_id,omitempty"`
+}
+
+func gitlabMeta(msg *IncomingMessage) (gitlabReplyMeta, error) {
+	var meta gitlabReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return meta, fmt.Errorf("invalid reply meta: %w", err)
+	}
+	return meta, nil
+}
+
+func gitlabClient(cfg map[string]any) (*gogitlab.Client, error) {
+	baseURL, _ := cfg["base_url"].(string)
+	token, _ := cfg["token"].(string)
+	client, err := gogitlab.NewClient(token, gogitlab.WithBaseURL(baseURL))
+	if err != nil {
+		return nil, fmt.Errorf("create gitlab client: %w", err)
+	}
+	return client, nil
 }
 
 func (g *GitLabProvider) BuildHandler(providerCfgID string, secret string, cfg map[string]any, onMessage func(context.Context, *IncomingMessage)) http.Handler {
+	rules, err := gitlabIssueRules(cfg)
+	if err != nil {
+		g.logger.Warn("gitlab issue rules ignored", "provider_cfg", providerCfgID, "error", err)
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -51,7 +98,14 @@ func (g *GitLabProvider) BuildHandler(providerCfgID string, secret string, cfg m
 		}
 
 		eventType := gogitlab.HookEventType(r)
-		if eventType != gogitlab.EventTypeNote && eventType != gogitlab.EventConfidentialNote {
+		switch eventType {
+		case gogitlab.EventTypeNote, gogitlab.EventConfidentialNote, gogitlab.EventTypeJob, gogitlab.EventTypePipeline:
+		case gogitlab.EventTypeIssue, gogitlab.EventConfidentialIssue:
+			if len(rules) == 0 {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		default:
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -71,56 +125,351 @@ func (g *GitLabProvider) BuildHandler(providerCfgID string, secret string, cfg m
 
 		w.WriteHeader(http.StatusOK)
 
-		issueComment, ok := event.(*gogitlab.IssueCommentEvent)
-		if !ok || issueComment.ObjectAttributes.System {
-			return
+		var msgs []*IncomingMessage
+		switch e := event.(type) {
+		case *gogitlab.IssueCommentEvent:
+			msgs = append(msgs, issueCommentMessage(e))
+		case *gogitlab.MergeCommentEvent:
+			msgs = append(msgs, mergeCommentMessage(e))
+		case *gogitlab.CommitCommentEvent:
+			msgs = append(msgs, commitCommentMessage(e))
+		case *gogitlab.SnippetCommentEvent:
+			msgs = append(msgs, snippetCommentMessage(e))
+		case *gogitlab.JobEvent:
+			msgs = append(msgs, jobEventMessage(e))
+		case *gogitlab.PipelineEvent:
+			msgs = pipelineEventMessages(e)
+		case *gogitlab.IssueEvent:
+			msgs = append(msgs, issueEventMessage(e, rules))
 		}
+		// A pipeline event can report several failed jobs; each message of
+		// the delivery gets its own ID. A failed job is reported by both the
+		// Job Hook and the Pipeline Hook, so its delivery is keyed on the job
+		// instead: whichever hook arrives second is a duplicate.
+		eventUUID := r.Header.Get("X-Gitlab-Event-UUID")
+		// Messages are handled after the response is sent, with the
+		// request's values but not its cancellation.
+		ctx := context.WithoutCancel(r.Context())
+		for i, msg := range msgs {
+			if msg == nil {
+				continue
+			}
+			msg.Provider = ProviderGitLab
+			msg.ProviderCfgID = providerCfgID
+			switch {
+			case msg.FailedJob != nil:
+				msg.Delivery = newDelivery(fmt.Sprintf("job/%d", msg.FailedJob.ID), string(eventType), payload)
+			case len(msgs) == 1:
+				msg.Delivery = newDelivery(eventUUID, string(eventType), payload)
+			case eventUUID != "":
+				msg.Delivery = newDelivery(fmt.Sprintf("%s/%d", eventUUID, i), string(eventType), payload)
+			}
 
-		webURL := ""
-		if issueComment.ObjectAttributes.URL != "" {
-			webURL = issueComment.ObjectAttributes.URL
-		} else {
-			webURL = fmt.Sprintf("%s/-/issues/%d", issueComment.Project.WebURL, issueComment.Issue.IID)
+			go func() {
+				if msg.FailedJob != nil {
+					g.resolveMergeRequest(ctx, cfg, msg)
+				}
+				onMessage(ctx, msg)
+			}()
 		}
+	})
+}
 
-		meta := gitlabReplyMeta{
-			ProjectID: issueComment.ProjectID,
-			IssueIID:  issueComment.Issue.IID,
-		}
+func (g *GitLabProvider) SignWebhook(req *http.Request, secret string, _ map[string]any, _ []byte) {
+	req.Header.Set("X-Gitlab-Token", secret)
+}
 
-		msg := &IncomingMessage{
-			Provider:      ProviderGitLab,
-			ProviderCfgID: providerCfgID,
-			ExternalRef:   webURL,
-			Title:         issueComment.Issue.Title,
-			Body:          issueComment.ObjectAttributes.Note,
-			Author:        issueComment.User.Username,
-			ReplyMeta:     meta,
-		}
+func issueCommentMessage(e *gogitlab.IssueCommentEvent) *IncomingMessage {
+	if e.ObjectAttributes.System {
+		return nil
+	}
+	webURL := e.ObjectAttributes.URL
+	if webURL == "" {
+		webURL = fmt.Sprintf("%s/-/issues/%d", e.Project.WebURL, e.Issue.IID)
+	}
+	meta := gitlabReplyMeta{
+		ProjectID: e.ProjectID,
+		IssueIID:  e.Issue.IID,
+	}
+	return &IncomingMessage{
+		ExternalRef: webURL,
+		Title:       e.Issue.Title,
+		Body:        e.ObjectAttributes.Note,
+		Author:      e.User.Username,
+		ReplyMeta:   meta,
+		Source: MessageRef{
+			ID:  strconv.Itoa(e.ObjectAttributes.ID),
+			URL: webURL,
+		},
+		ThreadKey: fmt.Sprintf("gitlab:%d:issue:%d", meta.ProjectID, meta.IssueIID),
+	}
+}
 
-		go onMessage(context.Background(), msg)
-	})
+// mergeCommentMessage handles a comment on a merge request. The analysis
+// defaults to the MR's source branch unless it lives in a fork, whose
+// branches are not in the project's repository.
+func mergeCommentMessage(e *gogitlab.MergeCommentEvent) *IncomingMessage {
+	if e.ObjectAttributes.System {
+		return nil
+	}
+	webURL := e.ObjectAttributes.URL
+	if webURL == "" {
+		webURL = fmt.Sprintf("%s/-/merge_requests/%d", e.Project.WebURL, e.MergeRequest.IID)
+	}
+	meta := gitlabReplyMeta{
+		ProjectID:       e.ProjectID,
+		MergeRequestIID: e.MergeRequest.IID,
+	}
+	ref := ""
+	if e.MergeRequest.SourceProjectID == e.MergeRequest.TargetProjectID {
+		ref = e.MergeRequest.SourceBranch
+	}
+	return &IncomingMessage{
+		ExternalRef: webURL,
+		Title:       e.MergeRequest.Title,
+		Body:        e.ObjectAttributes.Note,
+		Author:      e.User.Username,
+		ReplyMeta:   meta,
+		Ref:         ref,
+		Source: MessageRef{
+			ID:  strconv.Itoa(e.ObjectAttributes.ID),
+			URL: webURL,
+		},
+		ThreadKey: fmt.Sprintf("gitlab:%d:mr:%d", meta.ProjectID, meta.MergeRequestIID),
+	}
 }
 
-func (g *GitLabProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) error {
-	baseURL, _ := cfg["base_url"].(string)
-	token, _ := cfg["token"].(string)
+// commitCommentMessage handles a comment on a commit, which is analyzed at
+// that commit.
+func commitCommentMessage(e *gogitlab.CommitCommentEvent) *IncomingMessage {
+	if e.ObjectAttributes.System || e.Commit == nil {
+		return nil
+	}
+	webURL := e.ObjectAttributes.URL
+	if webURL == "" {
+		webURL = fmt.Sprintf("%s/-/commit/%s", e.Project.WebURL, e.Commit.ID)
+	}
+	meta := gitlabReplyMeta{
+		ProjectID: e.ProjectID,
+		CommitSHA: e.Commit.ID,
+	}
+	return &IncomingMessage{
+		ExternalRef: webURL,
+		Title:       e.Commit.Title,
+		Body:        e.ObjectAttributes.Note,
+		Author:      e.User.Username,
+		ReplyMeta:   meta,
+		Ref:         e.Commit.ID,
+		Source: MessageRef{
+			ID:  strconv.Itoa(e.ObjectAttributes.ID),
+			URL: webURL,
+		},
+		ThreadKey: fmt.Sprintf("gitlab:%d:commit:%s", meta.ProjectID, meta.CommitSHA),
+	}
+}
 
-	client, err := gogitlab.NewClient(token, gogitlab.WithBaseURL(baseURL))
+func snippetCommentMessage(e *gogitlab.SnippetCommentEvent) *IncomingMessage {
+	if e.ObjectAttributes.System || e.Snippet == nil {
+		return nil
+	}
+	webURL := e.ObjectAttributes.URL
+	if webURL == "" {
+		webURL = fmt.Sprintf("%s/-/snippets/%d", e.Project.WebURL, e.Snippet.ID)
+	}
+	meta := gitlabReplyMeta{
+		ProjectID: e.ProjectID,
+		SnippetID: e.Snippet.ID,
+	}
+	return &IncomingMessage{
+		ExternalRef: webURL,
+		Title:       e.Snippet.Title,
+		Body:        e.ObjectAttributes.Note,
+		Author:      e.User.Username,
+		ReplyMeta:   meta,
+		Source: MessageRef{
+			ID:  strconv.Itoa(e.ObjectAttributes.ID),
+			URL: webURL,
+		},
+		ThreadKey: fmt.Sprintf("gitlab:%d:snippet:%d", meta.ProjectID, meta.SnippetID),
+	}
+}
+
+// SendReply posts body as a note on the issue, merge request, commit or
+// snippet msg was posted on. Commit comments can only be edited through their
+// discussion, so a commit reply starts a discussion whose ID is returned as the
+// reference's Channel.
+func (g *GitLabProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) (*MessageRef, error) {
+	client, err := gitlabClient(cfg)
 	if err != nil {
-		return fmt.Errorf("create gitlab client: %w", err)
+		return nil, err
+	}
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return nil, err
 	}
 
-	var meta gitlabReplyMeta
-	raw, _ := json.Marshal(msg.ReplyMeta)
-	if err := json.Unmarshal(raw, &meta); err != nil {
-		return fmt.Errorf("invalid reply meta: %w", err)
+	var note *gogitlab.Note
+	channel := ""
+	switch {
+	case meta.MergeRequestIID != 0:
+		note, _, err = client.Notes.CreateMergeRequestNote(
+			meta.ProjectID,
+			meta.MergeRequestIID,
+			&gogitlab.CreateMergeRequestNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	case meta.CommitSHA != "":
+		var d *gogitlab.Discussion
+		d, _, err = client.Discussions.CreateCommitDiscussion(
+			meta.ProjectID,
+			meta.CommitSHA,
+			&gogitlab.CreateCommitDiscussionOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+		if err == nil {
+			if len(d.Notes) == 0 {
+				return nil, fmt.Errorf("commit discussion %s has no note", d.ID)
+			}
+			note, channel = d.Notes[0], d.ID
+		}
+	case meta.SnippetID != 0:
+		note, _, err = client.Notes.CreateSnippetNote(
+			meta.ProjectID,
+			meta.SnippetID,
+			&gogitlab.CreateSnippetNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	default:
+		note, _, err = client.Notes.CreateIssueNote(
+			meta.ProjectID,
+			meta.IssueIID,
+			&gogitlab.CreateIssueNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return &MessageRef{ID: strconv.Itoa(note.ID), Channel: channel, URL: gitlabNoteURL(msg.ExternalRef, note.ID)}, nil
+}
 
-	_, _, err = client.Notes.CreateIssueNote(
-		meta.ProjectID,
-		meta.IssueIID,
-		&gogitlab.CreateIssueNoteOptions{Body: gogitlab.Ptr(body)},
-	)
+func (g *GitLabProvider) EditReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, ref MessageRef, body string) error {
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return err
+	}
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return err
+	}
+	noteID, err := strconv.Atoi(ref.ID)
+	if err != nil {
+		return fmt.Errorf("invalid note id %q: %w", ref.ID, err)
+	}
+
+	switch {
+	case meta.MergeRequestIID != 0:
+		_, _, err = client.Notes.UpdateMergeRequestNote(
+			meta.ProjectID,
+			meta.MergeRequestIID,
+			noteID,
+			&gogitlab.UpdateMergeRequestNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	case meta.CommitSHA != "":
+		if ref.Channel == "" {
+			return fmt.Errorf("commit note %s has no discussion id", ref.ID)
+		}
+		_, _, err = client.Discussions.UpdateCommitDiscussionNote(
+			meta.ProjectID,
+			meta.CommitSHA,
+			ref.Channel,
+			noteID,
+			&gogitlab.UpdateCommitDiscussionNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	case meta.SnippetID != 0:
+		_, _, err = client.Notes.UpdateSnippetNote(
+			meta.ProjectID,
+			meta.SnippetID,
+			noteID,
+			&gogitlab.UpdateSnippetNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	default:
+		_, _, err = client.Notes.UpdateIssueNote(
+			meta.ProjectID,
+			meta.IssueIID,
+			noteID,
+			&gogitlab.UpdateIssueNoteOptions{Body: gogitlab.Ptr(body)},
+			gogitlab.WithContext(ctx),
+		)
+	}
 	return err
 }
+
+func (g *GitLabProvider) CreateMergeRequest(ctx context.Context, cfg map[string]any, msg *IncomingMessage, mr MergeRequest) (string, error) {
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// A GitLab message names the project; otherwise derive its path from
+	// the repository URL.
+	var pid any
+	if msg != nil && msg.Provider == ProviderGitLab {
+		if meta, err := gitlabMeta(msg); err == nil && meta.ProjectID != 0 {
+			pid = meta.ProjectID
+		}
+	}
+	if pid == nil {
+		path := gitlabProjectPath(mr.RepoURL)
+		if path == "" {
+			return "", fmt.Errorf("cannot derive gitlab project from %q", mr.RepoURL)
+		}
+		pid = path
+	}
+
+	created, _, err := client.MergeRequests.CreateMergeRequest(pid, &gogitlab.CreateMergeRequestOptions{
+		Title:              gogitlab.Ptr(mr.Title),
+		Description:        gogitlab.Ptr(mr.Description),
+		SourceBranch:       gogitlab.Ptr(mr.SourceBranch),
+		TargetBranch:       gogitlab.Ptr(mr.TargetBranch),
+		RemoveSourceBranch: gogitlab.Ptr(true),
+	}, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	return created.WebURL, nil
+}
+
+// gitlabProjectPath extracts "group/project" from an SSH or HTTP(S)
+// repository URL.
+func gitlabProjectPath(repoURL string) string {
+	path := repoURL
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		if j := strings.IndexByte(path, '/'); j >= 0 {
+			path = path[j+1:]
+		} else {
+			return ""
+		}
+	} else if i := strings.IndexByte(path, ':'); i >= 0 {
+		path = path[i+1:]
+	} else {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+}
+
+// gitlabNoteURL builds the URL of a note on the same page as ref, which is the
+// URL of the triggering note or of the issue itself.
+func gitlabNoteURL(ref string, noteID int) string {
+	if ref == "" {
+		return ""
+	}
+	if i := strings.IndexByte(ref, '#'); i >= 0 {
+		ref = ref[:i]
+	}
+	return fmt.Sprintf("%s#note_%d", ref, noteID)
+}
@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+var _ AttachmentFetcher = (*GitLabProvider)(nil)
+
+// gitlabUpload matches a Markdown link to a file uploaded to the project, as
+// in ![screenshot](/uploads/<secret>/screenshot.png).
+var gitlabUpload = regexp.MustCompile(`\]\(/uploads/([0-9a-f]{32})/([^)\s]+)\)`)
+
+// FetchAttachments downloads the files uploaded to the project and linked
+// from the message body, such as screenshots pasted into a comment.
+func (g *GitLabProvider) FetchAttachments(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits AttachmentLimits) ([]Attachment, error) {
+	links := gitlabUpload.FindAllStringSubmatch(msg.Body, -1)
+	if len(links) == 0 {
+		return nil, nil
+	}
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Attachment
+	seen := make(map[string]bool)
+	for _, link := range links {
+		secret := link[1]
+		if seen[secret] || len(out) == maxAttachments {
+			continue
+		}
+		seen[secret] = true
+		name, err := url.PathUnescape(link[2])
+		if err != nil {
+			name = link[2]
+		}
+		body, mimeType, err := g.downloadUpload(ctx, cfg, client, meta.ProjectID, secret, name)
+		if err != nil {
+			g.logger.Warn("gitlab attachment skipped", "file", name, "error", err)
+			continue
+		}
+		att, err := readAttachment(body, name, mimeType, limits)
+		body.Close()
+		if err != nil {
+			g.logger.Warn("gitlab attachment skipped", "file", name, "error", err)
+			continue
+		}
+		out = append(out, att)
+	}
+	return out, nil
+}
+
+// downloadUpload requests a file uploaded to the project and returns its
+// body, which the caller must close, and content type. The client's
+// DownloadProjectMarkdownUploadBySecretAndFilename reads the whole file
+// before it can be checked against the size limit; the body returned here
+// is read only as far as readAttachment needs.
+func (g *GitLabProvider) downloadUpload(ctx context.Context, cfg map[string]any, client *gogitlab.Client, projectID int, secret, name string) (io.ReadCloser, string, error) {
+	u := fmt.Sprintf("projects/%d/uploads/%s/%s", projectID, gogitlab.PathEscape(secret), gogitlab.PathEscape(name))
+	req, err := client.NewRequest(http.MethodGet, u, nil, []gogitlab.RequestOptionFunc{gogitlab.WithContext(ctx)})
+	if err != nil {
+		return nil, "", err
+	}
+	token, _ := cfg["token"].(string)
+	req.Header.Set("PRIVATE-TOKEN", token)
+	resp, err := g.httpClient.Do(req.Request)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := gogitlab.CheckResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,271 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+const (
+	// maxContextFiles caps the changed files listed for a merge request or
+	// commit.
+	maxContextFiles = 200
+	// maxContextText caps descriptions and snippet contents.
+	maxContextText = 20000
+)
+
+// FetchContext describes the issue, merge request, commit or snippet a comment
+// was made on: for a merge request its title, description, branches and
+// changed files; for an issue its description, labels, related merge requests
+// and latest comments within limits. For a failed CI job, the failing part of the job's log
+// comes first.
+func (g *GitLabProvider) FetchContext(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits ContextLimits) (string, error) {
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return "", err
+	}
+	if meta.IssueIID == 0 && meta.MergeRequestIID == 0 && meta.CommitSHA == "" && meta.SnippetID == 0 {
+		return "", nil
+	}
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	var noteable string
+	switch {
+	case meta.MergeRequestIID != 0:
+		noteable, err = mergeRequestContext(ctx, client, meta)
+	case meta.CommitSHA != "":
+		noteable, err = commitContext(ctx, client, meta)
+	case meta.SnippetID != 0:
+		noteable, err = snippetContext(ctx, client, meta)
+	default:
+		noteable, err = issueContext(ctx, client, meta, msg.Source.ID, limits)
+	}
+	if err != nil || meta.JobID == 0 {
+		return noteable, err
+	}
+	job, err := jobContext(ctx, client, meta)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(job + "\n\n" + noteable), nil
+}
+
+func mergeRequestContext(ctx context.Context, client *gogitlab.Client, meta gitlabReplyMeta) (string, error) {
+	mr, _, err := client.MergeRequests.GetMergeRequest(meta.ProjectID, meta.MergeRequestIID, nil, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get merge request: %w", err)
+	}
+
+	var files []string
+	truncated := false
+	opt := &gogitlab.ListMergeRequestDiffsOptions{ListOptions: gogitlab.ListOptions{PerPage: 100}}
+	for {
+		diffs, resp, err := client.MergeRequests.ListMergeRequestDiffs(meta.ProjectID, meta.MergeRequestIID, opt, gogitlab.WithContext(ctx))
+		if err != nil {
+			return "", fmt.Errorf("list merge request diffs: %w", err)
+		}
+		for _, d := range diffs {
+			files = append(files, changedFile(d.OldPath, d.NewPath, d.NewFile, d.RenamedFile, d.DeletedFile))
+		}
+		if len(files) >= maxContextFiles {
+			truncated = resp.NextPage != 0 || len(files) > maxContextFiles
+			files = files[:maxContextFiles]
+			break
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Merge request !%d: %s\n", mr.IID, mr.Title)
+	fmt.Fprintf(&sb, "Source branch `%s` → target branch `%s`", mr.SourceBranch, mr.TargetBranch)
+	if mr.State != "" {
+		fmt.Fprintf(&sb, " (%s)", mr.State)
+	}
+	sb.WriteString("\n\n")
+	if desc := strings.TrimSpace(mr.Description); desc != "" {
+		sb.WriteString("### Description\n")
+		sb.WriteString(clip(desc, maxContextText))
+		sb.WriteString("\n\n")
+	}
+	writeFileList(&sb, files, truncated)
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func commitContext(ctx context.Context, client *gogitlab.Client, meta gitlabReplyMeta) (string, error) {
+	commit, _, err := client.Commits.GetCommit(meta.ProjectID, meta.CommitSHA, nil, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get commit: %w", err)
+	}
+	diffs, resp, err := client.Commits.GetCommitDiff(meta.ProjectID, meta.CommitSHA,
+		&gogitlab.GetCommitDiffOptions{ListOptions: gogitlab.ListOptions{PerPage: maxContextFiles}}, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get commit diff: %w", err)
+	}
+	files := make([]string, 0, len(diffs))
+	for _, d := range diffs {
+		files = append(files, changedFile(d.OldPath, d.NewPath, d.NewFile, d.RenamedFile, d.DeletedFile))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Commit %s by %s\n", commit.ShortID, commit.AuthorName)
+	fmt.Fprintf(&sb, "```\n%s\n```\n\n", clip(strings.TrimSpace(commit.Message), maxContextText))
+	writeFileList(&sb, files, resp.NextPage != 0)
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func snippetContext(ctx context.Context, client *gogitlab.Client, meta gitlabReplyMeta) (string, error) {
+	snippet, _, err := client.ProjectSnippets.GetSnippet(meta.ProjectID, meta.SnippetID, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get snippet: %w", err)
+	}
+	content, _, err := client.ProjectSnippets.SnippetContent(meta.ProjectID, meta.SnippetID, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get snippet content: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Snippet $%d: %s\n", snippet.ID, snippet.Title)
+	if desc := strings.TrimSpace(snippet.Description); desc != "" {
+		sb.WriteString(clip(desc, maxContextText))
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "\n`%s`:\n```\n%s\n```", snippet.FileName, clip(strings.TrimRight(string(content), "\n"), maxContextText))
+	return sb.String(), nil
+}
+
+// issueContext describes an issue and its latest comments within limits,
+// leaving out system notes, the bot's own replies and the triggering comment
+// sourceID, which is already in the prompt.
+func issueContext(ctx context.Context, client *gogitlab.Client, meta gitlabReplyMeta, sourceID string, limits ContextLimits) (string, error) {
+	issue, _, err := client.Issues.GetIssue(meta.ProjectID, meta.IssueIID, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get issue: %w", err)
+	}
+	mrs, _, err := client.Issues.ListMergeRequestsRelatedToIssue(meta.ProjectID, meta.IssueIID,
+		&gogitlab.ListMergeRequestsRelatedToIssueOptions{PerPage: 20}, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("list related merge requests: %w", err)
+	}
+	bot, _, err := client.Users.CurrentUser(gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get current user: %w", err)
+	}
+	notes, _, err := client.Notes.ListIssueNotes(meta.ProjectID, meta.IssueIID, &gogitlab.ListIssueNotesOptions{
+		ListOptions: gogitlab.ListOptions{PerPage: 100},
+		OrderBy:     gogitlab.Ptr("created_at"),
+		Sort:        gogitlab.Ptr("desc"),
+	}, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("list issue notes: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## Issue #%d: %s\n", issue.IID, issue.Title)
+	fmt.Fprintf(&sb, "State: %s", issue.State)
+	if issue.Author != nil {
+		fmt.Fprintf(&sb, ", opened by @%s", issue.Author.Username)
+	}
+	if len(issue.Labels) > 0 {
+		fmt.Fprintf(&sb, ", labels: ~%s", strings.Join(issue.Labels, ", ~"))
+	}
+	sb.WriteString("\n\n")
+	if desc := strings.TrimSpace(issue.Description); desc != "" {
+		sb.WriteString("### Description\n")
+		sb.WriteString(clip(desc, maxContextText))
+		sb.WriteString("\n\n")
+	}
+	if len(mrs) > 0 {
+		sb.WriteString("### Related merge requests\n")
+		for _, mr := range mrs {
+			fmt.Fprintf(&sb, "- !%d %s (%s)\n", mr.IID, mr.Title, mr.State)
+		}
+		sb.WriteString("\n")
+	}
+
+	// Notes come newest first; keep the latest ones that fit the budget and
+	// print them in order.
+	budget := limits.IssueTokens - approxTokens(sb.String())
+	var kept []string
+	omitted := 0
+	for _, n := range notes {
+		if n.System || n.Author.ID == bot.ID || strconv.Itoa(n.ID) == sourceID {
+			continue
+		}
+		body := strings.TrimSpace(n.Body)
+		if body == "" {
+			continue
+		}
+		entry := fmt.Sprintf("**@%s**", n.Author.Username)
+		if n.CreatedAt != nil {
+			entry += " (" + n.CreatedAt.UTC().Format("2006-01-02 15:04") + ")"
+		}
+		entry += ":\n" + body + "\n"
+		if omitted > 0 || len(kept) >= limits.IssueNotes || approxTokens(entry) > budget {
+			omitted++
+			continue
+		}
+		budget -= approxTokens(entry)
+		kept = append(kept, entry)
+	}
+	if len(kept) > 0 {
+		sb.WriteString("### Comments\n")
+		if omitted > 0 {
+			fmt.Fprintf(&sb, "[… %d earlier comments omitted]\n\n", omitted)
+		}
+		for i := len(kept) - 1; i >= 0; i-- {
+			sb.WriteString(kept[i])
+			sb.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func changedFile(oldPath, newPath string, added, renamed, deleted bool) string {
+	switch {
+	case added:
+		return fmt.Sprintf("`%s` (added)", newPath)
+	case deleted:
+		return fmt.Sprintf("`%s` (deleted)", oldPath)
+	case renamed:
+		return fmt.Sprintf("`%s` → `%s` (renamed)", oldPath, newPath)
+	default:
+		return fmt.Sprintf("`%s`", newPath)
+	}
+}
+
+func writeFileList(sb *strings.Builder, files []string, truncated bool) {
+	if len(files) == 0 {
+		return
+	}
+	more := ""
+	if truncated {
+		more = "+"
+	}
+	fmt.Fprintf(sb, "### Changed files (%d%s)\n", len(files), more)
+	for _, f := range files {
+		fmt.Fprintf(sb, "- %s\n", f)
+	}
+}
+
+// approxTokens estimates the tokens s costs in a prompt.
+func approxTokens(s string) int {
+	return (len([]rune(s)) + 3) / 4
+}
+
+// clip shortens s to at most n runes, marking the cut.
+func clip(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "\n[…truncated]"
+}
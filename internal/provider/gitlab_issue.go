@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+// gitlabIssueRule maps an issue label to the mode an issue is analyzed in,
+// with no comment needed, when it is opened with the label or the label is
+// added later. Rules are configured as "issue_rules" in the provider config:
+//
+//	"issue_rules": [{"label": "ai-triage", "mode": "ask"}, {"label": "ai-plan", "mode": "plan"}]
+type gitlabIssueRule struct {
+	Label string      `json:"label"`
+	Mode  TriggerMode `json:"mode"`
+}
+
+func gitlabIssueRules(cfg map[string]any) ([]gitlabIssueRule, error) {
+	raw, ok := cfg["issue_rules"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	data, _ := json.Marshal(raw)
+	var rules []gitlabIssueRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid issue_rules: %w", err)
+	}
+	for _, r := range rules {
+		if strings.TrimSpace(r.Label) == "" {
+			return nil, fmt.Errorf("issue rule without a label")
+		}
+		switch r.Mode {
+		case ModeAsk, ModePlan, ModeDo:
+		default:
+			return nil, fmt.Errorf("issue rule %q: unsupported mode %q", r.Label, r.Mode)
+		}
+	}
+	return rules, nil
+}
+
+// issueEventMessage handles an Issue Hook: an issue opened (or reopened) with
+// a rule's label, or updated to add one, is analyzed in that rule's mode. The
+// first matching rule wins. The message is the issue's title and description.
+func issueEventMessage(e *gogitlab.IssueEvent, rules []gitlabIssueRule) *IncomingMessage {
+	if len(rules) == 0 {
+		return nil
+	}
+	var added []*gogitlab.EventLabel
+	switch e.ObjectAttributes.Action {
+	case "open", "reopen":
+		added = e.Labels
+	case "update":
+		previous := make(map[string]bool)
+		for _, l := range e.Changes.Labels.Previous {
+			previous[l.Title] = true
+		}
+		for _, l := range e.Changes.Labels.Current {
+			if !previous[l.Title] {
+				added = append(added, l)
+			}
+		}
+	default:
+		return nil
+	}
+
+	var rule *gitlabIssueRule
+	for i := range rules {
+		for _, l := range added {
+			if l != nil && strings.EqualFold(l.Title, rules[i].Label) {
+				rule = &rules[i]
+				break
+			}
+		}
+		if rule != nil {
+			break
+		}
+	}
+	if rule == nil {
+		return nil
+	}
+
+	attrs := e.ObjectAttributes
+	webURL := attrs.URL
+	if webURL == "" {
+		webURL = fmt.Sprintf("%s/-/issues/%d", e.Project.WebURL, attrs.IID)
+	}
+	meta := gitlabReplyMeta{ProjectID: e.Project.ID, IssueIID: attrs.IID}
+	author := ""
+	if e.User != nil {
+		author = e.User.Username
+	}
+	body := attrs.Title
+	if desc := strings.TrimSpace(attrs.Description); desc != "" {
+		body += "\n\n" + desc
+	}
+	return &IncomingMessage{
+		ExternalRef:    webURL,
+		Title:          attrs.Title,
+		Body:           body,
+		Author:         author,
+		TriggerMode:    rule.Mode,
+		TriggerKeyword: "~" + rule.Label,
+		ReplyMeta:      meta,
+		ThreadKey:      fmt.Sprintf("gitlab:%d:issue:%d", meta.ProjectID, meta.IssueIID),
+	}
+}
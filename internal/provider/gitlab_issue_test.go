@@ -0,0 +1,121 @@
+package provider
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+)
+
+var testIssueRules = []any{
+	map[string]any{"label": "ai-triage", "mode": "ask"},
+	map[string]any{"label": "ai-plan", "mode": "plan"},
+}
+
+func issueHookPayload(action string, labels []string, previous []string) map[string]any {
+	toLabels := func(titles []string) []map[string]any {
+		out := []map[string]any{}
+		for _, t := range titles {
+			out = append(out, map[string]any{"title": t})
+		}
+		return out
+	}
+	payload := map[string]any{
+		"object_kind": "issue",
+		"user":        map[string]any{"username": "pm"},
+		"project":     map[string]any{"id": 42, "web_url": "https://gitlab.com/test/proj"},
+		"object_attributes": map[string]any{
+			"iid":         5,
+			"title":       "Login fails",
+			"description": "Steps: open /login, submit.",
+			"action":      action,
+			"url":         "https://gitlab.com/test/proj/-/issues/5",
+		},
+		"labels": toLabels(labels),
+	}
+	if previous != nil {
+		payload["changes"] = map[string]any{
+			"labels": map[string]any{"previous": toLabels(previous), "current": toLabels(labels)},
+		}
+	}
+	return payload
+}
+
+func receiveIssueMessage(t *testing.T, rules []any, event string, payload map[string]any) *IncomingMessage {
+	t.Helper()
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", map[string]any{"issue_rules": rules}, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	serveGitLabHook(t, handler, event, payload)
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestGitLabHandler_IssueOpenedWithLabel(t *testing.T) {
+	msg := receiveIssueMessage(t, testIssueRules, "Issue Hook", issueHookPayload("open", []string{"bug", "AI-Plan"}, nil))
+	if msg == nil {
+		t.Fatal("onMessage was not called")
+	}
+	if msg.TriggerMode != ModePlan || msg.TriggerKeyword != "~ai-plan" || msg.Author != "pm" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Body != "Login fails\n\nSteps: open /login, submit." || msg.ThreadKey != "gitlab:42:issue:5" {
+		t.Errorf("Body = %q, ThreadKey = %q", msg.Body, msg.ThreadKey)
+	}
+	if meta, _ := msg.ReplyMeta.(gitlabReplyMeta); meta.ProjectID != 42 || meta.IssueIID != 5 {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
+}
+
+func TestGitLabHandler_IssueLabelAdded(t *testing.T) {
+	msg := receiveIssueMessage(t, testIssueRules, "Confidential Issue Hook",
+		issueHookPayload("update", []string{"bug", "ai-triage"}, []string{"bug"}))
+	if msg == nil || msg.TriggerMode != ModeAsk {
+		t.Fatalf("message = %+v", msg)
+	}
+}
+
+func TestGitLabHandler_IssueIgnored(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []any
+		payload map[string]any
+	}{
+		{"no rules", nil, issueHookPayload("open", []string{"ai-triage"}, nil)},
+		{"no rule label", testIssueRules, issueHookPayload("open", []string{"bug"}, nil)},
+		{"label already present", testIssueRules, issueHookPayload("update", []string{"ai-triage"}, []string{"ai-triage"})},
+		{"other update", testIssueRules, issueHookPayload("update", []string{"ai-triage"}, nil)},
+		{"closed", testIssueRules, issueHookPayload("close", []string{"ai-triage"}, nil)},
+	}
+	for _, tt := range tests {
+		if msg := receiveIssueMessage(t, tt.rules, "Issue Hook", tt.payload); msg != nil {
+			t.Errorf("%s: unexpected message %+v", tt.name, msg)
+		}
+	}
+}
+
+func TestGitLabProvider_ValidateConfig_IssueRules(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	cfg := map[string]any{"base_url": "https://gitlab.com", "token": "tok", "issue_rules": testIssueRules}
+	if err := p.ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig() error = %v", err)
+	}
+	for _, bad := range []any{
+		[]any{map[string]any{"label": "x", "mode": "review"}},
+		[]any{map[string]any{"mode": "ask"}},
+		"ai-triage",
+	} {
+		cfg["issue_rules"] = bad
+		if err := p.ValidateConfig(cfg); err == nil {
+			t.Errorf("ValidateConfig(%v) succeeded", bad)
+		}
+	}
+}
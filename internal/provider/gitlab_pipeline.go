@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+const (
+	// maxTraceLines caps the lines of a failed job's log sent for analysis.
+	maxTraceLines = 300
+	// maxTraceBytes caps the bytes of a job log that are downloaded.
+	maxTraceBytes = 4 << 20
+)
+
+// jobEventMessage reports a failed job from a Job Hook. Jobs allowed to fail
+// are ignored. The diagnosis goes to the job's commit; resolveMergeRequest
+// later moves it to the commit's merge request, if any.
+func jobEventMessage(e *gogitlab.JobEvent) *IncomingMessage {
+	if e.BuildStatus != "failed" || e.BuildAllowFailure {
+		return nil
+	}
+	projectURL := ""
+	if e.Repository != nil {
+		projectURL = e.Repository.Homepage
+	}
+	author := ""
+	if e.User != nil {
+		author = e.User.Username
+	}
+	return failedJobMessage(failedJobInfo{
+		projectID:  e.ProjectID,
+		projectURL: projectURL,
+		pipelineID: e.PipelineID,
+		job:        FailedJob{ID: e.BuildID, Ref: e.Ref, Name: e.BuildName, Stage: e.BuildStage},
+		sha:        e.SHA,
+		title:      firstLine(e.Commit.Message),
+		reason:     e.BuildFailureReason,
+		author:     author,
+	})
+}
+
+// pipelineEventMessages reports the failed jobs of a failed pipeline from a
+// Pipeline Hook, on the pipeline's merge request if it has one.
+func pipelineEventMessages(e *gogitlab.PipelineEvent) []*IncomingMessage {
+	if e.ObjectAttributes.Status != "failed" {
+		return nil
+	}
+	author := ""
+	if e.User != nil {
+		author = e.User.Username
+	}
+	var msgs []*IncomingMessage
+	for _, b := range e.Builds {
+		if b.Status != "failed" || b.AllowFailure {
+			continue
+		}
+		msg := failedJobMessage(failedJobInfo{
+			projectID:  e.Project.ID,
+			projectURL: e.Project.WebURL,
+			pipelineID: e.ObjectAttributes.ID,
+			job:        FailedJob{ID: b.ID, Ref: e.ObjectAttributes.Ref, Name: b.Name, Stage: b.Stage},
+			sha:        e.ObjectAttributes.SHA,
+			title:      e.Commit.Title,
+			reason:     b.FailureReason,
+			author:     author,
+		})
+		if e.MergeRequest.IID != 0 {
+			setMergeRequest(msg, e.MergeRequest.IID, e.MergeRequest.URL, e.MergeRequest.Title)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+type failedJobInfo struct {
+	projectID  int
+	projectURL string
+	pipelineID int
+	job        FailedJob
+	sha        string
+	title      string
+	reason     string
+	author     string
+}
+
+// failedJobMessage builds the message for a failed job, addressed to its
+// commit. The commit is what gets analyzed.
+func failedJobMessage(f failedJobInfo) *IncomingMessage {
+	meta := gitlabReplyMeta{ProjectID: f.projectID, CommitSHA: f.sha, JobID: f.job.ID}
+	short := f.sha
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	body := fmt.Sprintf("Job [`%s`](%s/-/jobs/%d) in stage `%s` failed on `%s` (commit %s, pipeline #%d)",
+		f.job.Name, f.projectURL, f.job.ID, f.job.Stage, f.job.Ref, short, f.pipelineID)
+	if f.reason != "" {
+		body += ": " + strings.ReplaceAll(f.reason, "_", " ")
+	}
+	job := f.job
+	return &IncomingMessage{
+		ExternalRef: fmt.Sprintf("%s/-/commit/%s", f.projectURL, f.sha),
+		Title:       f.title,
+		Body:        body + ".",
+		Author:      f.author,
+		ReplyMeta:   meta,
+		Ref:         f.sha,
+		ThreadKey:   fmt.Sprintf("gitlab:%d:commit:%s", meta.ProjectID, meta.CommitSHA),
+		FailedJob:   &job,
+	}
+}
+
+// setMergeRequest redirects msg, a failed job message, to a merge request:
+// the diagnosis is posted there and joins the merge request's conversation.
+func setMergeRequest(msg *IncomingMessage, iid int, webURL, title string) {
+	meta := msg.ReplyMeta.(gitlabReplyMeta)
+	meta.MergeRequestIID = iid
+	msg.ReplyMeta = meta
+	if webURL != "" {
+		msg.ExternalRef = webURL
+	}
+	if title != "" {
+		msg.Title = title
+	}
+	msg.ThreadKey = fmt.Sprintf("gitlab:%d:mr:%d", meta.ProjectID, iid)
+}
+
+// resolveMergeRequest moves a failed job message reported on a commit to the
+// open merge request of the job's branch that contains the commit. Lookup
+// failures leave msg on the commit.
+func (g *GitLabProvider) resolveMergeRequest(ctx context.Context, cfg map[string]any, msg *IncomingMessage) {
+	meta, ok := msg.ReplyMeta.(gitlabReplyMeta)
+	if !ok || meta.MergeRequestIID != 0 || meta.CommitSHA == "" {
+		return
+	}
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	mrs, _, err := client.Commits.ListMergeRequestsByCommit(meta.ProjectID, meta.CommitSHA, gogitlab.WithContext(ctx))
+	if err != nil {
+		g.logger.Warn("gitlab find merge request of commit failed", "project", meta.ProjectID, "sha", meta.CommitSHA, "error", err)
+		return
+	}
+	for _, mr := range mrs {
+		if mr.State == "opened" && mr.SourceBranch == msg.FailedJob.Ref {
+			setMergeRequest(msg, mr.IID, mr.WebURL, mr.Title)
+			return
+		}
+	}
+}
+
+// jobContext returns the failing part of a job's log.
+func jobContext(ctx context.Context, client *gogitlab.Client, meta gitlabReplyMeta) (string, error) {
+	trace, _, err := client.Jobs.GetTraceFile(meta.ProjectID, meta.JobID, gogitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("get job log: %w", err)
+	}
+	raw, err := io.ReadAll(io.LimitReader(trace, maxTraceBytes))
+	if err != nil {
+		return "", fmt.Errorf("read job log: %w", err)
+	}
+	log := trimTrace(string(raw), maxTraceLines)
+	if log == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("## Job log\n```\n%s\n```", log), nil
+}
+
+var (
+	ansiEscape   = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	traceSection = regexp.MustCompile(`section_(start|end):\d+:([A-Za-z0-9_.-]+)(\[[^\]]*\])?\r?`)
+)
+
+// scriptSections are the runner sections that run the job's own commands,
+// where a failure usually is.
+var scriptSections = map[string]bool{"step_script": true, "build_script": true}
+
+// trimTrace cleans a GitLab job log (ANSI colors, carriage-return progress
+// output, section markers) and keeps the end of the failing part: the job's
+// script section if the runner marked one, or the whole log otherwise, cut to
+// its last maxLines lines. The runner's closing "ERROR: Job failed" line is
+// kept even when it lies outside that part.
+func trimTrace(raw string, maxLines int) string {
+	var lines []string
+	start, end := -1, -1
+	for _, line := range strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n") {
+		for _, m := range traceSection.FindAllStringSubmatch(line, -1) {
+			if !scriptSections[m[2]] {
+				continue
+			}
+			if m[1] == "start" {
+				start, end = len(lines), -1
+			} else if start >= 0 {
+				end = len(lines)
+			}
+		}
+		line = traceSection.ReplaceAllString(line, "")
+		line = ansiEscape.ReplaceAllString(line, "")
+		// A carriage return redraws the line; only the last drawing shows.
+		if i := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); i >= 0 {
+			line = line[i+1:]
+		}
+		lines = append(lines, strings.TrimRight(line, " \r"))
+	}
+
+	failed := ""
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "ERROR: Job failed") {
+			failed = lines[i]
+			break
+		}
+	}
+	if start >= 0 {
+		if end < 0 {
+			end = len(lines)
+		}
+		lines = lines[start:end]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	omitted := 0
+	if maxLines > 0 && len(lines) > maxLines {
+		omitted = len(lines) - maxLines
+		lines = lines[omitted:]
+	}
+
+	var sb strings.Builder
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "[… %d lines omitted]\n", omitted)
+	}
+	sb.WriteString(strings.Join(lines, "\n"))
+	if failed != "" && (len(lines) == 0 || lines[len(lines)-1] != failed) {
+		sb.WriteString("\n" + failed)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
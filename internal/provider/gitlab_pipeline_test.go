@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+)
+
+func serveGitLabHook(t *testing.T, handler http.Handler, event string, payload map[string]any) {
+	t.Helper()
+	body, _ := json.Marshal(payload)
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(string(body)))
+	req.Header.Set("X-Gitlab-Token", "secret")
+	req.Header.Set("X-Gitlab-Event", event)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func jobHookPayload(status string, allowFailure bool) map[string]any {
+	return map[string]any{
+		"object_kind":          "build",
+		"ref":                  "feature/cache",
+		"sha":                  "abc123def456",
+		"build_id":             99,
+		"build_name":           "unit-tests",
+		"build_stage":          "test",
+		"build_status":         status,
+		"build_allow_failure":  allowFailure,
+		"build_failure_reason": "script_failure",
+		"pipeline_id":          12,
+		"project_id":           42,
+		"user":                 map[string]any{"username": "bob"},
+		"commit":               map[string]any{"message": "Add cache\n\nDetails."},
+		"repository":           map[string]any{"homepage": "https://gitlab.com/test/proj"},
+	}
+}
+
+func TestGitLabHandler_FailedJobOnMergeRequest(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"iid": 3, "state": "merged", "source_branch": "feature/cache"},
+			{"iid": 7, "state": "opened", "source_branch": "feature/cache", "title": "Add cache", "web_url": "https://gitlab.com/test/proj/-/merge_requests/7"}]`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", map[string]any{"base_url": srv.URL, "token": "tok"}, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	serveGitLabHook(t, handler, "Job Hook", jobHookPayload("failed", false))
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	if gotPath != "/api/v4/projects/42/repository/commits/abc123def456/merge_requests" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if msg.FailedJob == nil || *msg.FailedJob != (FailedJob{ID: 99, Ref: "feature/cache", Name: "unit-tests", Stage: "test"}) {
+		t.Fatalf("FailedJob = %+v", msg.FailedJob)
+	}
+	if msg.Ref != "abc123def456" || msg.Author != "bob" || msg.Title != "Add cache" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if !strings.Contains(msg.Body, "[`unit-tests`](https://gitlab.com/test/proj/-/jobs/99)") || !strings.Contains(msg.Body, "script failure") {
+		t.Errorf("Body = %q", msg.Body)
+	}
+	meta, _ := msg.ReplyMeta.(gitlabReplyMeta)
+	if meta.MergeRequestIID != 7 || meta.JobID != 99 || meta.CommitSHA != "abc123def456" {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
+	if msg.ThreadKey != "gitlab:42:mr:7" || msg.ExternalRef != "https://gitlab.com/test/proj/-/merge_requests/7" {
+		t.Errorf("ThreadKey = %q, ExternalRef = %q", msg.ThreadKey, msg.ExternalRef)
+	}
+}
+
+func TestGitLabHandler_IgnoresPassedAndAllowedFailureJobs(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 2)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	serveGitLabHook(t, handler, "Job Hook", jobHookPayload("success", false))
+	serveGitLabHook(t, handler, "Job Hook", jobHookPayload("failed", true))
+
+	select {
+	case msg := <-received:
+		t.Fatalf("unexpected message: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGitLabHandler_FailedPipeline(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 3)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	serveGitLabHook(t, handler, "Pipeline Hook", map[string]any{
+		"object_kind":       "pipeline",
+		"object_attributes": map[string]any{"id": 12, "ref": "main", "sha": "abc123", "status": "failed"},
+		"project":           map[string]any{"id": 42, "web_url": "https://gitlab.com/test/proj"},
+		"commit":            map[string]any{"title": "Bump deps"},
+		"builds": []map[string]any{
+			{"id": 1, "name": "lint", "stage": "test", "status": "success"},
+			{"id": 2, "name": "flaky", "stage": "test", "status": "failed", "allow_failure": true},
+			{"id": 3, "name": "build", "stage": "build", "status": "failed"},
+		},
+	})
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	if msg.FailedJob.Name != "build" || msg.Title != "Bump deps" || msg.ExternalRef != "https://gitlab.com/test/proj/-/commit/abc123" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if meta, _ := msg.ReplyMeta.(gitlabReplyMeta); meta.JobID != 3 || meta.CommitSHA != "abc123" || meta.MergeRequestIID != 0 {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
+	select {
+	case extra := <-received:
+		t.Fatalf("unexpected second message: %+v", extra)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGitLabHandler_FailedJobDeliveryKeyedOnJob(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 2)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	serveGitLabHook(t, handler, "Job Hook", jobHookPayload("failed", false))
+	serveGitLabHook(t, handler, "Pipeline Hook", map[string]any{
+		"object_kind":       "pipeline",
+		"object_attributes": map[string]any{"id": 12, "ref": "feature/cache", "sha": "abc123def456", "status": "failed"},
+		"project":           map[string]any{"id": 42, "web_url": "https://gitlab.com/test/proj"},
+		"builds":            []map[string]any{{"id": 99, "name": "unit-tests", "stage": "test", "status": "failed"}},
+	})
+
+	// Both hooks report job 99: the analyzer handles whichever arrives first
+	// and skips the other as a duplicate.
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			if msg.Delivery == nil || msg.Delivery.ID != "job/99" {
+				t.Fatalf("Delivery = %+v, want it keyed on the job", msg.Delivery)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("onMessage was not called")
+		}
+	}
+}
+
+func TestTrimTrace(t *testing.T) {
+	raw := "Running with gitlab-runner 16.0\n" +
+		"section_start:1700000000:prepare_script\r\x1b[0KPreparing environment\n" +
+		"section_end:1700000001:prepare_script\r\x1b[0K\n" +
+		"section_start:1700000002:step_script\r\x1b[0K\x1b[32;1m$ go test ./...\x1b[0;m\n" +
+		"Downloading 10%\rDownloading 100%\n" +
+		"--- FAIL: TestCache (0.00s)\n" +
+		"FAIL\n" +
+		"section_end:1700000003:step_script\r\x1b[0K\n" +
+		"section_start:1700000004:cleanup_file_variables\r\x1b[0KCleaning up\n" +
+		"section_end:1700000005:cleanup_file_variables\r\x1b[0K\n" +
+		"\x1b[31;1mERROR: Job failed: exit code 1\n\x1b[0;m\n"
+
+	want := "$ go test ./...\nDownloading 100%\n--- FAIL: TestCache (0.00s)\nFAIL\nERROR: Job failed: exit code 1"
+	if got := trimTrace(raw, 100); got != want {
+		t.Errorf("trimTrace() =\n%q\nwant\n%q", got, want)
+	}
+	want = "[… 2 lines omitted]\n--- FAIL: TestCache (0.00s)\nFAIL\nERROR: Job failed: exit code 1"
+	if got := trimTrace(raw, 2); got != want {
+		t.Errorf("trimTrace(2) =\n%q\nwant\n%q", got, want)
+	}
+	if got := trimTrace("line 1\nline 2\n", 1); got != "[… 1 lines omitted]\nline 2" {
+		t.Errorf("trimTrace() without sections = %q", got)
+	}
+}
+
+func TestGitLabFetchContext_FailedJob(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/42/jobs/99/trace":
+			_, _ = w.Write([]byte("section_start:1:step_script\r\x1b[0K$ make\nboom\nsection_end:2:step_script\r\x1b[0K\nERROR: Job failed: exit code 2\n"))
+		case "/api/v4/projects/42/repository/commits/abc123":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"short_id": "abc123", "author_name": "Bob", "message": "Add cache"}`))
+		case "/api/v4/projects/42/repository/commits/abc123/diff":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, CommitSHA: "abc123", JobID: 99}}
+	got, err := p.FetchContext(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testContextLimits)
+	if err != nil {
+		t.Fatalf("FetchContext() error = %v", err)
+	}
+	want := "## Job log\n```\n$ make\nboom\nERROR: Job failed: exit code 2\n```\n\n## Commit abc123 by Bob"
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("context =\n%s\nwant prefix\n%s", got, want)
+	}
+}
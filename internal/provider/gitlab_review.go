@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+var _ MergeRequestReviewer = (*GitLabProvider)(nil)
+
+// ReviewDiff fetches the changes of the merge request msg was posted on,
+// along with the diff refs GitLab needs to position comments on them.
+func (g *GitLabProvider) ReviewDiff(ctx context.Context, cfg map[string]any, msg *IncomingMessage) (*ReviewDiff, error) {
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return nil, err
+	}
+	if meta.MergeRequestIID == 0 {
+		return nil, ErrNotMergeRequest
+	}
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mr, _, err := client.MergeRequests.GetMergeRequest(meta.ProjectID, meta.MergeRequestIID, nil, gogitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("get merge request: %w", err)
+	}
+
+	var sb strings.Builder
+	opt := &gogitlab.ListMergeRequestDiffsOptions{ListOptions: gogitlab.ListOptions{PerPage: 100}}
+	for {
+		diffs, resp, err := client.MergeRequests.ListMergeRequestDiffs(meta.ProjectID, meta.MergeRequestIID, opt, gogitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("list merge request diffs: %w", err)
+		}
+		for _, d := range diffs {
+			oldPath, newPath := "a/"+d.OldPath, "b/"+d.NewPath
+			if d.NewFile {
+				oldPath = "/dev/null"
+			}
+			if d.DeletedFile {
+				newPath = "/dev/null"
+			}
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldPath, newPath)
+			sb.WriteString(d.Diff)
+			if !strings.HasSuffix(d.Diff, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return &ReviewDiff{
+		Diff:     sb.String(),
+		BaseSHA:  mr.DiffRefs.BaseSha,
+		StartSHA: mr.DiffRefs.StartSha,
+		HeadSHA:  mr.DiffRefs.HeadSha,
+	}, nil
+}
+
+// PostReviewComment starts a merge request discussion anchored on the line
+// c refers to. The returned reference carries the discussion ID as Channel.
+func (g *GitLabProvider) PostReviewComment(ctx context.Context, cfg map[string]any, msg *IncomingMessage, diff *ReviewDiff, c ReviewComment) (*MessageRef, error) {
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return nil, err
+	}
+	if meta.MergeRequestIID == 0 {
+		return nil, ErrNotMergeRequest
+	}
+	oldPath, newLine, oldLine, ok := diff.Locate(c)
+	if !ok {
+		return nil, fmt.Errorf("%s:%d is not part of the diff", c.Path, max(c.Line, c.OldLine))
+	}
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := &gogitlab.PositionOptions{
+		BaseSHA:      gogitlab.Ptr(diff.BaseSHA),
+		StartSHA:     gogitlab.Ptr(diff.StartSHA),
+		HeadSHA:      gogitlab.Ptr(diff.HeadSHA),
+		PositionType: gogitlab.Ptr("text"),
+		OldPath:      gogitlab.Ptr(oldPath),
+		NewPath:      gogitlab.Ptr(c.Path),
+	}
+	if newLine > 0 {
+		pos.NewLine = gogitlab.Ptr(newLine)
+	}
+	if oldLine > 0 {
+		pos.OldLine = gogitlab.Ptr(oldLine)
+	}
+
+	d, _, err := client.Discussions.CreateMergeRequestDiscussion(meta.ProjectID, meta.MergeRequestIID,
+		&gogitlab.CreateMergeRequestDiscussionOptions{Body: gogitlab.Ptr(c.Body), Position: pos},
+		gogitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if len(d.Notes) == 0 {
+		return nil, fmt.Errorf("discussion %s has no note", d.ID)
+	}
+	noteID := d.Notes[0].ID
+	return &MessageRef{ID: strconv.Itoa(noteID), Channel: d.ID, URL: gitlabNoteURL(msg.ExternalRef, noteID)}, nil
+}
@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -10,12 +11,14 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
 )
 
 // --- GitLabProvider Type ---
 
 func TestGitLabProvider_Type(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	if p.Type() != ProviderGitLab {
 		t.Errorf("Type() = %q, want %q", p.Type(), ProviderGitLab)
 	}
@@ -24,7 +27,7 @@ func TestGitLabProvider_Type(t *testing.T) {
 // --- GitLabProvider ValidateConfig ---
 
 func TestGitLabProvider_ValidateConfig_Valid(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	cfg := map[string]any{"base_url": "https://gitlab.com", "token": "tok"}
 	if err := p.ValidateConfig(cfg); err != nil {
 		t.Errorf("ValidateConfig() error = %v", err)
@@ -32,7 +35,7 @@ func TestGitLabProvider_ValidateConfig_Valid(t *testing.T) {
 }
 
 func TestGitLabProvider_ValidateConfig_MissingBaseURL(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	cfg := map[string]any{"token": "tok"}
 	err := p.ValidateConfig(cfg)
 	if err == nil {
@@ -44,7 +47,7 @@ func TestGitLabProvider_ValidateConfig_MissingBaseURL(t *testing.T) {
 }
 
 func TestGitLabProvider_ValidateConfig_MissingToken(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	cfg := map[string]any{"base_url": "https://gitlab.com"}
 	err := p.ValidateConfig(cfg)
 	if err == nil {
@@ -56,7 +59,7 @@ func TestGitLabProvider_ValidateConfig_MissingToken(t *testing.T) {
 }
 
 func TestGitLabProvider_ValidateConfig_Empty(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	err := p.ValidateConfig(map[string]any{})
 	if err == nil {
 		t.Fatal("ValidateConfig() expected error for empty config")
@@ -66,7 +69,7 @@ func TestGitLabProvider_ValidateConfig_Empty(t *testing.T) {
 // --- GitLab BuildHandler: method not allowed ---
 
 func TestGitLabHandler_MethodNotAllowed(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "secret", nil, nil)
 
 	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodPatch} {
@@ -82,7 +85,7 @@ func TestGitLabHandler_MethodNotAllowed(t *testing.T) {
 // --- GitLab BuildHandler: invalid token ---
 
 func TestGitLabHandler_InvalidToken(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "correct-secret", nil, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", nil)
@@ -96,7 +99,7 @@ func TestGitLabHandler_InvalidToken(t *testing.T) {
 }
 
 func TestGitLabHandler_MissingToken(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "my-secret", nil, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", nil)
@@ -111,7 +114,7 @@ func TestGitLabHandler_MissingToken(t *testing.T) {
 // --- GitLab BuildHandler: non-note event ---
 
 func TestGitLabHandler_NonNoteEvent(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "secret", nil, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader("{}"))
@@ -128,7 +131,7 @@ func TestGitLabHandler_NonNoteEvent(t *testing.T) {
 // --- GitLab BuildHandler: empty body for note event ---
 
 func TestGitLabHandler_EmptyBody(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "secret", nil, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(""))
@@ -145,7 +148,7 @@ func TestGitLabHandler_EmptyBody(t *testing.T) {
 // --- GitLab BuildHandler: system comment ---
 
 func TestGitLabHandler_SystemComment(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 
 	var called bool
 	onMessage := func(_ context.Context, _ *IncomingMessage) {
@@ -193,7 +196,7 @@ func TestGitLabHandler_SystemComment(t *testing.T) {
 // --- GitLab BuildHandler: valid issue comment ---
 
 func TestGitLabHandler_ValidIssueComment(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 
 	var mu sync.Mutex
 	var received *IncomingMessage
@@ -212,6 +215,7 @@ func TestGitLabHandler_ValidIssueComment(t *testing.T) {
 		"project":       map[string]any{"web_url": "https://gitlab.com/test/proj"},
 		"noteable_type": "Issue",
 		"object_attributes": map[string]any{
+			"id":            100,
 			"note":          "@opencode analyze this",
 			"system":        false,
 			"noteable_type": "Issue",
@@ -227,6 +231,7 @@ func TestGitLabHandler_ValidIssueComment(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(string(body)))
 	req.Header.Set("X-Gitlab-Token", "secret")
 	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	req.Header.Set("X-Gitlab-Event-UUID", "0f3d-uuid")
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
@@ -260,12 +265,164 @@ func TestGitLabHandler_ValidIssueComment(t *testing.T) {
 	if received.ExternalRef != "https://gitlab.com/test/proj/-/issues/5#note_100" {
 		t.Errorf("ExternalRef = %q", received.ExternalRef)
 	}
+	if received.Source.ID != "100" || received.Source.URL != received.ExternalRef {
+		t.Errorf("Source = %+v", received.Source)
+	}
+	if received.ThreadKey != "gitlab:42:issue:5" {
+		t.Errorf("ThreadKey = %q", received.ThreadKey)
+	}
+	if d := received.Delivery; d == nil || d.ID != "0f3d-uuid" || d.Event != "Note Hook" {
+		t.Errorf("Delivery = %+v", d)
+	}
+}
+
+// --- GitLab BuildHandler: merge request comment ---
+
+func TestGitLabHandler_MergeRequestComment(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+
+	payload := map[string]any{
+		"object_kind":   "note",
+		"event_type":    "note",
+		"user":          map[string]any{"username": "bob"},
+		"project_id":    42,
+		"project":       map[string]any{"web_url": "https://gitlab.com/test/proj"},
+		"noteable_type": "MergeRequest",
+		"object_attributes": map[string]any{
+			"id":            200,
+			"note":          "@opencode does this break anything?",
+			"noteable_type": "MergeRequest",
+			"url":           "https://gitlab.com/test/proj/-/merge_requests/7#note_200",
+		},
+		"merge_request": map[string]any{
+			"iid":               7,
+			"title":             "Add cache",
+			"source_branch":     "feature/cache",
+			"source_project_id": 42,
+			"target_project_id": 42,
+		},
+	}
+	body, _ := json.Marshal(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(string(body)))
+	req.Header.Set("X-Gitlab-Token", "secret")
+	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	if msg.Provider != ProviderGitLab || msg.ProviderCfgID != "cfg-1" || msg.Title != "Add cache" || msg.Author != "bob" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Ref != "feature/cache" {
+		t.Errorf("Ref = %q, want the MR source branch", msg.Ref)
+	}
+	if msg.ThreadKey != "gitlab:42:mr:7" {
+		t.Errorf("ThreadKey = %q", msg.ThreadKey)
+	}
+	if meta, ok := msg.ReplyMeta.(gitlabReplyMeta); !ok || meta.MergeRequestIID != 7 || meta.ProjectID != 42 {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
+}
+
+// --- GitLab BuildHandler: commit and snippet comments ---
+
+func TestGitLabHandler_CommitComment(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+
+	payload := map[string]any{
+		"object_kind": "note",
+		"user":        map[string]any{"username": "carol"},
+		"project_id":  42,
+		"project":     map[string]any{"web_url": "https://gitlab.com/test/proj"},
+		"object_attributes": map[string]any{
+			"id":            300,
+			"note":          "@opencode why was this reverted?",
+			"noteable_type": "Commit",
+			"url":           "https://gitlab.com/test/proj/-/commit/abc123#note_300",
+		},
+		"commit": map[string]any{"id": "abc123", "title": "Revert cache"},
+	}
+	body, _ := json.Marshal(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(string(body)))
+	req.Header.Set("X-Gitlab-Token", "secret")
+	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	if msg.Title != "Revert cache" || msg.Ref != "abc123" || msg.ThreadKey != "gitlab:42:commit:abc123" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if meta, ok := msg.ReplyMeta.(gitlabReplyMeta); !ok || meta.CommitSHA != "abc123" || meta.ProjectID != 42 {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
+}
+
+func TestGitLabHandler_SnippetComment(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+
+	payload := map[string]any{
+		"object_kind": "note",
+		"user":        map[string]any{"username": "dave"},
+		"project_id":  42,
+		"project":     map[string]any{"web_url": "https://gitlab.com/test/proj"},
+		"object_attributes": map[string]any{
+			"id":            400,
+			"note":          "@opencode is this query safe?",
+			"noteable_type": "Snippet",
+		},
+		"snippet": map[string]any{"id": 9, "title": "Cleanup query"},
+	}
+	body, _ := json.Marshal(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader(string(body)))
+	req.Header.Set("X-Gitlab-Token", "secret")
+	req.Header.Set("X-Gitlab-Event", "Note Hook")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	if msg.Title != "Cleanup query" || msg.ExternalRef != "https://gitlab.com/test/proj/-/snippets/9" || msg.ThreadKey != "gitlab:42:snippet:9" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if meta, ok := msg.ReplyMeta.(gitlabReplyMeta); !ok || meta.SnippetID != 9 {
+		t.Errorf("ReplyMeta = %+v", msg.ReplyMeta)
+	}
 }
 
 // --- GitLab BuildHandler: malformed JSON ---
 
 func TestGitLabHandler_MalformedJSON(t *testing.T) {
-	p := NewGitLabProvider(slog.Default())
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
 	handler := p.BuildHandler("cfg-1", "secret", nil, nil)
 
 	req := httptest.NewRequest(http.MethodPost, "/hook/gitlab/test", strings.NewReader("{not valid json"))
@@ -278,3 +435,460 @@ func TestGitLabHandler_MalformedJSON(t *testing.T) {
 		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
 	}
 }
+
+// --- GitLab SendReply ---
+
+func TestGitLabSendReply_ReturnsNoteRef(t *testing.T) {
+	var gotPath, gotBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		var req map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotBody, _ = req["body"].(string)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 777, "body": "hi"}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{
+		ExternalRef: "https://gitlab.com/test/proj/-/issues/5#note_100",
+		ReplyMeta:   gitlabReplyMeta{ProjectID: 42, IssueIID: 5},
+	}
+	ref, err := p.SendReply(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, "hi")
+	if err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/issues/5/notes" || gotBody != "hi" {
+		t.Errorf("request = %s %q", gotPath, gotBody)
+	}
+	if ref.ID != "777" || ref.URL != "https://gitlab.com/test/proj/-/issues/5#note_777" {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestGitLabEditReply_UpdatesNote(t *testing.T) {
+	var gotMethod, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 777}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5}}
+	err := p.EditReply(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, MessageRef{ID: "777"}, "done")
+	if err != nil {
+		t.Fatalf("EditReply() error = %v", err)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/api/v4/projects/42/issues/5/notes/777" {
+		t.Errorf("request = %s %s", gotMethod, gotPath)
+	}
+}
+
+func TestGitLabSendReply_MergeRequestNote(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 778}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{
+		ExternalRef: "https://gitlab.com/test/proj/-/merge_requests/7#note_200",
+		ReplyMeta:   gitlabReplyMeta{ProjectID: 42, MergeRequestIID: 7},
+	}
+	ref, err := p.SendReply(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, "hi")
+	if err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/merge_requests/7/notes" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if ref.URL != "https://gitlab.com/test/proj/-/merge_requests/7#note_778" {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestGitLabSendReply_CommitDiscussion(t *testing.T) {
+	var gotMethod, gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath = r.Method, r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": "d1", "notes": [{"id": 779}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": 779}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	cfg := map[string]any{"base_url": srv.URL, "token": "tok"}
+	msg := &IncomingMessage{
+		ExternalRef: "https://gitlab.com/test/proj/-/commit/abc123#note_300",
+		ReplyMeta:   gitlabReplyMeta{ProjectID: 42, CommitSHA: "abc123"},
+	}
+	ref, err := p.SendReply(context.Background(), cfg, msg, "hi")
+	if err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/repository/commits/abc123/discussions" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if ref.ID != "779" || ref.Channel != "d1" || ref.URL != "https://gitlab.com/test/proj/-/commit/abc123#note_779" {
+		t.Errorf("ref = %+v", ref)
+	}
+
+	if err := p.EditReply(context.Background(), cfg, msg, *ref, "done"); err != nil {
+		t.Fatalf("EditReply() error = %v", err)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/api/v4/projects/42/repository/commits/abc123/discussions/d1/notes/779" {
+		t.Errorf("edit request = %s %s", gotMethod, gotPath)
+	}
+}
+
+func TestGitLabSendReply_SnippetNote(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 780}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, SnippetID: 9}}
+	if _, err := p.SendReply(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, "hi"); err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/snippets/9/notes" {
+		t.Errorf("path = %s", gotPath)
+	}
+}
+
+var testContextLimits = ContextLimits{IssueNotes: 20, IssueTokens: 8000}
+
+func TestGitLabFetchContext_MergeRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v4/projects/42/merge_requests/7":
+			_, _ = w.Write([]byte(`{"iid": 7, "title": "Add cache", "description": "Caches lookups.", "source_branch": "feature/cache", "target_branch": "main", "state": "opened"}`))
+		case "/api/v4/projects/42/merge_requests/7/diffs":
+			_, _ = w.Write([]byte(`[{"old_path": "cache.go", "new_path": "cache.go", "new_file": true}, {"old_path": "a.go", "new_path": "b.go", "renamed_file": true}, {"old_path": "lookup.go", "new_path": "lookup.go"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, MergeRequestIID: 7}}
+	got, err := p.FetchContext(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testContextLimits)
+	if err != nil {
+		t.Fatalf("FetchContext() error = %v", err)
+	}
+	for _, want := range []string{
+		"## Merge request !7: Add cache",
+		"Source branch `feature/cache` → target branch `main` (opened)",
+		"Caches lookups.",
+		"### Changed files (3)",
+		"- `cache.go` (added)",
+		"- `a.go` → `b.go` (renamed)",
+		"- `lookup.go`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("context missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestGitLabFetchContext_Issue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v4/projects/42/issues/5":
+			_, _ = w.Write([]byte(`{"id": 500, "iid": 5, "title": "Login fails", "description": "Steps: open /login.", "state": "opened", "author": {"username": "pm"}, "labels": ["bug", "auth"]}`))
+		case "/api/v4/projects/42/issues/5/related_merge_requests":
+			_, _ = w.Write([]byte(`[{"iid": 8, "title": "Fix login", "state": "opened"}]`))
+		case "/api/v4/user":
+			_, _ = w.Write([]byte(`{"id": 1, "username": "dog-bot"}`))
+		case "/api/v4/projects/42/issues/5/notes":
+			if r.URL.Query().Get("sort") != "desc" {
+				t.Errorf("notes query = %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`[
+				{"id": 14, "body": "@dog-bot why?", "author": {"id": 2, "username": "alice"}},
+				{"id": 13, "body": "Analyzing…", "author": {"id": 1, "username": "dog-bot"}},
+				{"id": 12, "body": "added ~bug label", "system": true, "author": {"id": 2, "username": "alice"}},
+				{"id": 11, "body": "Only on Safari.", "author": {"id": 3, "username": "bob"}, "created_at": "2024-05-01T10:00:00Z"},
+				{"id": 10, "body": "Seen it too.", "author": {"id": 2, "username": "alice"}}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5}, Source: MessageRef{ID: "14"}}
+	got, err := p.FetchContext(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testContextLimits)
+	if err != nil {
+		t.Fatalf("FetchContext() error = %v", err)
+	}
+	want := "## Issue #5: Login fails\n" +
+		"State: opened, opened by @pm, labels: ~bug, ~auth\n\n" +
+		"### Description\nSteps: open /login.\n\n" +
+		"### Related merge requests\n- !8 Fix login (opened)\n\n" +
+		"### Comments\n**@alice**:\nSeen it too.\n\n**@bob** (2024-05-01 10:00):\nOnly on Safari."
+	if got != want {
+		t.Errorf("context =\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = p.FetchContext(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, ContextLimits{IssueNotes: 1, IssueTokens: 8000})
+	if err != nil {
+		t.Fatalf("FetchContext() error = %v", err)
+	}
+	if want := "### Comments\n[… 1 earlier comments omitted]\n\n**@bob** (2024-05-01 10:00):\nOnly on Safari."; !strings.HasSuffix(got, want) {
+		t.Errorf("context with one note =\n%s", got)
+	}
+}
+
+func TestGitLabReviewDiff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v4/projects/42/merge_requests/7":
+			_, _ = w.Write([]byte(`{"iid": 7, "diff_refs": {"base_sha": "b1", "start_sha": "s1", "head_sha": "h1"}}`))
+		case "/api/v4/projects/42/merge_requests/7/diffs":
+			_, _ = w.Write([]byte(`[{"old_path": "cache.go", "new_path": "cache.go", "new_file": true, "diff": "@@ -0,0 +1,1 @@\n+package cache\n"}, {"old_path": "a.go", "new_path": "b.go", "renamed_file": true, "diff": "@@ -1,1 +1,1 @@\n-x\n+y"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, MergeRequestIID: 7}}
+	d, err := p.ReviewDiff(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg)
+	if err != nil {
+		t.Fatalf("ReviewDiff() error = %v", err)
+	}
+	want := "--- /dev/null\n+++ b/cache.go\n@@ -0,0 +1,1 @@\n+package cache\n--- a/a.go\n+++ b/b.go\n@@ -1,1 +1,1 @@\n-x\n+y\n"
+	if d.Diff != want {
+		t.Errorf("diff = %q, want %q", d.Diff, want)
+	}
+	if d.BaseSHA != "b1" || d.StartSHA != "s1" || d.HeadSHA != "h1" {
+		t.Errorf("refs = %s %s %s", d.BaseSHA, d.StartSHA, d.HeadSHA)
+	}
+}
+
+func TestGitLabReviewDiff_NotMergeRequest(t *testing.T) {
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5}}
+	if _, err := p.ReviewDiff(context.Background(), map[string]any{"base_url": "http://unused", "token": "tok"}, msg); !errors.Is(err, ErrNotMergeRequest) {
+		t.Fatalf("ReviewDiff() error = %v", err)
+	}
+}
+
+func TestGitLabPostReviewComment(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": "d9", "notes": [{"id": 901}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{
+		ExternalRef: "https://gitlab.com/test/proj/-/merge_requests/7#note_200",
+		ReplyMeta:   gitlabReplyMeta{ProjectID: 42, MergeRequestIID: 7},
+	}
+	diff := &ReviewDiff{Diff: "--- a/a.go\n+++ b/b.go\n@@ -1,2 +1,2 @@\n ctx\n-x\n+y\n", BaseSHA: "b1", StartSHA: "s1", HeadSHA: "h1"}
+	ref, err := p.PostReviewComment(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, diff,
+		ReviewComment{Path: "b.go", Line: 2, Body: "why y?"})
+	if err != nil {
+		t.Fatalf("PostReviewComment() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/merge_requests/7/discussions" {
+		t.Errorf("path = %s", gotPath)
+	}
+	pos, _ := gotBody["position"].(map[string]any)
+	if gotBody["body"] != "why y?" || pos["old_path"] != "a.go" || pos["new_path"] != "b.go" ||
+		pos["new_line"] != float64(2) || pos["old_line"] != nil || pos["head_sha"] != "h1" || pos["position_type"] != "text" {
+		t.Errorf("body = %v", gotBody)
+	}
+	if ref.ID != "901" || ref.Channel != "d9" || ref.URL != "https://gitlab.com/test/proj/-/merge_requests/7#note_901" {
+		t.Errorf("ref = %+v", ref)
+	}
+
+	if _, err := p.PostReviewComment(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, diff,
+		ReviewComment{Path: "b.go", Line: 9, Body: "x"}); err == nil {
+		t.Error("expected an error for a line outside the diff")
+	}
+}
+
+func TestGitLabProjectPath(t *testing.T) {
+	tests := map[string]string{
+		"git@gitlab.com:group/proj.git":             "group/proj",
+		"git@gitlab.com:group/sub/proj.git":         "group/sub/proj",
+		"ssh://git@gitlab.example.com:2222/g/p.git": "g/p",
+		"https://gitlab.com/group/proj":             "group/proj",
+		"/srv/repos/proj":                           "",
+	}
+	for url, want := range tests {
+		if got := gitlabProjectPath(url); got != want {
+			t.Errorf("gitlabProjectPath(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestGitLabCreateMergeRequest(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"iid": 3, "web_url": "https://gitlab.com/group/proj/-/merge_requests/3"}`))
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	cfg := map[string]any{"base_url": srv.URL, "token": "tok"}
+	mr := MergeRequest{
+		RepoURL:      "git@gitlab.com:group/proj.git",
+		SourceBranch: "opencode/task-1",
+		TargetBranch: "main",
+		Title:        "Fix parser",
+		Description:  "Requested by alice",
+	}
+
+	// A request from another channel: the project comes from the repo URL.
+	url, err := p.CreateMergeRequest(context.Background(), cfg, &IncomingMessage{Provider: ProviderSlack}, mr)
+	if err != nil {
+		t.Fatalf("CreateMergeRequest() error = %v", err)
+	}
+	if url != "https://gitlab.com/group/proj/-/merge_requests/3" {
+		t.Errorf("url = %q", url)
+	}
+	if gotPath != "/api/v4/projects/group%2Fproj/merge_requests" {
+		t.Errorf("path = %s", gotPath)
+	}
+	if gotBody["source_branch"] != "opencode/task-1" || gotBody["target_branch"] != "main" || gotBody["title"] != "Fix parser" {
+		t.Errorf("body = %v", gotBody)
+	}
+
+	// A GitLab request names the project itself.
+	msg := &IncomingMessage{Provider: ProviderGitLab, ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5}}
+	if _, err := p.CreateMergeRequest(context.Background(), cfg, msg, mr); err != nil {
+		t.Fatalf("CreateMergeRequest() error = %v", err)
+	}
+	if gotPath != "/api/v4/projects/42/merge_requests" {
+		t.Errorf("path = %s", gotPath)
+	}
+}
+
+func TestGitLabFetchAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v4/projects/42/uploads/0123456789abcdef0123456789abcdef/login error.png":
+			if r.Header.Get("PRIVATE-TOKEN") != "tok" {
+				t.Errorf("PRIVATE-TOKEN = %q", r.Header.Get("PRIVATE-TOKEN"))
+			}
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG"))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{
+		Body:      "@opencode see ![login error](/uploads/0123456789abcdef0123456789abcdef/login%20error.png) and [again](/uploads/0123456789abcdef0123456789abcdef/login%20error.png)",
+		ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5},
+	}
+	got, err := p.FetchAttachments(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testAttachmentLimits)
+	if err != nil {
+		t.Fatalf("FetchAttachments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "login error.png" || got[0].MIMEType != "image/png" {
+		t.Errorf("attachments = %+v", got)
+	}
+}
+
+func TestGitLabFetchAttachments_StopsAtMaxBytes(t *testing.T) {
+	const total = 32 << 20
+	written := make(chan int, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		chunk := make([]byte, 32<<10)
+		n := 0
+		for n < total {
+			if _, err := w.Write(chunk); err != nil {
+				break
+			}
+			n += len(chunk)
+		}
+		written <- n
+	}))
+	defer srv.Close()
+
+	p := NewGitLabProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{
+		Body:      "@opencode see ![huge](/uploads/0123456789abcdef0123456789abcdef/huge.png)",
+		ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5},
+	}
+	got, err := p.FetchAttachments(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testAttachmentLimits)
+	if err != nil || len(got) != 0 {
+		t.Fatalf("FetchAttachments() = %+v, %v; want the file skipped", got, err)
+	}
+	if n := <-written; n >= total {
+		t.Fatalf("the whole %d byte file was downloaded", n)
+	}
+}
+
+func TestGitLabFetchAttachments_TimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "gitlab_http_timeout", json.RawMessage(`"50ms"`))
+	p := NewGitLabProvider(store, slog.Default())
+	msg := &IncomingMessage{
+		Body:      "@opencode see ![stuck](/uploads/0123456789abcdef0123456789abcdef/stuck.png)",
+		ReplyMeta: gitlabReplyMeta{ProjectID: 42, IssueIID: 5},
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, err := p.FetchAttachments(context.Background(), map[string]any{"base_url": srv.URL, "token": "tok"}, msg, testAttachmentLimits)
+		if err != nil || len(got) != 0 {
+			t.Errorf("FetchAttachments() = %+v, %v; want the file skipped", got, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FetchAttachments did not give up on a stalled download")
+	}
+}
@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	gogitlab "github.com/xanzy/go-gitlab"
+)
+
+var (
+	_ MessageLimiter = (*GitLabProvider)(nil)
+	_ FileUploader   = (*GitLabProvider)(nil)
+)
+
+// gitlabMaxNote is the longest note GitLab accepts.
+const gitlabMaxNote = 1_000_000
+
+func (g *GitLabProvider) MaxMessageLength() int { return gitlabMaxNote }
+
+// UploadReply uploads content to the project and replies with comment and a
+// link to the file.
+func (g *GitLabProvider) UploadReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, name string, content []byte, comment string) (*MessageRef, error) {
+	client, err := gitlabClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := gitlabMeta(msg)
+	if err != nil {
+		return nil, err
+	}
+	file, _, err := client.Projects.UploadFile(meta.ProjectID, bytes.NewReader(content), name, gogitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: %w", name, err)
+	}
+	return g.SendReply(ctx, cfg, msg, comment+"\n\n"+file.Markdown)
+}
@@ -0,0 +1,512 @@
+package provider
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Replies are written in GitLab-flavored Markdown. Slack and Telegram each
+// understand their own subset of it, so a reply is parsed into blocks and
+// inlines and rendered again with an mdFormat per channel.
+
+type mdBlockKind int
+
+const (
+	mdParagraph mdBlockKind = iota
+	mdHeading
+	mdCode
+	mdList
+	mdQuote
+	mdRule
+	// mdTable keeps a table's source lines; chat platforms have no tables, so
+	// they are shown preformatted.
+	mdTable
+)
+
+type mdBlock struct {
+	kind    mdBlockKind
+	level   int        // heading level
+	inlines []mdInline // heading or paragraph text
+	lang    string     // code block language
+	text    string     // code block or table source
+	ordered bool
+	start   int         // number of an ordered list's first item
+	items   [][]mdBlock // list items
+	blocks  []mdBlock   // quoted blocks
+}
+
+type mdInlineKind int
+
+const (
+	mdText mdInlineKind = iota
+	mdStrong
+	mdEmph
+	mdStrike
+	mdCodeSpan
+	mdLink
+)
+
+type mdInline struct {
+	kind     mdInlineKind
+	text     string // text or code span
+	url      string
+	children []mdInline
+}
+
+var (
+	mdHeadingLine = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?\s*#*\s*$`)
+	mdRuleLine    = regexp.MustCompile(`^ {0,3}(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	mdListItem    = regexp.MustCompile(`^(\s*)([-*+]|(\d{1,9})[.)])(?:\s+(.*))?$`)
+)
+
+// parseMarkdown parses the block structure of s.
+func parseMarkdown(s string) []mdBlock {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return parseBlocks(strings.Split(s, "\n"))
+}
+
+func parseBlocks(lines []string) []mdBlock {
+	var blocks []mdBlock
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case nextFence("", line) != "":
+			fence := nextFence("", line)
+			var code []string
+			for i++; i < len(lines); i++ {
+				if nextFence(fence, lines[i]) == "" {
+					i++
+					break
+				}
+				code = append(code, lines[i])
+			}
+			lang := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(fence), fenceMarker(fence)))
+			blocks = append(blocks, mdBlock{kind: mdCode, lang: lang, text: strings.Join(code, "\n")})
+		case mdHeadingLine.MatchString(line):
+			m := mdHeadingLine.FindStringSubmatch(line)
+			blocks = append(blocks, mdBlock{kind: mdHeading, level: len(m[1]), inlines: parseInlines(m[2])})
+			i++
+		case mdRuleLine.MatchString(line):
+			blocks = append(blocks, mdBlock{kind: mdRule})
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(l, " "))
+			}
+			blocks = append(blocks, mdBlock{kind: mdQuote, blocks: parseBlocks(quoted)})
+		case mdListItem.MatchString(line):
+			var list mdBlock
+			list, i = parseList(lines, i)
+			blocks = append(blocks, list)
+		case strings.HasPrefix(trimmed, "|"):
+			var rows []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, mdBlock{kind: mdTable, text: strings.Join(rows, "\n")})
+		default:
+			para := []string{trimmed}
+			for i++; i < len(lines) && !startsBlock(lines[i]); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			blocks = append(blocks, mdBlock{kind: mdParagraph, inlines: parseInlines(strings.Join(para, "\n"))})
+		}
+	}
+	return blocks
+}
+
+// startsBlock reports whether line ends a paragraph.
+func startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || nextFence("", line) != "" || mdHeadingLine.MatchString(line) ||
+		mdRuleLine.MatchString(line) || strings.HasPrefix(trimmed, ">") || mdListItem.MatchString(line)
+}
+
+// parseList parses the list starting at lines[i] and returns it with the index
+// of the line after it. Lines indented past the item marker belong to the
+// item, as do unindented lines continuing its paragraph.
+func parseList(lines []string, i int) (mdBlock, int) {
+	m := mdListItem.FindStringSubmatch(lines[i])
+	indent := len(m[1])
+	list := mdBlock{kind: mdList, ordered: m[3] != ""}
+	if list.ordered {
+		list.start, _ = strconv.Atoi(m[3])
+	}
+
+	for i < len(lines) {
+		m := mdListItem.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != indent || (m[3] != "") != list.ordered {
+			break
+		}
+		item := []string{m[4]}
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line continues the item only if the next line is
+				// indented into it.
+				j := i + 1
+				for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+					j++
+				}
+				if j == len(lines) || indentOf(lines[j]) <= indent {
+					break
+				}
+				item = append(item, "")
+				continue
+			}
+			if n := indentOf(line); n > indent {
+				item = append(item, line[min(n, indent+len(m[2])+1):])
+				continue
+			}
+			if startsBlock(line) {
+				break
+			}
+			item = append(item, strings.TrimSpace(line))
+		}
+		list.items = append(list.items, parseBlocks(item))
+		// Skip the blank lines between items of a loose list.
+		j := i
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		if j < len(lines) && j > i {
+			if m := mdListItem.FindStringSubmatch(lines[j]); m != nil && len(m[1]) == indent {
+				i = j
+			}
+		}
+	}
+	return list, i
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// parseInlines parses emphasis, code spans and links in s.
+func parseInlines(s string) []mdInline {
+	var out []mdInline
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			out = append(out, mdInline{kind: mdText, text: text.String()})
+			text.Reset()
+		}
+	}
+	emit := func(in mdInline) {
+		flush()
+		out = append(out, in)
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			n := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			delim := s[i : i+n]
+			if end := closingBackticks(s[i+n:], delim); end >= 0 {
+				code := s[i+n : i+n+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				emit(mdInline{kind: mdCodeSpan, text: code})
+				i += n + end + n
+				continue
+			}
+			text.WriteString(delim)
+			i += n
+			continue
+		case c == '*' || c == '_' || c == '~':
+			if in, n, ok := parseEmphasis(s, i); ok {
+				emit(in)
+				i += n
+				continue
+			}
+		case c == '[' || c == '!' && strings.HasPrefix(s[i+1:], "["):
+			start := i
+			if c == '!' {
+				start++
+			}
+			if label, url, n, ok := parseLink(s[start:]); ok {
+				if c == '!' && label == "" {
+					label = url
+				}
+				emit(mdInline{kind: mdLink, url: url, children: parseInlines(label)})
+				i = start + n
+				continue
+			}
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if u := s[i+1 : i+end]; strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+					emit(mdInline{kind: mdLink, url: u, children: []mdInline{{kind: mdText, text: u}}})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		text.WriteByte(c)
+		i++
+	}
+	flush()
+	return out
+}
+
+// closingBackticks returns the index in s of a run of backticks as long as
+// delim, or -1.
+func closingBackticks(s, delim string) int {
+	for i := 0; i < len(s); {
+		j := strings.Index(s[i:], delim)
+		if j < 0 {
+			return -1
+		}
+		j += i
+		end := j + len(delim)
+		if end == len(s) || s[end] != '`' {
+			if j == 0 || s[j-1] != '`' {
+				return j
+			}
+		}
+		for end < len(s) && s[end] == '`' {
+			end++
+		}
+		i = end
+	}
+	return -1
+}
+
+// parseEmphasis parses **strong**, __strong__, *emphasis*, _emphasis_ or
+// ~~strikethrough~~ at s[i], returning the element and its length in s.
+func parseEmphasis(s string, i int) (mdInline, int, bool) {
+	c := s[i]
+	delim := string(c)
+	kind := mdEmph
+	switch {
+	case strings.HasPrefix(s[i:], strings.Repeat(delim, 2)):
+		delim += delim
+		kind = mdStrong
+		if c == '~' {
+			kind = mdStrike
+		}
+	case c == '~':
+		return mdInline{}, 0, false
+	}
+	// Underscores inside a word, as in snake_case, are not emphasis.
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return mdInline{}, 0, false
+	}
+	rest := s[i+len(delim):]
+	if rest == "" || rest[0] == ' ' || rest[0] == '\n' {
+		return mdInline{}, 0, false
+	}
+	for from := 1; from < len(rest); {
+		j := strings.Index(rest[from:], delim)
+		if j < 0 {
+			break
+		}
+		j += from
+		after := j + len(delim)
+		// A longer run closes strong text with its last two characters, as
+		// in ***both***.
+		for len(delim) == 2 && after < len(rest) && rest[after] == c {
+			j++
+			after++
+		}
+		switch {
+		case rest[j-1] == ' ' || rest[j-1] == '\n':
+		case len(delim) == 1 && after < len(rest) && rest[after] == c:
+			// Part of a longer run, e.g. the "**" closing a strong span
+			// inside this one.
+			for after < len(rest) && rest[after] == c {
+				after++
+			}
+			from = after
+			continue
+		case c == '_' && after < len(rest) && isWordByte(rest[after]):
+		default:
+			return mdInline{kind: kind, children: parseInlines(rest[:j])}, len(delim) + after, true
+		}
+		from = after
+	}
+	return mdInline{}, 0, false
+}
+
+func isASCIIPunct(b byte) bool {
+	return b < 0x80 && unicode.IsPunct(rune(b)) || b < 0x80 && unicode.IsSymbol(rune(b))
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// parseLink parses [label](url) at the start of s.
+func parseLink(s string) (label, url string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			url = strings.TrimSpace(s[i+2 : i+2+end])
+			if k := strings.IndexAny(url, " \t"); k >= 0 {
+				url = url[:k] // drop a "title"
+			}
+			if url == "" {
+				return "", "", 0, false
+			}
+			return s[1:i], url, i + 3 + end, true
+		case '\n':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				return "", "", 0, false
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// mdFormat is how a chat platform marks up each Markdown element. Its
+// functions receive text already rendered in the format.
+type mdFormat struct {
+	escape    func(string) string // plain text
+	code      func(string) string // code span, unescaped
+	codeBlock func(lang, code string) string
+	strong    func(string) string
+	emph      func(string) string
+	strike    func(string) string
+	link      func(label, url string) string
+	heading   func(string) string
+	quote     func(string) string
+	bullet    string
+	number    func(n int) string
+	rule      string
+}
+
+func (f *mdFormat) render(md string) string {
+	return f.blocks(parseMarkdown(md), "\n\n")
+}
+
+func (f *mdFormat) blocks(blocks []mdBlock, sep string) string {
+	out := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		out = append(out, f.block(b))
+	}
+	return strings.Join(out, sep)
+}
+
+func (f *mdFormat) block(b mdBlock) string {
+	switch b.kind {
+	case mdHeading:
+		// Headings are shown in bold, so bold inside one adds nothing.
+		plain := *f
+		plain.strong = func(s string) string { return s }
+		return f.heading(plain.inlines(b.inlines))
+	case mdCode:
+		return f.codeBlock(b.lang, b.text)
+	case mdTable:
+		return f.codeBlock("", b.text)
+	case mdList:
+		var sb strings.Builder
+		for i, item := range b.items {
+			marker := f.bullet
+			if b.ordered {
+				marker = f.number(b.start + i)
+			}
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			lines := strings.Split(f.blocks(item, "\n"), "\n")
+			sb.WriteString(marker + lines[0])
+			for _, l := range lines[1:] {
+				sb.WriteString("\n    " + l)
+			}
+		}
+		return sb.String()
+	case mdQuote:
+		return f.quote(f.blocks(b.blocks, "\n\n"))
+	case mdRule:
+		return f.rule
+	}
+	return f.inlines(b.inlines)
+}
+
+func (f *mdFormat) inlines(ins []mdInline) string {
+	var sb strings.Builder
+	for _, in := range ins {
+		switch in.kind {
+		case mdText:
+			sb.WriteString(f.escape(in.text))
+		case mdCodeSpan:
+			sb.WriteString(f.code(in.text))
+		case mdStrong:
+			sb.WriteString(f.strong(f.inlines(in.children)))
+		case mdEmph:
+			sb.WriteString(f.emph(f.inlines(in.children)))
+		case mdStrike:
+			sb.WriteString(f.strike(f.inlines(in.children)))
+		case mdLink:
+			sb.WriteString(f.link(f.inlines(in.children), in.url))
+		}
+	}
+	return sb.String()
+}
+
+// wrap returns a function enclosing its argument in open and close.
+func wrap(open, close string) func(string) string {
+	return func(s string) string { return open + s + close }
+}
+
+// prefixLines returns a function prefixing each line of its argument.
+func prefixLines(prefix string) func(string) string {
+	return func(s string) string {
+		return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+	}
+}
+
+func identity(s string) string { return s }
+
+// plainFormat drops the markup, for platforms that rejected a formatted
+// message.
+var plainFormat = &mdFormat{
+	escape:    identity,
+	code:      identity,
+	codeBlock: func(_, code string) string { return code },
+	strong:    identity,
+	emph:      identity,
+	strike:    identity,
+	link: func(label, url string) string {
+		if label == url {
+			return url
+		}
+		return label + " (" + url + ")"
+	},
+	heading: identity,
+	quote:   prefixLines("> "),
+	bullet:  "• ",
+	number:  func(n int) string { return strconv.Itoa(n) + ". " },
+	rule:    "──────────",
+}
+
+// renderPlain renders md as plain text.
+func renderPlain(md string) string {
+	return plainFormat.render(md)
+}
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"testing"
+)
+
+const testMarkdown = "## Analysis\n\n" +
+	"The **root cause** is in `db.go`, see [docs](https://x.y/?a=1&b=2).\n\n" +
+	"1. Fix *this* in snake_case_name\n" +
+	"2. Drop ~~that~~\n" +
+	"   - nested\n\n" +
+	"```go\nif a < b {\n}\n```\n\n" +
+	"> quoted\n\n" +
+	"Done! 1 + 1 = 2."
+
+func TestParseMarkdown(t *testing.T) {
+	blocks := parseMarkdown(testMarkdown)
+	kinds := []mdBlockKind{mdHeading, mdParagraph, mdList, mdCode, mdQuote, mdParagraph}
+	if len(blocks) != len(kinds) {
+		t.Fatalf("parsed %d blocks: %+v", len(blocks), blocks)
+	}
+	for i, k := range kinds {
+		if blocks[i].kind != k {
+			t.Errorf("block %d kind = %d, want %d", i, blocks[i].kind, k)
+		}
+	}
+	list := blocks[2]
+	if !list.ordered || list.start != 1 || len(list.items) != 2 || len(list.items[1]) != 2 || list.items[1][1].kind != mdList {
+		t.Errorf("list = %+v", list)
+	}
+	if code := blocks[3]; code.lang != "go" || code.text != "if a < b {\n}" {
+		t.Errorf("code = %+v", code)
+	}
+}
+
+func TestParseInlines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"a **b** c", "a <b>b</b> c"},
+		{"__b__ and _i_", "<b>b</b> and <i>i</i>"},
+		{"***x*** y", "<b><i>x</i></b> y"},
+		{"snake_case_name * 2", "snake_case_name * 2"},
+		{"`a*b*c` and ``x ` y``", "<code>a*b*c</code> and <code>x ` y</code>"},
+		{`\*not bold\*`, "*not bold*"},
+		{"![shot](https://x/s.png) <https://x/y>", `<a href="https://x/s.png">shot</a> <a href="https://x/y">https://x/y</a>`},
+		{"[a [b]](https://x \"title\")", `<a href="https://x">a [b]</a>`},
+		{"unclosed **bold and [link](", "unclosed **bold and [link]("},
+	}
+	for _, tt := range tests {
+		if got := telegramHTML.inlines(parseInlines(tt.in)); got != tt.want {
+			t.Errorf("parseInlines(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderSlack(t *testing.T) {
+	want := "*Analysis*\n\n" +
+		"The *root cause* is in `db.go`, see <https://x.y/?a=1&amp;b=2|docs>.\n\n" +
+		"1. Fix _this_ in snake_case_name\n" +
+		"2. Drop ~that~\n" +
+		"    • nested\n\n" +
+		"```\nif a &lt; b {\n}\n```\n\n" +
+		"> quoted\n\n" +
+		"Done! 1 + 1 = 2."
+	if got := renderSlack(testMarkdown); got != want {
+		t.Errorf("renderSlack() =\n%s\nwant\n%s", got, want)
+	}
+
+	blocks := slackBlocks(testMarkdown)
+	if len(blocks) != 2 || blocks[0]["type"] != "header" || blocks[1]["type"] != "section" {
+		t.Fatalf("slackBlocks() = %v", blocks)
+	}
+	if text := blocks[0]["text"].(map[string]any)["text"]; text != "Analysis" {
+		t.Errorf("header text = %v", text)
+	}
+}
+
+func TestRenderTelegram(t *testing.T) {
+	html := "<b>Analysis</b>\n\n" +
+		`The <b>root cause</b> is in <code>db.go</code>, see <a href="https://x.y/?a=1&amp;b=2">docs</a>.` + "\n\n" +
+		"1. Fix <i>this</i> in snake_case_name\n" +
+		"2. Drop <s>that</s>\n" +
+		"    • nested\n\n" +
+		`<pre><code class="language-go">if a &lt; b {` + "\n}</code></pre>\n\n" +
+		"<blockquote>quoted</blockquote>\n\n" +
+		"Done! 1 + 1 = 2."
+	if got := telegramHTML.render(testMarkdown); got != html {
+		t.Errorf("HTML =\n%s\nwant\n%s", got, html)
+	}
+
+	v2 := "*Analysis*\n\n" +
+		"The *root cause* is in `db.go`, see [docs](https://x.y/?a=1&b=2)\\.\n\n" +
+		"1\\. Fix _this_ in snake\\_case\\_name\n" +
+		"2\\. Drop ~that~\n" +
+		"    • nested\n\n" +
+		"```go\nif a < b {\n}\n```\n\n" +
+		">quoted\n\n" +
+		"Done\\! 1 \\+ 1 \\= 2\\."
+	if got := telegramMarkdownV2.render(testMarkdown); got != v2 {
+		t.Errorf("MarkdownV2 =\n%s\nwant\n%s", got, v2)
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	want := "Analysis\n\n" +
+		"The root cause is in db.go, see docs (https://x.y/?a=1&b=2).\n\n" +
+		"1. Fix this in snake_case_name\n" +
+		"2. Drop that\n" +
+		"    • nested\n\n" +
+		"if a < b {\n}\n\n" +
+		"> quoted\n\n" +
+		"Done! 1 + 1 = 2."
+	if got := renderPlain(testMarkdown); got != want {
+		t.Errorf("renderPlain() =\n%s\nwant\n%s", got, want)
+	}
+}
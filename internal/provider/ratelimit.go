@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitError is returned by a provider when the channel refused a call
+// for sending too much, with how long it asked to wait before trying again.
+// GitLab calls are retried on 429 and 5xx responses by the client library
+// itself, honoring RateLimit-Reset.
+type RateLimitError struct {
+	After time.Duration
+	Err   error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.After)
+}
+
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// RetryAfter returns how long the channel asked to wait before retrying the
+// call that failed with err, or 0 if it did not say.
+func RetryAfter(err error) time.Duration {
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return rl.After
+	}
+	return 0
+}
+
+// retryAfterHeader parses a Retry-After header given in seconds.
+func retryAfterHeader(h http.Header) time.Duration {
+	secs, err := strconv.Atoi(h.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
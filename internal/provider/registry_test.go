@@ -21,8 +21,8 @@ func (m *mockProvider) ValidateConfig(_ map[string]any) error {
 func (m *mockProvider) BuildHandler(_ string, _ string, _ map[string]any, _ func(context.Context, *IncomingMessage)) http.Handler {
 	return nil
 }
-func (m *mockProvider) SendReply(_ context.Context, _ map[string]any, _ *IncomingMessage, _ string) error {
-	return nil
+func (m *mockProvider) SendReply(_ context.Context, _ map[string]any, _ *IncomingMessage, _ string) (*MessageRef, error) {
+	return nil, nil
 }
 
 // --- NewRegistry ---
@@ -1,7 +1,6 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"crypto/hmac"
 	"crypto/sha256"
@@ -11,6 +10,8 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/opencode-ai/opencode-dog/internal/db"
@@ -20,14 +21,18 @@ type SlackProvider struct {
 	database   db.Store
 	logger     *slog.Logger
 	httpClient *http.Client
+	apiURL     string
 }
 
+var _ ReplyEditor = (*SlackProvider)(nil)
+
 func NewSlackProvider(database db.Store, logger *slog.Logger) *SlackProvider {
 	timeout := database.GetSettingDuration(context.Background(), "slack_http_timeout", 30*time.Second)
 	return &SlackProvider{
 		database:   database,
 		logger:     logger,
 		httpClient: &http.Client{Timeout: timeout},
+		apiURL:     "https://slack.com/api",
 	}
 }
 
@@ -47,19 +52,34 @@ type slackEvent struct {
 	Token     string `json:"token"`
 	Challenge string `json:"challenge"`
 	Type      string `json:"type"`
+	EventID   string `json:"event_id"`
 	Event     struct {
-		Type     string `json:"type"`
-		Text     string `json:"text"`
-		User     string `json:"user"`
-		Channel  string `json:"channel"`
-		TS       string `json:"ts"`
-		ThreadTS string `json:"thread_ts"`
+		Type     string      `json:"type"`
+		Text     string      `json:"text"`
+		User     string      `json:"user"`
+		Channel  string      `json:"channel"`
+		TS       string      `json:"ts"`
+		ThreadTS string      `json:"thread_ts"`
+		Files    []slackFile `json:"files"`
 	} `json:"event"`
 }
 
+// slackFile is a file shared in a message.
+type slackFile struct {
+	Name     string `json:"name"`
+	MIMEType string `json:"mimetype"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url_private_download"`
+}
+
+// slackReplyMeta addresses replies to a thread. MessageTS is the triggering
+// message, whose earlier thread messages are fetched as context, and Files
+// the files shared with it.
 type slackReplyMeta struct {
-	Channel  string `json:"channel"`
-	ThreadTS string `json:"thread_ts"`
+	Channel   string      `json:"channel"`
+	ThreadTS  string      `json:"thread_ts"`
+	MessageTS string      `json:"message_ts,omitempty"`
+	Files     []slackFile `json:"files,omitempty"`
 }
 
 func (s *SlackProvider) BuildHandler(providerCfgID string, secret string, cfg map[string]any, onMessage func(context.Context, *IncomingMessage)) http.Handler {
@@ -115,8 +135,10 @@ func (s *SlackProvider) BuildHandler(providerCfgID string, secret string, cfg ma
 		}
 
 		meta := slackReplyMeta{
-			Channel:  evt.Event.Channel,
-			ThreadTS: threadTS,
+			Channel:   evt.Event.Channel,
+			ThreadTS:  threadTS,
+			MessageTS: evt.Event.TS,
+			Files:     evt.Event.Files,
 		}
 
 		msg := &IncomingMessage{
@@ -127,9 +149,20 @@ func (s *SlackProvider) BuildHandler(providerCfgID string, secret string, cfg ma
 			Body:          evt.Event.Text,
 			Author:        evt.Event.User,
 			ReplyMeta:     meta,
+			Source: MessageRef{
+				ID:      evt.Event.TS,
+				Channel: evt.Event.Channel,
+				URL:     slackMessageURL(evt.Event.Channel, evt.Event.TS),
+			},
+			ThreadKey: fmt.Sprintf("slack:%s:%s", meta.Channel, meta.ThreadTS),
+			Delivery:  newDelivery(evt.EventID, evt.Event.Type, body),
+		}
+		if retry := r.Header.Get("X-Slack-Retry-Num"); retry != "" {
+			s.logger.Info("slack event redelivered", "provider_cfg", providerCfgID, "event_id", evt.EventID,
+				"retry", retry, "reason", r.Header.Get("X-Slack-Retry-Reason"))
 		}
 
-		go onMessage(context.Background(), msg)
+		go onMessage(context.WithoutCancel(r.Context()), msg)
 	})
 }
 
@@ -140,56 +173,64 @@ func (s *SlackProvider) verifySlackSignature(r *http.Request, body []byte, signi
 		return false
 	}
 
+	expected := signSlackRequest(signingSecret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(sig))
+}
+
+// SignWebhook signs req with the config's signing secret as if Slack sent it
+// now.
+func (s *SlackProvider) SignWebhook(req *http.Request, _ string, cfg map[string]any, body []byte) {
+	signingSecret, _ := cfg["signing_secret"].(string)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", signSlackRequest(signingSecret, timestamp, body))
+}
+
+func signSlackRequest(signingSecret, timestamp string, body []byte) string {
 	baseString := fmt.Sprintf("v0:%s:%s", timestamp, string(body))
 	mac := hmac.New(sha256.New, []byte(signingSecret))
 	mac.Write([]byte(baseString))
-	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
-
-	return hmac.Equal([]byte(expected), []byte(sig))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
 }
 
-func (s *SlackProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) error {
+func (s *SlackProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) (*MessageRef, error) {
 	botToken, _ := cfg["bot_token"].(string)
 	if botToken == "" {
-		return fmt.Errorf("missing bot_token in config")
+		return nil, fmt.Errorf("missing bot_token in config")
 	}
 
 	var meta slackReplyMeta
 	raw, _ := json.Marshal(msg.ReplyMeta)
 	if err := json.Unmarshal(raw, &meta); err != nil {
-		return fmt.Errorf("invalid reply meta: %w", err)
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
 	}
 
-	payload := map[string]any{
-		"channel":   meta.Channel,
-		"thread_ts": meta.ThreadTS,
-		"text":      body,
-		"mrkdwn":    true,
+	var result struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
 	}
-
-	jsonBody, _ := json.Marshal(payload)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://slack.com/api/chat.postMessage", bytes.NewReader(jsonBody))
-	if err != nil {
-		return err
+	payload := map[string]any{"channel": meta.Channel, "thread_ts": meta.ThreadTS}
+	if err := s.postFormatted(ctx, botToken, "chat.postMessage", payload, body, &result); err != nil {
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+botToken)
+	return &MessageRef{ID: result.TS, Channel: result.Channel, URL: slackMessageURL(result.Channel, result.TS)}, nil
+}
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("slack api call failed: %w", err)
+func (s *SlackProvider) EditReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, ref MessageRef, body string) error {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return fmt.Errorf("missing bot_token in config")
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		OK    bool   `json:"ok"`
-		Error string `json:"error"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return err
-	}
-	if !result.OK {
-		return fmt.Errorf("slack api error: %s", result.Error)
+	payload := map[string]any{"channel": ref.Channel, "ts": ref.ID}
+	return s.postFormatted(ctx, botToken, "chat.update", payload, body, nil)
+}
+
+// slackMessageURL builds an archive link to a message; Slack redirects it to
+// the message in the user's workspace.
+func slackMessageURL(channel, ts string) string {
+	if channel == "" || ts == "" {
+		return ""
 	}
-	return nil
+	return fmt.Sprintf("https://slack.com/archives/%s/p%s", channel, strings.ReplaceAll(ts, ".", ""))
 }
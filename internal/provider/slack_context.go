@@ -0,0 +1,279 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var _ ContextFetcher = (*SlackProvider)(nil)
+
+// maxSlackHistoryPages caps the conversations.replies pages read for one
+// thread.
+const maxSlackHistoryPages = 10
+
+// slackMention matches a user mention such as <@U123> or <@U123|alice>.
+var slackMention = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|[^>]*)?>`)
+
+type slackThreadMessage struct {
+	User string `json:"user"`
+	Text string `json:"text"`
+	TS   string `json:"ts"`
+}
+
+// FetchContext returns the earlier messages of the thread msg was posted in:
+// the parent message and the latest replies before msg, bounded by the
+// slack_thread_history_messages and slack_thread_history_chars settings. The
+// bot's own messages are left out and user IDs are replaced with display
+// names.
+func (s *SlackProvider) FetchContext(ctx context.Context, cfg map[string]any, msg *IncomingMessage, _ ContextLimits) (string, error) {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return "", fmt.Errorf("missing bot_token in config")
+	}
+	var meta slackReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return "", fmt.Errorf("invalid reply meta: %w", err)
+	}
+	if meta.MessageTS == "" || meta.MessageTS == meta.ThreadTS {
+		return "", nil
+	}
+	maxMessages := s.database.GetSettingInt(ctx, "slack_thread_history_messages", 20)
+	maxChars := s.database.GetSettingInt(ctx, "slack_thread_history_chars", 12000)
+	if maxMessages <= 0 || maxChars <= 0 {
+		return "", nil
+	}
+
+	var self struct {
+		UserID string `json:"user_id"`
+	}
+	if err := s.call(ctx, botToken, "auth.test", nil, &self); err != nil {
+		return "", err
+	}
+	thread, err := s.threadMessages(ctx, botToken, meta)
+	if err != nil || len(thread) == 0 {
+		return "", err
+	}
+
+	var parent *slackThreadMessage
+	var replies []slackThreadMessage
+	for i, m := range thread {
+		if m.User == self.UserID || strings.TrimSpace(m.Text) == "" {
+			continue
+		}
+		if m.TS == meta.ThreadTS {
+			parent = &thread[i]
+			continue
+		}
+		replies = append(replies, m)
+	}
+
+	names := make(map[string]string)
+	render := func(m slackThreadMessage) string {
+		text := slackMention.ReplaceAllStringFunc(m.Text, func(mention string) string {
+			return "@" + s.displayName(ctx, botToken, names, slackMention.FindStringSubmatch(mention)[1])
+		})
+		return fmt.Sprintf("**%s**: %s\n", s.displayName(ctx, botToken, names, m.User), strings.TrimSpace(text))
+	}
+
+	var sb strings.Builder
+	sb.WriteString("## Slack thread\n")
+	budget := maxChars
+	if parent != nil {
+		entry := clip(render(*parent), maxChars/2)
+		if !strings.HasSuffix(entry, "\n") {
+			entry += "\n"
+		}
+		sb.WriteString(entry)
+		budget -= len([]rune(entry))
+		maxMessages--
+	}
+	// Keep the latest replies that fit, printed in order. Rendering looks up
+	// user names, so replies past the count are not rendered, and only the
+	// first one past the budget is.
+	var kept []string
+	omitted := 0
+	for i := len(replies) - 1; i >= 0; i-- {
+		if len(kept) >= maxMessages {
+			omitted = i + 1
+			break
+		}
+		entry := render(replies[i])
+		if len([]rune(entry)) > budget {
+			omitted = i + 1
+			break
+		}
+		budget -= len([]rune(entry))
+		kept = append(kept, entry)
+	}
+	if parent == nil && len(kept) == 0 {
+		return "", nil
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "[… %d earlier replies omitted]\n", omitted)
+	}
+	for i := len(kept) - 1; i >= 0; i-- {
+		sb.WriteString(kept[i])
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+// threadMessages lists the thread's messages posted before meta.MessageTS,
+// oldest first.
+func (s *SlackProvider) threadMessages(ctx context.Context, botToken string, meta slackReplyMeta) ([]slackThreadMessage, error) {
+	params := url.Values{
+		"channel":   {meta.Channel},
+		"ts":        {meta.ThreadTS},
+		"latest":    {meta.MessageTS},
+		"inclusive": {"false"},
+		"limit":     {"200"},
+	}
+	var messages []slackThreadMessage
+	for page := 0; page < maxSlackHistoryPages; page++ {
+		var result struct {
+			Messages []slackThreadMessage `json:"messages"`
+			Metadata struct {
+				NextCursor string `json:"next_cursor"`
+			} `json:"response_metadata"`
+		}
+		if err := s.call(ctx, botToken, "conversations.replies", params, &result); err != nil {
+			return nil, err
+		}
+		messages = append(messages, result.Messages...)
+		if result.Metadata.NextCursor == "" {
+			break
+		}
+		params.Set("cursor", result.Metadata.NextCursor)
+	}
+	return messages, nil
+}
+
+// displayName resolves a user ID to the user's display name, caching it in
+// names. The ID itself is returned if the lookup fails.
+func (s *SlackProvider) displayName(ctx context.Context, botToken string, names map[string]string, userID string) string {
+	if userID == "" {
+		return "unknown"
+	}
+	if name, ok := names[userID]; ok {
+		return name
+	}
+	var result struct {
+		User struct {
+			Name    string `json:"name"`
+			Profile struct {
+				DisplayName string `json:"display_name"`
+				RealName    string `json:"real_name"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	name := userID
+	if err := s.call(ctx, botToken, "users.info", url.Values{"user": {userID}}, &result); err != nil {
+		s.logger.Warn("slack user lookup failed", "user", userID, "error", err)
+	} else {
+		for _, n := range []string{result.User.Profile.DisplayName, result.User.Profile.RealName, result.User.Name} {
+			if n != "" {
+				name = n
+				break
+			}
+		}
+	}
+	names[userID] = name
+	return name
+}
+
+// call invokes a read-only Web API method and decodes its response into out.
+func (s *SlackProvider) call(ctx context.Context, botToken, method string, params url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL+"/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{After: retryAfterHeader(resp.Header), Err: fmt.Errorf("slack api error: %s: ratelimited", method)}
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("slack api error: %s: %s", method, result.Error)
+	}
+	return json.Unmarshal(body, out)
+}
+
+var _ AttachmentFetcher = (*SlackProvider)(nil)
+
+// FetchAttachments downloads the files shared with msg. The bot token needs
+// the files:read scope.
+func (s *SlackProvider) FetchAttachments(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits AttachmentLimits) ([]Attachment, error) {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return nil, fmt.Errorf("missing bot_token in config")
+	}
+	var meta slackReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
+	}
+
+	var out []Attachment
+	for _, f := range meta.Files {
+		if len(out) == maxAttachments {
+			break
+		}
+		att, err := s.downloadFile(ctx, botToken, f, limits)
+		if err != nil {
+			s.logger.Warn("slack attachment skipped", "file", f.Name, "error", err)
+			continue
+		}
+		out = append(out, att)
+	}
+	return out, nil
+}
+
+func (s *SlackProvider) downloadFile(ctx context.Context, botToken string, f slackFile, limits AttachmentLimits) (Attachment, error) {
+	if err := limits.check(f.Name, f.MIMEType, f.Size); err != nil {
+		return Attachment{}, err
+	}
+	if f.URL == "" {
+		return Attachment{}, fmt.Errorf("%s has no download URL", f.Name)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return Attachment{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("download %s: %w", f.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Attachment{}, fmt.Errorf("download %s: status %d", f.Name, resp.StatusCode)
+	}
+	// Without the files:read scope Slack answers with its login page.
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") && !strings.HasPrefix(f.MIMEType, "text/html") {
+		return Attachment{}, fmt.Errorf("download %s: got an HTML page instead of the file", f.Name)
+	}
+	return readAttachment(resp.Body, f.Name, f.MIMEType, limits)
+}
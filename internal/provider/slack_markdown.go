@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// slackMaxBlocks and slackMaxSection are Block Kit's limits on the blocks
+	// of a message and the text of a section; slackMaxHeader is that of a
+	// header's text.
+	slackMaxBlocks  = 50
+	slackMaxSection = 3000
+	slackMaxHeader  = 150
+)
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackFormat renders Markdown as Slack mrkdwn.
+var slackFormat = &mdFormat{
+	escape:    slackEscaper.Replace,
+	code:      func(s string) string { return "`" + slackEscaper.Replace(s) + "`" },
+	codeBlock: func(_, code string) string { return "```\n" + slackEscaper.Replace(code) + "\n```" },
+	strong:    wrap("*", "*"),
+	emph:      wrap("_", "_"),
+	strike:    wrap("~", "~"),
+	link: func(label, url string) string {
+		url = slackEscaper.Replace(url)
+		if label == url {
+			return "<" + url + ">"
+		}
+		return "<" + url + "|" + strings.ReplaceAll(label, "|", "¦") + ">"
+	},
+	heading: wrap("*", "*"),
+	quote:   prefixLines("> "),
+	bullet:  "• ",
+	number:  func(n int) string { return strconv.Itoa(n) + ". " },
+	rule:    "──────────",
+}
+
+// renderSlack renders md as Slack mrkdwn.
+func renderSlack(md string) string {
+	return slackFormat.render(md)
+}
+
+// slackBlocks lays md out as Block Kit blocks: top-level headings become
+// header blocks and everything else mrkdwn sections. It returns nil if md
+// needs more blocks than a message can have.
+func slackBlocks(md string) []map[string]any {
+	var blocks []map[string]any
+	var section []string
+	flush := func() {
+		if len(section) == 0 {
+			return
+		}
+		for _, text := range SplitMarkdown(strings.Join(section, "\n\n"), slackMaxSection) {
+			blocks = append(blocks, map[string]any{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": text},
+			})
+		}
+		section = nil
+	}
+	for _, b := range parseMarkdown(md) {
+		if b.kind == mdHeading && b.level <= 2 {
+			if text := strings.TrimSpace(plainFormat.inlines(b.inlines)); text != "" {
+				flush()
+				blocks = append(blocks, map[string]any{
+					"type": "header",
+					"text": map[string]any{"type": "plain_text", "text": cutLine(text, slackMaxHeader)[0], "emoji": true},
+				})
+				continue
+			}
+		}
+		section = append(section, slackFormat.block(b))
+	}
+	flush()
+	if len(blocks) > slackMaxBlocks {
+		return nil
+	}
+	return blocks
+}
+
+// postFormatted calls method, chat.postMessage or chat.update, with body laid
+// out as Block Kit blocks and mrkdwn text. If Slack rejects the blocks, it
+// posts body again as plain text.
+func (s *SlackProvider) postFormatted(ctx context.Context, botToken, method string, payload map[string]any, body string, out any) error {
+	payload["text"] = renderSlack(body)
+	if blocks := slackBlocks(body); blocks != nil {
+		payload["blocks"] = blocks
+	}
+	err := s.post(ctx, botToken, method, payload, out)
+	if err != nil && (strings.Contains(err.Error(), "invalid_blocks") || strings.Contains(err.Error(), "msg_blocks_too_long")) {
+		s.logger.Warn("slack rejected formatted message, posting plain text", "method", method, "error", err)
+		delete(payload, "blocks")
+		payload["text"] = slackEscaper.Replace(renderPlain(body))
+		payload["mrkdwn"] = false
+		err = s.post(ctx, botToken, method, payload, out)
+	}
+	return err
+}
+
+// post invokes a Web API method with a JSON payload and decodes its response
+// into out.
+func (s *SlackProvider) post(ctx context.Context, botToken, method string, payload map[string]any, out any) error {
+	jsonBody, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/"+method, bytes.NewReader(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("slack api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &RateLimitError{After: retryAfterHeader(resp.Header), Err: fmt.Errorf("slack api error: %s: ratelimited", method)}
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("slack api error: %s", result.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
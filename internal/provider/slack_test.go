@@ -7,6 +7,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -15,6 +16,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/opencode-ai/opencode-dog/internal/db"
 	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
 )
 
@@ -145,6 +147,24 @@ func TestSlackHandler_MissingSignatureHeaders(t *testing.T) {
 	}
 }
 
+// --- Slack SignWebhook: a re-signed request passes verification ---
+
+func TestSlackSignWebhook(t *testing.T) {
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	cfg := map[string]any{"signing_secret": "my-signing-secret"}
+	handler := p.BuildHandler("cfg-1", "secret", cfg, nil)
+
+	payload := `{"type":"url_verification","challenge":"replayed"}`
+	req := httptest.NewRequest(http.MethodPost, "/hook/slack/test", strings.NewReader(payload))
+	p.SignWebhook(req, "secret", cfg, []byte(payload))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "replayed") {
+		t.Errorf("status = %d, body %q; want the re-signed request accepted", w.Code, w.Body.String())
+	}
+}
+
 // --- Slack BuildHandler: valid signature + message event ---
 
 func slackSignature(secret, timestamp, body string) string {
@@ -169,7 +189,8 @@ func TestSlackHandler_ValidMessageEvent(t *testing.T) {
 	handler := p.BuildHandler("cfg-1", "secret", cfg, onMessage)
 
 	payload := map[string]any{
-		"type": "event_callback",
+		"type":     "event_callback",
+		"event_id": "Ev123",
 		"event": map[string]any{
 			"type":    "message",
 			"text":    "@opencode help me",
@@ -210,6 +231,18 @@ func TestSlackHandler_ValidMessageEvent(t *testing.T) {
 	if received.Author != "U123" {
 		t.Errorf("Author = %q, want %q", received.Author, "U123")
 	}
+	if received.Source.ID != "1234567890.123456" || received.Source.Channel != "C456" {
+		t.Errorf("Source = %+v", received.Source)
+	}
+	if received.Source.URL != "https://slack.com/archives/C456/p1234567890123456" {
+		t.Errorf("Source.URL = %q", received.Source.URL)
+	}
+	if received.ThreadKey != "slack:C456:1234567890.123456" {
+		t.Errorf("ThreadKey = %q", received.ThreadKey)
+	}
+	if d := received.Delivery; d == nil || d.ID != "Ev123" || d.Event != "message" || len(d.PayloadHash) != 64 {
+		t.Errorf("Delivery = %+v", d)
+	}
 }
 
 // --- Slack BuildHandler: non-event_callback type ---
@@ -349,3 +382,240 @@ func TestSlackHandler_NoSigningSecret(t *testing.T) {
 		t.Errorf("status = %d, want %d (should pass without signing_secret)", w.Code, http.StatusOK)
 	}
 }
+
+// --- Slack SendReply ---
+
+func TestSlackSendReply_ReturnsMessageRef(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" || r.Header.Get("Authorization") != "Bearer xoxb-1" {
+			t.Errorf("unexpected request %s auth=%q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"ok": true, "channel": "C456", "ts": "1700000000.000200"}`))
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C456", ThreadTS: "1.0"}}
+	ref, err := p.SendReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, "hello")
+	if err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if got["thread_ts"] != "1.0" || got["text"] != "hello" {
+		t.Errorf("payload = %v", got)
+	}
+	if ref.ID != "1700000000.000200" || ref.Channel != "C456" {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestSlackSendReply_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1"}}
+	_, err := p.SendReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, "hello")
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Fatalf("SendReply() error = %v, want channel_not_found", err)
+	}
+}
+
+func TestSlackEditReply_CallsChatUpdate(t *testing.T) {
+	var gotPath string
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	ref := MessageRef{ID: "1700000000.000200", Channel: "C456"}
+	if err := p.EditReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, &IncomingMessage{}, ref, "done"); err != nil {
+		t.Fatalf("EditReply() error = %v", err)
+	}
+	if gotPath != "/chat.update" || got["channel"] != "C456" || got["ts"] != "1700000000.000200" || got["text"] != "done" {
+		t.Errorf("request = %s %v", gotPath, got)
+	}
+}
+
+func TestSlackSendReply_Formatting(t *testing.T) {
+	var got []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		got = append(got, payload)
+		if len(got) == 1 {
+			_, _ = w.Write([]byte(`{"ok": false, "error": "invalid_blocks"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "channel": "C1", "ts": "2.0"}`))
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", ThreadTS: "1.0"}}
+	if _, err := p.SendReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, "## Result\n\n**a** < b"); err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected a plain text retry, got %d requests", len(got))
+	}
+	if got[0]["text"] != "*Result*\n\n*a* &lt; b" || got[0]["blocks"] == nil {
+		t.Errorf("formatted payload = %v", got[0])
+	}
+	if got[1]["text"] != "Result\n\na &lt; b" || got[1]["blocks"] != nil || got[1]["mrkdwn"] != false {
+		t.Errorf("plain payload = %v", got[1])
+	}
+}
+
+func TestSlackSendReply_RateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", ThreadTS: "1.0"}}
+	_, err := p.SendReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, "hi")
+	if RetryAfter(err) != 30*time.Second || !strings.Contains(err.Error(), "ratelimited") {
+		t.Fatalf("SendReply() error = %v, retry after %s", err, RetryAfter(err))
+	}
+}
+
+// --- Slack FetchContext ---
+
+func TestSlackFetchContext_ThreadHistory(t *testing.T) {
+	var repliesQuery string
+	var lookups []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth.test":
+			_, _ = w.Write([]byte(`{"ok": true, "user_id": "UBOT"}`))
+		case "/conversations.replies":
+			repliesQuery = r.URL.RawQuery
+			_, _ = w.Write([]byte(`{"ok": true, "messages": [
+				{"user": "U1", "ts": "1.0", "text": "Deploy failed: <https://ci/1|job 1>"},
+				{"user": "U3", "ts": "1.1", "text": "old reply by <@U4>"},
+				{"user": "UBOT", "ts": "1.2", "text": "Analyzing…"},
+				{"user": "U2", "ts": "1.3", "text": "<@U1|alice> it's the DB again"}
+			]}`))
+		case "/users.info":
+			lookups = append(lookups, r.URL.Query().Get("user"))
+			names := map[string]string{"U1": `{"profile": {"display_name": "alice"}}`, "U2": `{"name": "bob", "profile": {"display_name": ""}}`}
+			_, _ = w.Write([]byte(`{"ok": true, "user": ` + names[r.URL.Query().Get("user")] + `}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	store := dbmock.New()
+	store.Settings = []*db.Setting{{Key: "slack_thread_history_messages", Value: json.RawMessage(`2`)}}
+	p := NewSlackProvider(store, slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", ThreadTS: "1.0", MessageTS: "1.4"}}
+	got, err := p.FetchContext(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, ContextLimits{})
+	if err != nil {
+		t.Fatalf("FetchContext() error = %v", err)
+	}
+	want := "## Slack thread\n**alice**: Deploy failed: <https://ci/1|job 1>\n[… 1 earlier replies omitted]\n**bob**: @alice it's the DB again"
+	if got != want {
+		t.Errorf("context =\n%s\nwant\n%s", got, want)
+	}
+	if !strings.Contains(repliesQuery, "latest=1.4") || !strings.Contains(repliesQuery, "ts=1.0") {
+		t.Errorf("conversations.replies query = %s", repliesQuery)
+	}
+	// The omitted reply's author and mention are not looked up.
+	if strings.Join(lookups, ",") != "U1,U2" {
+		t.Errorf("users.info lookups = %v, want [U1 U2]", lookups)
+	}
+}
+
+func TestSlackFetchContext_TopLevelMessage(t *testing.T) {
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = "http://unused"
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", ThreadTS: "1.0", MessageTS: "1.0"}}
+	got, err := p.FetchContext(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, ContextLimits{})
+	if err != nil || got != "" {
+		t.Fatalf("FetchContext() = %q, %v", got, err)
+	}
+}
+
+// --- Slack FetchAttachments ---
+
+func TestSlackFetchAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xoxb-1" {
+			t.Errorf("auth = %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("\x89PNG"))
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", Files: []slackFile{
+		{Name: "shot.png", MIMEType: "image/png", Size: 4, URL: srv.URL + "/shot.png"},
+		{Name: "build.zip", MIMEType: "application/zip", Size: 4, URL: srv.URL + "/build.zip"},
+		{Name: "huge.png", MIMEType: "image/png", Size: 1 << 30, URL: srv.URL + "/huge.png"},
+	}}}
+	got, err := p.FetchAttachments(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, testAttachmentLimits)
+	if err != nil {
+		t.Fatalf("FetchAttachments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "shot.png" || got[0].MIMEType != "image/png" || string(got[0].Data) != "\x89PNG" {
+		t.Errorf("attachments = %+v", got)
+	}
+}
+
+func TestSlackUploadReply(t *testing.T) {
+	var uploaded, completed string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files.getUploadURLExternal":
+			if r.URL.Query().Get("filename") != "result.md" || r.URL.Query().Get("length") != "7" {
+				t.Errorf("query = %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"ok": true, "upload_url": "` + srv.URL + `/upload/F1", "file_id": "F1"}`))
+		case "/upload/F1":
+			b, _ := io.ReadAll(r.Body)
+			uploaded = string(b)
+		case "/files.completeUploadExternal":
+			b, _ := io.ReadAll(r.Body)
+			completed = string(b)
+			_, _ = w.Write([]byte(`{"ok": true, "files": [{"id": "F1"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewSlackProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: slackReplyMeta{Channel: "C1", ThreadTS: "1.0"}}
+	ref, err := p.UploadReply(context.Background(), map[string]any{"bot_token": "xoxb-1"}, msg, "result.md", []byte("# Plan\n"), "Full result")
+	if err != nil {
+		t.Fatalf("UploadReply() error = %v", err)
+	}
+	if uploaded != "# Plan\n" || ref.Channel != "C1" {
+		t.Errorf("uploaded = %q, ref = %+v", uploaded, ref)
+	}
+	for _, want := range []string{`"id":"F1"`, `"channel_id":"C1"`, `"thread_ts":"1.0"`, `"initial_comment":"Full result"`} {
+		if !strings.Contains(completed, want) {
+			t.Errorf("completeUploadExternal body %s lacks %s", completed, want)
+		}
+	}
+}
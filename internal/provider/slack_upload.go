@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+var (
+	_ MessageLimiter = (*SlackProvider)(nil)
+	_ FileUploader   = (*SlackProvider)(nil)
+)
+
+// slackMaxMessage stays below the 40,000 characters after which Slack
+// truncates a message's text, leaving room for escaping.
+const slackMaxMessage = 39000
+
+func (s *SlackProvider) MaxMessageLength() int { return slackMaxMessage }
+
+// UploadReply shares content as a file in msg's thread, the way files.uploadV2
+// does: it gets an upload URL, uploads the file to it, then completes the
+// upload into the thread. The bot token needs the files:write scope.
+func (s *SlackProvider) UploadReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, name string, content []byte, comment string) (*MessageRef, error) {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return nil, fmt.Errorf("missing bot_token in config")
+	}
+	var meta slackReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
+	}
+
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	params := url.Values{"filename": {name}, "length": {strconv.Itoa(len(content))}}
+	if err := s.call(ctx, botToken, "files.getUploadURLExternal", params, &upload); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upload.UploadURL, bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: %w", name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upload %s: status %d", name, resp.StatusCode)
+	}
+
+	payload := map[string]any{
+		"files":           []map[string]string{{"id": upload.FileID, "title": name}},
+		"channel_id":      meta.Channel,
+		"thread_ts":       meta.ThreadTS,
+		"initial_comment": renderSlack(comment),
+	}
+	if err := s.post(ctx, botToken, "files.completeUploadExternal", payload, nil); err != nil {
+		return nil, err
+	}
+	// Slack shares the file asynchronously and does not return the message.
+	return &MessageRef{Channel: meta.Channel}, nil
+}
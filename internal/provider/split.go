@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// partNumberSize is the room SplitMessage keeps for a "(12/34)" line.
+const partNumberSize = 16
+
+// SplitMessage splits body into messages of at most limit characters,
+// numbered "(1/3)" when there is more than one. See SplitMarkdown for where it
+// splits.
+func SplitMessage(body string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(body) <= limit {
+		return []string{body}
+	}
+	parts := SplitMarkdown(body, limit-partNumberSize)
+	if len(parts) == 1 {
+		return parts
+	}
+	for i := range parts {
+		parts[i] = fmt.Sprintf("(%d/%d)\n\n%s", i+1, len(parts), parts[i])
+	}
+	return parts
+}
+
+// SplitMarkdown splits body into parts of at most size characters. It splits
+// between Markdown blocks (paragraphs, lists, fenced code) where it can, and
+// otherwise between lines; a code fence split across parts is closed at the
+// end of one and reopened at the start of the next. Only a line longer than
+// half of size is cut in the middle.
+func SplitMarkdown(body string, size int) []string {
+	if size <= 0 || utf8.RuneCountInString(body) <= size {
+		return []string{body}
+	}
+	var parts []string
+	var cur string
+	for _, block := range markdownBlocks(body) {
+		joined := block
+		if cur != "" {
+			joined = cur + "\n\n" + block
+		}
+		if utf8.RuneCountInString(joined) <= size {
+			cur = joined
+			continue
+		}
+		if cur != "" {
+			parts = append(parts, cur)
+			cur = ""
+		}
+		if utf8.RuneCountInString(block) <= size {
+			cur = block
+			continue
+		}
+		pieces := splitLines(block, size)
+		parts = append(parts, pieces[:len(pieces)-1]...)
+		cur = pieces[len(pieces)-1]
+	}
+	if cur != "" {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// markdownBlocks splits body at blank lines outside of code fences.
+func markdownBlocks(body string) []string {
+	var blocks, cur []string
+	fence := ""
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if fence == "" && strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				blocks = append(blocks, strings.Join(cur, "\n"))
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, line)
+		fence = nextFence(fence, line)
+	}
+	if len(cur) > 0 {
+		blocks = append(blocks, strings.Join(cur, "\n"))
+	}
+	return blocks
+}
+
+// splitLines splits a block that does not fit into parts between its lines.
+func splitLines(block string, size int) []string {
+	var parts, cur []string
+	curLen := 0
+	fence := "" // opening line of the code fence being split, if any
+	flush := func() {
+		part := strings.Join(cur, "\n")
+		if fence != "" {
+			part += "\n" + fenceMarker(fence)
+		}
+		parts = append(parts, part)
+		cur, curLen = nil, 0
+		if fence != "" {
+			cur, curLen = []string{fence}, utf8.RuneCountInString(fence)
+		}
+	}
+	for _, line := range strings.Split(block, "\n") {
+		for _, seg := range cutLine(line, size/2) {
+			closing := 0
+			if fence != "" {
+				closing = len(fenceMarker(fence)) + 1
+			}
+			segLen := utf8.RuneCountInString(seg)
+			if len(cur) > 0 && curLen+1+segLen+closing > size {
+				flush()
+			}
+			if len(cur) > 0 {
+				curLen++
+			}
+			cur = append(cur, seg)
+			curLen += segLen
+		}
+		fence = nextFence(fence, line)
+	}
+	if len(cur) > 0 {
+		parts = append(parts, strings.Join(cur, "\n"))
+	}
+	return parts
+}
+
+// cutLine cuts line into pieces of at most n characters.
+func cutLine(line string, n int) []string {
+	r := []rune(line)
+	if n <= 0 || len(r) <= n {
+		return []string{line}
+	}
+	var out []string
+	for len(r) > n {
+		out = append(out, string(r[:n]))
+		r = r[n:]
+	}
+	return append(out, string(r))
+}
+
+// nextFence returns the code fence open after line, given the fence open
+// before it ("" for none): line opens a fence with ``` or ~~~ and closes the
+// open one with a run of at least as many of the same characters.
+func nextFence(fence, line string) string {
+	trimmed := strings.TrimSpace(line)
+	if fence == "" {
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			return trimmed
+		}
+		return ""
+	}
+	marker := fenceMarker(fence)
+	if strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == "" {
+		return ""
+	}
+	return fence
+}
+
+// fenceMarker returns the run of backticks or tildes opening a fence.
+func fenceMarker(fence string) string {
+	trimmed := strings.TrimSpace(fence)
+	return trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+}
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage_Short(t *testing.T) {
+	if got := SplitMessage("short", 100); len(got) != 1 || got[0] != "short" {
+		t.Fatalf("SplitMessage() = %q", got)
+	}
+}
+
+func TestSplitMessage_Blocks(t *testing.T) {
+	body := "## Plan\n\n" + strings.Repeat("a", 40) + "\n\n- one\n- two\n\n" + strings.Repeat("b", 40)
+	got := SplitMessage(body, 80)
+	want := []string{
+		"(1/2)\n\n## Plan\n\n" + strings.Repeat("a", 40) + "\n\n- one\n- two",
+		"(2/2)\n\n" + strings.Repeat("b", 40),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("SplitMessage() = %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("part %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSplitMarkdown_KeepsFencesBalanced(t *testing.T) {
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, "fmt.Println(\"line\")")
+	}
+	body := "Intro.\n\n```go\n" + strings.Join(lines, "\n") + "\n```\n\nDone."
+	parts := SplitMarkdown(body, 200)
+	if len(parts) < 3 {
+		t.Fatalf("expected the code block to be split, got %d parts", len(parts))
+	}
+	for i, p := range parts {
+		if n := utf8.RuneCountInString(p); n > 200 {
+			t.Errorf("part %d has %d characters", i, n)
+		}
+		if strings.Count(p, "```")%2 != 0 {
+			t.Errorf("part %d has an unbalanced fence:\n%s", i, p)
+		}
+	}
+	if !strings.HasPrefix(parts[1], "```go\n") {
+		t.Errorf("part 1 does not reopen the fence:\n%s", parts[1])
+	}
+	if !strings.HasSuffix(parts[len(parts)-1], "Done.") {
+		t.Errorf("last part = %q", parts[len(parts)-1])
+	}
+}
+
+func TestSplitMarkdown_LongLine(t *testing.T) {
+	body := strings.Repeat("é", 250)
+	parts := SplitMarkdown(body, 100)
+	if strings.Join(parts, "\n") != strings.Join(cutLine(body, 50), "\n") {
+		t.Fatalf("SplitMarkdown() = %q", parts)
+	}
+	for i, p := range parts {
+		if n := utf8.RuneCountInString(p); n > 100 {
+			t.Errorf("part %d has %d characters", i, n)
+		}
+	}
+}
@@ -1,13 +1,14 @@
 package provider
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/opencode-ai/opencode-dog/internal/db"
@@ -18,16 +19,27 @@ type TelegramProvider struct {
 	logger     *slog.Logger
 	httpClient *http.Client
 	parseMode  string
+	apiURL     string
+
+	// histories holds the recent messages of each provider config's chats.
+	// They outlive the handlers BuildHandler returns, which may be built
+	// for a single request.
+	mu        sync.Mutex
+	histories map[string]*telegramHistory
 }
 
+var _ ReplyEditor = (*TelegramProvider)(nil)
+
 func NewTelegramProvider(database db.Store, logger *slog.Logger) *TelegramProvider {
 	timeout := database.GetSettingDuration(context.Background(), "telegram_http_timeout", 30*time.Second)
-	parseMode := database.GetSettingString(context.Background(), "telegram_parse_mode", "Markdown")
+	parseMode := telegramParseMode(database.GetSettingString(context.Background(), "telegram_parse_mode", "HTML"))
 	return &TelegramProvider{
 		database:   database,
 		logger:     logger,
 		httpClient: &http.Client{Timeout: timeout},
 		parseMode:  parseMode,
+		apiURL:     "https://api.telegram.org",
+		histories:  make(map[string]*telegramHistory),
 	}
 }
 
@@ -37,32 +49,78 @@ func (t *TelegramProvider) ValidateConfig(cfg map[string]any) error {
 	if _, ok := cfg["bot_token"]; !ok {
 		return fmt.Errorf("missing required field: bot_token")
 	}
+	if v, ok := cfg["history_size"]; ok {
+		if n, ok := v.(float64); !ok || n < 0 || n != float64(int(n)) {
+			return fmt.Errorf("history_size must be a non-negative integer")
+		}
+	}
 	return nil
 }
 
 type telegramUpdate struct {
-	UpdateID int `json:"update_id"`
-	Message  *struct {
-		MessageID int `json:"message_id"`
-		From      struct {
-			ID       int    `json:"id"`
-			Username string `json:"username"`
-		} `json:"from"`
-		Chat struct {
-			ID    int64  `json:"id"`
+	UpdateID int              `json:"update_id"`
+	Message  *telegramMessage `json:"message"`
+}
+
+type telegramMessage struct {
+	MessageID int `json:"message_id"`
+	From      struct {
+		ID        int    `json:"id"`
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+	} `json:"from"`
+	Chat struct {
+		ID    int64  `json:"id"`
+		Title string `json:"title"`
+		Type  string `json:"type"`
+	} `json:"chat"`
+	Text    string `json:"text"`
+	Caption string `json:"caption"`
+	// Photo lists the sizes of a photo, smallest first.
+	Photo []struct {
+		FileID   string `json:"file_id"`
+		FileSize int64  `json:"file_size"`
+	} `json:"photo"`
+	Document *struct {
+		FileID   string `json:"file_id"`
+		FileName string `json:"file_name"`
+		MimeType string `json:"mime_type"`
+		FileSize int64  `json:"file_size"`
+	} `json:"document"`
+	// ForwardOrigin describes where a forwarded message came from; older
+	// Bot API versions send ForwardFrom and ForwardSenderName instead.
+	ForwardOrigin *struct {
+		SenderUser *struct {
+			Username  string `json:"username"`
+			FirstName string `json:"first_name"`
+		} `json:"sender_user"`
+		SenderUserName string `json:"sender_user_name"`
+		Chat           *struct {
 			Title string `json:"title"`
-			Type  string `json:"type"`
 		} `json:"chat"`
-		Text string `json:"text"`
-	} `json:"message"`
+	} `json:"forward_origin"`
+	ForwardFrom *struct {
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+	} `json:"forward_from"`
+	ForwardSenderName string           `json:"forward_sender_name"`
+	ReplyToMessage    *telegramMessage `json:"reply_to_message"`
 }
 
+// telegramReplyMeta addresses replies to a message. Context is the quoted
+// reply chain and recent chat messages captured when the message arrived, as
+// the Bot API cannot fetch them later. Files are the photos and documents of
+// the message and of the one it replies to.
 type telegramReplyMeta struct {
-	ChatID    int64 `json:"chat_id"`
-	MessageID int   `json:"message_id"`
+	ChatID    int64          `json:"chat_id"`
+	MessageID int            `json:"message_id"`
+	Context   string         `json:"context,omitempty"`
+	Files     []telegramFile `json:"files,omitempty"`
 }
 
 func (t *TelegramProvider) BuildHandler(providerCfgID string, secret string, cfg map[string]any, onMessage func(context.Context, *IncomingMessage)) http.Handler {
+	history := t.history(providerCfgID, telegramHistorySize(cfg))
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -92,13 +150,22 @@ func (t *TelegramProvider) BuildHandler(providerCfgID string, secret string, cfg
 
 		w.WriteHeader(http.StatusOK)
 
-		if update.Message == nil || update.Message.Text == "" {
+		if update.Message == nil {
+			return
+		}
+		text := update.Message.text()
+		if text == "" {
 			return
 		}
 
 		meta := telegramReplyMeta{
 			ChatID:    update.Message.Chat.ID,
 			MessageID: update.Message.MessageID,
+			Context:   history.context(update.Message),
+			Files:     update.Message.files(),
+		}
+		if reply := update.Message.ReplyToMessage; reply != nil {
+			meta.Files = append(meta.Files, reply.files()...)
 		}
 
 		chatTitle := update.Message.Chat.Title
@@ -111,58 +178,100 @@ func (t *TelegramProvider) BuildHandler(providerCfgID string, secret string, cfg
 			ProviderCfgID: providerCfgID,
 			ExternalRef:   fmt.Sprintf("tg://chat/%d/msg/%d", update.Message.Chat.ID, update.Message.MessageID),
 			Title:         chatTitle,
-			Body:          update.Message.Text,
+			Body:          text,
 			Author:        update.Message.From.Username,
 			ReplyMeta:     meta,
+			Source: MessageRef{
+				ID:      strconv.Itoa(update.Message.MessageID),
+				Channel: strconv.FormatInt(update.Message.Chat.ID, 10),
+				URL:     telegramMessageURL(update.Message.Chat.ID, update.Message.MessageID),
+			},
+			// A message starts its own conversation unless it replies to one;
+			// the analyzer resolves ReplyTo to the existing thread.
+			ThreadKey: fmt.Sprintf("telegram:%d:%d", update.Message.Chat.ID, update.Message.MessageID),
+		}
+		if update.UpdateID != 0 {
+			msg.Delivery = newDelivery(strconv.Itoa(update.UpdateID), "message", body)
+		}
+		if reply := update.Message.ReplyToMessage; reply != nil {
+			msg.ReplyTo = &MessageRef{
+				ID:      strconv.Itoa(reply.MessageID),
+				Channel: strconv.FormatInt(update.Message.Chat.ID, 10),
+			}
 		}
 
-		go onMessage(context.Background(), msg)
+		go onMessage(context.WithoutCancel(r.Context()), msg)
 	})
 }
 
-func (t *TelegramProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) error {
+func (t *TelegramProvider) SignWebhook(req *http.Request, secret string, _ map[string]any, _ []byte) {
+	if secret != "" {
+		req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	}
+}
+
+func (t *TelegramProvider) SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) (*MessageRef, error) {
 	botToken, _ := cfg["bot_token"].(string)
 	if botToken == "" {
-		return fmt.Errorf("missing bot_token in config")
+		return nil, fmt.Errorf("missing bot_token in config")
 	}
 
 	var meta telegramReplyMeta
 	raw, _ := json.Marshal(msg.ReplyMeta)
 	if err := json.Unmarshal(raw, &meta); err != nil {
-		return fmt.Errorf("invalid reply meta: %w", err)
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
 	}
 
+	var result struct {
+		MessageID int `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	}
 	payload := map[string]any{
 		"chat_id":                  meta.ChatID,
 		"reply_to_message_id":      meta.MessageID,
-		"text":                     body,
-		"parse_mode":               t.parseMode,
 		"disable_web_page_preview": true,
 	}
+	if err := t.sendFormatted(ctx, botToken, "sendMessage", payload, body, &result); err != nil {
+		return nil, err
+	}
+	return &MessageRef{
+		ID:      strconv.Itoa(result.MessageID),
+		Channel: strconv.FormatInt(result.Chat.ID, 10),
+		URL:     telegramMessageURL(result.Chat.ID, result.MessageID),
+	}, nil
+}
 
-	jsonBody, _ := json.Marshal(payload)
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(jsonBody))
-	if err != nil {
-		return err
+func (t *TelegramProvider) EditReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, ref MessageRef, body string) error {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return fmt.Errorf("missing bot_token in config")
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := t.httpClient.Do(req)
+	chatID, err := strconv.ParseInt(ref.Channel, 10, 64)
 	if err != nil {
-		return fmt.Errorf("telegram api call failed: %w", err)
+		return fmt.Errorf("invalid chat id %q: %w", ref.Channel, err)
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		OK          bool   `json:"ok"`
-		Description string `json:"description"`
+	messageID, err := strconv.Atoi(ref.ID)
+	if err != nil {
+		return fmt.Errorf("invalid message id %q: %w", ref.ID, err)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return err
+
+	payload := map[string]any{
+		"chat_id":                  chatID,
+		"message_id":               messageID,
+		"disable_web_page_preview": true,
 	}
-	if !result.OK {
-		return fmt.Errorf("telegram api error: %s", result.Description)
+	return t.sendFormatted(ctx, botToken, "editMessageText", payload, body, nil)
+}
+
+// telegramMessageURL links to a message in a supergroup or channel. Telegram
+// has no links into private chats or basic groups, so those get none.
+func telegramMessageURL(chatID int64, messageID int) string {
+	const supergroupPrefix = -1000000000000
+	if chatID > supergroupPrefix {
+		return ""
 	}
-	return nil
+	return fmt.Sprintf("https://t.me/c/%d/%d", -(chatID - supergroupPrefix), messageID)
 }
@@ -0,0 +1,289 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var _ ContextFetcher = (*TelegramProvider)(nil)
+
+const (
+	// defaultTelegramHistory is how many recent messages of a chat are kept
+	// when the provider config sets no "history_size".
+	defaultTelegramHistory = 10
+	// maxTelegramQuote caps the replied-to message's text, maxTelegramRecent
+	// that of each recent message.
+	maxTelegramQuote  = 4000
+	maxTelegramRecent = 500
+)
+
+// telegramHistorySize reads "history_size" from the provider config: how many
+// recent messages of a chat are kept as context. 0 disables the buffer.
+func telegramHistorySize(cfg map[string]any) int {
+	switch v := cfg["history_size"].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return defaultTelegramHistory
+}
+
+// FetchContext returns the context captured when msg arrived: the message it
+// replies to and the chat's recent messages.
+func (t *TelegramProvider) FetchContext(ctx context.Context, cfg map[string]any, msg *IncomingMessage, _ ContextLimits) (string, error) {
+	var meta telegramReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return "", fmt.Errorf("invalid reply meta: %w", err)
+	}
+	return meta.Context, nil
+}
+
+// text is the message's text, or the caption of a photo or document.
+func (m *telegramMessage) text() string {
+	if m.Text != "" {
+		return m.Text
+	}
+	return m.Caption
+}
+
+func (m *telegramMessage) sender() string {
+	if m.From.Username != "" {
+		return "@" + m.From.Username
+	}
+	if m.From.FirstName != "" {
+		return m.From.FirstName
+	}
+	return "unknown"
+}
+
+// forwardedFrom names the original sender of a forwarded message, or returns
+// "" if m was not forwarded.
+func (m *telegramMessage) forwardedFrom() string {
+	if o := m.ForwardOrigin; o != nil {
+		switch {
+		case o.SenderUser != nil && o.SenderUser.Username != "":
+			return "@" + o.SenderUser.Username
+		case o.SenderUser != nil:
+			return o.SenderUser.FirstName
+		case o.Chat != nil:
+			return o.Chat.Title
+		case o.SenderUserName != "":
+			return o.SenderUserName
+		}
+		return "unknown"
+	}
+	if m.ForwardFrom != nil {
+		if m.ForwardFrom.Username != "" {
+			return "@" + m.ForwardFrom.Username
+		}
+		return m.ForwardFrom.FirstName
+	}
+	return m.ForwardSenderName
+}
+
+// heading is "**sender**", followed by the original sender if m was
+// forwarded.
+func (m *telegramMessage) heading() string {
+	h := "**" + m.sender() + "**"
+	if from := m.forwardedFrom(); from != "" {
+		h += " (forwarded from " + from + ")"
+	}
+	return h
+}
+
+type telegramHistoryEntry struct {
+	messageID int
+	heading   string
+	text      string
+}
+
+// telegramHistory keeps the latest messages of each chat, so a message can be
+// analyzed together with the conversation that led to it. Telegram only
+// delivers every group message to bots with privacy mode disabled.
+type telegramHistory struct {
+	size  int
+	mu    sync.Mutex
+	chats map[int64][]telegramHistoryEntry
+}
+
+func newTelegramHistory(size int) *telegramHistory {
+	return &telegramHistory{size: max(size, 0), chats: make(map[int64][]telegramHistoryEntry)}
+}
+
+// history returns the history of a provider config's chats, keeping size
+// messages per chat.
+func (t *TelegramProvider) history(providerCfgID string, size int) *telegramHistory {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.histories[providerCfgID]
+	if !ok {
+		h = newTelegramHistory(size)
+		t.histories[providerCfgID] = h
+		return h
+	}
+	h.mu.Lock()
+	h.size = max(size, 0)
+	h.mu.Unlock()
+	return h
+}
+
+// context records m in its chat's history and returns Markdown quoting the
+// message m replies to and the chat's messages before m.
+func (h *telegramHistory) context(m *telegramMessage) string {
+	replyID := 0
+	var sb strings.Builder
+	if r := m.ReplyToMessage; r != nil && r.text() != "" {
+		replyID = r.MessageID
+		sb.WriteString("## Replied-to message\n")
+		sb.WriteString(r.heading() + ":\n")
+		for _, line := range strings.Split(clip(strings.TrimSpace(r.text()), maxTelegramQuote), "\n") {
+			sb.WriteString("> " + line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	recent := h.record(m)
+	var lines []string
+	for _, e := range recent {
+		if e.messageID != replyID {
+			lines = append(lines, e.heading+": "+e.text)
+		}
+	}
+	if len(lines) > 0 {
+		sb.WriteString("## Recent messages in the chat\n")
+		sb.WriteString(strings.Join(lines, "\n"))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// record appends m to its chat's history and returns the entries before it.
+// A message already recorded, redelivered or replayed, is not added again.
+func (h *telegramHistory) record(m *telegramMessage) []telegramHistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.size == 0 {
+		delete(h.chats, m.Chat.ID)
+		return nil
+	}
+	chat := h.chats[m.Chat.ID]
+	for i, e := range chat {
+		if e.messageID == m.MessageID {
+			return append([]telegramHistoryEntry(nil), chat[:i]...)
+		}
+	}
+	recent := append([]telegramHistoryEntry(nil), chat...)
+	chat = append(chat, telegramHistoryEntry{
+		messageID: m.MessageID,
+		heading:   m.heading(),
+		text:      clip(strings.TrimSpace(m.text()), maxTelegramRecent),
+	})
+	if len(chat) > h.size {
+		chat = chat[len(chat)-h.size:]
+	}
+	h.chats[m.Chat.ID] = chat
+	return recent
+}
+
+var _ AttachmentFetcher = (*TelegramProvider)(nil)
+
+// telegramFile is a photo or document to download with getFile.
+type telegramFile struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+}
+
+// files lists the message's largest photo size and its document.
+func (m *telegramMessage) files() []telegramFile {
+	var files []telegramFile
+	if n := len(m.Photo); n > 0 {
+		p := m.Photo[n-1]
+		files = append(files, telegramFile{ID: p.FileID, Name: fmt.Sprintf("photo-%d.jpg", m.MessageID), MIMEType: "image/jpeg", Size: p.FileSize})
+	}
+	if d := m.Document; d != nil {
+		name := d.FileName
+		if name == "" {
+			name = fmt.Sprintf("document-%d", m.MessageID)
+		}
+		files = append(files, telegramFile{ID: d.FileID, Name: name, MIMEType: d.MimeType, Size: d.FileSize})
+	}
+	return files
+}
+
+// FetchAttachments downloads the photos and documents recorded for msg.
+func (t *TelegramProvider) FetchAttachments(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits AttachmentLimits) ([]Attachment, error) {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return nil, fmt.Errorf("missing bot_token in config")
+	}
+	var meta telegramReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
+	}
+
+	var out []Attachment
+	for _, f := range meta.Files {
+		if len(out) == maxAttachments {
+			break
+		}
+		att, err := t.downloadFile(ctx, botToken, f, limits)
+		if err != nil {
+			t.logger.Warn("telegram attachment skipped", "file", f.Name, "error", err)
+			continue
+		}
+		out = append(out, att)
+	}
+	return out, nil
+}
+
+func (t *TelegramProvider) downloadFile(ctx context.Context, botToken string, f telegramFile, limits AttachmentLimits) (Attachment, error) {
+	if err := limits.check(f.Name, f.MIMEType, f.Size); err != nil {
+		return Attachment{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/bot%s/getFile?file_id=%s", t.apiURL, botToken, url.QueryEscape(f.ID)), nil)
+	if err != nil {
+		return Attachment{}, err
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("telegram api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+		Result      struct {
+			FilePath string `json:"file_path"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Attachment{}, err
+	}
+	if !result.OK {
+		return Attachment{}, fmt.Errorf("telegram api error: %s", result.Description)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/file/bot%s/%s", t.apiURL, botToken, result.Result.FilePath), nil)
+	if err != nil {
+		return Attachment{}, err
+	}
+	file, err := t.httpClient.Do(req)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("download %s: %w", f.Name, err)
+	}
+	defer file.Body.Close()
+	if file.StatusCode != http.StatusOK {
+		return Attachment{}, fmt.Errorf("download %s: status %d", f.Name, file.StatusCode)
+	}
+	return readAttachment(file.Body, f.Name, f.MIMEType, limits)
+}
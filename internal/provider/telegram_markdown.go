@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var telegramHTMLEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// telegramHTML renders Markdown in Telegram's HTML parse mode.
+var telegramHTML = &mdFormat{
+	escape: telegramHTMLEscaper.Replace,
+	code:   func(s string) string { return "<code>" + telegramHTMLEscaper.Replace(s) + "</code>" },
+	codeBlock: func(lang, code string) string {
+		if lang == "" {
+			return "<pre>" + telegramHTMLEscaper.Replace(code) + "</pre>"
+		}
+		return `<pre><code class="language-` + telegramHTMLEscaper.Replace(lang) + `">` + telegramHTMLEscaper.Replace(code) + "</code></pre>"
+	},
+	strong: wrap("<b>", "</b>"),
+	emph:   wrap("<i>", "</i>"),
+	strike: wrap("<s>", "</s>"),
+	link: func(label, url string) string {
+		return `<a href="` + telegramHTMLEscaper.Replace(url) + `">` + label + "</a>"
+	},
+	heading: wrap("<b>", "</b>"),
+	quote:   wrap("<blockquote>", "</blockquote>"),
+	bullet:  "• ",
+	number:  func(n int) string { return strconv.Itoa(n) + ". " },
+	rule:    "──────────",
+}
+
+var (
+	// telegramV2Escaper escapes the characters MarkdownV2 reserves in text,
+	// telegramV2CodeEscaper those it reserves in code and telegramV2URLEscaper
+	// those in a link's URL.
+	telegramV2Escaper = strings.NewReplacer(
+		`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "~", `\~`, "`", "\\`",
+		">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+	)
+	telegramV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+	telegramV2URLEscaper  = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+)
+
+// telegramMarkdownV2 renders Markdown in Telegram's MarkdownV2 parse mode.
+var telegramMarkdownV2 = &mdFormat{
+	escape: telegramV2Escaper.Replace,
+	code:   func(s string) string { return "`" + telegramV2CodeEscaper.Replace(s) + "`" },
+	codeBlock: func(lang, code string) string {
+		return "```" + lang + "\n" + telegramV2CodeEscaper.Replace(code) + "\n```"
+	},
+	strong: wrap("*", "*"),
+	emph:   wrap("_", "_"),
+	strike: wrap("~", "~"),
+	link: func(label, url string) string {
+		return "[" + label + "](" + telegramV2URLEscaper.Replace(url) + ")"
+	},
+	heading: wrap("*", "*"),
+	quote:   prefixLines(">"),
+	bullet:  "• ",
+	number:  func(n int) string { return strconv.Itoa(n) + `\. ` },
+	rule:    "──────────",
+}
+
+// telegramParseMode returns the parse mode replies are rendered in: HTML,
+// unless the telegram_parse_mode setting asks for MarkdownV2. The legacy
+// Markdown mode rejects too much of what OpenCode writes to be supported.
+func telegramParseMode(setting string) string {
+	if setting == "MarkdownV2" {
+		return setting
+	}
+	return "HTML"
+}
+
+// format renders md in the provider's parse mode.
+func (t *TelegramProvider) format(md string) string {
+	if t.parseMode == "MarkdownV2" {
+		return telegramMarkdownV2.render(md)
+	}
+	return telegramHTML.render(md)
+}
+
+// sendFormatted calls method, sendMessage or editMessageText, with body
+// rendered in the provider's parse mode. If Telegram cannot parse the result,
+// it sends body again as plain text.
+func (t *TelegramProvider) sendFormatted(ctx context.Context, botToken, method string, payload map[string]any, body string, out any) error {
+	payload["text"] = t.format(body)
+	payload["parse_mode"] = t.parseMode
+	err := t.post(ctx, botToken, method, payload, out)
+	if err != nil && strings.Contains(err.Error(), "can't parse entities") {
+		t.logger.Warn("telegram rejected formatted message, sending plain text", "method", method, "error", err)
+		payload["text"] = renderPlain(body)
+		delete(payload, "parse_mode")
+		err = t.post(ctx, botToken, method, payload, out)
+	}
+	return err
+}
+
+// post invokes a Bot API method with a JSON payload and decodes its result
+// into out.
+func (t *TelegramProvider) post(ctx context.Context, botToken, method string, payload map[string]any, out any) error {
+	jsonBody, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/%s", t.apiURL, botToken, method), bytes.NewReader(jsonBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("telegram api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool                `json:"ok"`
+		Description string              `json:"description"`
+		Parameters  telegramErrorParams `json:"parameters"`
+		Result      json.RawMessage     `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return telegramError(result.Description, result.Parameters)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+// telegramErrorParams holds the details Telegram gives about a failed call;
+// RetryAfter is set when it was rate limited (flood wait).
+type telegramErrorParams struct {
+	RetryAfter int `json:"retry_after"`
+}
+
+func telegramError(description string, params telegramErrorParams) error {
+	err := fmt.Errorf("telegram api error: %s", description)
+	if params.RetryAfter > 0 {
+		return &RateLimitError{After: time.Duration(params.RetryAfter) * time.Second, Err: err}
+	}
+	return err
+}
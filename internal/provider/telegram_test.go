@@ -3,6 +3,7 @@ package provider
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -176,6 +177,44 @@ func TestTelegramHandler_ValidMessage(t *testing.T) {
 	if meta.MessageID != 42 {
 		t.Errorf("MessageID = %d, want 42", meta.MessageID)
 	}
+	if received.Source.ID != "42" || received.Source.Channel != "12345" || received.Source.URL != "" {
+		t.Errorf("Source = %+v", received.Source)
+	}
+	if received.ThreadKey != "telegram:12345:42" {
+		t.Errorf("ThreadKey = %q", received.ThreadKey)
+	}
+	if received.ReplyTo != nil {
+		t.Errorf("ReplyTo = %+v, want nil", received.ReplyTo)
+	}
+	if d := received.Delivery; d == nil || d.ID != "100" || d.Event != "message" {
+		t.Errorf("Delivery = %+v", d)
+	}
+}
+
+// --- Telegram BuildHandler: reply to an earlier message ---
+
+func TestTelegramHandler_ReplyTo(t *testing.T) {
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "secret", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+
+	payload := `{"update_id":101,"message":{"message_id":43,"from":{"id":1001,"username":"alice"},` +
+		`"chat":{"id":12345,"type":"group"},"text":"@opencode and now?","reply_to_message":{"message_id":40}}}`
+	req := httptest.NewRequest(http.MethodPost, "/hook/telegram/test", strings.NewReader(payload))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	select {
+	case msg := <-received:
+		if msg.ReplyTo == nil || msg.ReplyTo.ID != "40" || msg.ReplyTo.Channel != "12345" {
+			t.Errorf("ReplyTo = %+v", msg.ReplyTo)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
 }
 
 // --- Telegram BuildHandler: null message ---
@@ -299,3 +338,278 @@ func TestTelegramHandler_ChatWithoutTitle(t *testing.T) {
 		t.Errorf("Title = %q, want %q", received.Title, "Chat 99")
 	}
 }
+
+// --- Telegram SendReply ---
+
+func TestTelegramSendReply_ReturnsMessageRef(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 43, "chat": {"id": -1001234567890}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: telegramReplyMeta{ChatID: -1001234567890, MessageID: 42}}
+	ref, err := p.SendReply(context.Background(), map[string]any{"bot_token": "123:abc"}, msg, "hello")
+	if err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if gotPath != "/bot123:abc/sendMessage" {
+		t.Errorf("path = %q", gotPath)
+	}
+	if ref.ID != "43" || ref.Channel != "-1001234567890" || ref.URL != "https://t.me/c/1234567890/43" {
+		t.Errorf("ref = %+v", ref)
+	}
+}
+
+func TestTelegramSendReply_Formatting(t *testing.T) {
+	var got []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		got = append(got, payload)
+		if len(got) == 1 {
+			_, _ = w.Write([]byte(`{"ok": false, "description": "Bad Request: can't parse entities: unexpected end tag"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 43, "chat": {"id": 7}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: telegramReplyMeta{ChatID: 7, MessageID: 42}}
+	if _, err := p.SendReply(context.Background(), map[string]any{"bot_token": "tok"}, msg, "## Result\n\n**a** < b"); err != nil {
+		t.Fatalf("SendReply() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected a plain text retry, got %d requests", len(got))
+	}
+	if got[0]["text"] != "<b>Result</b>\n\n<b>a</b> &lt; b" || got[0]["parse_mode"] != "HTML" {
+		t.Errorf("formatted payload = %v", got[0])
+	}
+	if got[1]["text"] != "Result\n\na < b" || got[1]["parse_mode"] != nil {
+		t.Errorf("plain payload = %v", got[1])
+	}
+}
+
+func TestTelegramProvider_ParseMode(t *testing.T) {
+	store := dbmock.New()
+	_ = store.SetSetting(context.Background(), "telegram_parse_mode", json.RawMessage(`"MarkdownV2"`))
+	if p := NewTelegramProvider(store, slog.Default()); p.format("**a.b**") != "*a\\.b*" {
+		t.Errorf("MarkdownV2 format = %q", p.format("**a.b**"))
+	}
+	_ = store.SetSetting(context.Background(), "telegram_parse_mode", json.RawMessage(`"Markdown"`))
+	if p := NewTelegramProvider(store, slog.Default()); p.parseMode != "HTML" {
+		t.Errorf("parse mode for legacy Markdown = %q, want HTML", p.parseMode)
+	}
+}
+
+func TestTelegramEditReply_CallsEditMessageText(t *testing.T) {
+	var gotPath string
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"ok": true}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	ref := MessageRef{ID: "43", Channel: "-1001234567890"}
+	if err := p.EditReply(context.Background(), map[string]any{"bot_token": "123:abc"}, &IncomingMessage{}, ref, "done"); err != nil {
+		t.Fatalf("EditReply() error = %v", err)
+	}
+	if gotPath != "/bot123:abc/editMessageText" || got["message_id"] != float64(43) || got["chat_id"] != float64(-1001234567890) {
+		t.Errorf("request = %s %v", gotPath, got)
+	}
+}
+
+func TestTelegramEditReply_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok": false, "description": "Bad Request: message to edit not found"}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	err := p.EditReply(context.Background(), map[string]any{"bot_token": "t"}, &IncomingMessage{}, MessageRef{ID: "1", Channel: "2"}, "x")
+	if err == nil || !strings.Contains(err.Error(), "message to edit not found") {
+		t.Fatalf("EditReply() error = %v", err)
+	}
+}
+
+func TestTelegramSendReply_FloodWait(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"ok": false, "error_code": 429, "description": "Too Many Requests: retry after 12", "parameters": {"retry_after": 12}}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: telegramReplyMeta{ChatID: 1, MessageID: 2}}
+	_, err := p.SendReply(context.Background(), map[string]any{"bot_token": "t"}, msg, "hi")
+	if RetryAfter(err) != 12*time.Second || !strings.Contains(err.Error(), "Too Many Requests") {
+		t.Fatalf("SendReply() error = %v, retry after %s", err, RetryAfter(err))
+	}
+}
+
+// --- Telegram BuildHandler: reply chain and recent messages as context ---
+
+func TestTelegramHandler_Context(t *testing.T) {
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 3)
+	handler := p.BuildHandler("cfg-1", "", map[string]any{"history_size": float64(2)}, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	send := func(payload string) *IncomingMessage {
+		t.Helper()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hook/telegram/test", strings.NewReader(payload)))
+		select {
+		case msg := <-received:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("onMessage was not called")
+			return nil
+		}
+	}
+
+	send(`{"update_id":1,"message":{"message_id":1,"from":{"username":"alice"},"chat":{"id":7},"text":"first"}}`)
+	send(`{"update_id":2,"message":{"message_id":2,"from":{"username":"bob"},"chat":{"id":7},"text":"deploy broke"}}`)
+	send(`{"update_id":3,"message":{"message_id":3,"from":{"first_name":"Carol"},"chat":{"id":7},` +
+		`"forward_origin":{"type":"user","sender_user":{"username":"ci"}},"caption":"panic: nil map\ngoroutine 1"}}`)
+	msg := send(`{"update_id":4,"message":{"message_id":4,"from":{"username":"dave"},"chat":{"id":7},"text":"@do fix this",` +
+		`"reply_to_message":{"message_id":3,"from":{"first_name":"Carol"},"forward_from":{"username":"ci"},"caption":"panic: nil map\ngoroutine 1"}}}`)
+
+	if msg.Body != "@do fix this" {
+		t.Errorf("Body = %q", msg.Body)
+	}
+	want := "## Replied-to message\n**Carol** (forwarded from @ci):\n> panic: nil map\n> goroutine 1\n\n" +
+		"## Recent messages in the chat\n**@bob**: deploy broke"
+	got, err := p.FetchContext(context.Background(), nil, msg, ContextLimits{})
+	if err != nil || got != want {
+		t.Errorf("FetchContext() = %q, %v\nwant %q", got, err, want)
+	}
+}
+
+func TestTelegramHandler_HistorySharedAcrossHandlers(t *testing.T) {
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	received := make(chan *IncomingMessage, 1)
+	// A handler is built per request, as the /hook/ fallback route and
+	// webhook replays do.
+	send := func(cfgID, payload string) string {
+		t.Helper()
+		handler := p.BuildHandler(cfgID, "", map[string]any{}, func(_ context.Context, msg *IncomingMessage) {
+			received <- msg
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hook/telegram/test", strings.NewReader(payload)))
+		select {
+		case msg := <-received:
+			got, _ := p.FetchContext(context.Background(), nil, msg, ContextLimits{})
+			return got
+		case <-time.After(time.Second):
+			t.Fatal("onMessage was not called")
+			return ""
+		}
+	}
+
+	first := `{"update_id":1,"message":{"message_id":1,"from":{"username":"alice"},"chat":{"id":7},"text":"deploy broke"}}`
+	send("cfg-1", first)
+	send("cfg-1", first)
+	want := "## Recent messages in the chat\n**@alice**: deploy broke"
+	if got := send("cfg-1", `{"update_id":2,"message":{"message_id":2,"from":{"username":"bob"},"chat":{"id":7},"text":"@ask why"}}`); got != want {
+		t.Errorf("context = %q, want %q", got, want)
+	}
+	if got := send("cfg-2", `{"update_id":2,"message":{"message_id":2,"from":{"username":"bob"},"chat":{"id":7},"text":"@ask why"}}`); got != "" {
+		t.Errorf("another provider config's context = %q, want none", got)
+	}
+}
+
+func TestTelegramProvider_ValidateConfig_HistorySize(t *testing.T) {
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	if err := p.ValidateConfig(map[string]any{"bot_token": "tok", "history_size": float64(0)}); err != nil {
+		t.Errorf("ValidateConfig() error = %v", err)
+	}
+	for _, bad := range []any{float64(-1), 2.5, "10"} {
+		if err := p.ValidateConfig(map[string]any{"bot_token": "tok", "history_size": bad}); err == nil {
+			t.Errorf("ValidateConfig(history_size=%v) succeeded", bad)
+		}
+	}
+}
+
+// --- Telegram FetchAttachments ---
+
+func TestTelegramFetchAttachments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottok/getFile":
+			_, _ = w.Write([]byte(`{"ok": true, "result": {"file_path": "photos/` + r.URL.Query().Get("file_id") + `.jpg"}}`))
+		case "/file/bottok/photos/big.jpg":
+			_, _ = w.Write([]byte("\xff\xd8\xff"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	received := make(chan *IncomingMessage, 1)
+	handler := p.BuildHandler("cfg-1", "", nil, func(_ context.Context, msg *IncomingMessage) {
+		received <- msg
+	})
+	payload := `{"update_id":1,"message":{"message_id":5,"from":{"username":"dave"},"chat":{"id":7},"text":"@do fix this",` +
+		`"reply_to_message":{"message_id":4,"from":{"username":"qa"},"photo":[{"file_id":"small","file_size":1},{"file_id":"big","file_size":3}]}}}`
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/hook/telegram/test", strings.NewReader(payload)))
+
+	var msg *IncomingMessage
+	select {
+	case msg = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("onMessage was not called")
+	}
+	got, err := p.FetchAttachments(context.Background(), map[string]any{"bot_token": "tok"}, msg, testAttachmentLimits)
+	if err != nil {
+		t.Fatalf("FetchAttachments() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Name != "photo-4.jpg" || got[0].MIMEType != "image/jpeg" || string(got[0].Data) != "\xff\xd8\xff" {
+		t.Errorf("attachments = %+v", got)
+	}
+}
+
+func TestTelegramUploadReply(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottok/sendDocument" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			t.Fatalf("FormFile: %v", err)
+		}
+		content, _ := io.ReadAll(file)
+		if header.Filename != "result.md" || string(content) != "# Plan\n" {
+			t.Errorf("document = %s %q", header.Filename, content)
+		}
+		if r.FormValue("chat_id") != "7" || r.FormValue("reply_to_message_id") != "5" || r.FormValue("caption") != "Full result" {
+			t.Errorf("form = %v", r.MultipartForm.Value)
+		}
+		_, _ = w.Write([]byte(`{"ok": true, "result": {"message_id": 9, "chat": {"id": 7}}}`))
+	}))
+	defer srv.Close()
+
+	p := NewTelegramProvider(dbmock.New(), slog.Default())
+	p.apiURL = srv.URL
+	msg := &IncomingMessage{ReplyMeta: telegramReplyMeta{ChatID: 7, MessageID: 5}}
+	ref, err := p.UploadReply(context.Background(), map[string]any{"bot_token": "tok"}, msg, "result.md", []byte("# Plan\n"), "Full result")
+	if err != nil {
+		t.Fatalf("UploadReply() error = %v", err)
+	}
+	if ref.ID != "9" || ref.Channel != "7" {
+		t.Errorf("ref = %+v", ref)
+	}
+}
@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+)
+
+var (
+	_ MessageLimiter = (*TelegramProvider)(nil)
+	_ FileUploader   = (*TelegramProvider)(nil)
+)
+
+const (
+	// telegramMaxMessage is the longest text sendMessage accepts.
+	telegramMaxMessage = 4096
+	// telegramMaxCaption is the longest caption sendDocument accepts.
+	telegramMaxCaption = 1024
+)
+
+func (t *TelegramProvider) MaxMessageLength() int { return telegramMaxMessage }
+
+// UploadReply sends content as a document replying to msg, with comment as its
+// caption.
+func (t *TelegramProvider) UploadReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, name string, content []byte, comment string) (*MessageRef, error) {
+	botToken, _ := cfg["bot_token"].(string)
+	if botToken == "" {
+		return nil, fmt.Errorf("missing bot_token in config")
+	}
+	var meta telegramReplyMeta
+	raw, _ := json.Marshal(msg.ReplyMeta)
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return nil, fmt.Errorf("invalid reply meta: %w", err)
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"chat_id":             strconv.FormatInt(meta.ChatID, 10),
+		"reply_to_message_id": strconv.Itoa(meta.MessageID),
+		"caption":             t.format(cutLine(comment, telegramMaxCaption)[0]),
+		"parse_mode":          t.parseMode,
+	}
+	for k, v := range fields {
+		if err := w.WriteField(k, v); err != nil {
+			return nil, err
+		}
+	}
+	part, err := w.CreateFormFile("document", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/sendDocument", t.apiURL, botToken), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("telegram api call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool                `json:"ok"`
+		Description string              `json:"description"`
+		Parameters  telegramErrorParams `json:"parameters"`
+		Result      struct {
+			MessageID int `json:"message_id"`
+			Chat      struct {
+				ID int64 `json:"id"`
+			} `json:"chat"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !result.OK {
+		return nil, telegramError(result.Description, result.Parameters)
+	}
+	return &MessageRef{
+		ID:      strconv.Itoa(result.Result.MessageID),
+		Channel: strconv.FormatInt(result.Result.Chat.ID, 10),
+		URL:     telegramMessageURL(result.Result.Chat.ID, result.Result.MessageID),
+	}, nil
+}
@@ -7,15 +7,20 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"net/http"
 )
 
 type TriggerMode string
 
 const (
-	ModeAsk  TriggerMode = "ask"
-	ModePlan TriggerMode = "plan"
-	ModeDo   TriggerMode = "do"
+	ModeAsk    TriggerMode = "ask"
+	ModePlan   TriggerMode = "plan"
+	ModeDo     TriggerMode = "do"
+	ModeReview TriggerMode = "review"
+	// ModePipeline analyzes a failed CI job; it is chosen by the provider
+	// rather than by a keyword.
+	ModePipeline TriggerMode = "pipeline"
 )
 
 type ProviderType string
@@ -26,6 +31,19 @@ const (
 	ProviderTelegram ProviderType = "telegram"
 )
 
+// MessageRef identifies a single message on a provider: the message that
+// triggered a task, or a reply returned by SendReply. It is what later edits,
+// deletions and links address.
+type MessageRef struct {
+	// ID is the GitLab note ID, Slack message ts or Telegram message_id.
+	ID string
+	// Channel is the Slack channel or Telegram chat ID; empty for GitLab, whose
+	// notes are addressed through the reply meta.
+	Channel string
+	// URL links to the message, when the provider can build one.
+	URL string
+}
+
 type IncomingMessage struct {
 	Provider       ProviderType
 	ProviderCfgID  string
@@ -37,11 +55,162 @@ type IncomingMessage struct {
 	TriggerMode    TriggerMode
 	TriggerKeyword string
 	ReplyMeta      any
+	// Ref is the branch, tag or commit to analyze. Providers may set a
+	// default (a merge request's source branch); a --ref option in the
+	// message overrides it. Empty means the project's default branch.
+	Ref string
+	// Source identifies the inbound message itself. It is only known while
+	// the webhook is handled and is not carried through the task queue.
+	Source MessageRef
+	// ThreadKey identifies the conversation the message belongs to (GitLab
+	// issue, Slack thread). Messages with the same key share an OpenCode
+	// session.
+	ThreadKey string
+	// ReplyTo is the message this one explicitly replies to, for channels
+	// where that, rather than ThreadKey, defines the conversation (Telegram).
+	ReplyTo *MessageRef
+	// FailedJob is set for a failed CI job reported by the provider rather
+	// than a message from a user. It needs no trigger keyword; the project's
+	// pipeline analysis settings decide whether it is analyzed.
+	FailedJob *FailedJob
+	// Delivery identifies the webhook delivery the message arrived in, if
+	// the sender gives deliveries an ID. Like Source, it is not carried
+	// through the task queue.
+	Delivery *Delivery
+}
+
+// FailedJob describes a failed CI job.
+type FailedJob struct {
+	// ID is the job's ID, unique across its CI server.
+	ID int
+	// Ref is the branch or tag the pipeline ran for.
+	Ref   string
+	Name  string
+	Stage string
+}
+
+// ReplyEditor is implemented by providers that can edit a reply they posted
+// earlier, so a status message can be updated in place instead of posting a
+// new one.
+type ReplyEditor interface {
+	EditReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, ref MessageRef, body string) error
+}
+
+// MergeRequest describes a merge request to open for pushed changes.
+type MergeRequest struct {
+	// RepoURL is the project's repository URL, used to find the project on
+	// the provider when msg does not identify it.
+	RepoURL      string
+	SourceBranch string
+	TargetBranch string
+	Title        string
+	Description  string
+}
+
+// MergeRequestCreator is implemented by providers that host repositories and
+// can open merge requests in them.
+type MergeRequestCreator interface {
+	// CreateMergeRequest opens mr and returns its web URL. msg is the
+	// message that requested the change; it may come from another provider.
+	CreateMergeRequest(ctx context.Context, cfg map[string]any, msg *IncomingMessage, mr MergeRequest) (string, error)
+}
+
+// ContextFetcher is implemented by providers that can look up what a message
+// refers to (e.g. the merge request a comment was made on) so the analysis
+// sees more than the message itself.
+type ContextFetcher interface {
+	// FetchContext returns Markdown describing msg's context for the prompt,
+	// bounded by limits, or "" if there is nothing to add.
+	FetchContext(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits ContextLimits) (string, error)
+}
+
+// ContextLimits bounds the context a provider fetches for a message.
+type ContextLimits struct {
+	// IssueNotes caps the earlier comments included for an issue.
+	IssueNotes int
+	// IssueTokens roughly bounds an issue's context, in tokens of about four
+	// characters. The most recent comments are kept when it runs out.
+	IssueTokens int
+}
+
+// ErrNotMergeRequest is returned by MergeRequestReviewer for messages that
+// were not posted on a merge request.
+var ErrNotMergeRequest = errors.New("message was not posted on a merge request")
+
+// ReviewComment is a finding on one line of a reviewed diff.
+type ReviewComment struct {
+	Path string
+	// Line is the line in the new version of the file. OldLine is the line
+	// in the old version, used instead of Line for a removed line.
+	Line    int
+	OldLine int
+	Body    string
+}
+
+// MergeRequestReviewer is implemented by providers that can review the merge
+// request a message was posted on with comments on lines of its diff.
+type MergeRequestReviewer interface {
+	// ReviewDiff returns the current diff of the merge request msg was
+	// posted on, or ErrNotMergeRequest.
+	ReviewDiff(ctx context.Context, cfg map[string]any, msg *IncomingMessage) (*ReviewDiff, error)
+	// PostReviewComment starts a discussion on the line of diff c refers to.
+	PostReviewComment(ctx context.Context, cfg map[string]any, msg *IncomingMessage, diff *ReviewDiff, c ReviewComment) (*MessageRef, error)
+}
+
+// Attachment is a file attached to a message, such as a screenshot or a log.
+type Attachment struct {
+	Name     string
+	MIMEType string
+	Data     []byte
+}
+
+// AttachmentLimits bounds the attachments a provider downloads.
+type AttachmentLimits struct {
+	// MaxBytes is the size of the largest file downloaded.
+	MaxBytes int64
+	// MIMETypes lists the allowed types; "image/*" allows every image type.
+	MIMETypes []string
+}
+
+// AttachmentFetcher is implemented by providers that can download the files
+// attached to a message, so OpenCode sees them along with the prompt.
+type AttachmentFetcher interface {
+	// FetchAttachments downloads msg's attachments. Files outside limits, or
+	// that cannot be downloaded, are skipped.
+	FetchAttachments(ctx context.Context, cfg map[string]any, msg *IncomingMessage, limits AttachmentLimits) ([]Attachment, error)
+}
+
+// MessageLimiter is implemented by providers whose messages have a maximum
+// length. Longer replies are split with SplitMessage.
+type MessageLimiter interface {
+	// MaxMessageLength returns the longest body, in characters, one reply
+	// may have.
+	MaxMessageLength() int
+}
+
+// FileUploader is implemented by providers that can post a file as a reply,
+// used for results too long to post as a few messages.
+type FileUploader interface {
+	// UploadReply posts content as a file named name, with comment as its
+	// message, in reply to msg.
+	UploadReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, name string, content []byte, comment string) (*MessageRef, error)
+}
+
+// WebhookSigner is implemented by providers whose webhooks carry a secret or
+// signature. Recorded webhooks are stored with those headers redacted; a
+// replay is authenticated again with SignWebhook.
+type WebhookSigner interface {
+	// SignWebhook sets the headers that authenticate req, whose body is
+	// body, as a webhook of the provider config with the given secret and
+	// config.
+	SignWebhook(req *http.Request, secret string, cfg map[string]any, body []byte)
 }
 
 type Provider interface {
 	Type() ProviderType
 	ValidateConfig(cfg map[string]any) error
 	BuildHandler(providerCfgID string, secret string, cfg map[string]any, onMessage func(context.Context, *IncomingMessage)) http.Handler
-	SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) error
+	// SendReply posts body as a reply to msg and returns a reference to the
+	// posted message.
+	SendReply(ctx context.Context, cfg map[string]any, msg *IncomingMessage, body string) (*MessageRef, error)
 }
@@ -16,6 +16,8 @@ import (
 	"github.com/opencode-ai/opencode-dog/internal/mcpmgr"
 	"github.com/opencode-ai/opencode-dog/internal/provider"
 	"github.com/opencode-ai/opencode-dog/internal/webui"
+	"github.com/opencode-ai/opencode-dog/internal/worker"
+	"github.com/opencode-ai/opencode-dog/internal/workspace"
 	"log/slog"
 	"net/http"
 	"os"
@@ -30,8 +32,11 @@ type Server struct {
 	analyzer   *analyzer.Analyzer
 	auth       *auth.Auth
 	mcpMgr     *mcpmgr.Manager
+	workers    *worker.Pool
 	logger     *slog.Logger
 	httpServer *http.Server
+
+	stopBackground context.CancelFunc
 }
 
 func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
@@ -43,11 +48,12 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 	}
 
 	registry := provider.NewRegistry(logger)
-	registry.Register(provider.NewGitLabProvider(logger))
+	registry.Register(provider.NewGitLabProvider(database, logger))
 	registry.Register(provider.NewSlackProvider(database, logger))
 	registry.Register(provider.NewTelegramProvider(database, logger))
 
-	a := analyzer.New(database, registry, logger, cfg.OpencodeConfigDir)
+	workspaces := workspace.New(database, cfg.WorkspaceDir, logger)
+	a := analyzer.New(database, registry, logger, cfg.OpencodeConfigDir, workspaces)
 	authSvc := auth.New(database, logger, cfg.JWTSecret)
 	mcpMgr := mcpmgr.New(database, logger)
 
@@ -55,6 +61,9 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 		logger.Warn("seed default admin failed", "error", err)
 	}
 
+	workers := worker.New(database, a, logger)
+	a.SetQueueNotifier(workers.Notify)
+
 	return &Server{
 		cfg:      cfg,
 		database: database,
@@ -62,6 +71,7 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 		analyzer: a,
 		auth:     authSvc,
 		mcpMgr:   mcpMgr,
+		workers:  workers,
 		logger:   logger,
 	}, nil
 }
@@ -69,7 +79,7 @@ func New(cfg *config.Config, logger *slog.Logger) (*Server, error) {
 func (s *Server) Start() error {
 	mux := http.NewServeMux()
 
-	apiHandler := api.New(s.database, s.auth, s.mcpMgr, s.logger)
+	apiHandler := api.New(s.database, s.auth, s.mcpMgr, s.analyzer, s.logger)
 	apiHandler.RegisterRoutes(mux)
 
 	s.registerWebhookRoutes(mux)
@@ -81,14 +91,22 @@ func (s *Server) Start() error {
 
 	mcpEnabled := s.database.GetSettingBool(context.Background(), "mcp_enabled", true)
 	if mcpEnabled {
-		mcpSrv := mcpserver.NewServer(s.database, s.logger)
+		mcpSrv := mcpserver.NewServer(s.database, s.analyzer, s.logger)
 		mcpEndpoint := s.database.GetSettingString(context.Background(), "mcp_endpoint", "/mcp")
-		mux.Handle(mcpEndpoint, newMCPHTTPHandler(mcpSrv.GetServer()))
+		mux.Handle(mcpEndpoint, s.auth.Middleware(newMCPHTTPHandler(mcpSrv.GetServer())))
 		s.logger.Info("MCP server enabled", "endpoint", mcpEndpoint)
 	}
 
 	webui.RegisterRoutes(mux)
 
+	s.workers.Start(context.Background())
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	s.stopBackground = stopBackground
+	go s.analyzer.RunConversationCleanup(bgCtx)
+	go s.analyzer.RunOutboxDispatcher(bgCtx)
+	go s.analyzer.RunDeliveryCleanup(bgCtx)
+
 	s.httpServer = &http.Server{
 		Addr:              s.cfg.ListenAddr(),
 		Handler:           mux,
@@ -127,26 +145,15 @@ func (s *Server) registerWebhookRoutes(mux *http.ServeMux) {
 	}
 
 	for _, pc := range configs {
-		p, ok := s.registry.Get(provider.ProviderType(pc.ProviderType))
-		if !ok {
-			s.logger.Warn("unknown provider type", "type", pc.ProviderType)
+		handler, err := s.analyzer.WebhookHandler(pc)
+		if err != nil {
+			s.logger.Warn("webhook route not registered", "path", pc.WebhookPath, "error", err)
 			continue
 		}
 
-		cfgMap := pc.ConfigMap()
-		path := pc.WebhookPath
-		cfgID := pc.ID
-		projectID := pc.ProjectID
-
-		handler := p.BuildHandler(cfgID, pc.WebhookSecret, cfgMap, func(ctx context.Context, msg *provider.IncomingMessage) {
-			msg.ProjectID = projectID
-			msg.ProviderCfgID = cfgID
-			s.analyzer.HandleMessage(ctx, msg)
-		})
-
-		mux.Handle(path, handler)
+		mux.Handle(pc.WebhookPath, handler)
 		s.logger.Info("webhook route registered",
-			"path", path,
+			"path", pc.WebhookPath,
 			"provider", pc.ProviderType,
 			"project", pc.ProjectID,
 		)
@@ -159,18 +166,11 @@ func (s *Server) registerWebhookRoutes(mux *http.ServeMux) {
 			return
 		}
 
-		p, ok := s.registry.Get(provider.ProviderType(pc.ProviderType))
-		if !ok {
+		handler, err := s.analyzer.WebhookHandler(pc)
+		if err != nil {
 			http.Error(w, "unknown provider", http.StatusInternalServerError)
 			return
 		}
-
-		cfgMap := pc.ConfigMap()
-		handler := p.BuildHandler(pc.ID, pc.WebhookSecret, cfgMap, func(ctx context.Context, msg *provider.IncomingMessage) {
-			msg.ProjectID = pc.ProjectID
-			msg.ProviderCfgID = pc.ID
-			s.analyzer.HandleMessage(ctx, msg)
-		})
 		handler.ServeHTTP(w, r)
 	})
 }
@@ -179,9 +179,13 @@ func (s *Server) shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 	defer cancel()
 	s.logger.Info("shutting down server...")
+	s.stopBackground()
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("server shutdown: %w", err)
 	}
+	if err := s.workers.Stop(ctx); err != nil {
+		s.logger.Warn("worker pool did not drain before shutdown", "error", err)
+	}
 	s.database.Close()
 	s.logger.Info("server stopped")
 	return nil
@@ -0,0 +1,267 @@
+// Package worker runs queued analysis tasks with bounded concurrency.
+//
+// Webhook handlers only persist a pending task row. The Pool claims pending
+// rows from the database and hands each one to a Processor. Concurrency is
+// capped globally by the number of workers and per project by the claim query,
+// so a burst of messages can never start more OpenCode sessions than
+// configured, and queued work survives a process restart.
+//
+// Every claimed task holds a lease that the running worker renews as a
+// heartbeat. A recovery loop, run at startup and then periodically, detects
+// processing tasks whose lease expired (their worker crashed or was
+// redeployed) and either re-queues them or, once they have used up their
+// attempts, fails them and lets the Processor notify the original channel.
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+// Processor runs tasks claimed by the pool.
+type Processor interface {
+	// ProcessTask handles a task that has already been claimed (status processing).
+	ProcessTask(ctx context.Context, task *db.Task)
+	// AbandonTask is called for a task that was orphaned too many times and has
+	// been marked failed, so the originating channel can be told.
+	AbandonTask(ctx context.Context, task *db.Task)
+}
+
+type Pool struct {
+	database  db.Store
+	processor Processor
+	logger    *slog.Logger
+
+	wake chan struct{}
+	wg   sync.WaitGroup
+
+	stopClaiming context.CancelFunc
+	abortRunning context.CancelFunc
+}
+
+func New(database db.Store, processor Processor, logger *slog.Logger) *Pool {
+	return &Pool{
+		database:  database,
+		processor: processor,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+type poolSettings struct {
+	concurrency      int
+	projectLimit     int
+	pollInterval     time.Duration
+	lease            time.Duration
+	recoveryInterval time.Duration
+	maxAttempts      int
+}
+
+func (p *Pool) loadSettings(ctx context.Context) poolSettings {
+	st := poolSettings{
+		concurrency:      p.database.GetSettingInt(ctx, "worker_concurrency", 4),
+		projectLimit:     p.database.GetSettingInt(ctx, "worker_project_concurrency", 2),
+		pollInterval:     p.database.GetSettingDuration(ctx, "worker_poll_interval", 2*time.Second),
+		lease:            p.database.GetSettingDuration(ctx, "worker_task_lease", 2*time.Minute),
+		recoveryInterval: p.database.GetSettingDuration(ctx, "worker_recovery_interval", time.Minute),
+		maxAttempts:      p.database.GetSettingInt(ctx, "worker_max_attempts", 3),
+	}
+	if st.concurrency < 1 {
+		st.concurrency = 1
+	}
+	if st.maxAttempts < 1 {
+		st.maxAttempts = 1
+	}
+	return st
+}
+
+// Start recovers orphaned tasks and launches the workers. Settings are read
+// once at startup: worker_concurrency (global cap), worker_project_concurrency
+// (per-project cap), worker_poll_interval (how often idle workers re-check the
+// queue), worker_task_lease (heartbeat lease length), worker_recovery_interval
+// and worker_max_attempts.
+func (p *Pool) Start(ctx context.Context) {
+	st := p.loadSettings(ctx)
+
+	claimCtx, stopClaiming := context.WithCancel(context.Background())
+	runCtx, abortRunning := context.WithCancel(context.Background())
+	p.stopClaiming = stopClaiming
+	p.abortRunning = abortRunning
+
+	p.recover(ctx, st.maxAttempts)
+
+	for i := 0; i < st.concurrency; i++ {
+		p.wg.Add(1)
+		go p.run(claimCtx, runCtx, st)
+	}
+	p.wg.Add(1)
+	go p.recoverLoop(claimCtx, st)
+
+	p.logger.Info("worker pool started",
+		"concurrency", st.concurrency,
+		"project_concurrency", st.projectLimit,
+		"poll_interval", st.pollInterval.String(),
+		"lease", st.lease.String(),
+		"max_attempts", st.maxAttempts,
+	)
+}
+
+// Notify wakes an idle worker so a freshly enqueued task is picked up without
+// waiting for the next poll. It never blocks.
+func (p *Pool) Notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop stops claiming new tasks and waits for in-flight tasks to finish. If ctx
+// expires first, running handlers are cancelled and ctx.Err() is returned; the
+// tasks they held are picked up again by recovery once their lease expires.
+func (p *Pool) Stop(ctx context.Context) error {
+	if p.stopClaiming == nil {
+		return nil
+	}
+	p.stopClaiming()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.abortRunning()
+		return nil
+	case <-ctx.Done():
+		p.abortRunning()
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) run(claimCtx, runCtx context.Context, st poolSettings) {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-claimCtx.Done():
+			return
+		case <-p.wake:
+		case <-timer.C:
+		}
+
+		for claimCtx.Err() == nil {
+			task, err := p.database.ClaimNextTask(claimCtx, st.projectLimit, st.lease)
+			if err != nil {
+				if claimCtx.Err() == nil {
+					p.logger.Error("claim task failed", "error", err)
+				}
+				break
+			}
+			if task == nil {
+				break
+			}
+			// Another task may be waiting behind this one; hand the wake-up on
+			// so bursts fan out across idle workers.
+			p.Notify()
+			p.process(runCtx, task, st.lease)
+		}
+
+		timer.Reset(st.pollInterval)
+	}
+}
+
+// process runs one task while renewing its lease in the background. If the
+// heartbeat finds the task is no longer processing under this attempt (it was
+// cancelled, possibly from another instance, or claimed again after its lease
+// expired), the task's context is cancelled.
+func (p *Pool) process(ctx context.Context, task *db.Task, lease time.Duration) {
+	taskCtx, cancelTask := context.WithCancel(ctx)
+	defer cancelTask()
+
+	hbCtx, stopHeartbeat := context.WithCancel(taskCtx)
+	var hb sync.WaitGroup
+	hb.Add(1)
+	go func() {
+		defer hb.Done()
+		p.heartbeat(hbCtx, task, lease, cancelTask)
+	}()
+
+	p.processor.ProcessTask(taskCtx, task)
+
+	stopHeartbeat()
+	hb.Wait()
+}
+
+func (p *Pool) heartbeat(ctx context.Context, task *db.Task, lease time.Duration, cancelTask context.CancelFunc) {
+	interval := lease / 3
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			active, err := p.database.RenewTaskLease(ctx, task.ID, task.Attempts, lease)
+			if err != nil {
+				if ctx.Err() == nil {
+					p.logger.Warn("renew task lease failed", "task_id", task.ID, "error", err)
+				}
+				continue
+			}
+			if !active {
+				p.logger.Info("task no longer processing, stopping it", "task_id", task.ID, "attempt", task.Attempts)
+				cancelTask()
+				return
+			}
+		}
+	}
+}
+
+func (p *Pool) recoverLoop(ctx context.Context, st poolSettings) {
+	defer p.wg.Done()
+	if st.recoveryInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(st.recoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.recover(ctx, st.maxAttempts)
+		}
+	}
+}
+
+// recover re-queues orphaned tasks and reports the ones that exhausted their
+// attempts to the processor.
+func (p *Pool) recover(ctx context.Context, maxAttempts int) {
+	requeued, failed, err := p.database.RecoverStaleTasks(ctx, maxAttempts, "task interrupted: worker stopped while processing")
+	if err != nil {
+		if ctx.Err() == nil {
+			p.logger.Error("recover stale tasks failed", "error", err)
+		}
+		return
+	}
+	if requeued > 0 {
+		p.logger.Warn("re-queued orphaned tasks", "count", requeued)
+		p.Notify()
+	}
+	for _, t := range failed {
+		p.logger.Warn("abandoned orphaned task", "task_id", t.ID, "attempts", t.Attempts)
+		p.processor.AbandonTask(ctx, t)
+	}
+}
@@ -0,0 +1,346 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+)
+
+func strPtr(s string) *string { return &s }
+
+// funcProcessor adapts plain functions to the Processor interface.
+type funcProcessor struct {
+	process func(ctx context.Context, task *db.Task)
+	abandon func(ctx context.Context, task *db.Task)
+}
+
+func (f funcProcessor) ProcessTask(ctx context.Context, task *db.Task) { f.process(ctx, task) }
+func (f funcProcessor) AbandonTask(ctx context.Context, task *db.Task) {
+	if f.abandon != nil {
+		f.abandon(ctx, task)
+	}
+}
+
+func processWith(fn func(ctx context.Context, task *db.Task)) Processor {
+	return funcProcessor{process: fn}
+}
+
+func newStore(t *testing.T, settings map[string]any) *dbmock.Store {
+	t.Helper()
+	store := dbmock.New()
+	for k, v := range settings {
+		b, _ := json.Marshal(v)
+		_ = store.SetSetting(context.Background(), k, b)
+	}
+	return store
+}
+
+func enqueue(t *testing.T, store *dbmock.Store, projectID string) *db.Task {
+	t.Helper()
+	task := &db.Task{ProjectID: strPtr(projectID), ProviderType: "gitlab"}
+	if err := store.CreateTask(context.Background(), task); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	return task
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met before deadline")
+}
+
+func TestPool_ProcessesQueuedTasks(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 2, "worker_poll_interval": "10ms"})
+	for i := 0; i < 5; i++ {
+		enqueue(t, store, "p1")
+	}
+
+	var handled atomic.Int32
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		if task.Status != db.TaskStatusProcessing {
+			t.Errorf("handler got status %q, want processing", task.Status)
+		}
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+		handled.Add(1)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	waitFor(t, func() bool { return handled.Load() == 5 })
+}
+
+func TestPool_RespectsProjectConcurrency(t *testing.T) {
+	store := newStore(t, map[string]any{
+		"worker_concurrency":         4,
+		"worker_project_concurrency": 1,
+		"worker_poll_interval":       "10ms",
+	})
+	for i := 0; i < 4; i++ {
+		enqueue(t, store, "p1")
+	}
+
+	var mu sync.Mutex
+	running, peak, done := 0, 0, 0
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		done++
+		mu.Unlock()
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return done == 4
+	})
+	if peak != 1 {
+		t.Fatalf("peak concurrency for one project = %d, want 1", peak)
+	}
+}
+
+func TestPool_RunsThreadTasksOneAtATime(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 4, "worker_poll_interval": "10ms"})
+	var thread []string
+	for i := 0; i < 3; i++ {
+		task := &db.Task{ProjectID: strPtr("p1"), ProviderConfigID: strPtr("cfg-1"), ProviderType: "gitlab", ThreadKey: "gitlab:1:issue:2"}
+		_ = store.CreateTask(context.Background(), task)
+		thread = append(thread, task.ID)
+	}
+	other := &db.Task{ProjectID: strPtr("p1"), ProviderConfigID: strPtr("cfg-1"), ProviderType: "gitlab", ThreadKey: "gitlab:1:issue:3"}
+	_ = store.CreateTask(context.Background(), other)
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var order []string
+	otherRan := make(chan struct{})
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		if task.ID == other.ID {
+			close(otherRan)
+			_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+			return
+		}
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		order = append(order, task.ID)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	select {
+	case <-otherRan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a task of another thread was held up")
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order) == 3 && running == 0
+	})
+	if peak != 1 {
+		t.Fatalf("peak concurrency for one thread = %d, want 1", peak)
+	}
+	for i, id := range thread {
+		if order[i] != id {
+			t.Fatalf("thread tasks ran in order %v, want %v", order, thread)
+		}
+	}
+}
+
+func TestPool_NotifyWakesIdleWorker(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 1, "worker_poll_interval": "1h"})
+
+	var handled atomic.Int32
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+		handled.Add(1)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	// Let the initial poll find an empty queue before enqueueing.
+	time.Sleep(20 * time.Millisecond)
+	enqueue(t, store, "p1")
+	pool.Notify()
+
+	waitFor(t, func() bool { return handled.Load() == 1 })
+}
+
+func TestPool_StopCancelsRunningAfterDeadline(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 1, "worker_poll_interval": "10ms"})
+	enqueue(t, store, "p1")
+
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	pool := New(store, processWith(func(ctx context.Context, _ *db.Task) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Stop(ctx); err == nil {
+		t.Fatal("expected deadline error from Stop")
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("running handler was not cancelled")
+	}
+}
+
+func TestPool_StopWithoutStart(t *testing.T) {
+	pool := New(dbmock.New(), processWith(func(context.Context, *db.Task) {}), slog.Default())
+	if err := pool.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop() = %v, want nil", err)
+	}
+}
+
+func TestPool_StartRequeuesOrphanedTask(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 1, "worker_poll_interval": "10ms", "worker_max_attempts": 3})
+	orphan := enqueue(t, store, "p1")
+	expired := time.Now().Add(-time.Minute)
+	orphan.Status = db.TaskStatusProcessing
+	orphan.Attempts = 1
+	orphan.LeaseExpiresAt = &expired
+
+	var attempts atomic.Int32
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		attempts.Store(int32(task.Attempts))
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	waitFor(t, func() bool { return attempts.Load() == 2 })
+}
+
+func TestPool_StartAbandonsExhaustedTask(t *testing.T) {
+	store := newStore(t, map[string]any{"worker_concurrency": 1, "worker_poll_interval": "1h", "worker_max_attempts": 2})
+	orphan := enqueue(t, store, "p1")
+	orphan.Status = db.TaskStatusProcessing
+	orphan.Attempts = 2
+
+	var abandoned []*db.Task
+	pool := New(store, funcProcessor{
+		process: func(context.Context, *db.Task) { t.Error("exhausted task must not be processed again") },
+		abandon: func(_ context.Context, task *db.Task) { abandoned = append(abandoned, task) },
+	}, slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	if len(abandoned) != 1 || abandoned[0].ID != orphan.ID {
+		t.Fatalf("abandoned = %v, want [%s]", abandoned, orphan.ID)
+	}
+	if orphan.Status != db.TaskStatusFailed || orphan.ErrorMessage == nil {
+		t.Fatalf("orphan status = %q, error = %v; want failed with message", orphan.Status, orphan.ErrorMessage)
+	}
+}
+
+// renewCounter records heartbeat calls on top of the in-memory store.
+type renewCounter struct {
+	*dbmock.Store
+	renewals atomic.Int32
+}
+
+func (r *renewCounter) RenewTaskLease(ctx context.Context, taskID string, attempt int, lease time.Duration) (bool, error) {
+	r.renewals.Add(1)
+	return r.Store.RenewTaskLease(ctx, taskID, attempt, lease)
+}
+
+func TestPool_HeartbeatRenewsLease(t *testing.T) {
+	store := &renewCounter{Store: newStore(t, map[string]any{
+		"worker_concurrency":   1,
+		"worker_poll_interval": "10ms",
+		"worker_task_lease":    "30ms",
+	})}
+	enqueue(t, store.Store, "p1")
+
+	release := make(chan struct{})
+	pool := New(store, processWith(func(ctx context.Context, task *db.Task) {
+		<-release
+		_, _ = store.UpdateTaskStatus(ctx, task.ID, task.Attempts, db.TaskStatusCompleted, nil, nil)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	waitFor(t, func() bool { return store.renewals.Load() >= 2 })
+	close(release)
+}
+
+func TestPool_HeartbeatStopsCancelledTask(t *testing.T) {
+	store := newStore(t, map[string]any{
+		"worker_concurrency":   1,
+		"worker_poll_interval": "10ms",
+		"worker_task_lease":    "30ms",
+	})
+	task := enqueue(t, store, "p1")
+
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	pool := New(store, processWith(func(ctx context.Context, _ *db.Task) {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+	}), slog.Default())
+
+	pool.Start(context.Background())
+	defer pool.Stop(context.Background())
+
+	<-started
+	if _, err := store.CancelTask(context.Background(), task.ID, "cancelled by test"); err != nil {
+		t.Fatalf("CancelTask: %v", err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("cancelled task context was not cancelled by the heartbeat")
+	}
+}
@@ -0,0 +1,92 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoChanges is returned by Publish when the worktree has nothing to commit.
+var ErrNoChanges = errors.New("no changes to publish")
+
+// Change describes a commit pushed by Publish.
+type Change struct {
+	Branch string
+	Commit string
+	// ShortStat summarizes the diff, e.g. "2 files changed, 10 insertions(+)".
+	ShortStat string
+	// Stat is git's per-file diff summary, limited to the first 20 files.
+	Stat string
+}
+
+// Changed reports whether any file in the worktree differs from the checked
+// out commit, including new untracked files.
+func (w *Workspace) Changed(ctx context.Context) (bool, error) {
+	status, err := w.git(ctx, nil, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(status) != "", nil
+}
+
+// Publish commits everything changed in the worktree to branch, starting from
+// the checked out commit, and pushes the branch to origin with the project's
+// SSH key. An existing remote branch of that name is overwritten, so a task
+// that is run again replaces its earlier push.
+func (w *Workspace) Publish(ctx context.Context, branch, message, authorName, authorEmail string) (*Change, error) {
+	if !validRef(branch) {
+		return nil, fmt.Errorf("invalid branch name %q", branch)
+	}
+	m := w.m
+	timeout := m.database.GetSettingDuration(ctx, "workspace_git_timeout", 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if _, err := w.git(ctx, nil, "add", "-A"); err != nil {
+		return nil, err
+	}
+	changed, err := w.Changed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !changed {
+		return nil, ErrNoChanges
+	}
+
+	if _, err := w.git(ctx, nil, "checkout", "-q", "-B", branch); err != nil {
+		return nil, err
+	}
+	w.branch = branch
+	if _, err := w.git(ctx, nil,
+		"-c", "user.name="+authorName, "-c", "user.email="+authorEmail, "-c", "commit.gpgsign=false",
+		"commit", "-q", "--no-verify", "-m", message); err != nil {
+		return nil, err
+	}
+
+	change := &Change{Branch: branch}
+	out, err := w.git(ctx, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	change.Commit = strings.TrimSpace(out)
+	if out, err = w.git(ctx, nil, "diff", "--shortstat", w.Commit, "HEAD"); err == nil {
+		change.ShortStat = strings.TrimSpace(out)
+	}
+	if out, err = w.git(ctx, nil, "diff", "--stat=100", "--stat-count=20", w.Commit, "HEAD"); err == nil {
+		change.Stat = strings.TrimRight(out, "\n")
+	}
+
+	env, cleanup, err := m.sshEnv(ctx, w.Project)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	if _, err := w.git(ctx, env, "push", "--force", "origin", "HEAD:refs/heads/"+branch); err != nil {
+		return nil, fmt.Errorf("push %s: %w", branch, err)
+	}
+
+	m.logger.Info("workspace changes pushed", "project", w.Project.ID, "branch", branch, "commit", change.Commit)
+	return change, nil
+}
@@ -0,0 +1,73 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+func TestPublish_PushesBranch(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+	if err := os.WriteFile(filepath.Join(ws.Dir, "README.md"), []byte("main\nfixed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.Dir, "new.go"), []byte("package x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := ws.Publish(context.Background(), "opencode/task-1", "Fix things\n\nTask: 1\n", "OpenCode", "oc@example.com")
+	if err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if change.Branch != "opencode/task-1" || len(change.Commit) != 40 {
+		t.Fatalf("unexpected change: %+v", change)
+	}
+	if !strings.Contains(change.ShortStat, "2 files changed") {
+		t.Fatalf("ShortStat = %q", change.ShortStat)
+	}
+	if !strings.Contains(change.Stat, "new.go") || !strings.Contains(change.Stat, "README.md") {
+		t.Fatalf("Stat = %q", change.Stat)
+	}
+
+	out, err := exec.Command("git", "-C", remote, "log", "-1", "--format=%H %an %s", "opencode/task-1").Output()
+	if err != nil {
+		t.Fatalf("branch not pushed: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != change.Commit+" OpenCode Fix things" {
+		t.Fatalf("remote branch head = %q", got)
+	}
+
+	ws.Release()
+	if err := exec.Command("git", "-C", ws.RepoDir, "rev-parse", "--verify", "--quiet", "refs/heads/opencode/task-1").Run(); err == nil {
+		t.Fatal("task branch left in the clone after Release")
+	}
+}
+
+func TestPublish_NoChanges(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+
+	if _, err := ws.Publish(context.Background(), "opencode/task-1", "msg", "OpenCode", "oc@example.com"); err != ErrNoChanges {
+		t.Fatalf("got %v, want ErrNoChanges", err)
+	}
+}
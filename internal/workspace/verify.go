@@ -0,0 +1,136 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// verifyEnv lists the variables passed on to verification commands. The
+// commands run code OpenCode just wrote, so the server's own environment
+// (database URL, secrets) is not handed to them.
+var verifyEnv = []string{
+	"PATH", "HOME", "LANG", "TMPDIR",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	"GOPATH", "GOCACHE", "GOMODCACHE", "GOPROXY", "GOFLAGS",
+	"NPM_CONFIG_CACHE",
+}
+
+// CheckResult is the outcome of one verification command.
+type CheckResult struct {
+	Command string
+	Passed  bool
+	// ExitCode is -1 if the command did not exit on its own (e.g. it timed
+	// out).
+	ExitCode int
+	// Output is the combined stdout and stderr, keeping only the end when
+	// it exceeds the output limit.
+	Output    string
+	Truncated bool
+	TimedOut  bool
+	Duration  time.Duration
+}
+
+// Verify runs commands one after another with sh -c in the worktree and stops
+// at the first that fails. Each command gets timeout and keeps at most limit
+// bytes of output. The worktree's changes are staged beforehand, and anything
+// the commands modify or leave behind (other than ignored files) is reverted
+// afterwards, so build output is not published with the changes.
+func (w *Workspace) Verify(ctx context.Context, commands []string, timeout time.Duration, limit int) ([]CheckResult, error) {
+	m := w.m
+	if _, err := w.git(ctx, nil, "add", "-A"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if _, err := w.git(cleanupCtx, nil, "checkout", "-q", "--", "."); err != nil {
+			m.logger.Warn("restore worktree after verification failed", "dir", w.Dir, "error", err)
+		}
+		if _, err := w.git(cleanupCtx, nil, "clean", "-fdq"); err != nil {
+			m.logger.Warn("clean worktree after verification failed", "dir", w.Dir, "error", err)
+		}
+	}()
+
+	var results []CheckResult
+	for _, command := range commands {
+		res := w.runCheck(ctx, command, timeout, limit)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		results = append(results, res)
+		m.logger.Info("verification command finished", "project", w.Project.ID, "command", command, "passed", res.Passed, "duration", res.Duration)
+		if !res.Passed {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (w *Workspace) runCheck(ctx context.Context, command string, timeout time.Duration, limit int) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	out := &tailBuffer{limit: limit}
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = w.Dir
+	cmd.Env = []string{"CI=true"}
+	for _, key := range verifyEnv {
+		if v, ok := os.LookupEnv(key); ok {
+			cmd.Env = append(cmd.Env, key+"="+v)
+		}
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	killGroup(cmd)
+	// Processes that left the group may still hold the output pipe open.
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	err := cmd.Run()
+	output := out.String()
+	res := CheckResult{
+		Command:   command,
+		Passed:    err == nil,
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Output:    output,
+		Truncated: out.truncated,
+		Duration:  time.Since(start).Round(100 * time.Millisecond),
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		res.TimedOut = true
+		res.Passed = false
+	} else if err != nil && res.ExitCode == -1 {
+		res.Output += fmt.Sprintf("\n%v", err)
+	}
+	return res
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	limit     int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if b.limit > 0 && len(b.buf) > 2*b.limit {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.limit:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	s := b.buf
+	if b.limit > 0 && len(s) > b.limit {
+		s = s[len(s)-b.limit:]
+		b.truncated = true
+	}
+	return strings.ToValidUTF8(string(s), "")
+}
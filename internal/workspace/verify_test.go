@@ -0,0 +1,105 @@
+package workspace
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+func TestVerify_StopsAtFirstFailure(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+	if err := os.WriteFile(filepath.Join(ws.Dir, "new.txt"), []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ws.Verify(context.Background(), []string{
+		"cat new.txt && echo junk > build.out && echo changed > README.md",
+		"echo boom >&2; exit 3",
+		"echo unreachable",
+	}, time.Minute, 1000)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if !results[0].Passed || results[0].Output != "new\n" {
+		t.Fatalf("first result = %+v", results[0])
+	}
+	if results[1].Passed || results[1].ExitCode != 3 || results[1].Output != "boom\n" {
+		t.Fatalf("second result = %+v", results[1])
+	}
+
+	// The command's side effects are reverted; the change under test stays.
+	if _, err := os.Stat(filepath.Join(ws.Dir, "build.out")); !os.IsNotExist(err) {
+		t.Fatalf("build.out left behind: %v", err)
+	}
+	if got := readFile(t, filepath.Join(ws.Dir, "README.md")); got != "main\n" {
+		t.Fatalf("README.md = %q", got)
+	}
+	if got := readFile(t, filepath.Join(ws.Dir, "new.txt")); got != "new\n" {
+		t.Fatalf("new.txt = %q", got)
+	}
+}
+
+func TestVerify_TimeoutAndOutputLimit(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+
+	results, err := ws.Verify(context.Background(), []string{"i=0; while [ $i -lt 500 ]; do echo line $i; i=$((i+1)); done"}, time.Minute, 100)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r := results[0]; !r.Passed || !r.Truncated || len(r.Output) != 100 || !strings.HasSuffix(r.Output, "line 499\n") {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	results, err = ws.Verify(context.Background(), []string{"sleep 10"}, 200*time.Millisecond, 100)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r := results[0]; r.Passed || !r.TimedOut {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+}
+
+func TestVerify_DoesNotLeakEnvironment(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+	t.Setenv("DATABASE_URL", "postgres://secret")
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+
+	results, err := ws.Verify(context.Background(), []string{`echo "[$DATABASE_URL][$CI]"`}, time.Minute, 100)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got := results[0].Output; got != "[][true]\n" {
+		t.Fatalf("output = %q", got)
+	}
+}
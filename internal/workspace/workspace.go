@@ -0,0 +1,338 @@
+// Package workspace keeps git checkouts of project repositories for analysis.
+//
+// Each project is cloned once with its SSH key into <root>/<project id>/repo
+// and fetched again before every task. A task then gets its own detached
+// worktree under <root>/<project id>/tasks/<name>, so concurrent tasks of the
+// same project can look at different refs without disturbing each other. The
+// root directory must be mounted at the same path in the OpenCode server
+// container, since worktrees refer to their repository by absolute path.
+// Since the agent can write there, the SSH key is kept out of the root, and
+// git runs with hooks disabled and the clone's config reset to our own.
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+)
+
+// ErrNoRepository is returned for projects without a repository URL.
+var ErrNoRepository = errors.New("project has no repository url")
+
+// ErrNoKnownHosts is returned for projects with an SSH key while the
+// workspace_ssh_known_hosts setting is empty: ssh would reject every host.
+var ErrNoKnownHosts = errors.New("setting workspace_ssh_known_hosts is empty: add the git server's host keys (e.g. from ssh-keyscan) to clone over SSH")
+
+type Manager struct {
+	database db.Store
+	root     string
+	logger   *slog.Logger
+
+	// locks serializes git operations per project: clone, fetch and worktree
+	// bookkeeping all write to the shared repository.
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func New(database db.Store, root string, logger *slog.Logger) *Manager {
+	return &Manager{database: database, root: root, logger: logger, locks: make(map[string]*sync.Mutex)}
+}
+
+// Workspace is a checkout prepared for one task.
+type Workspace struct {
+	// Dir is the worktree the task runs in.
+	Dir string
+	// RepoDir is the project's main clone, which stays in place between
+	// tasks.
+	RepoDir string
+	Project *db.Project
+	Ref     string
+	// Branch is the remote branch Ref resolved to, or empty if Ref is a tag
+	// or commit.
+	Branch string
+	Commit string
+
+	// branch is the local branch Publish committed to, deleted on Release.
+	branch string
+
+	m *Manager
+}
+
+// RepoDir returns the directory of the project's main clone.
+func (m *Manager) RepoDir(projectID string) string {
+	return filepath.Join(m.root, projectID, "repo")
+}
+
+// Checkout brings the project's clone up to date and adds a worktree named
+// name with ref checked out (detached). ref may be a branch, tag or commit;
+// an empty ref means the project's default branch. The workspace_git_timeout
+// setting bounds the git commands. Call Release when done.
+func (m *Manager) Checkout(ctx context.Context, project *db.Project, ref, name string) (*Workspace, error) {
+	if project.SSHURL == "" {
+		return nil, ErrNoRepository
+	}
+	if ref == "" {
+		ref = project.DefaultBranch
+	}
+	if !validRef(ref) {
+		return nil, fmt.Errorf("invalid ref %q", ref)
+	}
+
+	timeout := m.database.GetSettingDuration(ctx, "workspace_git_timeout", 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	env, cleanup, err := m.sshEnv(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	unlock := m.lock(project.ID)
+	defer unlock()
+
+	repo := m.RepoDir(project.ID)
+	if err := m.sync(ctx, repo, project.SSHURL, env); err != nil {
+		return nil, err
+	}
+
+	commit, branch, err := m.resolve(ctx, repo, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(m.root, project.ID, "tasks", name)
+	if _, err := os.Stat(dir); err == nil {
+		// Left over from a task that did not finish cleanly.
+		m.removeWorktree(ctx, repo, dir)
+	}
+	if _, err := m.git(ctx, repo, nil, "worktree", "add", "--detach", dir, commit); err != nil {
+		return nil, fmt.Errorf("add worktree: %w", err)
+	}
+
+	m.logger.Info("workspace ready", "project", project.ID, "ref", ref, "commit", commit, "dir", dir)
+	return &Workspace{Dir: dir, RepoDir: repo, Project: project, Ref: ref, Branch: branch, Commit: commit, m: m}, nil
+}
+
+// Release removes the task's worktree and the branch it published, which
+// has been pushed. The project's clone is kept.
+func (w *Workspace) Release() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	unlock := w.m.lock(w.Project.ID)
+	defer unlock()
+	if err := w.m.resetConfig(ctx, w.RepoDir, w.Project.SSHURL); err != nil {
+		w.m.logger.Warn("reset git config failed", "dir", w.RepoDir, "error", err)
+	}
+	w.m.removeWorktree(ctx, w.RepoDir, w.Dir)
+	if w.branch != "" {
+		if _, err := w.m.git(ctx, w.RepoDir, nil, "branch", "-q", "-D", w.branch); err != nil {
+			w.m.logger.Warn("delete task branch failed", "branch", w.branch, "error", err)
+		}
+		w.branch = ""
+	}
+}
+
+// git runs git in the worktree once the clone's config, which the agent may
+// have edited while the task ran, is reset.
+func (w *Workspace) git(ctx context.Context, env []string, args ...string) (string, error) {
+	if err := w.m.resetConfig(ctx, w.RepoDir, w.Project.SSHURL); err != nil {
+		return "", err
+	}
+	return w.m.git(ctx, w.Dir, env, args...)
+}
+
+// sync clones the repository into repo, or fetches it if already cloned.
+func (m *Manager) sync(ctx context.Context, repo, url string, env []string) error {
+	if _, err := os.Stat(filepath.Join(repo, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(repo), 0o755); err != nil {
+			return fmt.Errorf("create workspace dir: %w", err)
+		}
+		_ = os.RemoveAll(repo)
+		if _, err := m.git(ctx, "", env, "clone", "--no-checkout", "--", url, repo); err != nil {
+			return fmt.Errorf("clone %s: %w", url, err)
+		}
+		return nil
+	}
+
+	// This also picks up the project's URL if it was edited since the clone.
+	if err := m.resetConfig(ctx, repo, url); err != nil {
+		return err
+	}
+	if _, err := m.git(ctx, repo, env, "fetch", "--prune", "--tags", "--force", "origin"); err != nil {
+		return fmt.Errorf("fetch %s: %w", url, err)
+	}
+	return nil
+}
+
+// resolve turns ref into a commit hash, preferring the remote branch of that
+// name over tags and commits. branch is ref if it named a branch.
+func (m *Manager) resolve(ctx context.Context, repo, ref string) (commit, branch string, err error) {
+	out, err := m.git(ctx, repo, nil, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref+"^{commit}")
+	if err == nil {
+		return strings.TrimSpace(out), ref, nil
+	}
+	out, err = m.git(ctx, repo, nil, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err == nil {
+		return strings.TrimSpace(out), "", nil
+	}
+	return "", "", fmt.Errorf("unknown ref %q", ref)
+}
+
+// validRef rejects refs git would not accept as a name, in particular ones
+// that could be taken for a command-line option.
+func validRef(ref string) bool {
+	if ref == "" || strings.HasPrefix(ref, "-") || strings.Contains(ref, "..") || strings.Contains(ref, "@{") {
+		return false
+	}
+	for _, r := range ref {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("~^:?*[\\", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Manager) removeWorktree(ctx context.Context, repo, dir string) {
+	if _, err := m.git(ctx, repo, nil, "worktree", "remove", "--force", dir); err != nil {
+		m.logger.Warn("remove worktree failed, deleting directory", "dir", dir, "error", err)
+		_ = os.RemoveAll(dir)
+		_, _ = m.git(ctx, repo, nil, "worktree", "prune")
+	}
+}
+
+// sshEnv returns the environment that makes git use the project's SSH key and
+// accept only the host keys of the workspace_ssh_known_hosts setting. The key
+// and known_hosts file are written to a private temporary directory, outside
+// the root shared with the OpenCode container; the returned func deletes it.
+func (m *Manager) sshEnv(ctx context.Context, project *db.Project) ([]string, func(), error) {
+	if project.SSHKeyID == nil || *project.SSHKeyID == "" {
+		return nil, func() {}, nil
+	}
+	hosts := m.database.GetSettingString(ctx, "workspace_ssh_known_hosts", "")
+	if strings.TrimSpace(hosts) == "" {
+		return nil, nil, ErrNoKnownHosts
+	}
+	key, err := m.database.GetSSHKey(ctx, *project.SSHKeyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get ssh key: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "opencode-dog-ssh-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("write ssh key: %w", err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	keyFile := filepath.Join(dir, "id")
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(keyFile, []byte(withNewline(key.PrivateKey)), 0o600); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("write ssh key: %w", err)
+	}
+	if err := os.WriteFile(knownHosts, []byte(withNewline(hosts)), 0o600); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("write known_hosts: %w", err)
+	}
+
+	sshCmd := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s",
+		keyFile, knownHosts)
+	return []string{"GIT_SSH_COMMAND=" + sshCmd}, cleanup, nil
+}
+
+func withNewline(s string) string {
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return s
+}
+
+// gitConfigArgs disable what git could be made to run from configuration:
+// hooks and the file system monitor. The system and global config are not
+// read either; the repository's own is rewritten by resetConfig.
+var gitConfigArgs = []string{"-c", "core.hooksPath=/dev/null", "-c", "core.fsmonitor=false"}
+
+func (m *Manager) git(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append(append([]string(nil), gitConfigArgs...), args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL=/dev/null")
+	cmd.Env = append(cmd.Env, env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// gitExtensions are the repository extensions a clone may have been created
+// with, and their possible values.
+var gitExtensions = map[string][]string{
+	"objectformat": {"sha1", "sha256"},
+	"refstorage":   {"files", "reftable"},
+}
+
+// resetConfig replaces the config of the clone in repo with one of our own,
+// keeping only the repository format and the origin remote, url. The clone
+// is in the root shared with the OpenCode container, so the agent can edit
+// its config, and settings such as filters, core.sshCommand or
+// diff.external would run commands in this container.
+func (m *Manager) resetConfig(ctx context.Context, repo, url string) error {
+	if strings.ContainsAny(url, "\n\r\x00") {
+		return fmt.Errorf("invalid repository url %q", url)
+	}
+	path := filepath.Join(repo, ".git", "config")
+
+	var b strings.Builder
+	b.WriteString("[core]\n")
+	format := "0"
+	var extensions []string
+	for ext, values := range gitExtensions {
+		out, _ := m.git(ctx, "", nil, "config", "--file", path, "--get", "extensions."+ext)
+		if v := strings.TrimSpace(out); slices.Contains(values, v) {
+			format = "1"
+			extensions = append(extensions, fmt.Sprintf("\t%s = %s\n", ext, v))
+		}
+	}
+	slices.Sort(extensions)
+	fmt.Fprintf(&b, "\trepositoryformatversion = %s\n\tfilemode = true\n\tbare = false\n\tlogallrefupdates = true\n", format)
+	if len(extensions) > 0 {
+		b.WriteString("[extensions]\n" + strings.Join(extensions, ""))
+	}
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(url)
+	fmt.Fprintf(&b, "[remote \"origin\"]\n\turl = \"%s\"\n\tfetch = +refs/heads/*:refs/remotes/origin/*\n", quoted)
+
+	tmp := path + ".reset"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("write git config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write git config: %w", err)
+	}
+	return nil
+}
+
+func (m *Manager) lock(projectID string) func() {
+	m.mu.Lock()
+	l, ok := m.locks[projectID]
+	if !ok {
+		l = &sync.Mutex{}
+		m.locks[projectID] = l
+	}
+	m.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
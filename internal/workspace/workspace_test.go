@@ -0,0 +1,273 @@
+package workspace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode-ai/opencode-dog/internal/db"
+	"github.com/opencode-ai/opencode-dog/internal/db/dbmock"
+)
+
+// newRemote creates a repository with a commit on main and one on a feature
+// branch, and returns its path for use as a clone URL.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("init", "-q", "-b", "main")
+	write("README.md", "main\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "initial")
+	run("checkout", "-q", "-b", "feature")
+	write("README.md", "feature\n")
+	run("commit", "-q", "-am", "feature")
+	run("checkout", "-q", "main")
+	return dir
+}
+
+func newManager(t *testing.T) *Manager {
+	return New(dbmock.New(), t.TempDir(), slog.Default())
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCheckout_DefaultBranch(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if ws.Ref != "main" || ws.Branch != "main" || len(ws.Commit) != 40 {
+		t.Fatalf("unexpected workspace: %+v", ws)
+	}
+	if got := readFile(t, filepath.Join(ws.Dir, "README.md")); got != "main\n" {
+		t.Fatalf("README.md = %q", got)
+	}
+	if ws.RepoDir != m.RepoDir("p1") {
+		t.Fatalf("RepoDir = %q", ws.RepoDir)
+	}
+
+	ws.Release()
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Fatalf("worktree still present after Release: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(ws.RepoDir, ".git")); err != nil {
+		t.Fatalf("project clone removed: %v", err)
+	}
+}
+
+func TestCheckout_ConcurrentRefsAndFetch(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	a, err := m.Checkout(context.Background(), project, "", "task-a")
+	if err != nil {
+		t.Fatalf("Checkout main: %v", err)
+	}
+	defer a.Release()
+
+	// A new commit on the remote must be picked up by the next checkout.
+	cmd := exec.Command("git", "-c", "user.name=test", "-c", "user.email=test@example.com",
+		"commit", "-q", "--allow-empty", "-m", "later")
+	cmd.Dir = remote
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("commit: %v\n%s", err, out)
+	}
+
+	b, err := m.Checkout(context.Background(), project, "feature", "task-b")
+	if err != nil {
+		t.Fatalf("Checkout feature: %v", err)
+	}
+	defer b.Release()
+	if got := readFile(t, filepath.Join(b.Dir, "README.md")); got != "feature\n" {
+		t.Fatalf("feature README.md = %q", got)
+	}
+	if got := readFile(t, filepath.Join(a.Dir, "README.md")); got != "main\n" {
+		t.Fatalf("first worktree disturbed: %q", got)
+	}
+
+	c, err := m.Checkout(context.Background(), project, "main", "task-c")
+	if err != nil {
+		t.Fatalf("Checkout main again: %v", err)
+	}
+	defer c.Release()
+	if c.Commit == a.Commit {
+		t.Fatal("checkout did not fetch the new commit")
+	}
+}
+
+func TestCheckout_UnknownRef(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	_, err := m.Checkout(context.Background(), project, "no-such-branch", "task-1")
+	if err == nil || !strings.Contains(err.Error(), "unknown ref") {
+		t.Fatalf("expected unknown ref error, got %v", err)
+	}
+}
+
+func TestCheckout_NoRepository(t *testing.T) {
+	m := newManager(t)
+	if _, err := m.Checkout(context.Background(), &db.Project{ID: "p1"}, "", "task-1"); err != ErrNoRepository {
+		t.Fatalf("got %v, want ErrNoRepository", err)
+	}
+}
+
+func TestSSHEnv_WritesKeyFile(t *testing.T) {
+	store := dbmock.New()
+	key := &db.SSHKey{Name: "deploy", PrivateKey: "-----BEGIN KEY-----\nabc\n-----END KEY-----"}
+	_ = store.CreateSSHKey(context.Background(), key)
+	_ = store.SetSetting(context.Background(), "workspace_ssh_known_hosts", json.RawMessage(`"gitlab.example.com ssh-ed25519 AAAA"`))
+	root := t.TempDir()
+	m := New(store, root, slog.Default())
+
+	env, cleanup, err := m.sshEnv(context.Background(), &db.Project{ID: "p1", SSHKeyID: &key.ID})
+	if err != nil {
+		t.Fatalf("sshEnv: %v", err)
+	}
+	if len(env) != 1 || !strings.HasPrefix(env[0], "GIT_SSH_COMMAND=ssh -i ") || !strings.Contains(env[0], "StrictHostKeyChecking=yes") {
+		t.Fatalf("env = %v", env)
+	}
+	keyPath := strings.Fields(env[0])[2]
+	if strings.HasPrefix(keyPath, root) {
+		t.Fatalf("key file %s written to the shared workspace root", keyPath)
+	}
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("key file: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode = %v", info.Mode().Perm())
+	}
+	if got := readFile(t, keyPath); !strings.HasSuffix(got, "-----END KEY-----\n") {
+		t.Fatalf("key file content = %q", got)
+	}
+	knownHosts := strings.TrimPrefix(env[0][strings.Index(env[0], "UserKnownHostsFile="):], "UserKnownHostsFile=")
+	if got := readFile(t, knownHosts); got != "gitlab.example.com ssh-ed25519 AAAA\n" {
+		t.Fatalf("known_hosts = %q", got)
+	}
+
+	cleanup()
+	if _, err := os.Stat(filepath.Dir(keyPath)); !os.IsNotExist(err) {
+		t.Fatal("key directory not removed")
+	}
+}
+
+func TestCheckout_SSHKeyWithoutKnownHosts(t *testing.T) {
+	remote := newRemote(t)
+	store := dbmock.New()
+	key := &db.SSHKey{Name: "deploy", PrivateKey: "-----BEGIN KEY-----\nabc\n-----END KEY-----"}
+	_ = store.CreateSSHKey(context.Background(), key)
+	m := New(store, t.TempDir(), slog.Default())
+	project := &db.Project{ID: "p1", SSHURL: remote, SSHKeyID: &key.ID, DefaultBranch: "main"}
+
+	_, err := m.Checkout(context.Background(), project, "", "task-1")
+	if !errors.Is(err, ErrNoKnownHosts) || !strings.Contains(err.Error(), "workspace_ssh_known_hosts") {
+		t.Fatalf("got %v, want ErrNoKnownHosts", err)
+	}
+	if _, err := os.Stat(m.RepoDir("p1")); !os.IsNotExist(err) {
+		t.Fatal("git ran without known hosts")
+	}
+}
+
+func TestCheckout_URLIsNotAnOption(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	m := newManager(t)
+	url := "--upload-pack=touch " + filepath.Join(t.TempDir(), "ran")
+	project := &db.Project{ID: "p1", SSHURL: url, DefaultBranch: "main"}
+
+	_, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err == nil || !strings.Contains(err.Error(), "repository '"+url+"' does not exist") {
+		t.Fatalf("expected the URL to be taken as a repository, got %v", err)
+	}
+}
+
+func TestWorkspace_IgnoresAgentGitConfig(t *testing.T) {
+	remote := newRemote(t)
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: remote, DefaultBranch: "main"}
+
+	ws, err := m.Checkout(context.Background(), project, "", "task-1")
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	defer ws.Release()
+
+	// What an agent with write access to the worktree and clone could do.
+	marker := filepath.Join(t.TempDir(), "pwned")
+	hook := []byte("#!/bin/sh\ntouch " + marker + "\n")
+	hooks := filepath.Join(ws.RepoDir, ".git", "hooks")
+	for _, name := range []string{"post-checkout", "pre-commit", "pre-push", "reference-transaction"} {
+		if err := os.WriteFile(filepath.Join(hooks, name), hook, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := os.OpenFile(filepath.Join(ws.RepoDir, ".git", "config"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintf(config, "[core]\n\thooksPath = %s\n\tfsmonitor = touch %s\n[filter \"x\"]\n\tclean = touch %s\n", hooks, marker, marker)
+	config.Close()
+	if err := os.WriteFile(filepath.Join(ws.Dir, ".gitattributes"), []byte("* filter=x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ws.Publish(context.Background(), "opencode/task-1", "msg", "OpenCode", "oc@example.com"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatal("git ran a command from the agent's config or hooks")
+	}
+	if got := readFile(t, filepath.Join(ws.RepoDir, ".git", "config")); strings.Contains(got, "filter") || !strings.Contains(got, remote) {
+		t.Fatalf("config not reset:\n%s", got)
+	}
+}
+
+func TestCheckout_InvalidRef(t *testing.T) {
+	m := newManager(t)
+	project := &db.Project{ID: "p1", SSHURL: "/nonexistent", DefaultBranch: "main"}
+	for _, ref := range []string{"--upload-pack=touch /tmp/x", "a..b", "main~1", "has space", "x@{1}"} {
+		if _, err := m.Checkout(context.Background(), project, ref, "task-1"); err == nil || !strings.Contains(err.Error(), "invalid ref") {
+			t.Errorf("ref %q: got %v, want invalid ref error", ref, err)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS reply_meta JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_tasks_pending_queue ON tasks(created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_tasks_project_processing ON tasks(project_id) WHERE status = 'processing';
+
+INSERT INTO settings (key, value) VALUES
+    ('worker_concurrency', '4'),
+    ('worker_project_concurrency', '2'),
+    ('worker_poll_interval', '"2s"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,11 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_tasks_processing_lease ON tasks(lease_expires_at) WHERE status = 'processing';
+
+INSERT INTO settings (key, value) VALUES
+    ('worker_task_lease', '"2m"'),
+    ('worker_recovery_interval', '"1m"'),
+    ('worker_max_attempts', '3'),
+    ('analyzer_interrupted_message', '"The task was interrupted %d time(s) by a restart or crash and has been abandoned. Please post your request again."')
+ON CONFLICT (key) DO NOTHING;
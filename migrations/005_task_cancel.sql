@@ -0,0 +1,3 @@
+INSERT INTO settings (key, value) VALUES
+    ('analyzer_cancel_template', '"🛑 **OpenCode** request cancelled by %s."')
+ON CONFLICT (key) DO NOTHING;
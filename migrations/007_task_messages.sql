@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS task_messages (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id       UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    direction     TEXT NOT NULL,
+    kind          TEXT NOT NULL,
+    provider_type TEXT NOT NULL,
+    external_id   TEXT NOT NULL DEFAULT '',
+    channel       TEXT NOT NULL DEFAULT '',
+    url           TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_messages_task ON task_messages(task_id, created_at);
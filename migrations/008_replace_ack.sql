@@ -0,0 +1,3 @@
+INSERT INTO settings (key, value) VALUES
+    ('analyzer_replace_ack', 'true')
+ON CONFLICT (key) DO NOTHING;
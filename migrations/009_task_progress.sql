@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS task_events (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id    UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    kind       TEXT NOT NULL,
+    message    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_events_task ON task_events(task_id, created_at);
+
+INSERT INTO settings (key, value) VALUES
+    ('analyzer_progress_interval', '"10s"'),
+    ('gitlab_progress_interval', '"15s"'),
+    ('slack_progress_interval', '"3s"'),
+    ('telegram_progress_interval', '"5s"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,19 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS thread_key TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider_config_id UUID NOT NULL REFERENCES provider_configs(id) ON DELETE CASCADE,
+    thread_key         TEXT NOT NULL,
+    session_id         TEXT NOT NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider_config_id, thread_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversations_last_used ON conversations(last_used_at);
+CREATE INDEX IF NOT EXISTS idx_task_messages_external ON task_messages(provider_type, channel, external_id);
+
+INSERT INTO settings (key, value) VALUES
+    ('conversation_idle_timeout', '"24h"'),
+    ('conversation_cleanup_interval', '"10m"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,8 @@
+-- Working directory of a conversation's OpenCode session (the project's
+-- clone), needed to address the session outside of a task.
+ALTER TABLE conversations ADD COLUMN IF NOT EXISTS directory TEXT NOT NULL DEFAULT '';
+
+INSERT INTO settings (key, value) VALUES
+    ('workspace_enabled', 'true'),
+    ('workspace_git_timeout', '"5m"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Branch, tag or commit a task analyzed: requested with --ref, defaulted by
+-- the provider (merge request source branch), or the project's default
+-- branch once checked out.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS ref TEXT NOT NULL DEFAULT '';
+
+-- Show the ref in replies, unless the template was customized.
+UPDATE settings
+   SET value = '"## 🤖 OpenCode Analysis\n\n%s\n\n---\n_%s mode | triggered by %s%s_"'
+ WHERE key = 'analyzer_result_template'
+   AND value = '"## 🤖 OpenCode Analysis\n\n%s\n\n---\n_%s mode | triggered by %s_"';
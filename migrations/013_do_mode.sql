@@ -0,0 +1,6 @@
+INSERT INTO settings (key, value) VALUES
+    ('prompt_do_workspace', '"Make the changes by editing the files in your working directory. Do not commit: your changes will be committed and submitted as a merge request. Finish with a short summary of what you changed."'),
+    ('do_branch_prefix', '"opencode/"'),
+    ('do_git_author_name', '"OpenCode"'),
+    ('do_git_author_email', '"opencode@localhost"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,15 @@
+-- Shell commands run in a "do" task's worktree after OpenCode's edits, e.g.
+-- ["go build ./...", "go test ./..."]. An empty list skips verification.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS verify_commands JSONB NOT NULL DEFAULT '[]';
+
+-- Outcome of the verification ('passed', 'failed', or '' if none ran) and the
+-- output of the commands, cut to verify_output_limit bytes per command.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS verify_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS verify_log TEXT NOT NULL DEFAULT '';
+
+INSERT INTO settings (key, value) VALUES
+    ('verify_timeout', '"10m"'),
+    ('verify_output_limit', '20000'),
+    ('verify_fix_rounds', '0'),
+    ('prompt_verify_fix', '"The verification command `%s` failed after your changes:\n```\n%s\n```\nFix the problem by editing the files in your working directory. Do not commit. Finish with a short summary of what you changed."')
+ON CONFLICT (key) DO NOTHING;
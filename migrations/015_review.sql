@@ -0,0 +1,6 @@
+ALTER TYPE trigger_mode ADD VALUE IF NOT EXISTS 'review';
+
+INSERT INTO settings (key, value) VALUES
+    ('prompt_review', '"You are an expert code reviewer. Review the changes of the following merge request for bugs, security problems and maintainability issues. Only report findings worth a reviewer''s comment.\n\n"'),
+    ('review_max_diff_bytes', '200000')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,21 @@
+-- Automatic analysis of failed CI jobs. Branch and job lists hold glob
+-- patterns such as "release/*"; an empty branch list means the default branch
+-- and an empty job list every job.
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS pipeline_analysis BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS pipeline_branches JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS pipeline_jobs JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS pipeline_cooldown_minutes INTEGER NOT NULL DEFAULT 60;
+
+-- When a job of a ref was last analyzed, to enforce the cooldown.
+CREATE TABLE IF NOT EXISTS pipeline_analyses (
+    project_id  UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    ref         TEXT NOT NULL,
+    job_name    TEXT NOT NULL,
+    last_run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (project_id, ref, job_name)
+);
+
+INSERT INTO settings (key, value) VALUES
+    ('prompt_pipeline', '"You are an expert software engineer. A CI job failed. Find the root cause from the job log and the code, and propose a fix.\n\n"'),
+    ('analyzer_pipeline_ack_template', '"🔍 **OpenCode** is analyzing a failed CI job.\n> %s\n\n_Analyzing..._"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,6 @@
+-- Bounds for the Slack thread history added to the prompt of a message posted
+-- in a thread.
+INSERT INTO settings (key, value) VALUES
+    ('slack_thread_history_messages', '20'),
+    ('slack_thread_history_chars', '12000')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,8 @@
+-- Files attached to a message (Slack files, Telegram photos and documents,
+-- GitLab uploads) are sent to OpenCode with the prompt when they are no larger
+-- than attachment_max_bytes (0 disables them) and their type is listed in
+-- attachment_mime_types; "image/*" allows every image type.
+INSERT INTO settings (key, value) VALUES
+    ('attachment_max_bytes', '5242880'),
+    ('attachment_mime_types', '["image/png", "image/jpeg", "image/gif", "image/webp", "text/*", "application/json", "application/pdf"]')
+ON CONFLICT (key) DO NOTHING;
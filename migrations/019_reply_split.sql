@@ -0,0 +1,6 @@
+-- Results longer than a channel's message limit are posted as numbered parts.
+-- When that takes more than reply_max_parts messages (0 never uploads), the
+-- full result is uploaded as a file instead, where the channel supports it.
+INSERT INTO settings (key, value) VALUES
+    ('reply_max_parts', '3')
+ON CONFLICT (key) DO NOTHING;
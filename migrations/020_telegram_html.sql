@@ -0,0 +1,5 @@
+-- Replies are now rendered per channel from Markdown. Telegram's legacy
+-- Markdown parse mode is no longer supported; installs still on the old
+-- default move to HTML (MarkdownV2 is the other choice).
+UPDATE settings SET value = '"HTML"'
+WHERE key = 'telegram_parse_mode' AND value = '"Markdown"';
@@ -0,0 +1,31 @@
+-- Closing replies (result, error, notice) are written to an outbox and
+-- delivered from there, so a reply the channel rejects (rate limit, outage)
+-- is retried with exponential backoff instead of being lost. parts_sent and
+-- uploaded record how far a split reply got, so a retry resumes where it
+-- stopped. Replies still failing after outbox_max_attempts are marked dead
+-- until resent from the API.
+CREATE TABLE IF NOT EXISTS reply_outbox (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id         UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    kind            TEXT NOT NULL,
+    body            TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending',
+    attempts        INT NOT NULL DEFAULT 0,
+    parts_sent      INT NOT NULL DEFAULT 0,
+    uploaded        BOOLEAN NOT NULL DEFAULT FALSE,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_reply_outbox_due ON reply_outbox(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_reply_outbox_task ON reply_outbox(task_id);
+
+INSERT INTO settings (key, value) VALUES
+    ('outbox_max_attempts', '8'),
+    ('outbox_retry_base', '"10s"'),
+    ('outbox_retry_max', '"10m"'),
+    ('outbox_poll_interval', '"5s"')
+ON CONFLICT (key) DO NOTHING;
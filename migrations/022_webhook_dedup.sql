@@ -0,0 +1,10 @@
+-- Webhook deliveries that triggered analysis are recorded by event ID so a
+-- redelivered event (Slack retries, GitLab timeouts) does not queue a second
+-- task. Records older than webhook_delivery_retention are deleted every
+-- webhook_delivery_cleanup_interval.
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created ON webhook_deliveries(created_at);
+
+INSERT INTO settings (key, value) VALUES
+    ('webhook_delivery_retention', '"168h"'),
+    ('webhook_delivery_cleanup_interval', '"1h"')
+ON CONFLICT (key) DO NOTHING;
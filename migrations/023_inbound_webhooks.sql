@@ -0,0 +1,29 @@
+-- Every request received on a webhook route is recorded with its headers
+-- (secrets redacted), body (capped at webhook_log_max_body bytes) and what
+-- came of it: rejected, ignored, no_keyword, duplicate, failed or
+-- task_created, so "nothing happened" can be explained and the request
+-- replayed. Records older than webhook_log_retention are deleted every
+-- webhook_delivery_cleanup_interval.
+CREATE TABLE IF NOT EXISTS inbound_webhooks (
+    id                 UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider_config_id UUID NOT NULL REFERENCES provider_configs(id) ON DELETE CASCADE,
+    provider_type      TEXT NOT NULL,
+    method             TEXT NOT NULL,
+    path               TEXT NOT NULL,
+    headers            JSONB NOT NULL DEFAULT '{}',
+    body               TEXT NOT NULL DEFAULT '',
+    body_truncated     BOOLEAN NOT NULL DEFAULT FALSE,
+    status_code        INT NOT NULL DEFAULT 0,
+    outcome            TEXT NOT NULL DEFAULT 'received',
+    task_id            UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    replay_of          UUID REFERENCES inbound_webhooks(id) ON DELETE SET NULL,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inbound_webhooks_created ON inbound_webhooks(created_at);
+CREATE INDEX IF NOT EXISTS idx_inbound_webhooks_config ON inbound_webhooks(provider_config_id, created_at);
+
+INSERT INTO settings (key, value) VALUES
+    ('webhook_log_max_body', '65536'),
+    ('webhook_log_retention', '"168h"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,6 @@
+-- Host keys git accepts when cloning and pushing over SSH, in known_hosts
+-- format. Unknown or changed host keys are rejected instead of trusted on
+-- first use.
+INSERT INTO settings (key, value) VALUES
+    ('workspace_ssh_known_hosts', '""')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,2 @@
+-- "@opencode retry" in a thread re-runs the thread's latest task.
+CREATE INDEX IF NOT EXISTS idx_tasks_thread ON tasks(provider_config_id, thread_key, created_at DESC) WHERE thread_key <> '';
@@ -0,0 +1,5 @@
+-- Webhook requests with a larger body are refused with 413 before they reach
+-- the provider.
+INSERT INTO settings (key, value) VALUES
+    ('webhook_max_body', '4194304')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,5 @@
+-- Timeout for requests the GitLab provider makes itself, such as downloading
+-- uploaded attachments.
+INSERT INTO settings (key, value) VALUES
+    ('gitlab_http_timeout', '"30s"')
+ON CONFLICT (key) DO NOTHING;
@@ -0,0 +1,6 @@
+-- How many of an issue's earlier comments, and roughly how many tokens of
+-- issue context, are added to the prompt for a GitLab comment.
+INSERT INTO settings (key, value) VALUES
+    ('gitlab_issue_context_notes', '20'),
+    ('gitlab_issue_context_tokens', '8000')
+ON CONFLICT (key) DO NOTHING;
@@ -80,11 +80,22 @@ const GitLabGuide = () => (
       <Box component="ul" sx={{ pl: 2 }}>
         <li><Typography variant="body2"><strong>Note events</strong>（留言事件）— 這是主要的觸發方式</Typography></li>
         <li><Typography variant="body2"><strong>Merge request events</strong>（可選）— 用於 MR 相關的操作</Typography></li>
-        <li><Typography variant="body2"><strong>Issue events</strong>（可選）— 用於 Issue 相關的操作</Typography></li>
+        <li><Typography variant="body2"><strong>Issue events</strong>（可選）— 依標籤規則自動分析 Issue（見下一步）</Typography></li>
+        <li><Typography variant="body2"><strong>Job events</strong>（可選）— 自動分析失敗的 CI job（需在 Project 開啟）</Typography></li>
       </Box>
     </Step>
 
-    <Step num={5} title="測試連線">
+    <Step num={5} title="設定 Issue 標籤規則（可選）">
+      <Typography variant="body2" sx={{ mb: 1 }}>
+        在 Provider 的 Configuration JSON 加入 <code>issue_rules</code>，Issue 建立時帶有、或之後被加上對應標籤，就會以該模式分析 Issue 標題與描述，不需要留言：
+      </Typography>
+      <CodeBlock>{`"issue_rules": [
+  { "label": "ai-triage", "mode": "ask" },
+  { "label": "ai-plan", "mode": "plan" }
+]`}</CodeBlock>
+    </Step>
+
+    <Step num={6} title="測試連線">
       <Typography variant="body2">
         儲存後，點擊 <strong>Test</strong> 按鈕發送測試請求。
         在本系統的 Tasks 頁面確認是否收到測試事件。
@@ -188,6 +199,14 @@ const TelegramGuide = () => (
         將 BotFather 給你的 Token 填入本系統 Provider 的 config JSON 中，
         格式如：<code>{`{"bot_token": "123456:ABC-DEF..."}`}</code>
       </Typography>
+      <Typography variant="body2" sx={{ mt: 1 }}>
+        回覆某則訊息觸發分析時，被回覆的訊息（含轉傳內容與圖片說明）會一併送給 OpenCode。
+        另外會保留每個群組最近的訊息作為上下文，筆數由 <code>history_size</code> 設定（預設 10，設為 0 停用）：
+      </Typography>
+      <CodeBlock>{`{"bot_token": "123456:ABC-DEF...", "history_size": 20}`}</CodeBlock>
+      <Typography variant="body2" sx={{ mt: 1 }}>
+        Bot 預設的隱私模式只會收到提及它的訊息；若要保留群組最近的訊息，請向 @BotFather 發送 <code>/setprivacy</code> 並選擇 Disable。
+      </Typography>
     </Step>
 
     <Step num={5} title="測試">
@@ -113,6 +113,7 @@ export const KeywordEditor = ({ projectId }: { projectId: string }) => {
                   <MenuItem value="ask"><Chip label="ask" size="small" color="info" variant="outlined" /></MenuItem>
                   <MenuItem value="plan"><Chip label="plan" size="small" color="warning" variant="outlined" /></MenuItem>
                   <MenuItem value="do"><Chip label="do" size="small" color="error" variant="outlined" /></MenuItem>
+                  <MenuItem value="review"><Chip label="review" size="small" color="secondary" variant="outlined" /></MenuItem>
                 </Select>
               </TableCell>
               <TableCell>
@@ -3,7 +3,7 @@ import {
   Create, Edit, SimpleForm, TextInput, BooleanInput, ReferenceInput, SelectInput,
   Show, SimpleShowLayout, TabbedShowLayout,
   usePermissions, TopToolbar, CreateButton, ExportButton, FilterButton,
-  ReferenceManyField, FunctionField,
+  ReferenceManyField, FunctionField, ArrayInput, SimpleFormIterator, NumberInput,
 } from 'react-admin';
 import Box from '@mui/material/Box';
 import Chip from '@mui/material/Chip';
@@ -59,6 +59,23 @@ export const ProjectCreate = () => (
         <SelectInput optionText="name" label="SSH Key" fullWidth />
       </ReferenceInput>
       <TextInput source="default_branch" label="Default Branch" defaultValue="main" fullWidth />
+      <ArrayInput source="verify_commands" label="Verify Commands (do mode)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Command" helperText={false} fullWidth />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <BooleanInput source="pipeline_analysis" label="Analyze Failed CI Jobs" />
+      <ArrayInput source="pipeline_branches" label="Pipeline Branches (default branch if empty)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Branch pattern" helperText={false} />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <ArrayInput source="pipeline_jobs" label="Pipeline Jobs (all if empty)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Job pattern" helperText={false} />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <NumberInput source="pipeline_cooldown_minutes" label="Cooldown per Branch and Job (minutes)" defaultValue={60} min={0} />
       <BooleanInput source="enabled" defaultValue={true} />
     </SimpleForm>
   </Create>
@@ -73,6 +90,23 @@ export const ProjectEdit = () => (
         <SelectInput optionText="name" label="SSH Key" fullWidth />
       </ReferenceInput>
       <TextInput source="default_branch" label="Default Branch" fullWidth />
+      <ArrayInput source="verify_commands" label="Verify Commands (do mode)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Command" helperText={false} fullWidth />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <BooleanInput source="pipeline_analysis" label="Analyze Failed CI Jobs" />
+      <ArrayInput source="pipeline_branches" label="Pipeline Branches (default branch if empty)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Branch pattern" helperText={false} />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <ArrayInput source="pipeline_jobs" label="Pipeline Jobs (all if empty)">
+        <SimpleFormIterator inline disableReordering>
+          <TextInput source="" label="Job pattern" helperText={false} />
+        </SimpleFormIterator>
+      </ArrayInput>
+      <NumberInput source="pipeline_cooldown_minutes" label="Cooldown per Branch and Job (minutes)" min={0} />
       <BooleanInput source="enabled" />
     </SimpleForm>
   </Edit>
@@ -87,6 +121,29 @@ export const ProjectShow = () => (
           <TextField source="name" />
           <TextField source="ssh_url" label="SSH URL" />
           <TextField source="default_branch" label="Default Branch" />
+          <FunctionField
+            label="Verify Commands"
+            render={(record: Record<string, unknown>) => {
+              const commands = (record.verify_commands as string[] | undefined) || [];
+              if (commands.length === 0) return '—';
+              return (
+                <Box sx={{ fontFamily: '"JetBrains Mono", monospace', fontSize: '0.8rem' }}>
+                  {commands.map((c, i) => <div key={i}>$ {c}</div>)}
+                </Box>
+              );
+            }}
+          />
+          <FunctionField
+            label="Pipeline Analysis"
+            render={(record: Record<string, unknown>) => {
+              if (!record.pipeline_analysis) return 'Off';
+              const branches = (record.pipeline_branches as string[] | undefined) || [];
+              const jobs = (record.pipeline_jobs as string[] | undefined) || [];
+              return `Branches: ${branches.length ? branches.join(', ') : String(record.default_branch)}`
+                + ` | Jobs: ${jobs.length ? jobs.join(', ') : 'all'}`
+                + ` | Cooldown: ${record.pipeline_cooldown_minutes || 0} min`;
+            }}
+          />
           <BooleanField source="enabled" />
           <TextField source="created_at" label="Created" />
         </SimpleShowLayout>
@@ -131,7 +188,8 @@ export const ProjectShow = () => (
                     size="small"
                     color={
                       record.mode === 'do' ? 'error' :
-                      record.mode === 'plan' ? 'warning' : 'info'
+                      record.mode === 'plan' ? 'warning' :
+                      record.mode === 'review' ? 'secondary' : 'info'
                     }
                     variant="outlined"
                   />
@@ -52,19 +52,39 @@ const SETTING_CATEGORIES: Record<string, SettingConfig[]> = {
     { key: 'analyzer_ack_template', label: 'Acknowledgment Template', type: 'multiline', description: 'Uses %s placeholders: mode, keyword, author' },
     { key: 'analyzer_error_template', label: 'Error Template', type: 'multiline', description: 'Uses %s for error message' },
     { key: 'analyzer_result_template', label: 'Result Template', type: 'multiline', description: 'Uses %s: result, mode, author' },
+    { key: 'reply_max_parts', label: 'Reply Max Parts', type: 'number', description: 'Long results are split into messages; past this many they are uploaded as a file (0 never uploads)' },
+    { key: 'outbox_max_attempts', label: 'Reply Max Attempts', type: 'number', description: 'Delivery attempts of a reply before it is marked dead' },
+    { key: 'outbox_retry_base', label: 'Reply Retry Delay', type: 'duration', description: 'Delay after the first failed delivery, doubled on each further failure' },
+    { key: 'outbox_retry_max', label: 'Reply Max Retry Delay', type: 'duration', description: 'Longest delay between delivery attempts, unless the channel asks to wait longer' },
+    { key: 'outbox_poll_interval', label: 'Reply Outbox Poll Interval', type: 'duration', description: 'How often replies due for another attempt are looked for' },
     { key: 'prompt_ask', label: 'Ask Mode Prompt', type: 'multiline', description: 'System prompt for ask mode' },
     { key: 'prompt_plan', label: 'Plan Mode Prompt', type: 'multiline', description: 'System prompt for plan mode' },
     { key: 'prompt_do', label: 'Do Mode Prompt', type: 'multiline', description: 'System prompt for do mode' },
     { key: 'prompt_default', label: 'Default Prompt', type: 'multiline', description: 'Fallback system prompt' },
     { key: 'prompt_format_suffix', label: 'Format Suffix', type: 'text', description: 'Appended to all prompts' },
+    { key: 'attachment_max_bytes', label: 'Attachment Max Size', type: 'number', description: 'Largest attached file sent to OpenCode, in bytes (0 disables attachments)' },
+    { key: 'attachment_mime_types', label: 'Attachment Types', type: 'json', description: 'Allowed MIME types of attached files, e.g. ["image/*", "text/plain"]' },
   ],
   'Authentication': [
     { key: 'token_ttl', label: 'Token TTL', type: 'duration', description: 'Login session duration (e.g., 24h, 12h)' },
   ],
   'Providers': [
+    { key: 'gitlab_http_timeout', label: 'GitLab HTTP Timeout', type: 'duration', description: 'Timeout for downloading GitLab attachments' },
+    { key: 'gitlab_issue_context_notes', label: 'GitLab Issue Context Comments', type: 'number', description: 'Max earlier issue comments added to the prompt (0 disables)' },
+    { key: 'gitlab_issue_context_tokens', label: 'GitLab Issue Context Size', type: 'number', description: 'Approximate max tokens of issue context added to the prompt; the latest comments are kept' },
     { key: 'slack_http_timeout', label: 'Slack HTTP Timeout', type: 'duration', description: 'Timeout for Slack API calls' },
+    { key: 'slack_thread_history_messages', label: 'Slack Thread History Messages', type: 'number', description: 'Max earlier thread messages added to the prompt (0 disables)' },
+    { key: 'slack_thread_history_chars', label: 'Slack Thread History Size', type: 'number', description: 'Max characters of thread history added to the prompt' },
     { key: 'telegram_http_timeout', label: 'Telegram HTTP Timeout', type: 'duration', description: 'Timeout for Telegram API calls' },
-    { key: 'telegram_parse_mode', label: 'Telegram Parse Mode', type: 'text', description: 'Markdown, MarkdownV2, or HTML' },
+    { key: 'telegram_parse_mode', label: 'Telegram Parse Mode', type: 'text', description: 'HTML (default) or MarkdownV2; replies are converted from Markdown' },
+    { key: 'webhook_delivery_retention', label: 'Webhook Dedup Retention', type: 'duration', description: 'How long delivered webhook event IDs are remembered to skip redeliveries' },
+    { key: 'webhook_delivery_cleanup_interval', label: 'Webhook Dedup Cleanup Interval', type: 'duration', description: 'How often expired webhook event IDs and webhook log entries are deleted' },
+    { key: 'webhook_max_body', label: 'Webhook Max Body', type: 'number', description: 'Largest webhook request body accepted, in bytes; larger requests are refused with 413' },
+    { key: 'webhook_log_max_body', label: 'Webhook Log Max Body', type: 'number', description: 'Largest webhook body stored in the webhook log, in bytes; longer bodies are truncated and cannot be replayed' },
+    { key: 'webhook_log_retention', label: 'Webhook Log Retention', type: 'duration', description: 'How long received webhooks are kept in the webhook log' },
+  ],
+  'Workspace': [
+    { key: 'workspace_ssh_known_hosts', label: 'SSH Known Hosts', type: 'multiline', description: 'Host keys accepted for git over SSH, in known_hosts format (e.g. output of ssh-keyscan gitlab.com)' },
   ],
   'API': [
     { key: 'task_list_default_limit', label: 'Default Task Limit', type: 'number', description: 'Default page size for task list' },
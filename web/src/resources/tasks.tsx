@@ -9,11 +9,27 @@ import Typography from '@mui/material/Typography';
 import Link from '@mui/material/Link';
 import ReactMarkdown from 'react-markdown';
 
+interface TaskEvent {
+  id: string;
+  kind: string;
+  message: string;
+  created_at: string;
+}
+
+interface TaskMessage {
+  id: string;
+  direction: 'inbound' | 'outbound';
+  kind: string;
+  external_id: string;
+  url?: string;
+}
+
 const statusColors: Record<string, 'success' | 'warning' | 'info' | 'error' | 'default'> = {
   completed: 'success',
   processing: 'warning',
   pending: 'info',
   failed: 'error',
+  cancelled: 'default',
 };
 
 const providerColors: Record<string, 'warning' | 'info' | 'primary' | 'default'> = {
@@ -28,6 +44,7 @@ const TaskFilters = [
     { id: 'processing', name: 'Processing' },
     { id: 'completed', name: 'Completed' },
     { id: 'failed', name: 'Failed' },
+    { id: 'cancelled', name: 'Cancelled' },
   ]} />,
   <SelectInput key="provider_type" source="provider_type" choices={[
     { id: 'gitlab', name: 'GitLab' },
@@ -70,7 +87,7 @@ export const TaskList = () => (
             label={String(record.trigger_mode || '—')}
             size="small"
             variant="outlined"
-            color={record.trigger_mode === 'do' ? 'error' : record.trigger_mode === 'plan' ? 'warning' : 'info'}
+            color={record.trigger_mode === 'do' ? 'error' : record.trigger_mode === 'plan' ? 'warning' : record.trigger_mode === 'review' ? 'secondary' : 'info'}
           />
         )}
       />
@@ -95,6 +112,7 @@ export const TaskShow = () => (
   <Show>
     <SimpleShowLayout>
       <TextField source="id" />
+      <TextField source="parent_task_id" label="Retry Of" emptyText="—" />
       <FunctionField
         label="Status"
         render={(record: Record<string, unknown>) => (
@@ -119,6 +137,7 @@ export const TaskShow = () => (
       <TextField source="author" />
       <TextField source="trigger_mode" label="Mode" />
       <TextField source="trigger_keyword" label="Keyword" />
+      <TextField source="ref" label="Ref" emptyText="—" />
       <FunctionField
         label="External Reference"
         render={(record: Record<string, unknown>) =>
@@ -132,6 +151,50 @@ export const TaskShow = () => (
       <DateField source="created_at" label="Created" showTime />
       <DateField source="updated_at" label="Updated" showTime />
 
+      <FunctionField
+        label="Messages"
+        render={(record: Record<string, unknown>) => {
+          const messages = (record.messages as TaskMessage[] | undefined) || [];
+          if (messages.length === 0) return '—';
+          return (
+            <Box sx={{ display: 'flex', flexDirection: 'column', gap: 0.5 }}>
+              {messages.map((m) => (
+                <Box key={m.id} sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+                  <Chip label={m.direction === 'inbound' ? '←' : '→'} size="small" variant="outlined" />
+                  <Typography variant="body2" sx={{ minWidth: 60 }}>{m.kind}</Typography>
+                  {m.url ? (
+                    <Link href={m.url} target="_blank" rel="noopener" sx={{ fontFamily: '"JetBrains Mono", monospace', fontSize: '0.75rem' }}>
+                      {m.external_id} ↗
+                    </Link>
+                  ) : (
+                    <Typography variant="body2" sx={{ fontFamily: '"JetBrains Mono", monospace', fontSize: '0.75rem' }}>
+                      {m.external_id}
+                    </Typography>
+                  )}
+                </Box>
+              ))}
+            </Box>
+          );
+        }}
+      />
+
+      <FunctionField
+        label="Progress"
+        render={(record: Record<string, unknown>) => {
+          const events = (record.events as TaskEvent[] | undefined) || [];
+          if (events.length === 0) return '—';
+          return (
+            <Box sx={{ fontFamily: '"JetBrains Mono", monospace', fontSize: '0.75rem' }}>
+              {events.map((e) => (
+                <div key={e.id}>
+                  {new Date(e.created_at).toLocaleTimeString()} · {e.message}
+                </div>
+              ))}
+            </Box>
+          );
+        }}
+      />
+
       <FunctionField
         label="Result"
         render={(record: Record<string, unknown>) =>
@@ -152,6 +215,31 @@ export const TaskShow = () => (
         }
       />
 
+      <FunctionField
+        label="Verification"
+        render={(record: Record<string, unknown>) =>
+          record.verify_status ? (
+            <Box>
+              <Chip
+                label={String(record.verify_status)}
+                color={record.verify_status === 'passed' ? 'success' : 'error'}
+                size="small"
+                variant="outlined"
+              />
+              {record.verify_log ? (
+                <Box component="pre" sx={{
+                  p: 1.5, mt: 1, borderRadius: 1, maxHeight: 400, overflow: 'auto',
+                  bgcolor: 'background.default', border: '1px solid', borderColor: 'divider',
+                  fontFamily: '"JetBrains Mono", monospace', fontSize: '0.75rem',
+                }}>
+                  {String(record.verify_log)}
+                </Box>
+              ) : null}
+            </Box>
+          ) : '—'
+        }
+      />
+
       <FunctionField
         label="Error"
         render={(record: Record<string, unknown>) =>